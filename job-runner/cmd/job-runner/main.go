@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"job-runner/internal/runner"
+)
+
+const (
+	defaultListen = "127.0.0.1:8787"
+	defaultServer = "http://127.0.0.1:8787"
+)
+
+var defaultTools = []string{"video-subtitle", "url-downloader"}
+
+type toolFlags map[string]string
+
+func (t toolFlags) String() string {
+	parts := make([]string, 0, len(t))
+	for name, path := range t {
+		parts = append(parts, name+"="+path)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (t toolFlags) Set(v string) error {
+	name, path, ok := strings.Cut(v, "=")
+	if !ok || name == "" || path == "" {
+		return fmt.Errorf("expected name=path, got %q", v)
+	}
+	t[name] = path
+	return nil
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "job-runner - run heavy bag-of-tricks jobs on another machine\n\n")
+	fmt.Fprintf(os.Stderr, "Usage:\n")
+	fmt.Fprintf(os.Stderr, "  job-runner serve [flags]                 run the agent\n")
+	fmt.Fprintf(os.Stderr, "  job-runner submit [flags] TOOL [ARGS...] submit a job\n")
+	fmt.Fprintf(os.Stderr, "  job-runner list                          list jobs\n")
+	fmt.Fprintf(os.Stderr, "  job-runner status ID                     show job status\n")
+	fmt.Fprintf(os.Stderr, "  job-runner log ID                        print job output\n")
+	fmt.Fprintf(os.Stderr, "  job-runner fetch [flags] ID [NAME...]    download artifacts\n\n")
+	fmt.Fprintf(os.Stderr, "Client commands use --server or $JOB_RUNNER_URL (default %s).\n", defaultServer)
+	fmt.Fprintf(os.Stderr, "Set $JOB_RUNNER_TOKEN on both sides to require a bearer token.\n")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "serve":
+		err = runServe(os.Args[2:])
+	case "submit":
+		err = runSubmit(os.Args[2:])
+	case "list", "ls":
+		err = runList(os.Args[2:])
+	case "status":
+		err = runStatus(os.Args[2:])
+	case "log":
+		err = runLog(os.Args[2:])
+	case "fetch":
+		err = runFetch(os.Args[2:])
+	case "-h", "--help", "help":
+		usage()
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	listen := fs.String("listen", defaultListen, "listen address")
+	dir := fs.String("dir", "~/.job-runner", "directory holding job state, inputs and artifacts")
+	maxJobs := fs.Int("max-jobs", 1, "number of jobs run concurrently")
+	tools := toolFlags{}
+	fs.Var(tools, "tool", "allowed tool as name=path (repeatable; default: video-subtitle and url-downloader from PATH)")
+	_ = fs.Parse(args)
+
+	if len(tools) == 0 {
+		for _, name := range defaultTools {
+			if p, err := exec.LookPath(name); err == nil {
+				tools[name] = p
+			}
+		}
+	}
+	if len(tools) == 0 {
+		return fmt.Errorf("no tools available; pass --tool name=path")
+	}
+
+	root, err := expandPath(*dir)
+	if err != nil {
+		return err
+	}
+	store, err := runner.OpenStore(root)
+	if err != nil {
+		return fmt.Errorf("open job store: %w", err)
+	}
+
+	logf := func(format string, args ...any) {
+		fmt.Fprintf(os.Stderr, time.Now().Format("15:04:05")+" "+format+"\n", args...)
+	}
+	srv := runner.NewServer(store, runner.ServerOptions{
+		Tools:   tools,
+		MaxJobs: *maxJobs,
+		Token:   os.Getenv("JOB_RUNNER_TOKEN"),
+		Logf:    logf,
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	srv.Start(ctx)
+
+	httpSrv := &http.Server{Addr: *listen, Handler: srv.Handler()}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = httpSrv.Shutdown(shutdownCtx)
+	}()
+
+	logf("serving %s on %s (tools: %s)", root, *listen, tools.String())
+	if err := httpSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func clientFlags(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	server := os.Getenv("JOB_RUNNER_URL")
+	if server == "" {
+		server = defaultServer
+	}
+	return fs, fs.String("server", server, "job-runner server URL")
+}
+
+func newClient(server string) *runner.Client {
+	return runner.NewClient(server, os.Getenv("JOB_RUNNER_TOKEN"))
+}
+
+func runSubmit(args []string) error {
+	fs, server := clientFlags("submit")
+	input := fs.String("input", "", "local file uploaded with the job; replaces {input} in args or is appended")
+	wait := fs.Bool("wait", false, "poll until the job finishes")
+	fetchDir := fs.String("fetch", "", "with --wait, download artifacts into this directory")
+	interval := fs.Duration("interval", 3*time.Second, "status polling interval")
+	_ = fs.Parse(args)
+	if fs.NArg() < 1 {
+		return fmt.Errorf("submit: tool name required")
+	}
+
+	ctx := context.Background()
+	c := newClient(*server)
+	j, err := c.Submit(ctx, fs.Arg(0), fs.Args()[1:], *input)
+	if err != nil {
+		return err
+	}
+	fmt.Println(j.ID)
+	if !*wait && *fetchDir == "" {
+		return nil
+	}
+
+	last := j.Status
+	j, err = c.Wait(ctx, j.ID, *interval, func(cur runner.Job) {
+		if cur.Status != last {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", cur.ID, cur.Status)
+			last = cur.Status
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if j.Status != runner.StatusSucceeded {
+		_ = c.Log(ctx, j.ID, os.Stderr)
+		return fmt.Errorf("job %s failed (exit %d)", j.ID, j.ExitCode)
+	}
+	if *fetchDir != "" {
+		return fetchAll(ctx, c, j, nil, *fetchDir)
+	}
+	return nil
+}
+
+func runList(args []string) error {
+	fs, server := clientFlags("list")
+	_ = fs.Parse(args)
+	jobs, err := newClient(*server).List(context.Background())
+	if err != nil {
+		return err
+	}
+	for _, j := range jobs {
+		fmt.Printf("%s  %-9s  %s %s\n", j.ID, j.Status, j.Tool, strings.Join(j.Args, " "))
+	}
+	return nil
+}
+
+func runStatus(args []string) error {
+	fs, server := clientFlags("status")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("status: job id required")
+	}
+	j, err := newClient(*server).Status(context.Background(), fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(j)
+}
+
+func runLog(args []string) error {
+	fs, server := clientFlags("log")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("log: job id required")
+	}
+	return newClient(*server).Log(context.Background(), fs.Arg(0), os.Stdout)
+}
+
+func runFetch(args []string) error {
+	fs, server := clientFlags("fetch")
+	out := fs.String("out", ".", "destination directory")
+	_ = fs.Parse(args)
+	if fs.NArg() < 1 {
+		return fmt.Errorf("fetch: job id required")
+	}
+	ctx := context.Background()
+	c := newClient(*server)
+	j, err := c.Status(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if !j.Status.Done() {
+		return fmt.Errorf("job %s is still %s", j.ID, j.Status)
+	}
+	return fetchAll(ctx, c, j, fs.Args()[1:], *out)
+}
+
+func fetchAll(ctx context.Context, c *runner.Client, j runner.Job, names []string, dir string) error {
+	if len(names) == 0 {
+		names = j.Artifacts
+	}
+	if len(names) == 0 {
+		fmt.Fprintf(os.Stderr, "job %s has no artifacts\n", j.ID)
+		return nil
+	}
+	for _, name := range names {
+		path, err := c.Fetch(ctx, j.ID, name, dir)
+		if err != nil {
+			return fmt.Errorf("fetch %s: %w", name, err)
+		}
+		fmt.Println(path)
+	}
+	return nil
+}
+
+func expandPath(path string) (string, error) {
+	if strings.HasPrefix(path, "~") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, strings.TrimPrefix(path, "~"))
+	}
+	return filepath.Abs(path)
+}
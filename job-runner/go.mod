@@ -0,0 +1,3 @@
+module job-runner
+
+go 1.22
@@ -0,0 +1,204 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+func NewClient(baseURL, token string) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		token:      token,
+		httpClient: &http.Client{},
+	}
+}
+
+// Submit streams the optional input file to the server, so large videos are
+// never buffered in memory.
+func (c *Client) Submit(ctx context.Context, tool string, args []string, inputPath string) (Job, error) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(writeSubmitForm(mw, tool, args, inputPath))
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/jobs", pr)
+	if err != nil {
+		return Job{}, err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	var j Job
+	err = c.doJSON(req, &j)
+	return j, err
+}
+
+func writeSubmitForm(mw *multipart.Writer, tool string, args []string, inputPath string) error {
+	if err := mw.WriteField("tool", tool); err != nil {
+		return err
+	}
+	for _, a := range args {
+		if err := mw.WriteField("arg", a); err != nil {
+			return err
+		}
+	}
+	if inputPath != "" {
+		f, err := os.Open(inputPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		part, err := mw.CreateFormFile("input", filepath.Base(inputPath))
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(part, f); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+func (c *Client) Status(ctx context.Context, id string) (Job, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/jobs/"+url.PathEscape(id), nil)
+	if err != nil {
+		return Job{}, err
+	}
+	var j Job
+	err = c.doJSON(req, &j)
+	return j, err
+}
+
+func (c *Client) List(ctx context.Context) ([]Job, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/jobs", nil)
+	if err != nil {
+		return nil, err
+	}
+	var jobs []Job
+	err = c.doJSON(req, &jobs)
+	return jobs, err
+}
+
+// Wait polls until the job finishes, calling onPoll after every status check.
+func (c *Client) Wait(ctx context.Context, id string, interval time.Duration, onPoll func(Job)) (Job, error) {
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	for {
+		j, err := c.Status(ctx, id)
+		if err != nil {
+			return Job{}, err
+		}
+		if onPoll != nil {
+			onPoll(j)
+		}
+		if j.Status.Done() {
+			return j, nil
+		}
+		select {
+		case <-ctx.Done():
+			return j, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (c *Client) Log(ctx context.Context, id string, w io.Writer) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/jobs/"+url.PathEscape(id)+"/log", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// Fetch downloads one artifact into dstDir, keeping its relative path. A
+// name that is absolute or leads out of dstDir is refused, as the server
+// may not be trusted.
+func (c *Client) Fetch(ctx context.Context, id, name, dstDir string) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(name)) {
+		return "", fmt.Errorf("invalid artifact name %q", name)
+	}
+	var escaped []string
+	for _, p := range strings.Split(name, "/") {
+		escaped = append(escaped, url.PathEscape(p))
+	}
+	u := c.baseURL + "/jobs/" + url.PathEscape(id) + "/artifacts/" + strings.Join(escaped, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	dst := filepath.Join(dstDir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return "", err
+	}
+	tmp := dst + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return dst, os.Rename(tmp, dst)
+}
+
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxFieldBytes))
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &e) == nil && e.Error != "" {
+			return nil, fmt.Errorf("server error (%d): %s", resp.StatusCode, e.Error)
+		}
+		return nil, fmt.Errorf("server error (%d): %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+func (c *Client) doJSON(req *http.Request, v any) error {
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,218 @@
+package runner
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+)
+
+func (s Status) Done() bool {
+	return s == StatusSucceeded || s == StatusFailed
+}
+
+type Job struct {
+	ID         string    `json:"id"`
+	Tool       string    `json:"tool"`
+	Args       []string  `json:"args"`
+	Input      string    `json:"input,omitempty"`
+	Status     Status    `json:"status"`
+	ExitCode   int       `json:"exit_code"`
+	Error      string    `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	StartedAt  time.Time `json:"started_at,omitempty"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+	Artifacts  []string  `json:"artifacts,omitempty"`
+}
+
+const (
+	jobFile  = "job.json"
+	logFile  = "output.log"
+	inputDir = "input"
+	workDir  = "work"
+)
+
+// Store keeps one directory per job under root: job.json, output.log, the
+// uploaded input and a work dir that becomes the tool's working directory.
+type Store struct {
+	root string
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+func OpenStore(root string) (*Store, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	s := &Store{root: root, jobs: map[string]*Job{}}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(root, e.Name(), jobFile))
+		if err != nil {
+			continue
+		}
+		var j Job
+		if err := json.Unmarshal(b, &j); err != nil || j.ID != e.Name() {
+			continue
+		}
+		if !j.Status.Done() {
+			// The server went away while this job was queued or running.
+			j.Status = StatusFailed
+			j.Error = "interrupted by server restart"
+			j.ExitCode = -1
+			if j.FinishedAt.IsZero() {
+				j.FinishedAt = time.Now()
+			}
+			_ = s.writeJob(&j)
+		}
+		s.jobs[j.ID] = &j
+	}
+	return s, nil
+}
+
+func (s *Store) Create(tool string, args []string) (*Job, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	dir := s.JobDir(id)
+	if err := os.MkdirAll(filepath.Join(dir, workDir), 0o755); err != nil {
+		return nil, err
+	}
+	j := &Job{
+		ID:        id,
+		Tool:      tool,
+		Args:      args,
+		Status:    StatusQueued,
+		CreatedAt: time.Now(),
+	}
+	s.mu.Lock()
+	s.jobs[id] = j
+	s.mu.Unlock()
+	return j, s.writeJob(j)
+}
+
+func (s *Store) Get(id string) (Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *j, true
+}
+
+func (s *Store) List() []Job {
+	s.mu.Lock()
+	out := make([]Job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		out = append(out, *j)
+	}
+	s.mu.Unlock()
+	sort.Slice(out, func(i, k int) bool { return out[i].CreatedAt.Before(out[k].CreatedAt) })
+	return out
+}
+
+func (s *Store) Update(id string, fn func(*Job)) error {
+	s.mu.Lock()
+	j, ok := s.jobs[id]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("unknown job %s", id)
+	}
+	fn(j)
+	snapshot := *j
+	s.mu.Unlock()
+	return s.writeJob(&snapshot)
+}
+
+func (s *Store) JobDir(id string) string {
+	return filepath.Join(s.root, id)
+}
+
+func (s *Store) InputDir(id string) string {
+	return filepath.Join(s.JobDir(id), inputDir)
+}
+
+func (s *Store) WorkDir(id string) string {
+	return filepath.Join(s.JobDir(id), workDir)
+}
+
+func (s *Store) LogPath(id string) string {
+	return filepath.Join(s.JobDir(id), logFile)
+}
+
+// ArtifactPath resolves an artifact name (as returned by ScanArtifacts)
+// inside the job's work dir, rejecting anything that escapes it.
+func (s *Store) ArtifactPath(id, name string) (string, error) {
+	base := s.WorkDir(id)
+	p := filepath.Join(base, filepath.FromSlash(name))
+	rel, err := filepath.Rel(base, p)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", errors.New("invalid artifact name")
+	}
+	return p, nil
+}
+
+func (s *Store) ScanArtifacts(id string) []string {
+	base := s.WorkDir(id)
+	var out []string
+	_ = filepath.WalkDir(base, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(base, p)
+		if err != nil {
+			return nil
+		}
+		out = append(out, filepath.ToSlash(rel))
+		return nil
+	})
+	sort.Strings(out)
+	return out
+}
+
+func (s *Store) writeJob(j *Job) error {
+	b, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.JobDir(j.ID), jobFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func newID() (string, error) {
+	var b [6]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(b[:]), nil
+}
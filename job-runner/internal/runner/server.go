@@ -0,0 +1,345 @@
+package runner
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	maxFieldBytes = 64 << 10
+	queueSize     = 256
+	inputToken    = "{input}"
+)
+
+type ServerOptions struct {
+	// Tools maps the names clients may request to executable paths. Only
+	// these binaries are ever run.
+	Tools   map[string]string
+	MaxJobs int
+	// Token, when set, must be presented as "Authorization: Bearer <token>".
+	Token string
+	Logf  func(string, ...any)
+}
+
+type Server struct {
+	store *Store
+	opts  ServerOptions
+	queue chan string
+}
+
+func NewServer(store *Store, opts ServerOptions) *Server {
+	if opts.MaxJobs <= 0 {
+		opts.MaxJobs = 1
+	}
+	if opts.Logf == nil {
+		opts.Logf = func(string, ...any) {}
+	}
+	return &Server{
+		store: store,
+		opts:  opts,
+		queue: make(chan string, queueSize),
+	}
+}
+
+// Start launches the job workers; they stop when ctx is canceled.
+func (s *Server) Start(ctx context.Context) {
+	for i := 0; i < s.opts.MaxJobs; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case id := <-s.queue:
+					s.runJob(ctx, id)
+				}
+			}
+		}()
+	}
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs", s.handleSubmit)
+	mux.HandleFunc("GET /jobs", s.handleList)
+	mux.HandleFunc("GET /jobs/{id}", s.handleStatus)
+	mux.HandleFunc("GET /jobs/{id}/log", s.handleLog)
+	mux.HandleFunc("GET /jobs/{id}/artifacts/{name...}", s.handleArtifact)
+	mux.HandleFunc("GET /tools", s.handleTools)
+	return s.auth(mux)
+}
+
+func (s *Server) auth(next http.Handler) http.Handler {
+	if s.opts.Token == "" {
+		return next
+	}
+	want := []byte("Bearer " + s.opts.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Compare in constant time, so that response times do not give the
+		// token away byte by byte.
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "expected multipart/form-data")
+		return
+	}
+
+	var (
+		tool  string
+		args  []string
+		job   *Job
+		input string
+	)
+	create := func() error {
+		if job != nil {
+			return nil
+		}
+		if _, ok := s.opts.Tools[tool]; !ok {
+			return fmt.Errorf("unknown tool %q", tool)
+		}
+		j, err := s.store.Create(tool, args)
+		if err != nil {
+			return err
+		}
+		job = j
+		return nil
+	}
+	// A request that fails once the input file made its job leaves the job
+	// failed rather than pending forever.
+	reject := func(status int, msg string) {
+		if job != nil {
+			s.failJob(job.ID, errors.New(msg))
+		}
+		writeError(w, status, msg)
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			reject(http.StatusBadRequest, err.Error())
+			return
+		}
+		switch part.FormName() {
+		case "tool", "arg":
+			if job != nil {
+				reject(http.StatusBadRequest, "tool and args must precede the input file")
+				return
+			}
+			b, err := io.ReadAll(io.LimitReader(part, maxFieldBytes))
+			if err != nil {
+				reject(http.StatusBadRequest, err.Error())
+				return
+			}
+			if part.FormName() == "tool" {
+				tool = string(b)
+			} else {
+				args = append(args, string(b))
+			}
+		case "input":
+			if input != "" {
+				reject(http.StatusBadRequest, "only one input file is supported")
+				return
+			}
+			if err := create(); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			name := filepath.Base(part.FileName())
+			if name == "." || name == string(filepath.Separator) || name == "" {
+				name = "input"
+			}
+			path := filepath.Join(s.store.InputDir(job.ID), name)
+			if err := saveUpload(path, part); err != nil {
+				reject(http.StatusInternalServerError, err.Error())
+				return
+			}
+			input = path
+		}
+		part.Close()
+	}
+
+	if err := create(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if input != "" {
+		_ = s.store.Update(job.ID, func(j *Job) { j.Input = input })
+	}
+
+	select {
+	case s.queue <- job.ID:
+	default:
+		s.failJob(job.ID, errors.New("queue full"))
+		writeError(w, http.StatusServiceUnavailable, "queue full")
+		return
+	}
+	s.opts.Logf("job %s queued: %s %s", job.ID, tool, strings.Join(args, " "))
+	current, _ := s.store.Get(job.ID)
+	writeJSON(w, http.StatusCreated, current)
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.store.List())
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	j, ok := s.store.Get(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "no such job")
+		return
+	}
+	writeJSON(w, http.StatusOK, j)
+}
+
+func (s *Server) handleLog(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, ok := s.store.Get(id); !ok {
+		writeError(w, http.StatusNotFound, "no such job")
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	http.ServeFile(w, r, s.store.LogPath(id))
+}
+
+func (s *Server) handleArtifact(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, ok := s.store.Get(id); !ok {
+		writeError(w, http.StatusNotFound, "no such job")
+		return
+	}
+	path, err := s.store.ArtifactPath(id, r.PathValue("name"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		writeError(w, http.StatusNotFound, "no such artifact")
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(path)))
+	http.ServeFile(w, r, path)
+}
+
+func (s *Server) handleTools(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(s.opts.Tools))
+	for name := range s.opts.Tools {
+		names = append(names, name)
+	}
+	writeJSON(w, http.StatusOK, names)
+}
+
+func (s *Server) runJob(ctx context.Context, id string) {
+	j, ok := s.store.Get(id)
+	if !ok || j.Status.Done() {
+		return
+	}
+	bin := s.opts.Tools[j.Tool]
+
+	args := make([]string, 0, len(j.Args)+1)
+	usedInput := false
+	for _, a := range j.Args {
+		if j.Input != "" && strings.Contains(a, inputToken) {
+			a = strings.ReplaceAll(a, inputToken, j.Input)
+			usedInput = true
+		}
+		args = append(args, a)
+	}
+	if j.Input != "" && !usedInput {
+		args = append(args, j.Input)
+	}
+
+	logOut, err := os.Create(s.store.LogPath(id))
+	if err != nil {
+		s.failJob(id, err)
+		return
+	}
+	defer logOut.Close()
+
+	_ = s.store.Update(id, func(j *Job) {
+		j.Status = StatusRunning
+		j.StartedAt = time.Now()
+	})
+	s.opts.Logf("job %s running", id)
+
+	cmd := exec.CommandContext(ctx, bin, args...)
+	cmd.Dir = s.store.WorkDir(id)
+	cmd.Stdout = logOut
+	cmd.Stderr = logOut
+	runErr := cmd.Run()
+
+	artifacts := s.store.ScanArtifacts(id)
+	_ = s.store.Update(id, func(j *Job) {
+		j.FinishedAt = time.Now()
+		j.Artifacts = artifacts
+		j.ExitCode = 0
+		j.Status = StatusSucceeded
+		if runErr != nil {
+			j.Status = StatusFailed
+			j.Error = runErr.Error()
+			j.ExitCode = -1
+			var exitErr *exec.ExitError
+			if errors.As(runErr, &exitErr) {
+				j.ExitCode = exitErr.ExitCode()
+			}
+		}
+	})
+	final, _ := s.store.Get(id)
+	s.opts.Logf("job %s %s (exit %d)", id, final.Status, final.ExitCode)
+}
+
+func (s *Server) failJob(id string, err error) {
+	_ = s.store.Update(id, func(j *Job) {
+		j.Status = StatusFailed
+		j.Error = err.Error()
+		j.ExitCode = -1
+		j.FinishedAt = time.Now()
+	})
+}
+
+func saveUpload(path string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,3 @@
+module bag-of-tricks/pkg
+
+go 1.22
@@ -0,0 +1,257 @@
+// Package httpreplay records HTTP interactions to a JSON cassette and replays
+// them later, so tool workflows that talk to paid APIs can run in CI without
+// live keys.
+package httpreplay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request describes what an interaction matches: method and URL path always,
+// plus either a JSON body (compared semantically) or a substring of the raw
+// body. Multipart uploads are recorded without a body.
+type Request struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	JSON   json.RawMessage `json:"json,omitempty"`
+	Match  string          `json:"match,omitempty"`
+}
+
+type Response struct {
+	Status   int               `json:"status"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	JSON     json.RawMessage   `json:"json,omitempty"`
+	BodyText string            `json:"body_text,omitempty"`
+}
+
+// FromEnv returns a recording transport when <prefix>_RECORD names a
+// cassette path, a replaying one when <prefix>_REPLAY does, and nil
+// otherwise. base defaults to http.DefaultTransport.
+func FromEnv(prefix string, base http.RoundTripper) (http.RoundTripper, error) {
+	if path := os.Getenv(prefix + "_REPLAY"); path != "" {
+		return NewReplayer(path)
+	}
+	if path := os.Getenv(prefix + "_RECORD"); path != "" {
+		return NewRecorder(path, base), nil
+	}
+	return nil, nil
+}
+
+func LoadCassette(path string) (*Cassette, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("parse cassette %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+type Replayer struct {
+	path string
+
+	mu   sync.Mutex
+	c    *Cassette
+	used []bool
+}
+
+func NewReplayer(path string) (*Replayer, error) {
+	c, err := LoadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Replayer{path: path, c: c, used: make([]bool, len(c.Interactions))}, nil
+}
+
+// RoundTrip serves the first unused interaction matching the request. Each
+// interaction is served once, so retries can be scripted as a failure
+// followed by a success.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, it := range r.c.Interactions {
+		if r.used[i] || !it.Request.matches(req, body) {
+			continue
+		}
+		r.used[i] = true
+		return it.Response.toHTTP(req), nil
+	}
+	return nil, fmt.Errorf("httpreplay: no interaction in %s for %s %s", r.path, req.Method, req.URL.Path)
+}
+
+// Unused lists interactions that were never served, to catch stale fixtures.
+func (r *Replayer) Unused() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []Interaction
+	for i, it := range r.c.Interactions {
+		if !r.used[i] {
+			out = append(out, it)
+		}
+	}
+	return out
+}
+
+func (q Request) matches(req *http.Request, body []byte) bool {
+	if !strings.EqualFold(q.Method, req.Method) || q.Path != req.URL.Path {
+		return false
+	}
+	if q.Match != "" && !bytes.Contains(body, []byte(q.Match)) {
+		return false
+	}
+	if len(q.JSON) > 0 {
+		return jsonEqual(q.JSON, body)
+	}
+	return true
+}
+
+func (p Response) toHTTP(req *http.Request) *http.Response {
+	status := p.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	header := http.Header{}
+	for k, v := range p.Headers {
+		header.Set(k, v)
+	}
+	body := []byte(p.BodyText)
+	if len(p.JSON) > 0 {
+		body = p.JSON
+		if header.Get("Content-Type") == "" {
+			header.Set("Content-Type", "application/json")
+		}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+type Recorder struct {
+	path string
+	base http.RoundTripper
+
+	mu sync.Mutex
+	c  Cassette
+}
+
+func NewRecorder(path string, base http.RoundTripper) *Recorder {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Recorder{path: path, base: base}
+}
+
+// RoundTrip forwards to the real transport and rewrites the cassette after
+// every interaction, so a crashed run still leaves usable fixtures.
+// Request headers (and with them API keys) are never stored.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	it := Interaction{
+		Request: Request{Method: req.Method, Path: req.URL.Path},
+		Response: Response{
+			Status:  resp.StatusCode,
+			Headers: map[string]string{},
+		},
+	}
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "application/json") && json.Valid(body) {
+		it.Request.JSON = compact(body)
+	}
+	for _, k := range []string{"Content-Type", "Retry-After"} {
+		if v := resp.Header.Get(k); v != "" {
+			it.Response.Headers[k] = v
+		}
+	}
+	if json.Valid(respBody) {
+		it.Response.JSON = compact(respBody)
+	} else {
+		it.Response.BodyText = string(respBody)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.c.Interactions = append(r.c.Interactions, it)
+	b, err := json.MarshalIndent(&r.c, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(r.path, b, 0o644); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	b, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
+
+func compact(b []byte) json.RawMessage {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, b); err != nil {
+		return json.RawMessage(b)
+	}
+	return json.RawMessage(buf.Bytes())
+}
+
+func jsonEqual(a, b []byte) bool {
+	var va, vb any
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	ca, _ := json.Marshal(va)
+	cb, _ := json.Marshal(vb)
+	return bytes.Equal(ca, cb)
+}
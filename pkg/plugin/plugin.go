@@ -0,0 +1,100 @@
+// Package plugin defines the backend interfaces the tools in this repo can
+// delegate to, and a subprocess transport so users can provide their own
+// implementations without forking: a plugin is any executable speaking
+// line-delimited JSON-RPC 2.0 on stdin/stdout (see Start and Serve).
+package plugin
+
+import "context"
+
+type Segment struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
+
+type TranscribeRequest struct {
+	AudioPath string `json:"audio_path"`
+	Model     string `json:"model,omitempty"`
+	Language  string `json:"language,omitempty"`
+	// Prompt is vocabulary or preceding text to condition on, Whisper-style.
+	Prompt      string  `json:"prompt,omitempty"`
+	Temperature float64 `json:"temperature,omitempty"`
+}
+
+type Transcriber interface {
+	Transcribe(ctx context.Context, req TranscribeRequest) ([]Segment, error)
+}
+
+// TranslationPair is an earlier source line and its translation, passed as
+// context so consecutive lines are translated consistently.
+type TranslationPair struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+type TranslateRequest struct {
+	Model      string            `json:"model,omitempty"`
+	SourceLang string            `json:"source_lang"`
+	TargetLang string            `json:"target_lang"`
+	Text       string            `json:"text"`
+	Context    []TranslationPair `json:"context,omitempty"`
+}
+
+type Translator interface {
+	Translate(ctx context.Context, req TranslateRequest) (string, error)
+}
+
+type DownloadRequest struct {
+	URL     string `json:"url"`
+	DestDir string `json:"dest_dir"`
+}
+
+type DownloadResult struct {
+	Path  string `json:"path,omitempty"`
+	Bytes int64  `json:"bytes,omitempty"`
+}
+
+type Downloader interface {
+	Download(ctx context.Context, req DownloadRequest) (DownloadResult, error)
+}
+
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type ChatRequest struct {
+	Model       string    `json:"model,omitempty"`
+	Messages    []Message `json:"messages"`
+	Temperature float64   `json:"temperature"`
+}
+
+type LLMProvider interface {
+	Complete(ctx context.Context, req ChatRequest) (string, error)
+}
+
+type Event struct {
+	Tool    string         `json:"tool"`
+	Status  string         `json:"status"`
+	Message string         `json:"message,omitempty"`
+	Data    map[string]any `json:"data,omitempty"`
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, ev Event) error
+}
+
+// JSON-RPC method names, one per interface.
+const (
+	MethodCapabilities = "capabilities"
+	MethodTranscribe   = "transcribe"
+	MethodTranslate    = "translate"
+	MethodDownload     = "download"
+	MethodComplete     = "complete"
+	MethodNotify       = "notify"
+)
+
+type Capabilities struct {
+	Name    string   `json:"name,omitempty"`
+	Methods []string `json:"methods"`
+}
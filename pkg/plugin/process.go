@@ -0,0 +1,245 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrUnsupported = errors.New("plugin does not implement this method")
+
+type rpcRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      int64  `json:"id"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      int64           `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("plugin error (%d): %s", e.Code, e.Message)
+}
+
+// Process is a running plugin executable. It implements every interface in
+// this package; calls for methods the plugin did not advertise return
+// ErrUnsupported. Calls may be issued concurrently.
+type Process struct {
+	cmd  *exec.Cmd
+	in   io.WriteCloser
+	caps Capabilities
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan rpcResponse
+	closed  chan struct{}
+	once    sync.Once
+	readErr error
+}
+
+// Start launches argv[0] with the remaining arguments and performs the
+// capabilities handshake. The plugin's stderr is passed through.
+func Start(argv []string) (*Process, error) {
+	if len(argv) == 0 || argv[0] == "" {
+		return nil, errors.New("empty plugin command")
+	}
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stderr = os.Stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	p := &Process{
+		cmd:     cmd,
+		in:      in,
+		nextID:  1,
+		pending: map[int64]chan rpcResponse{},
+		closed:  make(chan struct{}),
+	}
+	go p.readLoop(out)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := p.call(ctx, MethodCapabilities, nil, &p.caps); err != nil {
+		_ = p.Close()
+		return nil, fmt.Errorf("plugin %s handshake: %w", argv[0], err)
+	}
+	return p, nil
+}
+
+// StartCommand splits a command line on whitespace and calls Start.
+func StartCommand(command string) (*Process, error) {
+	return Start(strings.Fields(command))
+}
+
+func (p *Process) Capabilities() Capabilities { return p.caps }
+
+func (p *Process) Supports(method string) bool {
+	for _, m := range p.caps.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Process) Name() string {
+	if p.caps.Name != "" {
+		return p.caps.Name
+	}
+	return p.cmd.Path
+}
+
+func (p *Process) Close() error {
+	var err error
+	p.once.Do(func() {
+		close(p.closed)
+		_ = p.in.Close()
+		done := make(chan error, 1)
+		go func() { done <- p.cmd.Wait() }()
+		select {
+		case err = <-done:
+		case <-time.After(2 * time.Second):
+			_ = p.cmd.Process.Kill()
+			err = <-done
+		}
+	})
+	return err
+}
+
+func (p *Process) readLoop(r io.Reader) {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			var resp rpcResponse
+			if json.Unmarshal(line, &resp) == nil {
+				p.mu.Lock()
+				ch := p.pending[resp.ID]
+				delete(p.pending, resp.ID)
+				p.mu.Unlock()
+				if ch != nil {
+					ch <- resp
+				}
+			}
+		}
+		if err != nil {
+			p.mu.Lock()
+			p.readErr = fmt.Errorf("plugin exited: %w", err)
+			for id, ch := range p.pending {
+				close(ch)
+				delete(p.pending, id)
+			}
+			p.mu.Unlock()
+			return
+		}
+	}
+}
+
+func (p *Process) call(ctx context.Context, method string, params, result any) error {
+	p.mu.Lock()
+	if p.readErr != nil {
+		err := p.readErr
+		p.mu.Unlock()
+		return err
+	}
+	id := p.nextID
+	p.nextID++
+	ch := make(chan rpcResponse, 1)
+	p.pending[id] = ch
+	b, err := json.Marshal(rpcRequest{JSONRPC: "2.0", ID: id, Method: method, Params: params})
+	if err == nil {
+		_, err = p.in.Write(append(b, '\n'))
+	}
+	if err != nil {
+		delete(p.pending, id)
+		p.mu.Unlock()
+		return err
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		p.mu.Lock()
+		delete(p.pending, id)
+		p.mu.Unlock()
+		return ctx.Err()
+	case <-p.closed:
+		return errors.New("plugin closed")
+	case resp, ok := <-ch:
+		if !ok {
+			p.mu.Lock()
+			err := p.readErr
+			p.mu.Unlock()
+			return err
+		}
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result == nil || len(resp.Result) == 0 {
+			return nil
+		}
+		return json.Unmarshal(resp.Result, result)
+	}
+}
+
+func (p *Process) checkedCall(ctx context.Context, method string, params, result any) error {
+	if !p.Supports(method) {
+		return fmt.Errorf("%s: %w", method, ErrUnsupported)
+	}
+	return p.call(ctx, method, params, result)
+}
+
+func (p *Process) Transcribe(ctx context.Context, req TranscribeRequest) ([]Segment, error) {
+	var out []Segment
+	err := p.checkedCall(ctx, MethodTranscribe, req, &out)
+	return out, err
+}
+
+func (p *Process) Translate(ctx context.Context, req TranslateRequest) (string, error) {
+	var out string
+	err := p.checkedCall(ctx, MethodTranslate, req, &out)
+	return out, err
+}
+
+func (p *Process) Download(ctx context.Context, req DownloadRequest) (DownloadResult, error) {
+	var out DownloadResult
+	err := p.checkedCall(ctx, MethodDownload, req, &out)
+	return out, err
+}
+
+func (p *Process) Complete(ctx context.Context, req ChatRequest) (string, error) {
+	var out string
+	err := p.checkedCall(ctx, MethodComplete, req, &out)
+	return out, err
+}
+
+func (p *Process) Notify(ctx context.Context, ev Event) error {
+	return p.checkedCall(ctx, MethodNotify, ev, nil)
+}
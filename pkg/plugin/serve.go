@@ -0,0 +1,153 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	codeParseError     = -32700
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeServerError    = -32000
+)
+
+type rpcIncoming struct {
+	ID     int64           `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+// Serve runs a plugin over stdin/stdout until stdin closes. impl may satisfy
+// any subset of the interfaces in this package; capabilities are derived
+// from which ones it implements. Requests are handled concurrently.
+func Serve(name string, impl any) error {
+	return ServeIO(context.Background(), name, impl, os.Stdin, os.Stdout)
+}
+
+func ServeIO(ctx context.Context, name string, impl any, r io.Reader, w io.Writer) error {
+	caps := Capabilities{Name: name}
+	if _, ok := impl.(Transcriber); ok {
+		caps.Methods = append(caps.Methods, MethodTranscribe)
+	}
+	if _, ok := impl.(Translator); ok {
+		caps.Methods = append(caps.Methods, MethodTranslate)
+	}
+	if _, ok := impl.(Downloader); ok {
+		caps.Methods = append(caps.Methods, MethodDownload)
+	}
+	if _, ok := impl.(LLMProvider); ok {
+		caps.Methods = append(caps.Methods, MethodComplete)
+	}
+	if _, ok := impl.(Notifier); ok {
+		caps.Methods = append(caps.Methods, MethodNotify)
+	}
+
+	var wmu sync.Mutex
+	reply := func(id int64, result any, rerr *rpcError) {
+		resp := rpcResponse{JSONRPC: "2.0", ID: id, Error: rerr}
+		if rerr == nil {
+			b, err := json.Marshal(result)
+			if err != nil {
+				resp.Error = &rpcError{Code: codeServerError, Message: err.Error()}
+			} else {
+				resp.Result = b
+			}
+		}
+		b, _ := json.Marshal(resp)
+		wmu.Lock()
+		_, _ = w.Write(append(b, '\n'))
+		wmu.Unlock()
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			var req rpcIncoming
+			if jerr := json.Unmarshal(line, &req); jerr != nil {
+				reply(0, nil, &rpcError{Code: codeParseError, Message: jerr.Error()})
+			} else {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					result, rerr := dispatch(ctx, impl, caps, req)
+					reply(req.ID, result, rerr)
+				}()
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func dispatch(ctx context.Context, impl any, caps Capabilities, req rpcIncoming) (any, *rpcError) {
+	decode := func(v any) *rpcError {
+		if err := json.Unmarshal(req.Params, v); err != nil {
+			return &rpcError{Code: codeInvalidParams, Message: err.Error()}
+		}
+		return nil
+	}
+	wrap := func(result any, err error) (any, *rpcError) {
+		if err != nil {
+			return nil, &rpcError{Code: codeServerError, Message: err.Error()}
+		}
+		return result, nil
+	}
+
+	switch req.Method {
+	case MethodCapabilities:
+		return caps, nil
+	case MethodTranscribe:
+		if t, ok := impl.(Transcriber); ok {
+			var p TranscribeRequest
+			if e := decode(&p); e != nil {
+				return nil, e
+			}
+			return wrap(t.Transcribe(ctx, p))
+		}
+	case MethodTranslate:
+		if t, ok := impl.(Translator); ok {
+			var p TranslateRequest
+			if e := decode(&p); e != nil {
+				return nil, e
+			}
+			return wrap(t.Translate(ctx, p))
+		}
+	case MethodDownload:
+		if d, ok := impl.(Downloader); ok {
+			var p DownloadRequest
+			if e := decode(&p); e != nil {
+				return nil, e
+			}
+			return wrap(d.Download(ctx, p))
+		}
+	case MethodComplete:
+		if l, ok := impl.(LLMProvider); ok {
+			var p ChatRequest
+			if e := decode(&p); e != nil {
+				return nil, e
+			}
+			return wrap(l.Complete(ctx, p))
+		}
+	case MethodNotify:
+		if n, ok := impl.(Notifier); ok {
+			var p Event
+			if e := decode(&p); e != nil {
+				return nil, e
+			}
+			return wrap(nil, n.Notify(ctx, p))
+		}
+	}
+	return nil, &rpcError{Code: codeMethodNotFound, Message: "method not found: " + req.Method}
+}
@@ -0,0 +1,15 @@
+//go:build windows
+
+package workspace
+
+import "os"
+
+func processAlive(pid int) bool {
+	// FindProcess opens a handle on Windows and fails once the process is gone.
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = p.Release()
+	return true
+}
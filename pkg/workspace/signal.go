@@ -0,0 +1,73 @@
+package workspace
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// HandleSignals closes all open workspaces on SIGINT/SIGTERM and exits with
+// 128+signal. onSignal, if set, runs first (e.g. to restore the terminal).
+// The returned stop function uninstalls the handler.
+func HandleSignals(onSignal func(os.Signal)) (stop func()) {
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-ch:
+			if onSignal != nil {
+				onSignal(sig)
+			}
+			CloseAll()
+			code := 1
+			if s, ok := sig.(syscall.Signal); ok {
+				code = 128 + int(s)
+			}
+			os.Exit(code)
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
+
+// CancelOnSignal returns a context that is cancelled by the first
+// SIGINT/SIGTERM, so the caller can wind down and save what it has. A second
+// signal closes all open workspaces and exits with 128+signal, as
+// HandleSignals does. onSignal, if set, runs on the first signal.
+func CancelOnSignal(parent context.Context, onSignal func(os.Signal)) (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(parent)
+	ch := make(chan os.Signal, 2)
+	done := make(chan struct{})
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-ch:
+			if onSignal != nil {
+				onSignal(sig)
+			}
+			cancel()
+		case <-done:
+			return
+		}
+		select {
+		case sig := <-ch:
+			CloseAll()
+			code := 1
+			if s, ok := sig.(syscall.Signal); ok {
+				code = 128 + int(s)
+			}
+			os.Exit(code)
+		case <-done:
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(ch)
+		close(done)
+		cancel()
+	}
+}
@@ -0,0 +1,232 @@
+// Package workspace manages per-run scratch directories for the tools in
+// this repo: namespaced temp dirs that are removed on exit (including panics
+// and signals), optional keep-for-debugging, a disk quota, and sweeping of
+// directories left behind by runs that crashed.
+package workspace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var ErrQuotaExceeded = errors.New("workspace disk quota exceeded")
+
+// keepMarker is written into kept workspaces so Sweep leaves them alone.
+const keepMarker = ".keep"
+
+type Options struct {
+	// Root is the parent directory; defaults to os.TempDir().
+	Root string
+	// Keep leaves the directory on disk after Close.
+	Keep bool
+	// QuotaBytes caps the total size of the workspace (0 = unlimited).
+	QuotaBytes int64
+}
+
+type Workspace struct {
+	dir  string
+	opts Options
+
+	mu        sync.Mutex
+	artifacts []string
+	closed    bool
+}
+
+var (
+	liveMu sync.Mutex
+	live   = map[*Workspace]struct{}{}
+)
+
+// New sweeps orphans of the same namespace, then creates
+// <root>/<namespace>-<pid>-<rand>.
+func New(namespace string, opts Options) (*Workspace, error) {
+	if opts.Root == "" {
+		opts.Root = os.TempDir()
+	}
+	if namespace == "" || strings.ContainsAny(namespace, `/\`) {
+		return nil, fmt.Errorf("invalid workspace namespace %q", namespace)
+	}
+	_, _ = Sweep(opts.Root, namespace)
+
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("%s-%d-%s", namespace, os.Getpid(), hex.EncodeToString(b[:]))
+	dir := filepath.Join(opts.Root, name)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	w := &Workspace{dir: dir, opts: opts}
+	liveMu.Lock()
+	live[w] = struct{}{}
+	liveMu.Unlock()
+	return w, nil
+}
+
+func (w *Workspace) Dir() string { return w.dir }
+
+// Path returns name joined to the workspace dir and records it as an
+// artifact.
+func (w *Workspace) Path(name string) string {
+	p := filepath.Join(w.dir, name)
+	w.Track(p)
+	return p
+}
+
+func (w *Workspace) Track(path string) {
+	w.mu.Lock()
+	w.artifacts = append(w.artifacts, path)
+	w.mu.Unlock()
+}
+
+func (w *Workspace) Artifacts() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	out := make([]string, len(w.artifacts))
+	copy(out, w.artifacts)
+	return out
+}
+
+// WriteFile writes data to name inside the workspace, honoring the quota.
+func (w *Workspace) WriteFile(name string, data []byte, perm os.FileMode) (string, error) {
+	if err := w.Reserve(int64(len(data))); err != nil {
+		return "", err
+	}
+	p := w.Path(name)
+	if err := os.WriteFile(p, data, perm); err != nil {
+		return "", err
+	}
+	return p, nil
+}
+
+// Usage reports the bytes currently stored in the workspace.
+func (w *Workspace) Usage() (int64, error) {
+	var total int64
+	err := filepath.WalkDir(w.dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		total += info.Size()
+		return nil
+	})
+	return total, err
+}
+
+// Reserve fails with ErrQuotaExceeded if writing n more bytes would go over
+// the quota.
+func (w *Workspace) Reserve(n int64) error {
+	if w.opts.QuotaBytes <= 0 {
+		return nil
+	}
+	used, err := w.Usage()
+	if err != nil {
+		return err
+	}
+	if used+n > w.opts.QuotaBytes {
+		return fmt.Errorf("%w (%d of %d bytes used)", ErrQuotaExceeded, used, w.opts.QuotaBytes)
+	}
+	return nil
+}
+
+// CheckQuota is Reserve(0): call it after something outside our control
+// (ffmpeg, a download) wrote into the workspace.
+func (w *Workspace) CheckQuota() error {
+	return w.Reserve(0)
+}
+
+// Close removes the directory unless Keep is set. It is safe to call more
+// than once.
+func (w *Workspace) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	liveMu.Lock()
+	delete(live, w)
+	liveMu.Unlock()
+
+	if w.opts.Keep {
+		return os.WriteFile(filepath.Join(w.dir, keepMarker), nil, 0o600)
+	}
+	return os.RemoveAll(w.dir)
+}
+
+// CloseOnPanic is meant to be deferred right after New: it cleans up and
+// re-panics.
+func (w *Workspace) CloseOnPanic() {
+	if r := recover(); r != nil {
+		_ = w.Close()
+		panic(r)
+	}
+}
+
+// CloseAll closes every workspace that is still open in this process.
+func CloseAll() {
+	liveMu.Lock()
+	open := make([]*Workspace, 0, len(live))
+	for w := range live {
+		open = append(open, w)
+	}
+	liveMu.Unlock()
+	for _, w := range open {
+		_ = w.Close()
+	}
+}
+
+// Sweep removes <namespace>-<pid>-* directories under root whose owning
+// process is gone and that were not kept on purpose.
+func Sweep(root, namespace string) ([]string, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	prefix := namespace + "-"
+	var removed []string
+	for _, e := range entries {
+		if !e.IsDir() || !strings.HasPrefix(e.Name(), prefix) {
+			continue
+		}
+		pidStr, _, ok := strings.Cut(strings.TrimPrefix(e.Name(), prefix), "-")
+		if !ok {
+			continue
+		}
+		pid, err := strconv.Atoi(pidStr)
+		if err != nil || pid <= 0 || pid == os.Getpid() || processAlive(pid) {
+			continue
+		}
+		dir := filepath.Join(root, e.Name())
+		if _, err := os.Stat(filepath.Join(dir, keepMarker)); err == nil {
+			continue
+		}
+		if err := os.RemoveAll(dir); err == nil {
+			removed = append(removed, dir)
+		}
+	}
+	sort.Strings(removed)
+	return removed, nil
+}
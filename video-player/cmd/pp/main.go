@@ -8,14 +8,28 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"bag-of-tricks/pkg/workspace"
 	"video-player/internal/mpv"
 	"video-player/internal/pp"
 	"video-player/internal/tty"
 )
 
+// stringList is a flag that can be given several times.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, " ") }
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
 func main() {
+	var mpvArgs stringList
+	flag.Var(&mpvArgs, "mpv-arg", "option passed to mpv, such as --hwdec=auto (repeatable; the leading -- is optional)")
 	var (
 		seekFine    = flag.Int("seek-fine", 1, "fine seek seconds (left/right)")
 		seekShort   = flag.Int("seek-short", 10, "short seek seconds (A/D)")
@@ -24,20 +38,27 @@ func main() {
 		autoplay    = flag.Bool("autoplay", true, "auto-play on start (default true; forces pause=false after load)")
 		noAutoplay  = flag.Bool("no-autoplay", false, "disable autoplay on start")
 		startMuted  = flag.Bool("mute", false, "start muted")
+		volume      = flag.Int("volume", -1, "start at this volume in percent (default: mpv's)")
 		noResume    = flag.Bool("no-resume", false, "disable resume (even within this session)")
-		persist     = flag.Bool("persist-resume", false, "persist resume timestamps across runs (writes to ~/.pp_timestamps_go.json)")
+		persist     = flag.Bool("persist-resume", false, "persist resume positions and watch state across runs (writes to ~/.pp_state.db)")
+		resumeLast  = flag.Bool("continue", false, "reopen the file played last, in whatever folder it is (implies --persist-resume)")
 		mpvPathFlag = flag.String("mpv", "mpv", "mpv executable path")
+		mpvProfile  = flag.String("mpv-profile", "", "mpv config profile(s) to apply, comma-separated")
 		latest      = flag.Bool("latest", false, "order video list by date added (most recent first)")
+		shuffle     = flag.Bool("shuffle", false, "play the video list in random order")
+		shotDir     = flag.String("screenshot-dir", "snapshots", "directory screenshots are saved to")
+		shotName    = flag.String("screenshot-template", "%F_%wHh%wMm%wSs%wTms", "screenshot file name, in mpv's --screenshot-template syntax (add %n for numbered names)")
+		tuiMode     = flag.Bool("tui", false, "keep the playlist, a progress bar and a status line at the top of the terminal")
 	)
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "pp (Go) - keyboard-first video player controller (mpv)\n\n")
 		fmt.Fprintf(os.Stderr, "Usage:\n  %s [flags] [path]\n\n", filepath.Base(os.Args[0]))
-		fmt.Fprintf(os.Stderr, "Path may be a video file or a directory (default: .).\n\nFlags:\n")
+		fmt.Fprintf(os.Stderr, "Path may be a video file, a directory (default: .), a URL mpv can play\n(with yt-dlp for sites like YouTube), or an .m3u/.m3u8 playlist or .txt\nlist of files and URLs.\n--continue reopens the file played last instead.\n\nFlags:\n")
 		flag.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\nKeys:\n")
-		fmt.Fprintf(os.Stderr, "  Space  play/pause\n  ←/→    seek ±fine\n  Z/C    seek ±fine (same as arrows)\n  ↑/↓    seek ±long\n  WASD   seek (A/D=short, W/S=long)\n  J/K    seek (long, same as ↑/↓)\n  1-9    jump 10%%-90%%\n  q/e    prev/next video\n  h/l    prev/next video\n  x      snapshot (./snapshots)\n  g      clip toggle (./clips)\n  t      trim toggle (./clips)\n  +/-    window scale\n  m      mute\n  [/ ]   speed -/+ 0.1x\n  :      command mode\n  Esc    quit\n")
+		fmt.Fprintf(os.Stderr, "  Space  play/pause\n  ←/→    seek ±fine\n  Z      seek -fine (same as ←)\n  c/C    next/previous chapter\n  ↑/↓    seek ±long\n  WASD   seek (A/D=short, W/S=long)\n  J/K    seek (long, same as ↑/↓)\n  1-9    jump 10%%-90%%\n  , / .  frame back/forward (pauses)\n  q/e    prev/next video\n  h      prev video\n  l/L    A-B loop mark/clear\n  x      screenshot (--screenshot-dir)\n  g      clip toggle (./clips)\n  t      trim toggle (./clips)\n  -/=    volume -/+ 5%%\n  _/+    window scale\n  v/V    cycle subtitle/audio track\n  ( / )  subtitle delay -/+ 0.1s\n  m      mute\n  [/ ]   speed -/+ 0.1x\n  /      find and open a file\n  :      command mode\n  Esc    quit\n")
 		fmt.Fprintf(os.Stderr, "\nCommand mode examples:\n")
-		fmt.Fprintf(os.Stderr, "  :ls\n  :open 3\n  :open substring\n  :seek +30\n  :jump 50%%\n")
+		fmt.Fprintf(os.Stderr, "  :ls\n  :open 3\n  :open query (fuzzy finder)\n  :history\n  :history 2\n  :seek +30\n  :jump 50%%\n  :clip 1:30 2:05\n  :loop file|off\n  :sub 2|off\n  :audio 2\n  :subdelay 0.5\n  :chapters\n  :chapter 3\n  :seekexact [on|off]\n  :vol 50|+10|-10\n  :sort name|mtime|size|random\n  :shuffle\n  :unwatched\n  :all\n  :saveplaylist name.m3u\n  :rate 4\n  :mv keep\n  :rename \"new name\"\n")
 	}
 	flag.Parse()
 
@@ -54,6 +75,30 @@ func main() {
 		os.Exit(1)
 	}
 
+	var store *pp.StateStore
+	if *persist || *resumeLast {
+		store = pp.NewStateStore(pp.DefaultStatePath())
+		store.LegacyPath = pp.LegacyTimestampPath()
+		if !*noResume || *resumeLast {
+			if err := store.Load(); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to load %s: %v\n", pp.DefaultStatePath(), err)
+			}
+		}
+	} else {
+		store = pp.NewStateStore("")
+	}
+
+	var last pp.HistoryEntry
+	if *resumeLast {
+		history := store.History()
+		if len(history) == 0 {
+			fmt.Fprintln(os.Stderr, "nothing played yet")
+			os.Exit(1)
+		}
+		last = history[0]
+		path = last.Path
+	}
+
 	playlist, startIndex, err := pp.BuildPlaylist(path, *latest)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
@@ -63,39 +108,61 @@ func main() {
 		fmt.Fprintln(os.Stderr, "no video files found")
 		os.Exit(1)
 	}
-
-	var ts *pp.TimestampStore
-	if *persist {
-		ts = pp.NewTimestampStore(pp.DefaultTimestampPath())
-		if !*noResume {
-			_ = ts.Load()
+	if last.Watched && startIndex < len(playlist)-1 {
+		// The last file was finished; go on with the one after it.
+		startIndex++
+	}
+	if *shuffle {
+		// Start on the file given, or on the first of the shuffled list.
+		start := playlist[startIndex]
+		_ = pp.SortPlaylist(playlist, pp.SortRandom)
+		startIndex = 0
+		if abs, err := filepath.Abs(path); err == nil && abs == start {
+			for i, p := range playlist {
+				if p == start {
+					startIndex = i
+				}
+			}
 		}
-	} else {
-		ts = pp.NewTimestampStore("")
 	}
 
+	ws, err := workspace.New("pp", workspace.Options{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create temp dir: %v\n", err)
+		os.Exit(1)
+	}
+	defer ws.Close()
+	defer ws.CloseOnPanic()
+
 	restoreTTY, err := tty.MakeRaw()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to set raw terminal mode: %v\n", err)
 		os.Exit(1)
 	}
 	defer restoreTTY()
+	stopSignals := workspace.HandleSignals(func(os.Signal) {
+		restoreTTY()
+		if *tuiMode {
+			tty.ResetScrollRegion()
+		}
+	})
+	defer stopSignals()
 
-	socketPath, cleanupSock, err := mpv.TempSocketPath()
+	socketPath, cleanupSock, err := mpv.TempSocketPath(ws.Dir())
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to create socket path: %v\n", err)
 		os.Exit(1)
 	}
 	defer cleanupSock()
 
-	playlistPath, cleanupPlaylist, err := pp.WriteTempPlaylist(playlist)
+	playlistPath, cleanupPlaylist, err := pp.WriteTempPlaylist(ws.Dir(), playlist)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to write playlist: %v\n", err)
 		os.Exit(1)
 	}
 	defer cleanupPlaylist()
 
-	inputConfPath, cleanupInputConf, err := pp.WriteTempInputConf(pp.KeybindOptions{
+	inputConfPath, cleanupInputConf, err := pp.WriteTempInputConf(ws.Dir(), pp.KeybindOptions{
 		SeekShortS: float64(*seekShort),
 		SeekFineS:  float64(*seekFine),
 		SeekLongS:  float64(*seekLong),
@@ -106,7 +173,7 @@ func main() {
 	}
 	defer cleanupInputConf()
 
-	browserScriptPath, cleanupBrowserScript, err := pp.WriteTempBrowserScript()
+	browserScriptPath, cleanupBrowserScript, err := pp.WriteTempBrowserScript(ws.Dir())
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to write browser script: %v\n", err)
 		os.Exit(1)
@@ -120,6 +187,8 @@ func main() {
 		InputConfPath: inputConfPath,
 		ScriptPaths:   []string{browserScriptPath},
 		KeepOpen:      true,
+		Profile:       *mpvProfile,
+		ExtraArgs:     mpvOptions(mpvArgs),
 	})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to start mpv: %v\n", err)
@@ -140,21 +209,34 @@ func main() {
 	defer client.Close()
 
 	_ = client.Command(context.Background(), "set_property", "mute", *startMuted)
+	if *volume >= 0 {
+		_ = client.Command(context.Background(), "set_property", "volume", *volume)
+	}
+	screenshotDir, err := filepath.Abs(*shotDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid screenshot dir: %v\n", err)
+		os.Exit(1)
+	}
+	_ = client.Command(context.Background(), "set_property", "screenshot-directory", screenshotDir)
+	_ = client.Command(context.Background(), "set_property", "screenshot-template", *shotName)
 
 	app := &pp.App{
-		MPV:         client,
-		Proc:        player,
-		Playlist:    playlist,
-		Index:       startIndex,
-		SeekShortS:  float64(*seekShort),
-		SeekFineS:   float64(*seekFine),
-		SeekLongS:   float64(*seekLong),
-		Continuous:  *continuous,
-		AutoPlay:    autoPlayEffective,
-		Timestamps:  ts,
-		ResumeState: !*noResume,
+		MPV:           client,
+		Proc:          player,
+		Playlist:      playlist,
+		Index:         startIndex,
+		SeekShortS:    float64(*seekShort),
+		SeekFineS:     float64(*seekFine),
+		SeekLongS:     float64(*seekLong),
+		Continuous:    *continuous,
+		AutoPlay:      autoPlayEffective,
+		ScreenshotDir: screenshotDir,
+		Store:         store,
+		ResumeState:   !*noResume,
+		TUI:           *tuiMode,
 	}
 
+	_ = app.LoadSidecarSubtitles(context.Background())
 	_ = app.RestorePosition(context.Background())
 	if autoPlayEffective {
 		_ = client.Command(context.Background(), "set_property", "pause", false)
@@ -167,3 +249,16 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// mpvOptions turns the --mpv-arg values into mpv options, so that
+// "hwdec=auto" works as well as "--hwdec=auto".
+func mpvOptions(args []string) []string {
+	opts := make([]string, 0, len(args))
+	for _, a := range args {
+		if !strings.HasPrefix(a, "-") {
+			a = "--" + a
+		}
+		opts = append(opts, a)
+	}
+	return opts
+}
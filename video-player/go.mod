@@ -2,3 +2,11 @@ module video-player
 
 go 1.22
 
+require (
+	bag-of-tricks/pkg v0.0.0
+	go.etcd.io/bbolt v1.3.11
+)
+
+require golang.org/x/sys v0.4.0 // indirect
+
+replace bag-of-tricks/pkg => ../pkg
@@ -37,8 +37,10 @@ type Event struct {
 	Raw  map[string]json.RawMessage
 }
 
-func TempSocketPath() (string, func(), error) {
-	dir := os.TempDir()
+func TempSocketPath(dir string) (string, func(), error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
 	name := "pp-mpv-" + strconv.FormatInt(time.Now().UnixNano(), 10) + ".sock"
 	path := filepath.Join(dir, name)
 	_ = os.Remove(path)
@@ -20,6 +20,11 @@ type StartOptions struct {
 	InputConfPath string
 	ScriptPaths   []string
 	KeepOpen      bool
+
+	// Profile is passed as --profile, and ExtraArgs as they are, after the
+	// options above so that they can change them.
+	Profile   string
+	ExtraArgs []string
 }
 
 func Start(mpvPath string, opts StartOptions) (*Process, error) {
@@ -47,6 +52,11 @@ func Start(mpvPath string, opts StartOptions) (*Process, error) {
 		args = append(args, "--script="+s)
 	}
 
+	if opts.Profile != "" {
+		args = append(args, "--profile="+opts.Profile)
+	}
+	args = append(args, opts.ExtraArgs...)
+
 	if opts.PlaylistPath != "" {
 		args = append(args, "--playlist="+opts.PlaylistPath, "--playlist-start="+strconv.Itoa(opts.PlaylistStart))
 	}
@@ -9,12 +9,14 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"video-player/internal/mpv"
+	"video-player/internal/trash"
 	"video-player/internal/tty"
 )
 
@@ -25,23 +27,54 @@ type App struct {
 	Playlist []string
 	Index    int
 
+	// fullPlaylist is the playlist before :unwatched filtered it, nil
+	// when it is not filtered.
+	fullPlaylist []string
+
 	SeekShortS float64
 	SeekFineS  float64
 	SeekLongS  float64
 	Continuous bool
 	AutoPlay   bool
 
-	Timestamps  *TimestampStore
+	// ScreenshotDir is where mpv saves screenshots, named after its
+	// screenshot-template.
+	ScreenshotDir string
+
+	Store       *StateStore
 	ResumeState bool
 
+	// TUI keeps the playlist, the progress and a status line at the top of
+	// the terminal while playing.
+	TUI bool
+	tui *tui
+
 	helpShown bool
 
+	// playedPath is the file last recorded as played.
+	playedPath string
+
+	// history is the list :history printed last, which :history N opens
+	// from.
+	history []HistoryEntry
+
+	subsMu sync.Mutex
+
+	// trashArmedUntil is when a first press of the trash key stops
+	// waiting for the second one.
+	trashArmedUntil time.Time
+	// trashKeys passes the trash keys of the mpv window from the event
+	// loop to the input loop, which does all the trashing, as it changes
+	// the playlist.
+	trashKeys chan struct{}
+
 	pauseAfterLoad bool
 
-	lastMu         sync.Mutex
-	lastSamplePath string
-	lastSamplePos  float64
-	lastSavedAt    time.Time
+	lastMu             sync.Mutex
+	lastSamplePath     string
+	lastSamplePos      float64
+	lastSampleDuration float64
+	lastSavedAt        time.Time
 
 	clipActive    bool
 	clipStartPath string
@@ -57,8 +90,17 @@ func (a *App) Run() error {
 		return errors.New("mpv client is nil")
 	}
 
-	_ = a.MPV.Command(context.Background(), "observe_property", 1, "playlist-pos")
+	observed := []string{"playlist-pos", "chapter"}
+	if a.TUI {
+		a.tui = newTUI(a)
+		defer a.tui.close()
+		observed = append(observed, tuiProps...)
+	}
+	for i, name := range observed {
+		_ = a.MPV.Command(context.Background(), "observe_property", i+1, name)
+	}
 
+	a.trashKeys = make(chan struct{}, 1)
 	go a.eventLoop()
 	go a.periodicSaveLoop()
 	in := bufio.NewReader(os.Stdin)
@@ -67,6 +109,9 @@ func (a *App) Run() error {
 		select {
 		case <-a.MPV.Done():
 			return nil
+		case <-a.trashKeys:
+			a.requestTrash()
+			continue
 		default:
 		}
 
@@ -116,8 +161,16 @@ func (a *App) handleRune(r rune, in *bufio.Reader) (quit bool, err error) {
 	switch r {
 	case 'q', 'h':
 		return false, a.Prev(context.Background())
-	case 'e', 'l', '\r', '\n':
+	case 'e', '\r', '\n':
 		return false, a.Next(context.Background())
+	case 'l':
+		if err := a.MarkLoop(context.Background()); err != nil {
+			a.osd(err.Error())
+		}
+		return false, nil
+	case 'L':
+		_ = a.ClearLoop(context.Background())
+		return false, nil
 	case 'x', 'X':
 		if err := a.SaveSnapshot(context.Background()); err != nil {
 			a.osd("Snapshot failed")
@@ -134,19 +187,28 @@ func (a *App) handleRune(r rune, in *bufio.Reader) (quit bool, err error) {
 			a.osd(err.Error())
 		}
 		return false, nil
-	case '+', '=':
+	case '+':
 		_ = a.bumpWindowScale(0.1)
 		return false, nil
-	case '-', '_':
+	case '_':
 		_ = a.bumpWindowScale(-0.1)
 		return false, nil
+	case '=':
+		return false, a.bumpVolume(volumeStep)
+	case '-':
+		return false, a.bumpVolume(-volumeStep)
 	case 'z':
 		_ = a.MPV.Command(context.Background(), "seek", -a.SeekFineS, "relative")
 		a.osd(fmt.Sprintf("◀ %ss", formatSeconds(a.SeekFineS)))
 		return false, nil
-	case 'c':
-		_ = a.MPV.Command(context.Background(), "seek", a.SeekFineS, "relative")
-		a.osd(fmt.Sprintf("▶ %ss", formatSeconds(a.SeekFineS)))
+	case 'c', 'C':
+		delta := 1
+		if r == 'C' {
+			delta = -1
+		}
+		if err := a.StepChapter(context.Background(), delta); err != nil {
+			a.osd("Chapter failed")
+		}
 		return false, nil
 	case 'k':
 		_ = a.MPV.Command(context.Background(), "seek", a.SeekLongS, "relative")
@@ -172,6 +234,27 @@ func (a *App) handleRune(r rune, in *bufio.Reader) (quit bool, err error) {
 		_ = a.MPV.Command(context.Background(), "seek", -a.SeekLongS, "relative")
 		a.osd(fmt.Sprintf("◀ %.0fs", a.SeekLongS))
 		return false, nil
+	case 'v', 'V':
+		kind := "sub"
+		if r == 'V' {
+			kind = "audio"
+		}
+		if err := a.CycleTrack(context.Background(), kind); err != nil {
+			a.osd(trackNames[kind] + ": no tracks")
+		}
+		return false, nil
+	case '(':
+		return false, a.bumpSubDelay(-0.1)
+	case ')':
+		return false, a.bumpSubDelay(0.1)
+	case '.':
+		_ = a.MPV.Command(context.Background(), "frame-step")
+		a.osd("Frame ▶")
+		return false, nil
+	case ',':
+		_ = a.MPV.Command(context.Background(), "frame-back-step")
+		a.osd("Frame ◀")
+		return false, nil
 	case 'm':
 		_ = a.MPV.Command(context.Background(), "cycle", "mute")
 		a.osd("Toggle mute")
@@ -183,6 +266,11 @@ func (a *App) handleRune(r rune, in *bufio.Reader) (quit bool, err error) {
 	case 'H', '?':
 		a.ShowHelpOnce()
 		return false, nil
+	case 0x7f: // Backspace
+		a.requestTrash()
+		return false, nil
+	case '/':
+		return false, a.openFinder(in, "")
 	case ':':
 		return a.commandMode(in)
 	default:
@@ -198,69 +286,71 @@ func (a *App) handleRune(r rune, in *bufio.Reader) (quit bool, err error) {
 
 func (a *App) ShowHelpOnce() {
 	if a.helpShown {
-		a.osd("Keys: space pause, arrows/ZC fine, WASD short/long, j/k long, q/e/h/l prev/next, x snapshot, g clip, t trim, +/- scale, : commands, Esc quit")
+		a.osd("Keys: space pause, arrows/Z fine, c/C chapter, ,/. frame, WASD short/long, j/k long, q/e/h prev/next, l/L A-B loop, v/V sub/audio, (/) sub delay, x snapshot, g clip, t trim, -/= volume, _/+ scale, : commands, Esc quit")
 		return
 	}
 	a.helpShown = true
 	fmt.Fprintln(os.Stdout, "\npp (Go) controls:")
 	fmt.Fprintln(os.Stdout, "  Space  play/pause")
 	fmt.Fprintln(os.Stdout, "  ←/→    seek ±fine")
-	fmt.Fprintln(os.Stdout, "  Z/C    seek ±fine (same as arrows)")
+	fmt.Fprintln(os.Stdout, "  Z      seek -fine (same as ←)")
+	fmt.Fprintln(os.Stdout, "  c/C    next/previous chapter")
 	fmt.Fprintln(os.Stdout, "  ↑/↓    seek ±long")
 	fmt.Fprintln(os.Stdout, "  WASD   seek (A/D=short, W/S=long)")
 	fmt.Fprintln(os.Stdout, "  J/K    seek (long, same as ↑/↓)")
 	fmt.Fprintln(os.Stdout, "  1-9    jump 10%-90%")
+	fmt.Fprintln(os.Stdout, "  , / .  frame back/forward (pauses)")
 	fmt.Fprintln(os.Stdout, "  q/e    prev/next video")
-	fmt.Fprintln(os.Stdout, "  h/l    prev/next video")
-	fmt.Fprintln(os.Stdout, "  x      snapshot (./snapshots)")
+	fmt.Fprintln(os.Stdout, "  h      prev video")
+	fmt.Fprintln(os.Stdout, "  l/L    A-B loop mark/clear")
+	fmt.Fprintln(os.Stdout, "  x      screenshot (--screenshot-dir)")
 	fmt.Fprintln(os.Stdout, "  g      clip toggle (./clips)")
 	fmt.Fprintln(os.Stdout, "  t      trim toggle (./clips)")
-	fmt.Fprintln(os.Stdout, "  +/-    window scale")
+	fmt.Fprintln(os.Stdout, "  -/=    volume -/+ 5%")
+	fmt.Fprintln(os.Stdout, "  _/+    window scale")
+	fmt.Fprintln(os.Stdout, "  v/V    cycle subtitle/audio track")
+	fmt.Fprintln(os.Stdout, "  ( / )  subtitle delay -/+ 0.1s")
 	fmt.Fprintln(os.Stdout, "  m      mute")
 	fmt.Fprintln(os.Stdout, "  [/ ]   speed -/+ 0.1x")
-	fmt.Fprintln(os.Stdout, "  :      command mode (ls/open/seek/jump)")
+	fmt.Fprintln(os.Stdout, "  Bksp   move file to trash (press twice)")
+	fmt.Fprintln(os.Stdout, "  /      find and open a file")
+	fmt.Fprintln(os.Stdout, "  :      command mode (ls/open/history/seek/jump/clip/loop/sub/audio/sort/...)")
 	fmt.Fprintln(os.Stdout, "  Esc    quit")
 	fmt.Fprintln(os.Stdout)
 	a.osd("Ready. Press : for commands, h for help.")
 }
 
 func (a *App) osd(msg string) {
+	a.tui.setMessage(msg)
 	ctx := withTimeout(200 * time.Millisecond)
 	_ = a.MPV.Command(ctx, "show-text", msg, 1500)
 }
 
 func (a *App) SaveSnapshot(ctx context.Context) error {
-	wd, err := os.Getwd()
-	if err != nil {
-		return err
+	dir := a.ScreenshotDir
+	if dir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		dir = filepath.Join(wd, "snapshots")
 	}
-	dir := filepath.Join(wd, "snapshots")
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return err
 	}
 
-	path, err := a.MPV.GetString(withTimeout(300*time.Millisecond), "path")
-	if err != nil || path == "" {
-		if a.Index >= 0 && a.Index < len(a.Playlist) {
-			path = a.Playlist[a.Index]
-		}
+	data, err := a.MPV.CommandData(ctx, "screenshot", "video")
+	if err != nil {
+		return err
 	}
-	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
-	if base == "" {
-		base = "snapshot"
+	var res struct {
+		Filename string `json:"filename"`
 	}
-
-	pos, err := a.MPV.GetFloat(withTimeout(300*time.Millisecond), "time-pos")
-	if err != nil || pos < 0 {
-		pos = 0
+	if json.Unmarshal(data, &res) == nil && res.Filename != "" {
+		a.osd("Saved: " + filepath.Base(res.Filename))
+	} else {
+		a.osd("Saved screenshot")
 	}
-	stamp := formatTimestamp(pos)
-	outPath := uniquePath(filepath.Join(dir, fmt.Sprintf("%s_%s.jpg", base, stamp)))
-
-	if err := a.MPV.Command(ctx, "screenshot-to-file", outPath, "video"); err != nil {
-		return err
-	}
-	a.osd("Saved: " + filepath.Base(outPath))
 	return nil
 }
 
@@ -288,7 +378,7 @@ func (a *App) startClip(ctx context.Context) error {
 	if path == "" {
 		return errors.New("Clip failed (no file)")
 	}
-	if strings.Contains(path, "://") {
+	if IsURL(path) {
 		return errors.New("Clip failed (not local)")
 	}
 	pos, err := a.MPV.GetFloat(withTimeout(300*time.Millisecond), "time-pos")
@@ -343,7 +433,7 @@ func (a *App) startTrim(ctx context.Context) error {
 	if path == "" {
 		return errors.New("Trim failed (no file)")
 	}
-	if strings.Contains(path, "://") {
+	if IsURL(path) {
 		return errors.New("Trim failed (not local)")
 	}
 	pos, err := a.MPV.GetFloat(withTimeout(300*time.Millisecond), "time-pos")
@@ -395,6 +485,76 @@ func (a *App) finishTrim(ctx context.Context) error {
 	return a.exportSegment(startPath, startPos, endPos, "Trim")
 }
 
+// MarkLoop sets the A point of an A-B loop at the current position, then
+// its B point. Marking again once both are set starts a new loop.
+func (a *App) MarkLoop(ctx context.Context) error {
+	pos, err := a.MPV.GetFloat(withTimeout(300*time.Millisecond), "time-pos")
+	if err != nil || pos < 0 {
+		return errors.New("Loop failed (no position)")
+	}
+	// mpv reports an unset point as "no", which is not a number.
+	start, errA := a.MPV.GetFloat(withTimeout(300*time.Millisecond), "ab-loop-a")
+	_, errB := a.MPV.GetFloat(withTimeout(300*time.Millisecond), "ab-loop-b")
+	if errA != nil || errB == nil {
+		_ = a.MPV.Command(ctx, "set_property", "ab-loop-b", "no")
+		if err := a.MPV.Command(ctx, "set_property", "ab-loop-a", pos); err != nil {
+			return err
+		}
+		a.osd(fmt.Sprintf("Loop A %.1fs (l again for B)", pos))
+		return nil
+	}
+	if pos <= start {
+		return errors.New("Loop B must be after A")
+	}
+	if err := a.MPV.Command(ctx, "set_property", "ab-loop-b", pos); err != nil {
+		return err
+	}
+	a.osd(fmt.Sprintf("Loop A-B %.1fs - %.1fs", start, pos))
+	return nil
+}
+
+// ClearLoop removes the A-B loop points.
+func (a *App) ClearLoop(ctx context.Context) error {
+	_ = a.MPV.Command(ctx, "set_property", "ab-loop-a", "no")
+	_ = a.MPV.Command(ctx, "set_property", "ab-loop-b", "no")
+	a.osd("Loop cleared")
+	return nil
+}
+
+// ClipRange exports the part of the current file from start to end, in
+// seconds, the way a clip marked with g is.
+func (a *App) ClipRange(start, end float64) error {
+	path := a.currentPath()
+	if path == "" {
+		return errors.New("Clip failed (no file)")
+	}
+	if IsURL(path) {
+		return errors.New("Clip failed (not local)")
+	}
+	if end <= start+0.05 {
+		return errors.New("Clip invalid (end must be after start)")
+	}
+	return a.exportSegment(path, start, end, "Clip")
+}
+
+// parseClock parses a time given as seconds or as [h:]m:s, such as "90",
+// "1:30" or "1:02:03.5".
+func parseClock(s string) (float64, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	var sec float64
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil || v < 0 || (i > 0 && v >= 60) {
+			return 0, fmt.Errorf("invalid time %q", s)
+		}
+		sec = sec*60 + v
+	}
+	return sec, nil
+}
+
 func (a *App) exportSegment(path string, startPos, endPos float64, label string) error {
 	if _, err := exec.LookPath("ffmpeg"); err != nil {
 		return fmt.Errorf("%s failed (ffmpeg not found)", label)
@@ -522,10 +682,65 @@ func (a *App) bumpSpeed(delta float64) error {
 		next = 3.0
 	}
 	_ = a.MPV.Command(context.Background(), "set_property", "speed", next)
+	if path := a.currentPath(); path != "" && a.ResumeState {
+		a.Store.SetSetting(path, "speed", next)
+	}
 	a.osd(fmt.Sprintf("Speed %.1fx", next))
 	return nil
 }
 
+// SetExactSeeks makes relative seeks, from the terminal and the mpv window
+// alike, land on the exact time rather than the nearest keyframe. They are
+// slower, so mpv only seeks exactly to absolute times by default.
+func (a *App) SetExactSeeks(on bool) error {
+	mode := "default"
+	if on {
+		mode = "yes"
+	}
+	if err := a.MPV.Command(context.Background(), "set_property", "hr-seek", mode); err != nil {
+		return err
+	}
+	if on {
+		a.osd("Exact seeks on")
+	} else {
+		a.osd("Exact seeks off (keyframes)")
+	}
+	return nil
+}
+
+func (a *App) exactSeeks() bool {
+	mode, err := a.MPV.GetString(withTimeout(250*time.Millisecond), "hr-seek")
+	return err == nil && mode == "yes"
+}
+
+// volumeStep is how much - and = change the volume by, in percent.
+const volumeStep = 5
+
+func (a *App) bumpVolume(delta float64) error {
+	cur, err := a.MPV.GetFloat(withTimeout(250*time.Millisecond), "volume")
+	if err != nil {
+		cur = 100
+	}
+	return a.setVolume(cur + delta)
+}
+
+// setVolume sets the volume in percent, clamped to mpv's volume-max (130
+// unless configured otherwise).
+func (a *App) setVolume(v float64) error {
+	most, err := a.MPV.GetFloat(withTimeout(250*time.Millisecond), "volume-max")
+	if err != nil || most <= 0 {
+		most = 100
+	}
+	v = min(max(v, 0), most)
+	_ = a.MPV.Command(context.Background(), "set_property", "volume", v)
+	msg := fmt.Sprintf("Volume %.0f%%", v)
+	if muted, err := a.MPV.GetBool(withTimeout(250*time.Millisecond), "mute"); err == nil && muted {
+		msg += " (muted)"
+	}
+	a.osd(msg)
+	return nil
+}
+
 func (a *App) Next(ctx context.Context) error {
 	_ = a.persistPosition()
 	a.syncIndex()
@@ -580,22 +795,170 @@ func (a *App) Load(ctx context.Context, index int) error {
 	if err := a.MPV.Command(ctx, "playlist-play-index", a.Index); err != nil {
 		return err
 	}
-	a.osd(fmt.Sprintf("Open %s (%d/%d)", filepath.Base(a.Playlist[a.Index]), a.Index+1, len(a.Playlist)))
+	a.osd(fmt.Sprintf("Open %s (%d/%d)", displayName(a.Playlist[a.Index]), a.Index+1, len(a.Playlist)))
 	if !a.Continuous {
 		a.pauseAfterLoad = false
 	}
 	return nil
 }
 
+// Reorder sorts the playlist by mode and moves mpv's entries to match, so
+// the current file keeps playing at its new index.
+func (a *App) Reorder(ctx context.Context, mode string) error {
+	a.syncIndex()
+	order := append([]string(nil), a.Playlist...)
+	if err := SortPlaylist(order, mode); err != nil {
+		return err
+	}
+	if err := a.moveEntries(ctx, order); err != nil {
+		return err
+	}
+	if mode == SortRandom {
+		a.osd(fmt.Sprintf("Shuffled (%d/%d)", a.Index+1, len(a.Playlist)))
+	} else {
+		a.osd(fmt.Sprintf("Sorted by %s (%d/%d)", mode, a.Index+1, len(a.Playlist)))
+	}
+	return nil
+}
+
+// moveEntries moves mpv's playlist entries into order, which holds the
+// same files as the playlist, and follows the current file to its new index.
+func (a *App) moveEntries(ctx context.Context, order []string) error {
+	cur := append([]string(nil), a.Playlist...)
+	for i, p := range order {
+		j := i
+		for cur[j] != p {
+			j++
+		}
+		if j == i {
+			continue
+		}
+		// playlist-move puts entry j in front of entry i.
+		if err := a.MPV.Command(ctx, "playlist-move", j, i); err != nil {
+			return err
+		}
+		copy(cur[i+1:j+1], cur[i:j])
+		cur[i] = p
+	}
+
+	current := ""
+	if a.Index >= 0 && a.Index < len(a.Playlist) {
+		current = a.Playlist[a.Index]
+	}
+	a.Playlist = order
+	for i, p := range order {
+		if p == current {
+			a.Index = i
+		}
+	}
+	return nil
+}
+
+// SavePlaylist saves the playlist as it is now, sorted or filtered, to
+// path. A path without an extension gets .m3u.
+func (a *App) SavePlaylist(path string) error {
+	path, err := expandHome(path)
+	if err != nil {
+		return err
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == "" {
+		path += ".m3u"
+	} else if !listExts[ext] {
+		return fmt.Errorf("not a playlist name: %s (want .m3u, .m3u8 or .txt)", filepath.Base(path))
+	}
+	if err := WritePlaylistFile(path, a.Playlist); err != nil {
+		return err
+	}
+	a.osd(fmt.Sprintf("Saved %s (%d files)", filepath.Base(path), len(a.Playlist)))
+	return nil
+}
+
+// FilterUnwatched removes the watched files from the playlist, all but the
+// one playing. ShowAll brings them back.
+func (a *App) FilterUnwatched(ctx context.Context) error {
+	a.syncIndex()
+	current := ""
+	if a.Index >= 0 && a.Index < len(a.Playlist) {
+		current = a.Playlist[a.Index]
+	}
+	var keep []string
+	for _, p := range a.Playlist {
+		if p == current || !a.Store.Watched(p) {
+			keep = append(keep, p)
+		}
+	}
+	if len(keep) == len(a.Playlist) {
+		a.osd(fmt.Sprintf("No watched files (%d unwatched)", len(keep)))
+		return nil
+	}
+	if a.fullPlaylist == nil {
+		a.fullPlaylist = append([]string(nil), a.Playlist...)
+	}
+	// Remove from the end so the indexes ahead stay valid.
+	for i := len(a.Playlist) - 1; i >= 0; i-- {
+		p := a.Playlist[i]
+		if p == current || !a.Store.Watched(p) {
+			continue
+		}
+		if err := a.MPV.Command(ctx, "playlist-remove", i); err != nil {
+			return err
+		}
+		a.Playlist = append(a.Playlist[:i], a.Playlist[i+1:]...)
+		if i < a.Index {
+			a.Index--
+		}
+	}
+	a.osd(fmt.Sprintf("Unwatched: %d files (:all to show all)", len(a.Playlist)))
+	return nil
+}
+
+// ShowAll undoes FilterUnwatched, putting the hidden files back in their
+// places.
+func (a *App) ShowAll(ctx context.Context) error {
+	if a.fullPlaylist == nil {
+		a.osd(fmt.Sprintf("All files shown (%d)", len(a.Playlist)))
+		return nil
+	}
+	a.syncIndex()
+	for _, p := range a.fullPlaylist {
+		if slices.Contains(a.Playlist, p) {
+			continue
+		}
+		if err := a.MPV.Command(ctx, "loadfile", p, "append"); err != nil {
+			return err
+		}
+		a.Playlist = append(a.Playlist, p)
+	}
+	if err := a.moveEntries(ctx, a.fullPlaylist); err != nil {
+		return err
+	}
+	a.fullPlaylist = nil
+	a.osd(fmt.Sprintf("All files: %d (%d/%d)", len(a.Playlist), a.Index+1, len(a.Playlist)))
+	return nil
+}
+
+// RestorePosition resumes the current file where it stopped and restores
+// the mpv properties remembered for it. It also records the file as played,
+// once per switch to it.
 func (a *App) RestorePosition(ctx context.Context) error {
-	if !a.ResumeState || a.Timestamps == nil {
+	if !a.ResumeState || a.Store == nil {
 		return nil
 	}
 	path, err := a.MPV.GetString(withTimeout(300*time.Millisecond), "path")
 	if err != nil || path == "" {
 		path = a.Playlist[a.Index]
 	}
-	sec, ok := a.Timestamps.Get(path)
+	if path != a.playedPath {
+		a.playedPath = path
+		a.Store.MarkPlayed(path)
+	}
+	if st, ok := a.Store.State(path); ok {
+		for name, v := range st.Settings {
+			_ = a.MPV.Command(ctx, "set_property", name, v)
+		}
+	}
+	sec, ok := a.Store.Get(path)
 	if !ok || sec <= 0.5 {
 		return nil
 	}
@@ -605,7 +968,7 @@ func (a *App) RestorePosition(ctx context.Context) error {
 }
 
 func (a *App) persistPosition() error {
-	if !a.ResumeState || a.Timestamps == nil {
+	if !a.ResumeState || a.Store == nil {
 		return nil
 	}
 	pos, err := a.MPV.GetFloat(withTimeout(300*time.Millisecond), "time-pos")
@@ -616,8 +979,59 @@ func (a *App) persistPosition() error {
 	if err != nil || path == "" {
 		path = a.Playlist[a.Index]
 	}
-	a.Timestamps.Set(path, pos)
-	return a.Timestamps.Save()
+	duration, _ := a.MPV.GetFloat(withTimeout(300*time.Millisecond), "duration")
+	a.Store.SetProgress(path, pos, duration)
+	return a.Store.Save()
+}
+
+// requestTrash moves the current file to the trash on the second press of
+// a trash key within two seconds.
+func (a *App) requestTrash() {
+	if time.Now().After(a.trashArmedUntil) {
+		a.trashArmedUntil = time.Now().Add(2 * time.Second)
+		a.tui.setMessage("Trash file? Press Backspace/Delete again to confirm")
+		_ = a.MPV.Command(withTimeout(200*time.Millisecond), "show-text", "Trash file? Press Backspace/Delete again to confirm", 2000)
+		return
+	}
+	a.trashArmedUntil = time.Time{}
+	if err := a.TrashCurrent(context.Background()); err != nil {
+		a.osd(err.Error())
+	}
+}
+
+// TrashCurrent moves the current file to the trash of the OS, drops it from
+// the playlist and forgets its state, and plays the file that took its
+// place. mpv quits when it was the last one.
+func (a *App) TrashCurrent(ctx context.Context) error {
+	a.syncIndex()
+	path := a.currentPath()
+	if path == "" {
+		return errors.New("Trash failed (no file)")
+	}
+	if IsURL(path) {
+		return errors.New("Trash: not a local file")
+	}
+	if err := trash.Move(path); err != nil {
+		return fmt.Errorf("Trash failed: %v", err)
+	}
+	_ = a.Store.Delete(path)
+	a.fullPlaylist = slices.DeleteFunc(a.fullPlaylist, func(p string) bool { return p == path })
+	i := slices.Index(a.Playlist, path)
+	if i < 0 {
+		i = a.Index
+	}
+	_ = a.MPV.Command(ctx, "playlist-remove", i)
+	if i >= 0 && i < len(a.Playlist) {
+		a.Playlist = slices.Delete(a.Playlist, i, i+1)
+	}
+	if len(a.Playlist) == 0 {
+		_ = a.MPV.Command(ctx, "quit")
+		return nil
+	}
+	a.Index = min(i, len(a.Playlist)-1)
+	_ = a.MPV.Command(ctx, "playlist-play-index", a.Index)
+	a.osd("Moved to Trash: " + filepath.Base(path))
+	return nil
 }
 
 func (a *App) eventLoop() {
@@ -626,6 +1040,14 @@ func (a *App) eventLoop() {
 		case "property-change":
 			var name string
 			_ = json.Unmarshal(ev.Raw["name"], &name)
+			a.tui.update(name, ev.Raw["data"])
+			if name == "chapter" {
+				// Files without chapters report none.
+				var n int
+				if json.Unmarshal(ev.Raw["data"], &n) == nil && n >= 0 {
+					a.osdChapter()
+				}
+			}
 			if name == "playlist-pos" {
 				// Switching can happen from mpv window keybindings; flush last sampled position
 				// so toggling back/forth resumes instead of starting from 0.
@@ -636,6 +1058,16 @@ func (a *App) eventLoop() {
 					a.Index = n
 				}
 			}
+		case "client-message":
+			// Sent by the mpv window's trash keys.
+			var args []string
+			_ = json.Unmarshal(ev.Raw["args"], &args)
+			if len(args) > 0 && args[0] == "pp_trash_current" {
+				select {
+				case a.trashKeys <- struct{}{}:
+				default:
+				}
+			}
 		case "end-file":
 			_ = a.persistPosition()
 			if !a.Continuous && !a.AutoPlay {
@@ -644,6 +1076,7 @@ func (a *App) eventLoop() {
 			}
 		case "file-loaded":
 			a.syncIndex()
+			_ = a.LoadSidecarSubtitles(context.Background())
 			_ = a.RestorePosition(context.Background())
 			if a.AutoPlay {
 				_ = a.MPV.Command(context.Background(), "set_property", "pause", false)
@@ -678,7 +1111,7 @@ func (a *App) commandMode(in *bufio.Reader) (quit bool, err error) {
 	switch cmd {
 	case "h", "help", "?":
 		a.ShowHelpOnce()
-		a.osd(":ls, :open, :seek, :jump, :n, :p, :quit")
+		a.osd(":ls, :open, :seek, :jump, :clip, :loop, :sub, :audio, :subdelay, :chapters, :chapter, :seekexact, :vol, :history, :sort, :shuffle, :unwatched, :all, :saveplaylist, :rate, :mv, :rename, :trash, :n, :p, :quit")
 		return false, nil
 	case "quit", "exit":
 		_ = a.persistPosition()
@@ -693,20 +1126,248 @@ func (a *App) commandMode(in *bufio.Reader) (quit bool, err error) {
 		a.osd(fmt.Sprintf("%d files", len(a.Playlist)))
 		return false, nil
 	case "open", "o":
-		if len(args) == 0 {
-			a.osd("open: need index or substring")
-			return false, nil
-		}
 		target := strings.Join(args, " ")
 		if i, err := strconv.Atoi(target); err == nil {
 			return false, a.Load(context.Background(), i-1)
 		}
-		i := a.findBySubstring(target)
-		if i < 0 {
-			a.osd("not found")
+		// A query that picks out one file opens it; otherwise the
+		// finder starts with it.
+		if matches := fuzzyMatches(target, a.Playlist); target != "" && len(matches) == 1 {
+			return false, a.Load(context.Background(), matches[0])
+		}
+		return false, a.openFinder(in, target)
+	case "history", "hist":
+		if len(args) == 0 {
+			a.printHistory()
+			return false, nil
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			a.osd("history: usage history | history 3")
+			return false, nil
+		}
+		if err := a.OpenHistory(context.Background(), n); err != nil {
+			a.osd(err.Error())
+		}
+		return false, nil
+	case "vol", "volume":
+		if len(args) != 1 {
+			a.osd("vol: usage vol 50 | +10 | -10")
+			return false, nil
+		}
+		v, err := strconv.ParseFloat(args[0], 64)
+		if err != nil {
+			a.osd("vol: invalid volume")
 			return false, nil
 		}
-		return false, a.Load(context.Background(), i)
+		if strings.HasPrefix(args[0], "+") || strings.HasPrefix(args[0], "-") {
+			return false, a.bumpVolume(v)
+		}
+		return false, a.setVolume(v)
+	case "seekexact":
+		on := len(args) == 0 && !a.exactSeeks()
+		if len(args) == 1 {
+			switch strings.ToLower(args[0]) {
+			case "on":
+				on = true
+			case "off":
+			default:
+				a.osd("seekexact: usage seekexact [on|off]")
+				return false, nil
+			}
+		}
+		if err := a.SetExactSeeks(on); err != nil {
+			a.osd("seekexact: " + err.Error())
+		}
+		return false, nil
+	case "chapters":
+		a.printChapters()
+		return false, nil
+	case "chapter", "ch":
+		if len(args) != 1 {
+			a.osd("chapter: usage chapter 3")
+			return false, nil
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			a.osd("chapter: invalid number")
+			return false, nil
+		}
+		if err := a.SelectChapter(context.Background(), n-1); err != nil {
+			a.osd(err.Error())
+		}
+		return false, nil
+	case "saveplaylist", "save":
+		if len(args) == 0 {
+			a.osd("saveplaylist: usage saveplaylist name.m3u")
+			return false, nil
+		}
+		if err := a.SavePlaylist(strings.Join(args, " ")); err != nil {
+			a.osd("saveplaylist: " + err.Error())
+		}
+		return false, nil
+	case "sort":
+		if len(args) != 1 {
+			a.osd("sort: usage sort " + strings.Join(SortModes, "|"))
+			return false, nil
+		}
+		if err := a.Reorder(context.Background(), strings.ToLower(args[0])); err != nil {
+			a.osd("sort: " + err.Error())
+		}
+		return false, nil
+	case "shuffle":
+		if err := a.Reorder(context.Background(), SortRandom); err != nil {
+			a.osd("shuffle: " + err.Error())
+		}
+		return false, nil
+	case "loop":
+		if len(args) != 1 {
+			a.osd("loop: usage loop file|off")
+			return false, nil
+		}
+		switch strings.ToLower(args[0]) {
+		case "file":
+			_ = a.MPV.Command(context.Background(), "set_property", "loop-file", "inf")
+			a.osd("Loop file")
+		case "off":
+			_ = a.MPV.Command(context.Background(), "set_property", "loop-file", "no")
+			_ = a.MPV.Command(context.Background(), "set_property", "ab-loop-a", "no")
+			_ = a.MPV.Command(context.Background(), "set_property", "ab-loop-b", "no")
+			a.osd("Loop off")
+		default:
+			a.osd("loop: usage loop file|off")
+		}
+		return false, nil
+	case "sub", "audio":
+		kind := cmd
+		if len(args) == 0 {
+			a.printTracks(kind)
+			return false, nil
+		}
+		id, err := strconv.Atoi(args[0])
+		if strings.EqualFold(args[0], "off") && kind == "sub" {
+			id, err = 0, nil
+		}
+		if len(args) != 1 || err != nil || id < 0 {
+			if kind == "sub" {
+				a.osd("sub: usage sub <n>|off")
+			} else {
+				a.osd("audio: usage audio <n>")
+			}
+			return false, nil
+		}
+		if err := a.SelectTrack(context.Background(), kind, id); err != nil {
+			a.osd(err.Error())
+		}
+		return false, nil
+	case "subdelay":
+		if len(args) != 1 {
+			a.osd("subdelay: usage subdelay 0.5 | -1")
+			return false, nil
+		}
+		sec, err := strconv.ParseFloat(args[0], 64)
+		if err != nil {
+			a.osd("subdelay: invalid seconds")
+			return false, nil
+		}
+		return false, a.setSubDelay(sec)
+	case "clip":
+		if len(args) == 0 {
+			if err := a.ToggleClip(context.Background()); err != nil {
+				a.osd(err.Error())
+			}
+			return false, nil
+		}
+		if len(args) != 2 {
+			a.osd("clip: usage clip 1:30 2:05 | clip (mark)")
+			return false, nil
+		}
+		start, err := parseClock(args[0])
+		if err != nil {
+			a.osd("clip: " + err.Error())
+			return false, nil
+		}
+		end, err := parseClock(args[1])
+		if err != nil {
+			a.osd("clip: " + err.Error())
+			return false, nil
+		}
+		if err := a.ClipRange(start, end); err != nil {
+			a.osd(err.Error())
+		}
+		return false, nil
+	case "mv", "move":
+		if len(args) != 1 {
+			a.osd("mv: usage mv <dir>")
+			return false, nil
+		}
+		if err := a.MoveCurrent(context.Background(), args[0]); err != nil {
+			a.osd("mv: " + err.Error())
+		}
+		return false, nil
+	case "rename":
+		if len(args) == 0 {
+			a.osd("rename: usage rename <new name>")
+			return false, nil
+		}
+		if err := a.RenameCurrent(context.Background(), strings.Join(args, " ")); err != nil {
+			a.osd("rename: " + err.Error())
+		}
+		return false, nil
+	case "trash":
+		path := a.currentPath()
+		if path == "" {
+			a.osd("trash: no file")
+			return false, nil
+		}
+		if IsURL(path) {
+			a.osd("trash: not a local file")
+			return false, nil
+		}
+		answer, ok, err := tty.ReadLine(in, fmt.Sprintf("Trash %s? [y/N] ", filepath.Base(path)))
+		if err != nil {
+			return false, err
+		}
+		if !ok || !strings.EqualFold(strings.TrimSpace(answer), "y") {
+			a.osd("Canceled")
+			return false, nil
+		}
+		if err := a.TrashCurrent(context.Background()); err != nil {
+			a.osd(err.Error())
+		}
+		return false, nil
+	case "rate":
+		stars, err := 0, error(nil)
+		if len(args) == 1 {
+			stars, err = strconv.Atoi(args[0])
+		}
+		if len(args) != 1 || err != nil || stars < 0 || stars > 5 {
+			a.osd("rate: usage rate 0-5")
+			return false, nil
+		}
+		path := a.currentPath()
+		if path == "" || !a.ResumeState {
+			a.osd("rate: not tracking files (--no-resume)")
+			return false, nil
+		}
+		a.Store.SetRating(path, stars)
+		_ = a.Store.Save()
+		if stars == 0 {
+			a.osd("Rating cleared")
+		} else {
+			a.osd("Rated " + strings.Repeat("★", stars))
+		}
+		return false, nil
+	case "unwatched":
+		if err := a.FilterUnwatched(context.Background()); err != nil {
+			a.osd("unwatched: " + err.Error())
+		}
+		return false, nil
+	case "all":
+		if err := a.ShowAll(context.Background()); err != nil {
+			a.osd("all: " + err.Error())
+		}
+		return false, nil
 	case "seek":
 		if len(args) != 1 {
 			a.osd("seek: usage seek +10 | -10")
@@ -758,24 +1419,57 @@ func (a *App) commandMode(in *bufio.Reader) (quit bool, err error) {
 
 func (a *App) printPlaylist() {
 	fmt.Fprintln(os.Stdout, "\nPlaylist:")
-	for i, p := range a.Playlist {
-		prefix := "  "
-		if i == a.Index {
-			prefix = "→ "
-		}
-		fmt.Fprintf(os.Stdout, "%s%3d  %s\n", prefix, i+1, filepath.Base(p))
+	for i := range a.Playlist {
+		fmt.Fprintln(os.Stdout, a.playlistLine(i))
 	}
 	fmt.Fprintln(os.Stdout)
 }
 
-func (a *App) findBySubstring(q string) int {
-	q = strings.ToLower(q)
-	for i, p := range a.Playlist {
-		if strings.Contains(strings.ToLower(filepath.Base(p)), q) {
-			return i
-		}
+// playlistLine describes playlist entry i for :ls and the TUI.
+func (a *App) playlistLine(i int) string {
+	p := a.Playlist[i]
+	prefix := "  "
+	if i == a.Index {
+		prefix = "→ "
+	}
+	// ✓ marks watched files, a percentage the ones started.
+	mark := ""
+	if st, ok := a.Store.State(p); ok && st.Watched {
+		mark = "✓"
+	} else if ok && st.Percent >= 1 {
+		mark = fmt.Sprintf("%.0f%%", st.Percent)
+	}
+	stars := ""
+	if st, ok := a.Store.State(p); ok && st.Rating > 0 {
+		stars = "  " + strings.Repeat("★", st.Rating)
+	}
+	return fmt.Sprintf("%s%3d %4s  %s%s", prefix, i+1, mark, displayName(p), stars)
+}
+
+// openFinder opens the file picked in the finder, starting with query.
+func (a *App) openFinder(in *bufio.Reader, query string) error {
+	i, ok, err := a.pickFile(in, query)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		a.osd("Canceled")
+		return nil
+	}
+	return a.Load(context.Background(), i)
+}
+
+// currentPath returns the file mpv is playing, or the playlist entry at
+// Index if mpv does not say.
+func (a *App) currentPath() string {
+	path, err := a.MPV.GetString(withTimeout(300*time.Millisecond), "path")
+	if err == nil && path != "" {
+		return path
+	}
+	if a.Index >= 0 && a.Index < len(a.Playlist) {
+		return a.Playlist[a.Index]
 	}
-	return -1
+	return ""
 }
 
 func (a *App) syncIndex() {
@@ -786,7 +1480,7 @@ func (a *App) syncIndex() {
 }
 
 func (a *App) periodicSaveLoop() {
-	if !a.ResumeState || a.Timestamps == nil {
+	if !a.ResumeState || a.Store == nil {
 		return
 	}
 	t := time.NewTicker(1 * time.Second)
@@ -805,10 +1499,12 @@ func (a *App) sampleAndMaybeSave() {
 	if err != nil || pos < 0 {
 		return
 	}
+	duration, _ := a.MPV.GetFloat(withTimeout(200*time.Millisecond), "duration")
 
 	a.lastMu.Lock()
 	a.lastSamplePath = path
 	a.lastSamplePos = pos
+	a.lastSampleDuration = duration
 	shouldSave := time.Since(a.lastSavedAt) >= 3*time.Second
 	if shouldSave {
 		a.lastSavedAt = time.Now()
@@ -816,25 +1512,26 @@ func (a *App) sampleAndMaybeSave() {
 	a.lastMu.Unlock()
 
 	// Keep in-memory store fresh; persist to disk every few seconds.
-	a.Timestamps.Set(path, pos)
+	a.Store.SetProgress(path, pos, duration)
 	if shouldSave {
-		_ = a.Timestamps.Save()
+		_ = a.Store.Save()
 	}
 }
 
 func (a *App) flushLastSample() error {
-	if !a.ResumeState || a.Timestamps == nil {
+	if !a.ResumeState || a.Store == nil {
 		return nil
 	}
 	a.lastMu.Lock()
 	path := a.lastSamplePath
 	pos := a.lastSamplePos
+	duration := a.lastSampleDuration
 	a.lastMu.Unlock()
 	if path == "" || pos < 0 {
 		return nil
 	}
-	a.Timestamps.Set(path, pos)
-	return a.Timestamps.Save()
+	a.Store.SetProgress(path, pos, duration)
+	return a.Store.Save()
 }
 
 func splitCmd(s string) []string {
@@ -0,0 +1,91 @@
+package pp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// chapter is an entry of mpv's chapter-list.
+type chapter struct {
+	Title string  `json:"title"`
+	Time  float64 `json:"time"`
+}
+
+// chapters returns the chapters of the current file.
+func (a *App) chapters() []chapter {
+	data, err := a.MPV.CommandData(withTimeout(300*time.Millisecond), "get_property", "chapter-list")
+	if err != nil {
+		return nil
+	}
+	var out []chapter
+	_ = json.Unmarshal(data, &out)
+	return out
+}
+
+// StepChapter goes delta chapters forward or back. Going back from the
+// first chapter restarts it, and going past the last one does nothing.
+func (a *App) StepChapter(ctx context.Context, delta int) error {
+	chapters := a.chapters()
+	if len(chapters) == 0 {
+		a.osd("No chapters")
+		return nil
+	}
+	cur, err := a.MPV.GetInt(withTimeout(250*time.Millisecond), "chapter")
+	if err != nil {
+		cur = -1
+	}
+	next := max(0, cur+delta)
+	if next >= len(chapters) {
+		a.osd("Last chapter")
+		return nil
+	}
+	return a.SelectChapter(ctx, next)
+}
+
+// SelectChapter jumps to chapter i (0-based). mpv reports the new chapter,
+// which the event loop shows on the OSD.
+func (a *App) SelectChapter(ctx context.Context, i int) error {
+	if n := len(a.chapters()); i < 0 || i >= n {
+		return fmt.Errorf("no chapter %d (%d chapters)", i+1, n)
+	}
+	return a.MPV.Command(ctx, "set_property", "chapter", i)
+}
+
+// osdChapter shows the title of the current chapter.
+func (a *App) osdChapter() {
+	chapters := a.chapters()
+	cur, err := a.MPV.GetInt(withTimeout(250*time.Millisecond), "chapter")
+	if err != nil || cur < 0 || cur >= len(chapters) {
+		return
+	}
+	msg := fmt.Sprintf("Chapter %d/%d", cur+1, len(chapters))
+	if title := chapters[cur].Title; title != "" {
+		msg += ": " + title
+	}
+	a.osd(msg)
+}
+
+// printChapters lists the chapters of the current file in the terminal.
+func (a *App) printChapters() {
+	chapters := a.chapters()
+	cur, err := a.MPV.GetInt(withTimeout(250*time.Millisecond), "chapter")
+	if err != nil {
+		cur = -1
+	}
+	fmt.Fprintln(os.Stdout, "\nChapters:")
+	for i, c := range chapters {
+		prefix := "  "
+		if i == cur {
+			prefix = "→ "
+		}
+		fmt.Fprintf(os.Stdout, "%s%3d  %8s  %s\n", prefix, i+1, formatClock(c.Time), c.Title)
+	}
+	if len(chapters) == 0 {
+		fmt.Fprintln(os.Stdout, "  (none)")
+	}
+	fmt.Fprintln(os.Stdout)
+	a.osd(fmt.Sprintf("%d chapters", len(chapters)))
+}
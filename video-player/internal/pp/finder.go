@@ -0,0 +1,184 @@
+package pp
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"video-player/internal/tty"
+)
+
+// finderRows is how many matches the finder shows at once.
+const finderRows = 10
+
+// fuzzyScore scores how well term matches path: its runes have to appear
+// in path in order, and runs of them, word starts and the file name score
+// higher.
+func fuzzyScore(term, path string) (int, bool) {
+	path = strings.ToLower(path)
+	full, ok := subsequenceScore([]rune(term), []rune(path))
+	if !ok {
+		return 0, false
+	}
+	if base, ok := subsequenceScore([]rune(term), []rune(filepath.Base(path))); ok && base+10 > full {
+		return base + 10, true
+	}
+	return full, true
+}
+
+func subsequenceScore(term, target []rune) (int, bool) {
+	score, prev, ti := 0, -2, 0
+	for _, r := range term {
+		for ti < len(target) && target[ti] != r {
+			ti++
+		}
+		if ti == len(target) {
+			return 0, false
+		}
+		score++
+		if ti == prev+1 {
+			score += 5
+		}
+		if ti == 0 || strings.ContainsRune(`/\_-. []()`, target[ti-1]) {
+			score += 3
+		}
+		prev = ti
+		ti++
+	}
+	return score, true
+}
+
+// fuzzyMatches returns the indexes of the paths every term of query
+// matches, best first. Paths are matched as displayPath shows them, so
+// that the folder pp runs in does not match. An empty query matches every
+// path in order.
+func fuzzyMatches(query string, paths []string) []int {
+	terms := strings.Fields(strings.ToLower(query))
+	type match struct{ i, score int }
+	var matches []match
+	for i, p := range paths {
+		p = displayPath(p)
+		total, ok := 0, true
+		for _, term := range terms {
+			var score int
+			if score, ok = fuzzyScore(term, p); !ok {
+				break
+			}
+			total += score
+		}
+		if ok {
+			matches = append(matches, match{i, total})
+		}
+	}
+	sort.SliceStable(matches, func(a, b int) bool { return matches[a].score > matches[b].score })
+	out := make([]int, len(matches))
+	for i, m := range matches {
+		out[i] = m.i
+	}
+	return out
+}
+
+// pickFile searches the playlist as query is typed and returns the index
+// of the file picked with Enter, or false if Esc cancels.
+func (a *App) pickFile(in *bufio.Reader, query string) (int, bool, error) {
+	width := tty.Width()
+	sel, drawn := 0, 0
+	for {
+		matches := fuzzyMatches(query, a.Playlist)
+		sel = max(0, min(sel, len(matches)-1))
+		drawn = a.drawFinder(query, matches, sel, drawn, width)
+
+		k, err := tty.ReadKey(in)
+		if err != nil {
+			return 0, false, err
+		}
+		switch k.Kind {
+		case tty.KeyQuit:
+			clearLines(drawn)
+			return 0, false, nil
+		case tty.KeyUp:
+			sel--
+		case tty.KeyDown:
+			sel++
+		case tty.KeySpace:
+			query += " "
+			sel = 0
+		case tty.KeyRune:
+			switch {
+			case k.Rune == '\n' || k.Rune == '\r':
+				clearLines(drawn)
+				if len(matches) == 0 {
+					return 0, false, nil
+				}
+				return matches[sel], true, nil
+			case k.Rune == 0x7f || k.Rune == 0x08:
+				if r := []rune(query); len(r) > 0 {
+					query = string(r[:len(r)-1])
+				}
+				sel = 0
+			case k.Rune >= 0x20:
+				query += string(k.Rune)
+				sel = 0
+			}
+		}
+	}
+}
+
+// drawFinder redraws the finder over the drawn lines it printed last
+// time, and returns how many lines it printed this time.
+func (a *App) drawFinder(query string, matches []int, sel, drawn, width int) int {
+	clearLines(drawn)
+	var b strings.Builder
+	lines := 0
+	fmt.Fprintf(&b, "%d/%d files  ↑/↓ select  Enter open  Esc cancel\n", len(matches), len(a.Playlist))
+	lines++
+	first := max(0, min(sel-finderRows/2, len(matches)-finderRows))
+	for row := first; row < len(matches) && row < first+finderRows; row++ {
+		i := matches[row]
+		prefix := "  "
+		if row == sel {
+			prefix = "→ "
+		}
+		line := fmt.Sprintf("%s%3d  %s", prefix, i+1, displayPath(a.Playlist[i]))
+		fmt.Fprintln(&b, truncateMiddle(line, width-1, 7))
+		lines++
+	}
+	fmt.Fprintf(&b, "open> %s", query)
+	_, _ = os.Stdout.WriteString(b.String())
+	return lines
+}
+
+// clearLines erases the lines above the cursor and the current one.
+func clearLines(n int) {
+	_, _ = os.Stdout.WriteString("\r")
+	if n > 0 {
+		fmt.Fprintf(os.Stdout, "\x1b[%dA", n)
+	}
+	_, _ = os.Stdout.WriteString("\x1b[J")
+}
+
+// displayPath shortens path to be relative to the working directory when
+// it is inside it.
+func displayPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
+
+// truncateMiddle shortens line to width runes by cutting the runes after
+// the first keep ones, so that the end of a path stays visible.
+func truncateMiddle(line string, width, keep int) string {
+	r := []rune(line)
+	if width <= keep+1 || len(r) <= width {
+		return line
+	}
+	return string(r[:keep]) + "…" + string(r[len(r)-(width-keep-1):])
+}
@@ -0,0 +1,90 @@
+package pp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// historyRows is how many files :history lists.
+const historyRows = 20
+
+// printHistory lists the files played last, from this and earlier
+// sessions, in the terminal.
+func (a *App) printHistory() {
+	// Pick up what other pp instances played since the store was loaded.
+	if a.Store.Save() == nil {
+		_ = a.Store.Load()
+	}
+	a.history = a.Store.History()
+	if len(a.history) > historyRows {
+		a.history = a.history[:historyRows]
+	}
+	fmt.Fprintln(os.Stdout, "\nHistory:")
+	for i, e := range a.history {
+		mark := ""
+		if e.Watched {
+			mark = "✓"
+		} else if e.Percent >= 1 {
+			mark = fmt.Sprintf("%.0f%%", e.Percent)
+		}
+		where := ""
+		if !IsURL(e.Path) {
+			where = "  (" + filepath.Dir(displayPath(e.Path)) + ")"
+		}
+		fmt.Fprintf(os.Stdout, "  %3d  %s %4s  %s%s\n", i+1, e.LastPlayed.Format("2006-01-02 15:04"), mark, displayName(e.Path), where)
+	}
+	if len(a.history) == 0 {
+		fmt.Fprintln(os.Stdout, "  (none)")
+	}
+	fmt.Fprintln(os.Stdout)
+	a.osd(fmt.Sprintf("%d recent files (:history N to open)", len(a.history)))
+}
+
+// OpenHistory opens entry n (1-based) of the last :history list. A file
+// outside the playlist replaces it with the files of its folder.
+func (a *App) OpenHistory(ctx context.Context, n int) error {
+	if a.history == nil {
+		a.history = a.Store.History()
+	}
+	if n < 1 || n > len(a.history) {
+		return fmt.Errorf("no history entry %d", n)
+	}
+	path := a.history[n-1].Path
+	if i := slices.Index(a.Playlist, path); i >= 0 {
+		return a.Load(ctx, i)
+	}
+	return a.OpenFolder(ctx, path)
+}
+
+// OpenFolder plays path, with the files of its folder as the playlist. A
+// URL plays on its own.
+func (a *App) OpenFolder(ctx context.Context, path string) error {
+	files, start, err := BuildPlaylist(path, false)
+	if err != nil {
+		return err
+	}
+	_ = a.persistPosition()
+
+	// Play path right away, then add the rest of its folder around it.
+	if err := a.MPV.Command(ctx, "loadfile", path, "replace"); err != nil {
+		return err
+	}
+	for i, f := range files {
+		if i != start {
+			_ = a.MPV.Command(ctx, "loadfile", f, "append")
+		}
+	}
+	if start > 0 {
+		// playlist-move puts entry 0 in front of entry start+1.
+		_ = a.MPV.Command(ctx, "playlist-move", 0, start+1)
+	}
+	a.Playlist, a.Index, a.fullPlaylist = files, start, nil
+	a.osd(fmt.Sprintf("Open %s (%d/%d)", displayName(path), start+1, len(files)))
+	if !a.Continuous {
+		a.pauseAfterLoad = false
+	}
+	return nil
+}
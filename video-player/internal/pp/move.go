@@ -0,0 +1,155 @@
+package pp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// MoveCurrent moves the current file into dir, created if missing. A
+// relative dir is taken from the folder the file is in, so that ":mv keep"
+// files it next to the others.
+func (a *App) MoveCurrent(ctx context.Context, dir string) error {
+	path, err := a.localPath()
+	if err != nil {
+		return err
+	}
+	dir, err = expandHome(dir)
+	if err != nil {
+		return err
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(filepath.Dir(path), dir)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return a.relocate(ctx, path, filepath.Join(dir, filepath.Base(path)), "Moved to "+filepath.Base(dir))
+}
+
+// RenameCurrent renames the current file within its folder, keeping its
+// extension if name has none.
+func (a *App) RenameCurrent(ctx context.Context, name string) error {
+	path, err := a.localPath()
+	if err != nil {
+		return err
+	}
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return fmt.Errorf("invalid name %q", name)
+	}
+	if filepath.Ext(name) == "" {
+		name += filepath.Ext(path)
+	}
+	return a.relocate(ctx, path, filepath.Join(filepath.Dir(path), name), "Renamed to "+name)
+}
+
+// expandHome replaces a leading ~/ in path with the home folder.
+func expandHome(path string) (string, error) {
+	if !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, path[2:]), nil
+}
+
+func (a *App) localPath() (string, error) {
+	a.syncIndex()
+	path := a.currentPath()
+	if path == "" {
+		return "", errors.New("no file")
+	}
+	if IsURL(path) {
+		return "", errors.New("not a local file")
+	}
+	return path, nil
+}
+
+// relocate moves the current file from path to dest on disk, in the
+// playlists and in the state store, and keeps playing it where it was.
+func (a *App) relocate(ctx context.Context, path, dest, done string) error {
+	if dest == path {
+		return nil
+	}
+	if _, err := os.Lstat(dest); err == nil {
+		return fmt.Errorf("%s already exists", dest)
+	}
+	pos, posErr := a.MPV.GetFloat(withTimeout(300*time.Millisecond), "time-pos")
+	if err := moveFile(path, dest); err != nil {
+		return err
+	}
+
+	// The state follows the file, so RestorePosition resumes the new
+	// entry where the old one was.
+	a.Store.Move(path, dest)
+	if posErr == nil && pos > 0 {
+		a.Store.Set(dest, pos)
+	}
+	_ = a.Store.Save()
+	if i := slices.Index(a.fullPlaylist, path); i >= 0 {
+		a.fullPlaylist[i] = dest
+	}
+
+	// mpv cannot rename an entry: add the new path after the old one,
+	// then remove the old one and play the new one in its place.
+	i := slices.Index(a.Playlist, path)
+	if i < 0 {
+		i = a.Index
+	}
+	if err := a.MPV.Command(ctx, "loadfile", dest, "append"); err != nil {
+		return err
+	}
+	if n, err := a.MPV.GetInt(withTimeout(300*time.Millisecond), "playlist-count"); err == nil && n-1 != i+1 {
+		_ = a.MPV.Command(ctx, "playlist-move", n-1, i+1)
+	}
+	_ = a.MPV.Command(ctx, "playlist-remove", i)
+	_ = a.MPV.Command(ctx, "playlist-play-index", i)
+	if i >= 0 && i < len(a.Playlist) {
+		a.Playlist[i] = dest
+	}
+	a.Index = i
+	a.playedPath = dest
+	a.osd(done)
+	return nil
+}
+
+// moveFile renames path to dest, copying it when they are on different
+// file systems.
+func moveFile(path, dest string) error {
+	err := os.Rename(path, dest)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(dest)
+		return err
+	}
+	_ = os.Chtimes(dest, info.ModTime(), info.ModTime())
+	return os.Remove(path)
+}
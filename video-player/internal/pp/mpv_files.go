@@ -9,8 +9,10 @@ import (
 	"time"
 )
 
-func WriteTempPlaylist(files []string) (path string, cleanup func(), err error) {
-	dir := os.TempDir()
+func WriteTempPlaylist(dir string, files []string) (path string, cleanup func(), err error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
 	name := "pp-playlist-" + strconv.FormatInt(time.Now().UnixNano(), 10) + ".m3u"
 	path = filepath.Join(dir, name)
 	content := strings.Join(files, "\n") + "\n"
@@ -26,8 +28,10 @@ type KeybindOptions struct {
 	SeekLongS  float64
 }
 
-func WriteTempInputConf(opts KeybindOptions) (path string, cleanup func(), err error) {
-	dir := os.TempDir()
+func WriteTempInputConf(dir string, opts KeybindOptions) (path string, cleanup func(), err error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
 	name := "pp-input-" + strconv.FormatInt(time.Now().UnixNano(), 10) + ".conf"
 	path = filepath.Join(dir, name)
 	// Keep bindings simple and mpv-native so they work when the mpv window is focused.
@@ -39,7 +43,12 @@ UP    seek +%s relative
 DOWN  seek -%s relative
 
 z     seek -%s relative
-c     seek +%s relative
+
+c no-osd add chapter 1
+C no-osd add chapter -1
+
+. frame-step
+, frame-back-step
 
 a     seek -%s relative
 d     seek +%s relative
@@ -51,9 +60,11 @@ j     seek -%s relative
 q script-message pp_prev_wrap
 e script-message pp_next_wrap
 h script-message pp_prev_wrap
-l script-message pp_next_wrap
 ENTER script-message pp_next_wrap
 
+l ab-loop
+L no-osd set ab-loop-a no; no-osd set ab-loop-b no; show-text "Loop cleared"
+
 b script-message pp_browser_toggle
 B script-message pp_browser_toggle
 
@@ -67,13 +78,19 @@ T script-message pp_trim_toggle
 BS  script-message pp_trash_current
 DEL script-message pp_trash_current
 
+v cycle sub
+V cycle audio
+( add sub-delay -0.1
+) add sub-delay 0.1
+
 m cycle mute
 [ add speed -0.1
 ] add speed 0.1
 
+= add volume 5
+- add volume -5
+
 + add window-scale 0.1
-= add window-scale 0.1
-- add window-scale -0.1
 _ add window-scale -0.1
 
 1 seek 10 absolute-percent
@@ -95,7 +112,6 @@ ESC quit
 		formatSeekSeconds(opts.SeekLongS),
 		formatSeekSeconds(opts.SeekLongS),
 		formatSeekSeconds(opts.SeekFineS),
-		formatSeekSeconds(opts.SeekFineS),
 		formatSeekSeconds(opts.SeekShortS),
 		formatSeekSeconds(opts.SeekShortS),
 		formatSeekSeconds(opts.SeekLongS),
@@ -120,8 +136,10 @@ func formatSeekSeconds(v float64) string {
 	return s
 }
 
-func WriteTempBrowserScript() (path string, cleanup func(), err error) {
-	dir := os.TempDir()
+func WriteTempBrowserScript(dir string) (path string, cleanup func(), err error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
 	name := "pp-browser-" + strconv.FormatInt(time.Now().UnixNano(), 10) + ".lua"
 	path = filepath.Join(dir, name)
 
@@ -133,7 +151,6 @@ local utils = require 'mp.utils'
 local active = false
 local sel = 0
 local win = 13
-local pending_trash_until = 0
 
 local function basename(p)
   if p == nil then return "" end
@@ -296,32 +313,14 @@ local function mkdir_p(path)
 end
 
 local function screenshot()
-  local wd = mp.get_property("working-directory")
-  if wd == nil or wd == "" then
-    mp.osd_message("Snapshot failed (no wd)", 1.5)
-    return
+  -- pp sets screenshot-directory and screenshot-template at startup.
+  mkdir_p(mp.get_property("screenshot-directory"))
+  local res = mp.command_native({ "screenshot", "video" })
+  if res == nil then
+    mp.osd_message("Snapshot failed", 1.5)
+  elseif res.filename then
+    mp.osd_message("Saved: " .. basename(res.filename), 1.5)
   end
-
-  local dir = utils.join_path(wd, "snapshots")
-  mkdir_p(dir)
-
-  local p = mp.get_property("path") or ""
-  local base = basename(p)
-  base = string.gsub(base, "%.%w+$", "")
-  if base == "" then base = "snapshot" end
-
-  local pos = mp.get_property_number("time-pos", 0) or 0
-  if pos < 0 then pos = 0 end
-  local ms = math.floor(pos * 1000 + 0.5)
-  local h = math.floor(ms / 3600000)
-  local m = math.floor(ms / 60000) % 60
-  local s = math.floor(ms / 1000) % 60
-  local mmm = ms % 1000
-  local name = string.format("%s_%02dh%02dm%02ds%03dms.jpg", base, h, m, s, mmm)
-  local out = utils.join_path(dir, name)
-
-  mp.commandv("screenshot-to-file", out, "video")
-  mp.osd_message("Saved: " .. name, 1.5)
 end
 
 mp.register_script_message("pp_screenshot", screenshot)
@@ -509,57 +508,6 @@ local function trim_toggle()
 end
 
 mp.register_script_message("pp_trim_toggle", trim_toggle)
-
-local function applescript_escape(s)
-  s = string.gsub(s, "\\", "\\\\")
-  s = string.gsub(s, "\"", "\\\"")
-  return s
-end
-
-local function trash_current()
-  local now = mp.get_time()
-  if now < pending_trash_until then
-    pending_trash_until = 0
-  else
-    pending_trash_until = now + 2.0
-    mp.osd_message("Trash file? Press Backspace/Delete again to confirm", 2.0)
-    return
-  end
-
-  local p = mp.get_property("path")
-  if not is_probably_local_file(p) then
-    mp.osd_message("Trash: not a local file", 1.5)
-    return
-  end
-
-  local pos = mp.get_property_number("playlist-pos", 0)
-  local count = mp.get_property_number("playlist-count", 0)
-
-  local script = 'tell application "Finder" to delete POSIX file "' .. applescript_escape(p) .. '"'
-  local res = utils.subprocess({ args = { "osascript", "-e", script } })
-  if res.error ~= nil then
-    mp.osd_message("Trash failed: " .. tostring(res.error), 2.0)
-    return
-  end
-  if res.status ~= 0 then
-    mp.osd_message("Trash failed", 2.0)
-    return
-  end
-
-  mp.commandv("playlist-remove", pos)
-  mp.osd_message("Moved to Trash: " .. basename(p), 1.5)
-
-  local newCount = count - 1
-  if newCount <= 0 then
-    mp.commandv("quit")
-    return
-  end
-  if pos >= newCount then pos = newCount - 1 end
-  if pos < 0 then pos = 0 end
-  mp.commandv("playlist-play-index", pos)
-end
-
-mp.register_script_message("pp_trash_current", trash_current)
 `)
 	script += "\n"
 
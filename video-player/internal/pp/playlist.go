@@ -1,7 +1,10 @@
 package pp
 
 import (
+	"bytes"
 	"fmt"
+	"math/rand"
+	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
@@ -19,7 +22,48 @@ var videoExts = map[string]bool{
 	".m4v":  true,
 }
 
+// listExts are the extensions of playlist files read by BuildPlaylist.
+var listExts = map[string]bool{
+	".m3u":  true,
+	".m3u8": true,
+	".txt":  true,
+}
+
+// IsURL reports whether path is a URL, such as a stream or a page mpv plays
+// with yt-dlp, rather than a local file. URLs are never stat'ed, moved or
+// trashed.
+func IsURL(path string) bool {
+	scheme, _, ok := strings.Cut(path, "://")
+	return ok && scheme != "" && !strings.ContainsAny(scheme, `/\.`)
+}
+
+// displayName is the short name of a playlist entry: the file name of a
+// local file, or a URL without its scheme.
+func displayName(path string) string {
+	if IsURL(path) {
+		_, rest, _ := strings.Cut(path, "://")
+		return strings.TrimPrefix(rest, "www.")
+	}
+	return filepath.Base(path)
+}
+
+// BuildPlaylist returns the videos of the folder path is in, or that path
+// is, and the index of path among them. A URL plays on its own, and a
+// playlist file gives the entries it lists, in order.
 func BuildPlaylist(path string, latest bool) (files []string, startIndex int, err error) {
+	if IsURL(path) {
+		return []string{path}, 0, nil
+	}
+	if listExts[strings.ToLower(filepath.Ext(path))] {
+		files, err := ReadPlaylistFile(path)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(files) == 0 {
+			return nil, 0, fmt.Errorf("no entries in %s", path)
+		}
+		return files, 0, nil
+	}
 	path, err = filepath.Abs(path)
 	if err != nil {
 		return nil, 0, err
@@ -51,17 +95,9 @@ func BuildPlaylist(path string, latest bool) (files []string, startIndex int, er
 		files = append(files, filepath.Join(dir, e.Name()))
 	}
 	if latest {
-		// Sort by modification time, most recent first
-		sort.Slice(files, func(i, j int) bool {
-			infoI, errI := os.Stat(files[i])
-			infoJ, errJ := os.Stat(files[j])
-			if errI != nil || errJ != nil {
-				return files[i] < files[j]
-			}
-			return infoI.ModTime().After(infoJ.ModTime())
-		})
+		_ = SortPlaylist(files, SortMtime)
 	} else {
-		sort.Strings(files)
+		_ = SortPlaylist(files, SortName)
 	}
 	if len(files) == 0 {
 		return nil, 0, fmt.Errorf("no video files found in %s", dir)
@@ -75,3 +111,107 @@ func BuildPlaylist(path string, latest bool) (files []string, startIndex int, er
 	}
 	return files, 0, nil
 }
+
+// ReadPlaylistFile reads a list of files and URLs, one per line, such as an
+// M3U playlist. Blank lines and lines starting with # (M3U's directives)
+// are skipped, and relative paths are taken from the folder of the list.
+func ReadPlaylistFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if u, err := url.Parse(line); err == nil && u.Scheme == "file" {
+			line = filepath.FromSlash(u.Path)
+		}
+		if !IsURL(line) && !filepath.IsAbs(line) {
+			line = filepath.Join(dir, line)
+		}
+		files = append(files, line)
+	}
+	return files, nil
+}
+
+// WritePlaylistFile saves files to path as an M3U playlist, or as a plain
+// list if path ends in .txt. Files in the folder of path or below are
+// written relative to it, so that the playlist still works when the folder
+// moves.
+func WritePlaylistFile(path string, files []string) error {
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	if strings.ToLower(filepath.Ext(path)) != ".txt" {
+		b.WriteString("#EXTM3U\n")
+	}
+	for _, f := range files {
+		if !IsURL(f) {
+			if rel, err := filepath.Rel(dir, f); err == nil && !strings.HasPrefix(rel, "..") {
+				f = rel
+			}
+		}
+		b.WriteString(f + "\n")
+	}
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
+
+// Playlist orders for SortPlaylist.
+const (
+	SortName   = "name"   // by path
+	SortMtime  = "mtime"  // most recently modified first
+	SortSize   = "size"   // largest first
+	SortRandom = "random" // shuffled
+)
+
+var SortModes = []string{SortName, SortMtime, SortSize, SortRandom}
+
+// SortPlaylist orders files in place. Files that cannot be stat'ed, such
+// as URLs, sort by path after the others.
+func SortPlaylist(files []string, mode string) error {
+	switch mode {
+	case SortName:
+		sort.Strings(files)
+	case SortMtime, SortSize:
+		infos := make(map[string]os.FileInfo, len(files))
+		for _, f := range files {
+			if IsURL(f) {
+				continue
+			}
+			if info, err := os.Stat(f); err == nil {
+				infos[f] = info
+			}
+		}
+		sort.SliceStable(files, func(i, j int) bool {
+			infoI, infoJ := infos[files[i]], infos[files[j]]
+			if infoI == nil || infoJ == nil {
+				if (infoI == nil) != (infoJ == nil) {
+					return infoJ == nil
+				}
+				return files[i] < files[j]
+			}
+			if mode == SortSize {
+				if infoI.Size() != infoJ.Size() {
+					return infoI.Size() > infoJ.Size()
+				}
+				return files[i] < files[j]
+			}
+			return infoI.ModTime().After(infoJ.ModTime())
+		})
+	case SortRandom:
+		rand.Shuffle(len(files), func(i, j int) { files[i], files[j] = files[j], files[i] })
+	default:
+		return fmt.Errorf("unknown sort %q (want %s)", mode, strings.Join(SortModes, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,362 @@
+package pp
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// WatchedPercent is how far into a file playback has to get for the file
+// to count as watched.
+const WatchedPercent = 90
+
+// FileState is what is remembered of a file: where playback stopped, how
+// much of it has been played, when it was played, its rating and the mpv
+// properties set for it.
+type FileState struct {
+	Pos        float64            `json:"pos"`
+	Percent    float64            `json:"percent,omitempty"`
+	Watched    bool               `json:"watched,omitempty"`
+	LastPlayed time.Time          `json:"last_played,omitempty"`
+	Plays      int                `json:"plays,omitempty"`
+	Rating     int                `json:"rating,omitempty"`
+	Settings   map[string]float64 `json:"settings,omitempty"`
+}
+
+var filesBucket = []byte("files")
+
+// StateStore keeps a FileState per path in a bbolt database. Changes are
+// kept in memory and written by Save, which opens the database only for as
+// long as it takes to apply them on top of what is stored, so that several
+// pp instances can share it without losing each other's changes.
+type StateStore struct {
+	path string // empty => in-memory only (no persistence)
+
+	// LegacyPath is the JSON file of older versions, imported when the
+	// database is first created.
+	LegacyPath string
+
+	mu      sync.Mutex
+	m       map[string]FileState
+	pending map[string][]func(*FileState)
+}
+
+func NewStateStore(path string) *StateStore {
+	return &StateStore{
+		path:    path,
+		m:       map[string]FileState{},
+		pending: map[string][]func(*FileState){},
+	}
+}
+
+func (s *StateStore) open() (*bolt.DB, error) {
+	// Another instance holds the lock only while it saves.
+	return bolt.Open(s.path, 0o644, &bolt.Options{Timeout: 2 * time.Second})
+}
+
+// Load reads every stored FileState, importing LegacyPath into a new
+// database first.
+func (s *StateStore) Load() error {
+	if s == nil || s.path == "" {
+		return nil
+	}
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	m := map[string]FileState{}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(filesBucket)
+		if b == nil {
+			if b, err = tx.CreateBucket(filesBucket); err != nil {
+				return err
+			}
+			if err := importLegacy(b, s.LegacyPath); err != nil {
+				return err
+			}
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var st FileState
+			if json.Unmarshal(v, &st) == nil {
+				m[string(k)] = st
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m = m
+	return nil
+}
+
+// importLegacy copies the JSON file at path into b. Older files hold a bare
+// position per file.
+func importLegacy(b *bolt.Bucket, path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var raw map[string]json.RawMessage
+	_ = json.Unmarshal(data, &raw)
+	for file, v := range raw {
+		var st FileState
+		if err := json.Unmarshal(v, &st); err != nil {
+			if err := json.Unmarshal(v, &st.Pos); err != nil {
+				continue
+			}
+		}
+		enc, err := json.Marshal(st)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte(file), enc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Save writes the changes made since the last Save.
+func (s *StateStore) Save() error {
+	if s == nil || s.path == "" {
+		return nil
+	}
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = map[string][]func(*FileState){}
+	s.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	saved := map[string]FileState{}
+	db, err := s.open()
+	if err == nil {
+		err = db.Update(func(tx *bolt.Tx) error {
+			b, err := tx.CreateBucketIfNotExists(filesBucket)
+			if err != nil {
+				return err
+			}
+			for path, ops := range pending {
+				// Apply the changes to the stored state, which another
+				// instance may have changed since it was loaded.
+				var st FileState
+				if v := b.Get([]byte(path)); v != nil {
+					_ = json.Unmarshal(v, &st)
+				}
+				for _, op := range ops {
+					op(&st)
+				}
+				enc, err := json.Marshal(st)
+				if err != nil {
+					return err
+				}
+				if err := b.Put([]byte(path), enc); err != nil {
+					return err
+				}
+				saved[path] = st
+			}
+			return nil
+		})
+		if cerr := db.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		// Keep the changes for the next Save.
+		for path, ops := range pending {
+			s.pending[path] = append(ops, s.pending[path]...)
+		}
+		return err
+	}
+	for path, st := range saved {
+		for _, op := range s.pending[path] {
+			op(&st)
+		}
+		s.m[path] = st
+	}
+	return nil
+}
+
+// update applies op to the state of path now and to the stored state on
+// the next Save.
+func (s *StateStore) update(path string, op func(*FileState)) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.m[path]
+	op(&st)
+	s.m[path] = st
+	if s.path != "" {
+		s.pending[path] = append(s.pending[path], op)
+	}
+}
+
+func (s *StateStore) Get(path string) (float64, bool) {
+	st, ok := s.State(path)
+	return st.Pos, ok
+}
+
+func (s *StateStore) Set(path string, sec float64) {
+	s.update(path, func(st *FileState) { st.Pos = sec })
+}
+
+// SetProgress records the position of path out of its duration, marking
+// the file watched once playback gets past WatchedPercent. A watched file
+// stays watched when it is played again.
+func (s *StateStore) SetProgress(path string, sec, duration float64) {
+	s.update(path, func(st *FileState) {
+		st.Pos = sec
+		if duration > 0 {
+			st.Percent = min(100, sec/duration*100)
+			if st.Percent >= WatchedPercent {
+				st.Watched = true
+			}
+		}
+	})
+}
+
+// MarkPlayed records that path started playing now.
+func (s *StateStore) MarkPlayed(path string) {
+	now := time.Now()
+	s.update(path, func(st *FileState) {
+		st.LastPlayed = now
+		st.Plays++
+	})
+}
+
+// SetRating rates path from 1 to 5 stars, or clears its rating with 0.
+func (s *StateStore) SetRating(path string, stars int) {
+	s.update(path, func(st *FileState) { st.Rating = stars })
+}
+
+// SetSetting remembers the value of an mpv property for path.
+func (s *StateStore) SetSetting(path, name string, v float64) {
+	s.update(path, func(st *FileState) {
+		if st.Settings == nil {
+			st.Settings = map[string]float64{}
+		}
+		st.Settings[name] = v
+	})
+}
+
+// Delete forgets path, in the database too.
+func (s *StateStore) Delete(path string) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	delete(s.m, path)
+	delete(s.pending, path)
+	s.mu.Unlock()
+	if s.path == "" {
+		return nil
+	}
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(filesBucket)
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(path))
+	})
+}
+
+// Move carries what is remembered of path over to dest, where the file
+// was moved.
+func (s *StateStore) Move(path, dest string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	st, ok := s.m[path]
+	delete(s.m, path)
+	delete(s.pending, path)
+	s.mu.Unlock()
+	if ok {
+		s.update(dest, func(to *FileState) { *to = st })
+	}
+	_ = s.Delete(path)
+}
+
+// State returns what is remembered of path.
+func (s *StateStore) State(path string) (FileState, bool) {
+	if s == nil {
+		return FileState{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.m[path]
+	return st, ok
+}
+
+// Watched reports whether path was watched.
+func (s *StateStore) Watched(path string) bool {
+	st, _ := s.State(path)
+	return st.Watched
+}
+
+// HistoryEntry is a played file and what is remembered of it.
+type HistoryEntry struct {
+	Path string
+	FileState
+}
+
+// History returns the files played so far, the most recent first. Local
+// files that are gone are left out.
+func (s *StateStore) History() []HistoryEntry {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	var h []HistoryEntry
+	for path, st := range s.m {
+		if !st.LastPlayed.IsZero() {
+			h = append(h, HistoryEntry{path, st})
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(h, func(i, j int) bool { return h[i].LastPlayed.After(h[j].LastPlayed) })
+	out := h[:0]
+	for _, e := range h {
+		if !IsURL(e.Path) {
+			if _, err := os.Stat(e.Path); err != nil {
+				continue
+			}
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+func DefaultStatePath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".pp_state.db")
+}
+
+// LegacyTimestampPath is where older versions kept resume positions.
+func LegacyTimestampPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".pp_timestamps_go.json")
+}
@@ -0,0 +1,182 @@
+package pp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// subtitleExtensions are the subtitle files loaded along with a video.
+var subtitleExtensions = []string{".srt", ".ass", ".ssa", ".vtt"}
+
+// SidecarSubtitles returns the subtitle files next to video that are named
+// after it, such as "movie.srt" or "movie.en.ass" for "movie.mkv".
+func SidecarSubtitles(video string) []string {
+	dir := filepath.Dir(video)
+	base := strings.TrimSuffix(filepath.Base(video), filepath.Ext(video))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var subs []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !slices.Contains(subtitleExtensions, strings.ToLower(filepath.Ext(name))) {
+			continue
+		}
+		stem := strings.TrimSuffix(name, filepath.Ext(name))
+		if stem == base || strings.HasPrefix(stem, base+".") {
+			subs = append(subs, filepath.Join(dir, name))
+		}
+	}
+	return subs
+}
+
+// track is an entry of mpv's track-list.
+type track struct {
+	ID               int    `json:"id"`
+	Type             string `json:"type"`
+	Lang             string `json:"lang"`
+	Title            string `json:"title"`
+	External         bool   `json:"external"`
+	ExternalFilename string `json:"external-filename"`
+	Selected         bool   `json:"selected"`
+}
+
+func (t track) label() string {
+	var parts []string
+	if t.Lang != "" {
+		parts = append(parts, t.Lang)
+	}
+	if t.Title != "" {
+		parts = append(parts, t.Title)
+	} else if t.External {
+		parts = append(parts, filepath.Base(t.ExternalFilename))
+	}
+	if len(parts) == 0 {
+		return fmt.Sprintf("#%d", t.ID)
+	}
+	return fmt.Sprintf("#%d %s", t.ID, strings.Join(parts, " "))
+}
+
+// tracks returns the tracks of kind ("sub" or "audio") of the current file.
+func (a *App) tracks(kind string) []track {
+	data, err := a.MPV.CommandData(withTimeout(300*time.Millisecond), "get_property", "track-list")
+	if err != nil {
+		return nil
+	}
+	var all []track
+	_ = json.Unmarshal(data, &all)
+	var out []track
+	for _, t := range all {
+		if t.Type == kind {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// LoadSidecarSubtitles adds the sidecar subtitles of the current file that
+// mpv has not loaded on its own.
+func (a *App) LoadSidecarSubtitles(ctx context.Context) error {
+	// The first file can load while the startup call runs.
+	a.subsMu.Lock()
+	defer a.subsMu.Unlock()
+	path := a.currentPath()
+	if path == "" || IsURL(path) {
+		return nil
+	}
+	loaded := map[string]bool{}
+	for _, t := range a.tracks("sub") {
+		if t.External {
+			loaded[filepath.Clean(t.ExternalFilename)] = true
+		}
+	}
+	for _, sub := range SidecarSubtitles(path) {
+		if loaded[sub] {
+			continue
+		}
+		if err := a.MPV.Command(ctx, "sub-add", sub, "auto"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trackNames are the names of the track kinds on the OSD.
+var trackNames = map[string]string{"sub": "Subtitle", "audio": "Audio"}
+
+// CycleTrack selects the next track of kind, going through no subtitles
+// after the last subtitle track.
+func (a *App) CycleTrack(ctx context.Context, kind string) error {
+	if err := a.MPV.Command(ctx, "cycle", kind); err != nil {
+		return err
+	}
+	a.osdTrack(kind)
+	return nil
+}
+
+// SelectTrack selects track id of kind, or none if id is 0.
+func (a *App) SelectTrack(ctx context.Context, kind string, id int) error {
+	prop := "sid"
+	if kind == "audio" {
+		prop = "aid"
+	}
+	var v any = id
+	if id == 0 {
+		v = "no"
+	}
+	if err := a.MPV.Command(ctx, "set_property", prop, v); err != nil {
+		return fmt.Errorf("no %s track %d", strings.ToLower(trackNames[kind]), id)
+	}
+	a.osdTrack(kind)
+	return nil
+}
+
+func (a *App) osdTrack(kind string) {
+	tracks := a.tracks(kind)
+	for i, t := range tracks {
+		if t.Selected {
+			a.osd(fmt.Sprintf("%s: %s (%d/%d)", trackNames[kind], t.label(), i+1, len(tracks)))
+			return
+		}
+	}
+	a.osd(trackNames[kind] + ": off")
+}
+
+// printTracks lists the tracks of kind in the terminal.
+func (a *App) printTracks(kind string) {
+	tracks := a.tracks(kind)
+	fmt.Fprintf(os.Stdout, "\n%s tracks:\n", trackNames[kind])
+	for _, t := range tracks {
+		prefix := "  "
+		if t.Selected {
+			prefix = "→ "
+		}
+		fmt.Fprintf(os.Stdout, "%s%s\n", prefix, t.label())
+	}
+	if len(tracks) == 0 {
+		fmt.Fprintln(os.Stdout, "  (none)")
+	}
+	fmt.Fprintln(os.Stdout)
+	a.osd(fmt.Sprintf("%d %s tracks", len(tracks), kind))
+}
+
+func (a *App) bumpSubDelay(delta float64) error {
+	cur, err := a.MPV.GetFloat(withTimeout(250*time.Millisecond), "sub-delay")
+	if err != nil {
+		cur = 0
+	}
+	return a.setSubDelay(cur + delta)
+}
+
+func (a *App) setSubDelay(sec float64) error {
+	_ = a.MPV.Command(context.Background(), "set_property", "sub-delay", sec)
+	a.osd(fmt.Sprintf("Subtitle delay %+.1fs", sec))
+	return nil
+}
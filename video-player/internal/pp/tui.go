@@ -0,0 +1,281 @@
+package pp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"video-player/internal/tty"
+)
+
+// tuiProps are the mpv properties the TUI shows, besides playlist-pos and
+// chapter, which are always observed.
+var tuiProps = []string{"path", "media-title", "time-pos", "duration", "pause", "speed", "volume", "mute", "loop-file", "ab-loop-a", "ab-loop-b", "chapters"}
+
+const (
+	// tuiMaxRows is the most playlist entries the TUI shows.
+	tuiMaxRows = 10
+	// tuiFreeRows is how many rows the TUI leaves below it, so that the
+	// finder fits under it.
+	tuiFreeRows = finderRows + 4
+	// tuiMessageFor is how long an OSD message stays on the status line.
+	tuiMessageFor = 5 * time.Second
+)
+
+// tui keeps the playlist, the progress of the current file and a status
+// line at the top of the terminal. Prompts and the output of commands
+// scroll in the rows below it.
+type tui struct {
+	app *App
+
+	mu        sync.Mutex
+	props     map[string]json.RawMessage
+	message   string
+	messageAt time.Time
+	rows      int
+	cols      int
+	height    int
+
+	redraw chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+func newTUI(a *App) *tui {
+	t := &tui{
+		app:    a,
+		props:  map[string]json.RawMessage{},
+		redraw: make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	_, _ = os.Stdout.WriteString("\x1b[2J")
+	go t.loop()
+	return t
+}
+
+// update records the value mpv reported for an observed property.
+func (t *tui) update(name string, data json.RawMessage) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.props[name] = data
+	t.mu.Unlock()
+	t.changed()
+}
+
+// setMessage shows msg on the status line for a while.
+func (t *tui) setMessage(msg string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.message, t.messageAt = msg, time.Now()
+	t.mu.Unlock()
+	t.changed()
+}
+
+func (t *tui) changed() {
+	select {
+	case t.redraw <- struct{}{}:
+	default:
+	}
+}
+
+func (t *tui) loop() {
+	defer close(t.done)
+	// The terminal size is checked now and then rather than on SIGWINCH,
+	// which Windows does not have.
+	tick := time.NewTicker(2 * time.Second)
+	defer tick.Stop()
+	for {
+		t.resize()
+		t.draw()
+		select {
+		case <-t.stop:
+			return
+		case <-t.redraw:
+		case <-tick.C:
+		}
+		// time-pos changes with every frame; redraw ten times a second at
+		// most.
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// resize fits the pane and the scrolling region below it to the terminal.
+func (t *tui) resize() {
+	rows, cols := tty.Size()
+	n := max(1, min(len(t.app.Playlist), tuiMaxRows, rows-tuiFreeRows-5))
+	height := n + 5
+	t.mu.Lock()
+	same := rows == t.rows && cols == t.cols && height == t.height
+	t.rows, t.cols, t.height = rows, cols, height
+	t.mu.Unlock()
+	if same {
+		return
+	}
+	// Setting the region moves the cursor to the top, so move it back to
+	// the bottom, where prompts go.
+	fmt.Fprintf(os.Stdout, "\x1b[%d;%dr\x1b[%d;1H", min(height+1, rows), rows, rows)
+}
+
+func (t *tui) draw() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.height == 0 || t.height >= t.rows {
+		return
+	}
+	lines := []string{
+		t.header(),
+		t.progress(),
+		t.status(),
+	}
+	lines = append(lines, t.playlist(t.height-5)...)
+	msg := ""
+	if time.Since(t.messageAt) < tuiMessageFor {
+		msg = t.message
+	}
+	lines = append(lines, msg, strings.Repeat("─", t.cols-1))
+
+	// Draw the pane in one write, leaving the cursor where a prompt may be
+	// typing. Lines stop short of the last column, where the terminal
+	// would wrap.
+	var b strings.Builder
+	b.WriteString("\x1b7")
+	for i, line := range lines {
+		line = truncateMiddle(line, t.cols-1, t.cols/2)
+		if i == 0 {
+			line = "\x1b[7m" + pad(line, t.cols-1) + "\x1b[0m"
+		}
+		fmt.Fprintf(&b, "\x1b[%d;1H%s\x1b[K", i+1, line)
+	}
+	b.WriteString("\x1b8")
+	_, _ = os.Stdout.WriteString(b.String())
+}
+
+func (t *tui) header() string {
+	state := "▶"
+	if t.propBool("pause") {
+		state = "⏸"
+	}
+	// Streams are named by their title rather than their URL.
+	name := ""
+	if path := t.propString("path"); IsURL(path) && t.propString("media-title") != "" {
+		name = t.propString("media-title")
+	} else if path != "" {
+		name = displayName(path)
+	}
+	return fmt.Sprintf(" %s %d/%d  %s", state, t.app.Index+1, len(t.app.Playlist), name)
+}
+
+func (t *tui) progress() string {
+	pos, _ := t.propFloat("time-pos")
+	duration, ok := t.propFloat("duration")
+	times := fmt.Sprintf(" %s / %s", formatClock(pos), formatClock(duration))
+	percent := 0.0
+	if ok && duration > 0 {
+		percent = min(100, max(0, pos/duration*100))
+		times += fmt.Sprintf("  %3.0f%%", percent)
+	}
+	width := t.cols - len([]rune(times)) - 2
+	if width < 10 {
+		return times
+	}
+	filled := int(percent / 100 * float64(width))
+	return " " + strings.Repeat("█", filled) + strings.Repeat("░", width-filled) + times
+}
+
+func (t *tui) status() string {
+	var parts []string
+	if n, ok := t.propFloat("chapters"); ok && n > 0 {
+		if cur, ok := t.propFloat("chapter"); ok && cur >= 0 {
+			parts = append(parts, fmt.Sprintf("chapter %.0f/%.0f", cur+1, n))
+		}
+	}
+	if speed, ok := t.propFloat("speed"); ok {
+		parts = append(parts, fmt.Sprintf("speed %.1fx", speed))
+	}
+	if vol, ok := t.propFloat("volume"); ok {
+		parts = append(parts, fmt.Sprintf("vol %.0f", vol))
+	}
+	if t.propBool("mute") {
+		parts = append(parts, "muted")
+	}
+	// loop-file is "no", "inf" or a count.
+	if loop := string(t.props["loop-file"]); loop != "" && loop != `"no"` && loop != "false" {
+		parts = append(parts, "loop file")
+	}
+	// An unset loop point is "no", which is not a number.
+	if start, ok := t.propFloat("ab-loop-a"); ok {
+		if end, ok := t.propFloat("ab-loop-b"); ok {
+			parts = append(parts, fmt.Sprintf("loop %s-%s", formatClock(start), formatClock(end)))
+		} else {
+			parts = append(parts, fmt.Sprintf("loop %s-", formatClock(start)))
+		}
+	}
+	return " " + strings.Join(parts, "  ")
+}
+
+// playlist returns n entries of the playlist around the current one.
+func (t *tui) playlist(n int) []string {
+	a := t.app
+	first := max(0, min(a.Index-n/2, len(a.Playlist)-n))
+	lines := make([]string, 0, n)
+	for i := first; i < len(a.Playlist) && i < first+n; i++ {
+		lines = append(lines, a.playlistLine(i))
+	}
+	for len(lines) < n {
+		lines = append(lines, "")
+	}
+	return lines
+}
+
+func (t *tui) propFloat(name string) (float64, bool) {
+	var v float64
+	err := json.Unmarshal(t.props[name], &v)
+	return v, err == nil
+}
+
+func (t *tui) propBool(name string) bool {
+	var v bool
+	_ = json.Unmarshal(t.props[name], &v)
+	return v
+}
+
+func (t *tui) propString(name string) string {
+	var v string
+	_ = json.Unmarshal(t.props[name], &v)
+	return v
+}
+
+// close stops drawing and gives the whole terminal back.
+func (t *tui) close() {
+	if t == nil {
+		return
+	}
+	close(t.stop)
+	<-t.done
+	tty.ResetScrollRegion()
+}
+
+// formatClock formats sec as m:ss, or h:mm:ss from an hour on.
+func formatClock(sec float64) string {
+	s := int(max(0, sec))
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
+// pad fills line with spaces up to width runes.
+func pad(line string, width int) string {
+	if n := len([]rune(line)); n < width {
+		return line + strings.Repeat(" ", width-n)
+	}
+	return line
+}
@@ -0,0 +1,14 @@
+// Package trash moves files to the trash of the operating system, from
+// where they can be restored.
+package trash
+
+import "path/filepath"
+
+// Move moves the file at path to the trash.
+func Move(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	return move(abs)
+}
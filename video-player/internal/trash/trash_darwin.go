@@ -0,0 +1,48 @@
+//go:build darwin
+
+package trash
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// move renames path into ~/.Trash, or into the .Trashes folder of the
+// volume it is on, the places Finder puts deleted files.
+func move(path string) error {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(home, ".Trash")
+	if strings.HasPrefix(path, "/Volumes/") {
+		parts := strings.SplitN(path, "/", 4)
+		dir = filepath.Join("/", parts[1], parts[2], ".Trashes", strconv.Itoa(os.Getuid()))
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	err = os.Rename(path, freeName(dir, filepath.Base(path)))
+	if errors.Is(err, syscall.EXDEV) {
+		return errors.New("file is on another volume than its trash")
+	}
+	return err
+}
+
+// freeName returns a path in dir named name, numbered like Finder does if
+// that is taken.
+func freeName(dir, name string) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	candidate := filepath.Join(dir, name)
+	for i := 2; ; i++ {
+		if _, err := os.Lstat(candidate); err != nil {
+			return candidate
+		}
+		candidate = filepath.Join(dir, base+" "+strconv.Itoa(i)+ext)
+	}
+}
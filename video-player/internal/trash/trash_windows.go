@@ -0,0 +1,43 @@
+//go:build windows
+
+package trash
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var procSHFileOperationW = syscall.NewLazyDLL("shell32.dll").NewProc("SHFileOperationW")
+
+// From shellapi.h.
+const (
+	foDelete          = 0x3
+	fofSilent         = 0x4
+	fofNoConfirmation = 0x10
+	fofAllowUndo      = 0x40
+	fofNoErrorUI      = 0x400
+)
+
+// move deletes path with undo allowed, which puts it in the Recycle Bin.
+func move(path string) error {
+	from, err := syscall.UTF16FromString(path)
+	if err != nil {
+		return err
+	}
+	// pFrom is a list of paths ended by an empty one.
+	from = append(from, 0)
+	op := shFileOpStruct{
+		wFunc:  foDelete,
+		pFrom:  &from[0],
+		fFlags: fofAllowUndo | fofNoConfirmation | fofSilent | fofNoErrorUI,
+	}
+	r, _, _ := procSHFileOperationW.Call(uintptr(unsafe.Pointer(&op)))
+	if r != 0 {
+		return fmt.Errorf("SHFileOperation failed with code %#x", r)
+	}
+	if op.aborted() {
+		return fmt.Errorf("moving to the Recycle Bin was aborted")
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+//go:build windows && (386 || arm)
+
+package trash
+
+// shFileOpStruct is SHFILEOPSTRUCTW as laid out on 32-bit Windows, where
+// shellapi.h packs it to 1 byte: fAnyOperationsAborted follows fFlags with
+// no padding, which Go fields cannot express, so it and the fields after
+// it are kept as bytes.
+type shFileOpStruct struct {
+	hwnd   uintptr
+	wFunc  uint32
+	pFrom  *uint16
+	pTo    *uint16
+	fFlags uint16
+	// fAnyOperationsAborted (BOOL), hNameMappings and lpszProgressTitle.
+	rest [12]byte
+}
+
+func (op *shFileOpStruct) aborted() bool {
+	return op.rest[0]|op.rest[1]|op.rest[2]|op.rest[3] != 0
+}
@@ -0,0 +1,19 @@
+//go:build windows && (amd64 || arm64)
+
+package trash
+
+// shFileOpStruct is SHFILEOPSTRUCTW as laid out on 64-bit Windows.
+type shFileOpStruct struct {
+	hwnd                  uintptr
+	wFunc                 uint32
+	pFrom                 *uint16
+	pTo                   *uint16
+	fFlags                uint16
+	fAnyOperationsAborted int32
+	hNameMappings         uintptr
+	lpszProgressTitle     *uint16
+}
+
+func (op *shFileOpStruct) aborted() bool {
+	return op.fAnyOperationsAborted != 0
+}
@@ -0,0 +1,131 @@
+//go:build !windows && !darwin
+
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// move follows the freedesktop.org trash specification: the file goes to
+// $XDG_DATA_HOME/Trash, or to $topdir/.Trash-$uid when it is on another
+// file system, next to an info file that remembers where it came from.
+func move(path string) error {
+	home, err := homeTrash()
+	if err != nil {
+		return err
+	}
+	err = moveInto(home, path, path)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	top, err := topDir(path)
+	if err != nil {
+		return err
+	}
+	// Files in a top directory trash are recorded relative to it.
+	rel, err := filepath.Rel(top, path)
+	if err != nil {
+		return err
+	}
+	return moveInto(filepath.Join(top, ".Trash-"+strconv.Itoa(os.Getuid())), path, rel)
+}
+
+func homeTrash() (string, error) {
+	data := os.Getenv("XDG_DATA_HOME")
+	if data == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		data = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(data, "Trash"), nil
+}
+
+// moveInto moves path into the trash directory trash, recording it as
+// recorded.
+func moveInto(trash, path, recorded string) error {
+	files := filepath.Join(trash, "files")
+	info := filepath.Join(trash, "info")
+	if err := os.MkdirAll(files, 0o700); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(info, 0o700); err != nil {
+		return err
+	}
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(filepath.Base(path), ext)
+	content := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: recorded}).EscapedPath(), time.Now().Format("2006-01-02T15:04:05"))
+	for i := 1; ; i++ {
+		name := base + ext
+		if i > 1 {
+			name = base + "." + strconv.Itoa(i) + ext
+		}
+		// Creating the info file claims the name.
+		f, err := os.OpenFile(filepath.Join(info, name+".trashinfo"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		_, err = f.WriteString(content)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			if _, serr := os.Lstat(filepath.Join(files, name)); serr == nil {
+				err = os.ErrExist
+			} else {
+				err = os.Rename(path, filepath.Join(files, name))
+			}
+		}
+		if err != nil {
+			_ = os.Remove(filepath.Join(info, name+".trashinfo"))
+			if errors.Is(err, os.ErrExist) {
+				continue
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+// topDir returns the mount point of the file system path is on.
+func topDir(path string) (string, error) {
+	dev := func(p string) (uint64, error) {
+		var st syscall.Stat_t
+		if err := syscall.Stat(p, &st); err != nil {
+			return 0, err
+		}
+		return uint64(st.Dev), nil
+	}
+	want, err := dev(path)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Dir(path)
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir, nil
+		}
+		d, err := dev(parent)
+		if err != nil {
+			return "", err
+		}
+		if d != want {
+			return dir, nil
+		}
+		dir = parent
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -53,6 +54,41 @@ func MakeRaw() (restore func(), err error) {
 	}, nil
 }
 
+// Width returns the number of columns of the terminal, or 80 if stty
+// cannot tell.
+func Width() int {
+	_, cols := Size()
+	return cols
+}
+
+// Size returns the number of rows and columns of the terminal, or 24x80 if
+// stty cannot tell.
+func Size() (rows, cols int) {
+	cmd := exec.Command("stty", "size")
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	if err != nil {
+		return 24, 80
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return 24, 80
+	}
+	rows, rerr := strconv.Atoi(fields[0])
+	cols, cerr := strconv.Atoi(fields[1])
+	if rerr != nil || cerr != nil || rows <= 0 || cols <= 0 {
+		return 24, 80
+	}
+	return rows, cols
+}
+
+// ResetScrollRegion makes the whole terminal scroll again and moves the
+// cursor to its last row.
+func ResetScrollRegion() {
+	rows, _ := Size()
+	fmt.Fprintf(os.Stdout, "\x1b[r\x1b[%d;1H\n", rows)
+}
+
 func ReadKey(r *bufio.Reader) (Key, error) {
 	b, err := r.ReadByte()
 	if err != nil {
@@ -167,6 +203,10 @@ func ReadLine(r *bufio.Reader, prompt string) (line string, ok bool, err error)
 			_, _ = os.Stdout.WriteString("\n")
 			return string(buf), true, nil
 		}
+		if k.Kind == KeySpace {
+			// ReadKey reports a space as a key of its own.
+			k = Key{Kind: KeyRune, Rune: ' '}
+		}
 		if k.Kind != KeyRune {
 			continue
 		}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// defaultConfigPath is ~/.config/video-subtitle/config.json (or the
+// platform's equivalent), or "" when there is no config dir.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "video-subtitle", "config.json")
+}
+
+// applyConfig reads a JSON object whose keys are flag names (without the
+// dashes) and sets each flag the command line left alone, so flags always
+// win. The "credentials" key maps environment variable names such as
+// OPENAI_API_KEY to values, used only when the variable is unset. A missing
+// file is an error only when required (i.e. named with --config).
+func applyConfig(fs *flag.FlagSet, path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !required && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		raw := values[name]
+		if name == "credentials" {
+			var creds map[string]string
+			if err := json.Unmarshal(raw, &creds); err != nil {
+				return fmt.Errorf("%s: credentials: %v", path, err)
+			}
+			for key, value := range creds {
+				if os.Getenv(key) == "" {
+					os.Setenv(key, value)
+				}
+			}
+			continue
+		}
+		if name == "config" || fs.Lookup(name) == nil {
+			return fmt.Errorf("%s: unknown option %q", path, name)
+		}
+		if set[name] {
+			continue
+		}
+		value, err := configValue(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %v", path, name, err)
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("%s: %s: %v", path, name, err)
+		}
+	}
+	return nil
+}
+
+// configValue renders a JSON string, number or bool the way it would be
+// typed on the command line.
+func configValue(raw json.RawMessage) (string, error) {
+	var value any
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", err
+	}
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return fmt.Sprint(v), nil
+	case float64:
+		return strings.TrimSpace(string(raw)), nil
+	}
+	return "", fmt.Errorf("want a string, number or bool, got %s", raw)
+}
@@ -0,0 +1,15 @@
+package main
+
+// Exit statuses, so scripts wrapping the tool can tell failures apart. Flag
+// parse errors already exit with 2 from the flag package.
+const (
+	exitOK          = 0
+	exitFailure     = 1   // anything not covered below
+	exitUsage       = 2   // bad flags, config or missing credentials
+	exitMissingDep  = 3   // ffmpeg, ffprobe or a plugin is unavailable
+	exitBadInput    = 4   // the input is missing, unreadable or not media
+	exitTranscribe  = 5   // transcription failed
+	exitTranslate   = 6   // translation or review failed
+	exitWrite       = 7   // an output file could not be written
+	exitInterrupted = 130 // stopped by Ctrl-C or SIGTERM
+)
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// hookTimeout bounds each --on-complete/--on-error command and webhook
+// post, so a hung hook cannot keep the run from exiting.
+const hookTimeout = 2 * time.Minute
+
+// runSummary is what the completion hooks are told about a run.
+type runSummary struct {
+	// Status is "done", "failed" or "interrupted".
+	Status   string   `json:"status"`
+	ExitCode int      `json:"exit_code"`
+	Inputs   []string `json:"inputs"`
+	Output   string   `json:"output,omitempty"`
+	Segments int      `json:"segments,omitempty"`
+	Error    string   `json:"error,omitempty"`
+	Seconds  float64  `json:"duration_seconds"`
+}
+
+// hooks are the commands and webhook run when a run ends.
+type hooks struct {
+	OnComplete string
+	OnError    string
+	Webhook    string
+	// Transport carries the webhook post (http.DefaultTransport if nil).
+	Transport http.RoundTripper
+}
+
+// notify runs the hook for how the run ended and posts the summary to the
+// webhook. Hook failures are reported but do not change the exit status.
+func (h hooks) notify(summary runSummary, logger *progressLog) {
+	data, err := json.Marshal(summary)
+	if err != nil {
+		logger.Printf("Failed to encode run summary: %v", err)
+		return
+	}
+	command, name := h.OnComplete, "--on-complete"
+	if summary.Status != "done" {
+		command, name = h.OnError, "--on-error"
+	}
+	if command != "" {
+		if err := runHook(command, summary, data); err != nil {
+			logger.Printf("%s hook failed: %v", name, err)
+		}
+	}
+	if h.Webhook != "" {
+		if err := postWebhook(h.Webhook, data, h.Transport); err != nil {
+			logger.Printf("Webhook failed: %v", err)
+		}
+	}
+}
+
+// runHook runs command with sh, the summary as JSON on stdin and its main
+// fields in VIDEO_SUBTITLE_* variables. Its output goes to stderr.
+func runHook(command string, summary runSummary, data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	input := ""
+	if len(summary.Inputs) > 0 {
+		input = summary.Inputs[0]
+	}
+	cmd.Env = append(os.Environ(),
+		"VIDEO_SUBTITLE_STATUS="+summary.Status,
+		"VIDEO_SUBTITLE_EXIT_CODE="+strconv.Itoa(summary.ExitCode),
+		"VIDEO_SUBTITLE_INPUT="+input,
+		"VIDEO_SUBTITLE_OUTPUT="+summary.Output,
+		"VIDEO_SUBTITLE_ERROR="+summary.Error,
+	)
+	return cmd.Run()
+}
+
+func postWebhook(url string, data []byte, transport http.RoundTripper) error {
+	client := &http.Client{Timeout: hookTimeout, Transport: transport}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("POST %s: %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+)
+
+// progressLog writes progress to stderr, either as the usual free-form lines
+// or, with --log-format json, as one JSON object per line. Structured events
+// (stage boundaries, chunks, retries) only appear in JSON mode; the text
+// output is unchanged. A nil *progressLog discards everything.
+type progressLog struct {
+	mu    sync.Mutex
+	w     io.Writer
+	quiet bool
+	json  *slog.Logger
+	// lastError is the text of the last Errorf, for the run summary.
+	lastError string
+}
+
+func newProgressLog(w io.Writer, format string, quiet bool) (*progressLog, error) {
+	l := &progressLog{w: w, quiet: quiet}
+	switch format {
+	case "text":
+	case "json":
+		l.json = slog.New(slog.NewJSONHandler(w, nil))
+	default:
+		return nil, fmt.Errorf("unknown --log-format %q (want text or json)", format)
+	}
+	return l, nil
+}
+
+// Printf reports a progress message; --quiet suppresses it.
+func (l *progressLog) Printf(format string, args ...any) {
+	if l == nil || l.quiet {
+		return
+	}
+	if l.json != nil {
+		l.json.Info("message", "text", fmt.Sprintf(format, args...))
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(l.w, format+"\n", args...)
+}
+
+// Errorf reports a fatal error. It is printed even with --quiet.
+func (l *progressLog) Errorf(format string, args ...any) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lastError = fmt.Sprintf(format, args...)
+	if l.json != nil {
+		l.json.Error("error", "text", l.lastError)
+		return
+	}
+	fmt.Fprintln(l.w, l.lastError)
+}
+
+// LastError returns the text of the last Errorf, or "".
+func (l *progressLog) LastError() string {
+	if l == nil {
+		return ""
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lastError
+}
+
+// Event emits a structured event with slog-style key/value pairs.
+func (l *progressLog) Event(name string, args ...any) {
+	if l == nil || l.json == nil {
+		return
+	}
+	l.json.Info(name, args...)
+}
@@ -1,900 +1,1122 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"mime/multipart"
-	"net"
-	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"runtime"
-	"strconv"
 	"strings"
-	"sync"
 	"time"
-	"unicode"
-)
 
-const (
-	defaultWhisperModel     = "whisper-1"
-	defaultTranslateModel   = "gpt-4o-mini"
-	defaultSourceLang       = "ja"
-	defaultTargetLang       = "zh-TW"
-	defaultChunkSeconds     = 600
-	defaultMaxAudioMB       = 24
-	defaultTranslateWorkers = 4
-	defaultTimeoutSeconds   = 900
-	maxRetries              = 4
-	baseRetryDelay          = 1 * time.Second
-	maxRetryDelay           = 20 * time.Second
+	"bag-of-tricks/pkg/httpreplay"
+	"bag-of-tricks/pkg/plugin"
+	"bag-of-tricks/pkg/workspace"
+	"video-subtitle/subtitle"
 )
 
-type Segment struct {
-	Start float64
-	End   float64
-	Text  string
-}
-
-type apiError struct {
-	StatusCode int
-	Message    string
-	Type       string
-	Code       string
-}
-
-func (e *apiError) Error() string {
-	if e.Message == "" {
-		return fmt.Sprintf("openai error (%d)", e.StatusCode)
+func copyFile(src, dst string) error {
+	input, err := os.Open(src)
+	if err != nil {
+		return err
 	}
-	return fmt.Sprintf("openai error (%d): %s", e.StatusCode, e.Message)
-}
-
-type openAIClient struct {
-	apiKey     string
-	baseURL    string
-	httpClient *http.Client
-}
+	defer input.Close()
 
-func newOpenAIClient(apiKey string, timeout time.Duration) *openAIClient {
-	baseURL := strings.TrimRight(os.Getenv("OPENAI_BASE_URL"), "/")
-	if baseURL == "" {
-		baseURL = "https://api.openai.com/v1"
-	}
-	if timeout <= 0 {
-		timeout = time.Duration(defaultTimeoutSeconds) * time.Second
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
 	}
-	return &openAIClient{
-		apiKey:  apiKey,
-		baseURL: baseURL,
-		httpClient: &http.Client{
-			Timeout: timeout,
-		},
+	output, err := os.Create(dst)
+	if err != nil {
+		return err
 	}
-}
-
-type transcriptionResponse struct {
-	Text     string                 `json:"text"`
-	Segments []transcriptionSegment `json:"segments"`
-}
-
-type transcriptionSegment struct {
-	Start float64 `json:"start"`
-	End   float64 `json:"end"`
-	Text  string  `json:"text"`
-}
+	defer output.Close()
 
-type chatResponse struct {
-	Choices []struct {
-		Message struct {
-			Content string `json:"content"`
-		} `json:"message"`
-	} `json:"choices"`
+	if _, err := io.Copy(output, input); err != nil {
+		return err
+	}
+	return output.Sync()
 }
 
-type openAIErrorResponse struct {
-	Error struct {
-		Message string `json:"message"`
-		Type    string `json:"type"`
-		Code    string `json:"code"`
-	} `json:"error"`
+// partialOutputPath is where an interrupted run leaves its finished cues:
+// video.srt becomes video.partial.srt.
+func partialOutputPath(outputPath string) string {
+	ext := filepath.Ext(outputPath)
+	return strings.TrimSuffix(outputPath, ext) + ".partial" + ext
 }
 
-func (c *openAIClient) do(req *http.Request) ([]byte, error) {
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
-	req.Header.Set("User-Agent", "video-subtitle/0.1")
-
-	resp, err := c.httpClient.Do(req)
+// spoolStdin copies stdin to path.
+func spoolStdin(path string) error {
+	output, err := os.Create(path)
 	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+		return err
 	}
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, parseAPIError(resp.StatusCode, body)
+	defer output.Close()
+	if _, err := io.Copy(output, os.Stdin); err != nil {
+		return err
 	}
-	return body, nil
+	return output.Close()
 }
 
-func (c *openAIClient) Transcribe(ctx context.Context, audioPath, model, language string) ([]Segment, error) {
-	var buf bytes.Buffer
-	writer := multipart.NewWriter(&buf)
-
-	if err := writer.WriteField("model", model); err != nil {
-		return nil, err
-	}
-	if language != "" {
-		if err := writer.WriteField("language", language); err != nil {
-			return nil, err
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
 		}
 	}
-	if err := writer.WriteField("response_format", "verbose_json"); err != nil {
-		return nil, err
-	}
-	if err := writer.WriteField("timestamp_granularities[]", "segment"); err != nil {
-		return nil, err
-	}
+	return items
+}
 
-	file, err := os.Open(audioPath)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
+// maxQCWarnings is how many timing check warnings are logged; --qc-report
+// has them all.
+const maxQCWarnings = 10
 
-	part, err := writer.CreateFormFile("file", filepath.Base(audioPath))
-	if err != nil {
-		return nil, err
-	}
-	if _, err := io.Copy(part, file); err != nil {
-		return nil, err
-	}
+func run() (status int) {
+	configPath := flag.String("config", "", "JSON file of default flag values and credentials (default ~/.config/video-subtitle/config.json)")
+	quiet := flag.Bool("quiet", false, "Suppress progress output")
+	logFormat := flag.String("log-format", "text", "Progress output on stderr: text, or json for one event object per line")
+	output := flag.String("output", "", "Output subtitle path; .vtt and .ass select those formats, anything else is SRT (defaults to input path with .srt, or .<target-lang>.srt when translating a subtitle file)")
+	shortOutput := flag.String("o", "", "Output subtitle path (shorthand)")
+	exportJSON := flag.String("export-json", "", "Also write the segments (times, source text, translation, confidence) to this JSON file")
+	importJSON := flag.String("import-json", "", "Render segments from a JSON file written by --export-json instead of transcribing; no API calls are made")
+	repairPath := flag.String("repair", "", "Translate again only the cues of this subtitle file that were left untranslated or marked [untranslated], and write it back in place (or to --output)")
+	whisperModel := flag.String("whisper-model", subtitle.DefaultWhisperModel, "Whisper model")
+	sttProviderName := flag.String("stt-provider", "openai", "Speech-to-text backend: openai, deepgram, assemblyai or google")
+	sttFallback := flag.String("stt-fallback", "", "Comma-separated transcription backends to fail over to, in order: "+subtitle.STTProviderNames()+" or plugin:COMMAND")
+	sttModel := flag.String("stt-model", "", "Model for a non-OpenAI --stt-provider (defaults to the provider's general model)")
+	sourceLang := flag.String("source-lang", subtitle.DefaultSourceLang, "Source language")
+	targetLang := flag.String("target-lang", subtitle.DefaultTargetLang, "Target language")
+	translateModel := flag.String("translate-model", subtitle.DefaultTranslateModel, "Translation model")
+	azureEndpoint := flag.String("azure-endpoint", "", "Use the Azure OpenAI resource at this URL instead of OpenAI; --whisper-model, --translate-model and --review-model name its deployments (defaults to $AZURE_OPENAI_ENDPOINT)")
+	azureAPIVersion := flag.String("azure-api-version", "", "Azure OpenAI API version (defaults to $AZURE_OPENAI_API_VERSION, then "+subtitle.DefaultAzureAPIVersion+")")
+	translateFallback := flag.String("translate-fallback", "", "Comma-separated translation backends to fail over to, in order: openai, plugin:COMMAND or llm-plugin:COMMAND")
+	noTranslate := flag.Bool("no-translate", false, "Skip translation and output original transcript")
+	chunkSeconds := flag.Int("chunk-seconds", 0, "Split audio into chunks of N seconds before transcription")
+	noChapters := flag.Bool("no-chapters", false, "Chunk at fixed --chunk-seconds intervals even when the input has chapter markers")
+	chunkOverlap := flag.Float64("chunk-overlap", 0, "Seconds consecutive chunks overlap; cues at the cut are de-duplicated")
+	maxAudioMB := flag.Int("max-audio-mb", subtitle.DefaultMaxAudioMB, "Auto-chunk when extracted audio exceeds this size (MB)")
+	saveTranscript := flag.Bool("save-transcript", false, "Also write the untranslated transcript as <output>.<source-lang>.<ext>")
+	transcriptText := flag.Bool("transcript-text", false, "Also write the untranslated transcript as plain text, <output>.<source-lang>.txt")
+	perFile := flag.Bool("per-file", false, "When joining several inputs, also write each part's subtitles next to it as <part>.<ext>")
+	keepAudio := flag.Bool("keep-audio", false, "Keep the extracted audio file")
+	maxCueSeconds := flag.Float64("max-cue-seconds", 0, "Split cues longer than N seconds at punctuation/word boundaries (0 to disable)")
+	maxLineChars := flag.Int("max-line-chars", 0, "Wrap cue lines longer than N characters onto two lines, splitting cues that need more (0 to disable)")
+	shiftSeconds := flag.Float64("shift-seconds", 0, "Add N seconds (may be negative) to every cue time in the output")
+	scaleFactor := flag.Float64("scale-factor", 1, "Multiply every cue time in the output by N before --shift-seconds (e.g. 0.95904 = 23.976/25 for a PAL speed-up)")
+	fixTiming := flag.Bool("fix-timing", false, "Adjust cue ends to clear overlaps and too-short or too-fast cues found by the timing check")
+	minCueSeconds := flag.Float64("min-cue-seconds", 0.5, "Timing check: warn about cues shorter than N seconds (0 to disable)")
+	maxCPS := flag.Float64("max-cps", 0, "Timing check: warn about cues read faster than N characters per second (0 = the output language's usual limit)")
+	qcReport := flag.String("qc-report", "", "Also write every timing check warning to this file")
+	mergeUnder := flag.Float64("merge-under", 0, "Merge cues shorter than N seconds into their neighbours before translation (0 to disable)")
+	mergeGap := flag.Float64("merge-gap", 0.5, "Largest gap in seconds bridged by --merge-under")
+	noNormalize := flag.Bool("no-normalize", false, "Keep the translator's punctuation and spacing in Chinese, Japanese and Korean output")
+	censorMode := flag.String("censor", "", "Filter the words in --censor-words out of the subtitles: mask (***), drop, or tag ("+subtitle.CensorPlaceholder+")")
+	censorWords := flag.String("censor-words", "", "Word list for --censor: one word or phrase per line, word* matches prefixes")
+	censorScope := flag.String("censor-scope", "both", "Text --censor filters: transcript, translation or both")
+	noClean := flag.Bool("no-clean", false, "Keep repeated, zero-length and junk-phrase segments Whisper tends to hallucinate")
+	preferEmbedded := flag.Bool("prefer-embedded", false, "Use the input's own text subtitle track in --source-lang, if it has one, instead of transcribing")
+	scriptPath := flag.String("script", "", "Known text of the recording (one cue per line): time it against the transcript instead of using the transcript's words")
+	startAt := flag.String("start", "", "Only transcribe from this time on (seconds or [hh:]mm:ss); cue times still follow the whole video")
+	endAt := flag.String("end", "", "Only transcribe up to this time (seconds or [hh:]mm:ss)")
+	var skipRanges []subtitle.TimeRange
+	flag.Func("skip", "Leave START-END out of the transcription, e.g. 0:00-1:30 for an intro (repeatable)", func(value string) error {
+		r, err := subtitle.ParseTimeRange(value)
+		if err != nil {
+			return err
+		}
+		skipRanges = append(skipRanges, r)
+		return nil
+	})
+	skipSilence := flag.Bool("skip-silence", false, "Detect silence with ffmpeg and only send speech to the API")
+	silenceDB := flag.Float64("silence-db", -35, "Level in dB below which audio counts as silence for --skip-silence")
+	minSilence := flag.Float64("min-silence", 2, "Shortest pause in seconds that --skip-silence removes")
+	audioStream := flag.Int("audio-track", -1, "Audio stream to transcribe, numbered from 0 as shown by --list-tracks (default: ffmpeg's pick)")
+	normalizeAudio := flag.Bool("normalize-audio", false, "High-pass and loudness-normalize the audio before transcription, for quiet or noisy recordings")
+	listTracks := flag.Bool("list-tracks", false, "List the input's audio streams and exit")
+	audioCodec := flag.String("audio-codec", "opus", "Codec for the extracted audio upload: opus, mp3 or wav")
+	translateWorkers := flag.Int("translate-workers", subtitle.DefaultTranslateWorkers, "Number of concurrent translation workers")
+	transcribeWorkers := flag.Int("transcribe-workers", subtitle.DefaultTranscribeWorkers, "Number of chunks transcribed concurrently when chunking")
+	minTranslateChars := flag.Int("min-translate-chars", 4, "Skip translation for segments with fewer than N letters/numbers (0 to disable)")
+	reviewUIFlag := flag.Bool("review-ui", false, "After writing the subtitles, serve a local web page with the video and the cues to edit; each save rewrites the output")
+	reviewUIListen := flag.String("review-ui-listen", "127.0.0.1:0", "Address of the --review-ui page (default: a free local port)")
+	review := flag.Bool("review", false, "After translating, send (source, draft) batches through a second LLM pass that fixes mistranslations and awkward phrasing")
+	reviewModel := flag.String("review-model", "", "Model for --review (defaults to --translate-model)")
+	reviewBatch := flag.Int("review-batch", subtitle.DefaultReviewBatch, "Cues per --review request")
+	translateRPM := flag.Int("translate-rpm", 0, "Cap translation requests per minute across all workers (0 = unlimited)")
+	translateTPM := flag.Int("translate-tpm", 0, "Cap estimated translation tokens per minute across all workers (0 = unlimited)")
+	promptTemplate := flag.String("prompt-template", "", "Template file overriding the translation prompts (text/template; see README)")
+	glossary := flag.String("glossary", "", "File of \"source = target\" lines the translator must follow for names and terms")
+	memoryPath := flag.String("memory", "", "Translation memory file: reuse translations of lines seen in earlier runs and remember this run's (created if missing)")
+	memorySimilarity := flag.Float64("memory-similarity", subtitle.DefaultMemorySimilarity, "How alike (0-1) a line must be to a remembered one to reuse its translation; 1 for exact matches only")
+	speakerStyles := flag.String("speaker-styles", "", "File of \"speaker = register\" lines: how lines tagged with each speaker (\"Name: ...\") are translated")
+	contextSegments := flag.Int("context-segments", subtitle.DefaultContextSegments, "Send the previous N translated segments as context with each translation (0 to translate segments independently)")
+	defaultRetry := subtitle.DefaultRetryPolicy()
+	maxRetries := flag.Int("max-retries", defaultRetry.MaxRetries, "Times a failed transcription, translation or review request is retried (0 to fail at once)")
+	retryBaseDelay := flag.Duration("retry-base-delay", defaultRetry.BaseDelay, "Wait before the first retry; doubles with each attempt")
+	retryMaxDelay := flag.Duration("retry-max-delay", defaultRetry.MaxDelay, "Longest wait between retries")
+	showUsage := flag.Bool("usage", false, "Print the API requests, audio minutes and tokens of the run per provider when done")
+	onComplete := flag.String("on-complete", "", "Shell command run when the subtitles are written, with the run summary as JSON on stdin and in VIDEO_SUBTITLE_* variables")
+	onError := flag.String("on-error", "", "Shell command run when the run fails or is interrupted, like --on-complete")
+	webhook := flag.String("webhook", "", "URL the run summary is POSTed to as JSON when the run ends, either way")
+	usageReport := flag.String("usage-report", "", "Also write the API usage of the run to this JSON file")
+	timeoutSeconds := flag.Int("timeout-seconds", subtitle.DefaultTimeoutSeconds, "HTTP timeout for API requests (seconds)")
+	transcribePrompt := flag.String("transcribe-prompt", "", "Vocabulary or context hint for transcription, e.g. names and jargon (comma-separated terms for non-OpenAI providers)")
+	transcribeTemperature := flag.Float64("transcribe-temperature", 0, "Whisper sampling temperature, 0-1 (0 = API default)")
+	chainChunks := flag.Bool("chain-chunks", false, "When chunking, send the end of each chunk's transcript as the prompt for the next (chunks then reach the API one at a time)")
+	stream := flag.Bool("stream", false, "When chunking, translate each chunk as soon as it is transcribed instead of after the whole transcript")
+	highAccuracy := flag.Bool("high-accuracy", false, "Use higher-accuracy transcription settings (slower)")
+	keepTemp := flag.Bool("keep-temp", false, "Keep the temp workspace (extracted audio, chunks) for debugging")
+	tempQuotaMB := flag.Int("temp-quota-mb", 0, "Fail if temp files exceed this size in MB (0 = unlimited)")
+	transcribePlugin := flag.String("transcribe-plugin", "", "Command of an external transcription plugin (JSON-RPC over stdio)")
+	translatePlugin := flag.String("translate-plugin", "", "Command of an external translation plugin (JSON-RPC over stdio)")
+	llmPlugin := flag.String("llm-plugin", "", "Command of an external LLM plugin that receives the translation prompts")
+	noResume := flag.Bool("no-resume", false, "Ignore any checkpoint from a previous interrupted run and start over")
+	keepState := flag.Bool("keep-state", false, "Keep the checkpoint file after a successful run")
+	noCache := flag.Bool("no-cache", false, "Neither read nor write the transcription cache in ~/.cache/video-subtitle")
+	mux := flag.Bool("mux", false, "Also write a copy of the input with the subtitles embedded as a soft track")
+	muxOutput := flag.String("mux-output", "", "Path of the --mux copy (defaults to input path with .subtitled before the extension)")
+	burnIn := flag.Bool("burn-in", false, "Also write an H.264 mp4 with the subtitles rendered into the picture")
+	burnInOutput := flag.String("burn-in-output", "", "Path of the --burn-in video (defaults to input path with .burned.mp4)")
+	crf := flag.Int("crf", 20, "x264 CRF for --burn-in (lower is higher quality)")
+	preset := flag.String("preset", "medium", "x264 preset for --burn-in")
+	font := flag.String("font", "", "Font name for --burn-in (default: libass default)")
+	fontSize := flag.Int("font-size", 0, "Font size for --burn-in (0 = libass default)")
+	flag.Parse()
 
-	if err := writer.Close(); err != nil {
-		return nil, err
+	configFile, configRequired := *configPath, true
+	if configFile == "" {
+		configFile, configRequired = defaultConfigPath(), false
 	}
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/audio/transcriptions", &buf)
-	if err != nil {
-		return nil, err
+	if configFile != "" {
+		if err := applyConfig(flag.CommandLine, configFile, configRequired); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+			return exitUsage
+		}
 	}
-	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	body, err := c.do(req)
+	logger, err := newProgressLog(os.Stderr, *logFormat, *quiet)
 	if err != nil {
-		return nil, err
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	progress := &subtitle.Progress{
+		OnMessage: func(text string) { logger.Printf("%s", text) },
+		OnEvent:   logger.Event,
 	}
 
-	var resp transcriptionResponse
-	if err := json.Unmarshal(body, &resp); err != nil {
-		return nil, err
+	// The hooks hear about every run that gets past the flags, however it
+	// ends; the fields are filled in as they become known.
+	started := time.Now()
+	notify := hooks{OnComplete: *onComplete, OnError: *onError, Webhook: *webhook}
+	summary := runSummary{Inputs: flag.Args()}
+	if notify != (hooks{}) {
+		defer func() {
+			if *listTracks {
+				return
+			}
+			summary.ExitCode = status
+			summary.Seconds = time.Since(started).Seconds()
+			switch status {
+			case exitOK:
+				summary.Status = "done"
+			case exitInterrupted:
+				summary.Status = "interrupted"
+			default:
+				summary.Status = "failed"
+			}
+			if status != exitOK {
+				summary.Error = logger.LastError()
+			}
+			notify.notify(summary, logger)
+		}()
 	}
 
-	segments := make([]Segment, 0, len(resp.Segments))
-	for _, seg := range resp.Segments {
-		segments = append(segments, Segment{
-			Start: seg.Start,
-			End:   seg.End,
-			Text:  seg.Text,
-		})
+	importMode := *importJSON != ""
+	repairMode := *repairPath != ""
+	if importMode && repairMode {
+		logger.Errorf("--import-json and --repair are mutually exclusive.")
+		return exitUsage
 	}
-	if len(segments) == 0 && strings.TrimSpace(resp.Text) != "" {
-		segments = append(segments, Segment{Start: 0, End: 0, Text: resp.Text})
+	if flag.NArg() < 1 && !importMode && !repairMode {
+		logger.Errorf("Input file is required.")
+		flag.Usage()
+		return exitUsage
 	}
-	return segments, nil
-}
 
-func (c *openAIClient) Translate(ctx context.Context, model, sourceLang, targetLang, text string) (string, error) {
-	systemPrompt := "You are a precise translator. Return only the translation."
-	userPrompt := fmt.Sprintf(
-		"Translate the following text from %s to %s. Preserve punctuation and line breaks.\n\n%s",
-		sourceLang,
-		targetLang,
-		text,
-	)
-
-	payload := map[string]any{
-		"model": model,
-		"messages": []map[string]string{
-			{"role": "system", "content": systemPrompt},
-			{"role": "user", "content": userPrompt},
-		},
-		"temperature": 0,
-	}
-	bodyBytes, err := json.Marshal(payload)
+	ws, err := workspace.New("video-subtitle", workspace.Options{
+		Keep:       *keepTemp,
+		QuotaBytes: int64(*tempQuotaMB) * 1024 * 1024,
+	})
 	if err != nil {
-		return "", err
+		logger.Errorf("Failed to create temp dir: %v", err)
+		return exitFailure
+	}
+	defer ws.Close()
+	defer ws.CloseOnPanic()
+	// The first Ctrl-C stops the run and keeps what is done (see
+	// interrupted below); a second one exits at once.
+	ctx, stopSignals := workspace.CancelOnSignal(context.Background(), func(os.Signal) {
+		logger.Printf("Interrupted; saving progress (Ctrl-C again to quit now)...")
+	})
+	defer stopSignals()
+	if *keepTemp {
+		logger.Printf("Keeping temp files in %s", ws.Dir())
+	}
+
+	// With --import-json or --repair the positional video is optional; it
+	// is only needed for --mux/--burn-in and to name the output.
+	inputPath := flag.Arg(0)
+	if inputPath == "" {
+		inputPath = *importJSON + *repairPath
+	}
+	// Several inputs are consecutive parts of one recording, transcribed
+	// into one subtitle file.
+	parts := flag.Args()
+	joinParts := len(parts) > 1 && !importMode && !repairMode
+	if joinParts {
+		if *output == "" && *shortOutput == "" {
+			logger.Errorf("--output is required when joining several inputs.")
+			return exitUsage
+		}
+		if *mux || *burnIn || *keepAudio {
+			logger.Errorf("--mux, --burn-in and --keep-audio need a single input.")
+			return exitUsage
+		}
+		for _, part := range parts {
+			if part == "-" || subtitle.IsSubtitleFile(part) {
+				logger.Errorf("Only media files can be joined: %s", part)
+				return exitUsage
+			}
+			if info, err := os.Stat(part); err != nil || info.IsDir() {
+				logger.Errorf("Input file not found: %s", part)
+				return exitBadInput
+			}
+		}
+		if _, err := exec.LookPath("ffprobe"); err != nil {
+			logger.Errorf("ffprobe is required to join several inputs.")
+			return exitMissingDep
+		}
+	} else if *perFile {
+		logger.Errorf("--per-file needs several inputs.")
+		return exitUsage
+	}
+	// "-" reads the media from stdin. It is spooled to the workspace first,
+	// since chunking needs the duration and seeks into the file.
+	stdinInput := inputPath == "-"
+	if stdinInput {
+		if *output == "" && *shortOutput == "" {
+			logger.Errorf("--output is required when reading from stdin.")
+			return exitUsage
+		}
+		if *mux || *burnIn {
+			logger.Errorf("--mux and --burn-in need a video file, not stdin.")
+			return exitUsage
+		}
+		inputPath = ws.Path("stdin")
+		if err := spoolStdin(inputPath); err != nil {
+			logger.Errorf("Failed to read stdin: %v", err)
+			return exitBadInput
+		}
 	}
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/chat/completions", bytes.NewReader(bodyBytes))
-	if err != nil {
-		return "", err
+	info, err := os.Stat(inputPath)
+	if err != nil || info.IsDir() {
+		logger.Errorf("Input file not found: %s", inputPath)
+		return exitBadInput
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	body, err := c.do(req)
-	if err != nil {
-		return "", err
-	}
+	// An .srt/.vtt input only needs the translation half of the pipeline,
+	// and an imported JSON file neither.
+	subtitleInput := subtitle.IsSubtitleFile(inputPath)
+	transcribe := !subtitleInput && !importMode && !repairMode
+	videoInput := !subtitleInput && inputPath != *importJSON
 
-	var resp chatResponse
-	if err := json.Unmarshal(body, &resp); err != nil {
-		return "", err
-	}
-	if len(resp.Choices) == 0 {
-		return "", errors.New("translation returned no choices")
+	var start, end float64
+	if *startAt != "" {
+		if start, err = subtitle.ParseClock(*startAt); err != nil {
+			logger.Errorf("Invalid --start: %v", err)
+			return exitUsage
+		}
 	}
-	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
-}
-
-func parseAPIError(statusCode int, body []byte) error {
-	var resp openAIErrorResponse
-	if err := json.Unmarshal(body, &resp); err == nil && resp.Error.Message != "" {
-		return &apiError{
-			StatusCode: statusCode,
-			Message:    resp.Error.Message,
-			Type:       resp.Error.Type,
-			Code:       resp.Error.Code,
+	if *endAt != "" {
+		if end, err = subtitle.ParseClock(*endAt); err != nil || end == 0 {
+			logger.Errorf("Invalid --end: %q", *endAt)
+			return exitUsage
+		}
+		if end <= start {
+			logger.Errorf("--end must be after --start.")
+			return exitUsage
 		}
 	}
-	message := strings.TrimSpace(string(body))
-	if message == "" {
-		message = http.StatusText(statusCode)
+	trimming := *startAt != "" || *endAt != "" || len(skipRanges) > 0
+	if trimming && (!transcribe || joinParts) {
+		logger.Errorf("--start, --end and --skip need a single media input.")
+		return exitUsage
 	}
-	return &apiError{StatusCode: statusCode, Message: message}
-}
 
-func describeError(err error) string {
-	var apiErr *apiError
-	if errors.As(err, &apiErr) {
-		errType := apiErr.Type
-		if errType == "" {
-			errType = "api_error"
+	var script []string
+	if *scriptPath != "" {
+		if !transcribe || joinParts {
+			logger.Errorf("--script needs a single media input.")
+			return exitUsage
+		}
+		if script, err = subtitle.LoadScript(*scriptPath); err != nil {
+			logger.Errorf("Failed to load --script: %v", err)
+			return exitUsage
 		}
-		return fmt.Sprintf("%s (%d)", errType, apiErr.StatusCode)
 	}
-	return err.Error()
-}
 
-func retry(
-	ctx context.Context,
-	maxRetries int,
-	baseDelay time.Duration,
-	maxDelay time.Duration,
-	shouldRetry func(error) bool,
-	onRetry func(int, time.Duration, error),
-	fn func() error,
-) error {
-	for attempt := 0; ; attempt++ {
-		if ctx.Err() != nil {
-			return ctx.Err()
-		}
-		err := fn()
-		if err == nil {
-			return nil
-		}
-		if attempt >= maxRetries {
-			return err
+	if *listTracks || *audioStream >= 0 {
+		if !videoInput {
+			logger.Errorf("--list-tracks and --audio-track need a video input.")
+			return exitUsage
 		}
-		if shouldRetry != nil && !shouldRetry(err) {
-			return err
+		if _, err := exec.LookPath("ffprobe"); err != nil {
+			logger.Errorf("ffprobe is required for --list-tracks and --audio-track.")
+			return exitMissingDep
 		}
-		delay := baseDelay * time.Duration(1<<attempt)
-		if delay > maxDelay {
-			delay = maxDelay
+		tracks, err := subtitle.ListAudioTracks(inputPath)
+		if err != nil {
+			logger.Errorf("Failed to list audio tracks: %v", err)
+			return exitBadInput
 		}
-		jitter := time.Duration(float64(delay) * (0.25 * randFloat()))
-		delay += jitter
-		if onRetry != nil {
-			onRetry(attempt+1, delay, err)
+		if *listTracks {
+			subtitle.PrintAudioTracks(os.Stdout, tracks)
+			return exitOK
 		}
-		timer := time.NewTimer(delay)
-		select {
-		case <-ctx.Done():
-			timer.Stop()
-			return ctx.Err()
-		case <-timer.C:
+		if *audioStream >= len(tracks) {
+			logger.Errorf("--audio-track %d: the input has %d audio tracks (see --list-tracks).", *audioStream, len(tracks))
+			return exitUsage
 		}
 	}
-}
 
-func randFloat() float64 {
-	return float64(time.Now().UnixNano()%1000) / 1000.0
-}
+	if _, err := exec.LookPath("ffmpeg"); err != nil && (transcribe || *mux || *burnIn) {
+		logger.Errorf("ffmpeg is required on PATH.")
+		return exitMissingDep
+	}
 
-func isRetryable(err error) bool {
-	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-		return false
+	if *burnIn && !videoInput {
+		logger.Errorf("--burn-in needs a video input.")
+		return exitUsage
 	}
-	var apiErr *apiError
-	if errors.As(err, &apiErr) {
-		switch apiErr.StatusCode {
-		case 408, 409, 429, 500, 502, 503, 504:
-			return true
-		default:
-			return false
+	if *mux {
+		if !videoInput {
+			logger.Errorf("--mux needs a video input.")
+			return exitUsage
+		}
+		if _, err := subtitle.MuxSubtitleCodec(inputPath); err != nil {
+			logger.Errorf("%v", err)
+			return exitUsage
 		}
 	}
-	var netErr net.Error
-	if errors.As(err, &netErr) {
-		return true
-	}
-	return false
-}
 
-func shouldFallbackToChunking(err error) bool {
-	var apiErr *apiError
-	if errors.As(err, &apiErr) {
-		message := strings.ToLower(apiErr.Message)
-		if strings.Contains(message, "reading your request") {
-			return true
+	format, ok := subtitle.AudioFormats[*audioCodec]
+	if !ok {
+		logger.Errorf("Unknown --audio-codec %q (want opus, mp3 or wav).", *audioCodec)
+		return exitUsage
+	}
+	if *scaleFactor <= 0 {
+		logger.Errorf("--scale-factor must be positive.")
+		return exitUsage
+	}
+	if *maxRetries < 0 || *retryBaseDelay <= 0 || *retryMaxDelay < *retryBaseDelay {
+		logger.Errorf("--max-retries must not be negative, and --retry-max-delay must be at least --retry-base-delay > 0.")
+		return exitUsage
+	}
+	retryPolicy := subtitle.RetryPolicy{MaxRetries: *maxRetries, BaseDelay: *retryBaseDelay, MaxDelay: *retryMaxDelay}
+	if *chunkOverlap < 0 {
+		logger.Errorf("--chunk-overlap must not be negative.")
+		return exitUsage
+	}
+	var censor *subtitle.Censor
+	if *censorMode != "" {
+		switch *censorMode {
+		case subtitle.CensorMask, subtitle.CensorDrop, subtitle.CensorTag:
+		default:
+			logger.Errorf("Unknown --censor %q (want mask, drop or tag).", *censorMode)
+			return exitUsage
 		}
-		if strings.Contains(strings.ToLower(apiErr.Type), "invalid_request_error") {
-			return true
+		if *censorWords == "" {
+			logger.Errorf("--censor needs a --censor-words list.")
+			return exitUsage
 		}
-		if apiErr.StatusCode == 413 {
-			return true
+		censor = &subtitle.Censor{Mode: *censorMode}
+		switch *censorScope {
+		case "transcript":
+			censor.Transcript = true
+		case "translation":
+			censor.Translation = true
+		case "both":
+			censor.Transcript, censor.Translation = true, true
+		default:
+			logger.Errorf("Unknown --censor-scope %q (want transcript, translation or both).", *censorScope)
+			return exitUsage
 		}
-		if apiErr.StatusCode >= 500 {
-			return true
+		if censor.Words, err = subtitle.LoadCensorWords(*censorWords); err != nil {
+			logger.Errorf("Failed to load --censor-words: %v", err)
+			return exitUsage
 		}
 	}
-	return false
-}
-
-func informativeRuneCount(text string) int {
-	count := 0
-	for _, r := range text {
-		if unicode.IsLetter(r) || unicode.IsNumber(r) {
-			count++
-		}
+	if *translatePlugin != "" && *llmPlugin != "" {
+		logger.Errorf("--translate-plugin and --llm-plugin are mutually exclusive.")
+		return exitUsage
 	}
-	return count
-}
-
-func isLowInfoText(text string, minChars int) bool {
-	trimmed := strings.TrimSpace(text)
-	if trimmed == "" {
-		return true
+	provider, ok := subtitle.STTProviders[*sttProviderName]
+	if !ok {
+		logger.Errorf("Unknown --stt-provider %q (want %s).", *sttProviderName, subtitle.STTProviderNames())
+		return exitUsage
 	}
-	if minChars <= 0 {
-		return false
+	if *transcribePlugin != "" && *sttProviderName != "openai" {
+		logger.Errorf("--transcribe-plugin and --stt-provider are mutually exclusive.")
+		return exitUsage
 	}
-	return informativeRuneCount(trimmed) < minChars
-}
-
-func countTranslatableSegments(segments []Segment, minChars int) int {
-	total := 0
-	for _, seg := range segments {
-		if !isLowInfoText(seg.Text, minChars) {
-			total++
-		}
+	transcribeModel := *whisperModel
+	if provider.New != nil {
+		transcribeModel = provider.DefaultModel
 	}
-	return total
-}
-
-func formatSRTTimestamp(seconds float64) string {
-	millis := int64(seconds * 1000)
-	hours := millis / 3600000
-	millis %= 3600000
-	minutes := millis / 60000
-	millis %= 60000
-	secs := millis / 1000
-	millis %= 1000
-	return fmt.Sprintf("%02d:%02d:%02d,%03d", hours, minutes, secs, millis)
-}
-
-func writeSRT(segments []Segment, outputPath string) error {
-	var buf strings.Builder
-	for idx, seg := range segments {
-		start := formatSRTTimestamp(seg.Start)
-		end := formatSRTTimestamp(seg.End)
-		buf.WriteString(strconv.Itoa(idx + 1))
-		buf.WriteString("\n")
-		buf.WriteString(start)
-		buf.WriteString(" --> ")
-		buf.WriteString(end)
-		buf.WriteString("\n")
-		buf.WriteString(strings.TrimSpace(seg.Text))
-		buf.WriteString("\n\n")
-	}
-	return os.WriteFile(outputPath, []byte(buf.String()), 0644)
-}
-
-func runCommand(name string, args ...string) error {
-	cmd := exec.Command(name, args...)
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		message := strings.TrimSpace(stderr.String())
-		if message == "" {
-			message = err.Error()
-		}
-		return fmt.Errorf("%s failed: %s", name, message)
+	if *sttModel != "" {
+		transcribeModel = *sttModel
 	}
-	return nil
-}
-
-func runCommandOutput(name string, args ...string) (string, error) {
-	cmd := exec.Command(name, args...)
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		message := strings.TrimSpace(stderr.String())
-		if message == "" {
-			message = err.Error()
+	maxUploadMB := provider.MaxUploadMB
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "max-audio-mb" {
+			maxUploadMB = *maxAudioMB
+		}
+	})
+	useProvider := transcribe && *transcribePlugin == "" && provider.New != nil
+	providerKey := strings.TrimSpace(os.Getenv(provider.KeyEnv))
+	if useProvider && providerKey == "" {
+		logger.Errorf("%s is not set", provider.KeyEnv)
+		return exitUsage
+	}
+
+	needTranslate := !*noTranslate && *sourceLang != *targetLang && !importMode
+	if repairMode && !needTranslate {
+		logger.Errorf("--repair needs a translation: --source-lang and --target-lang must differ.")
+		return exitUsage
+	}
+	needOpenAI := (transcribe && *transcribePlugin == "" && !useProvider) || (needTranslate && *llmPlugin == "" && (*translatePlugin == "" || *review))
+
+	// Azure stands in for OpenAI, with its own key.
+	azure := *azureEndpoint
+	if azure == "" {
+		azure = strings.TrimSpace(os.Getenv("AZURE_OPENAI_ENDPOINT"))
+	}
+	keyEnv := "OPENAI_API_KEY"
+	if azure != "" {
+		keyEnv = "AZURE_OPENAI_API_KEY"
+		if *azureAPIVersion == "" {
+			*azureAPIVersion = strings.TrimSpace(os.Getenv("AZURE_OPENAI_API_VERSION"))
 		}
-		return "", fmt.Errorf("%s failed: %s", name, message)
-	}
-	return stdout.String(), nil
-}
-
-func extractAudio(inputPath, outputPath string) error {
-	return runCommand(
-		"ffmpeg",
-		"-y",
-		"-i",
-		inputPath,
-		"-vn",
-		"-ac",
-		"1",
-		"-ar",
-		"16000",
-		"-f",
-		"wav",
-		outputPath,
-	)
-}
-
-func extractAudioSegment(inputPath, outputPath string, startSeconds, durationSeconds float64, accurate bool) error {
-	args := []string{"-y"}
-	if !accurate {
-		args = append(args, "-ss", fmt.Sprintf("%.3f", startSeconds))
-	}
-	args = append(args, "-i", inputPath)
-	if accurate {
-		args = append(args, "-ss", fmt.Sprintf("%.3f", startSeconds))
-	}
-	args = append(
-		args,
-		"-t",
-		fmt.Sprintf("%.3f", durationSeconds),
-		"-vn",
-		"-ac",
-		"1",
-		"-ar",
-		"16000",
-		"-f",
-		"wav",
-		outputPath,
-	)
-	return runCommand("ffmpeg", args...)
-}
-
-func audioDuration(path string) (float64, error) {
-	output, err := runCommandOutput(
-		"ffprobe",
-		"-v",
-		"error",
-		"-show_entries",
-		"format=duration",
-		"-of",
-		"default=noprint_wrappers=1:nokey=1",
-		path,
-	)
-	if err != nil {
-		return 0, err
-	}
-	value := strings.TrimSpace(output)
-	duration, err := strconv.ParseFloat(value, 64)
-	if err != nil {
-		return 0, fmt.Errorf("failed to parse audio duration: %w", err)
 	}
-	return duration, nil
-}
-
-func audioSize(path string) (int64, error) {
-	info, err := os.Stat(path)
-	if err != nil {
-		return 0, err
+	apiKey := strings.TrimSpace(os.Getenv(keyEnv))
+	if apiKey == "" && needOpenAI {
+		logger.Errorf("%s is not set", keyEnv)
+		return exitUsage
 	}
-	return info.Size(), nil
-}
 
-func chooseChunkSeconds(path string, defaultChunk int, maxAudioBytes int64) (int, error) {
-	duration, err := audioDuration(path)
-	if err != nil {
-		return defaultChunk, err
+	outputPath := *output
+	if outputPath == "" {
+		outputPath = *shortOutput
 	}
-	if duration <= 0 {
-		return defaultChunk, nil
+	if outputPath == "" && repairMode {
+		outputPath = *repairPath
 	}
-	sizeBytes, err := audioSize(path)
-	if err != nil {
-		return defaultChunk, err
+	if outputPath == "" {
+		ext := filepath.Ext(inputPath)
+		outputPath = strings.TrimSuffix(inputPath, ext) + ".srt"
+		if subtitleInput && needTranslate {
+			outputPath = strings.TrimSuffix(inputPath, ext) + "." + *targetLang + ".srt"
+		}
 	}
-	bytesPerSecond := float64(sizeBytes) / duration
-	if bytesPerSecond <= 0 {
-		return defaultChunk, nil
+	summary.Output = outputPath
+	if subtitleInput && !repairMode && filepath.Clean(outputPath) == filepath.Clean(inputPath) {
+		logger.Errorf("Output path must differ from the subtitle input.")
+		return exitUsage
 	}
-	estimated := int(float64(maxAudioBytes) / bytesPerSecond)
-	if estimated <= 0 {
-		return defaultChunk, nil
+
+	client := subtitle.NewOpenAIClient(apiKey, time.Duration(*timeoutSeconds)*time.Second)
+	if azure != "" {
+		client = subtitle.NewAzureOpenAIClient(azure, apiKey, *azureAPIVersion, time.Duration(*timeoutSeconds)*time.Second)
 	}
-	if estimated < 30 {
-		return 30, nil
+	if needTranslate {
+		client.Prompt, err = subtitle.LoadTranslationPrompt(*promptTemplate, *glossary, *speakerStyles)
+		if err != nil {
+			logger.Errorf("Failed to load translation prompt: %v", err)
+			return exitUsage
+		}
 	}
-	if estimated > defaultChunk {
-		return defaultChunk, nil
+	// VIDEO_SUBTITLE_HTTP_RECORD / _REPLAY point at a cassette for fixture-based runs.
+	transport, err := httpreplay.FromEnv("VIDEO_SUBTITLE_HTTP", nil)
+	if err != nil {
+		logger.Errorf("Failed to load HTTP fixtures: %v", err)
+		return exitUsage
+	}
+	if transport != nil {
+		client.HTTPClient.Transport = transport
+		notify.Transport = transport
+	}
+	if *showUsage || *usageReport != "" {
+		// Every HTTP backend shares client.HTTPClient, so this sees them all.
+		usage := &subtitle.Usage{}
+		client.HTTPClient.Transport = usage.Transport(transport)
+		defer func() {
+			for _, p := range usage.Providers() {
+				logger.Event("usage", "provider", p.Provider, "requests", p.Requests, "audio_seconds", p.AudioSeconds, "prompt_tokens", p.PromptTokens, "completion_tokens", p.CompletionTokens)
+			}
+			if *showUsage && *logFormat == "text" {
+				fmt.Fprint(os.Stderr, usage.Table())
+			}
+			if *usageReport != "" {
+				var inputs []string
+				for _, arg := range flag.Args() {
+					inputs = append(inputs, filepath.Base(arg))
+				}
+				if err := usage.WriteReport(*usageReport, inputs); err != nil {
+					logger.Errorf("Failed to write usage report: %v", err)
+				}
+			}
+		}()
 	}
-	return estimated, nil
-}
 
-func transcribeWithRetry(
-	ctx context.Context,
-	client *openAIClient,
-	audioPath, model, language string,
-	logf func(string, ...any),
-) ([]Segment, error) {
-	var segments []Segment
-	var err error
-	retryErr := retry(
-		ctx,
-		maxRetries,
-		baseRetryDelay,
-		maxRetryDelay,
-		isRetryable,
-		func(attempt int, delay time.Duration, err error) {
-			logf("Transcription failed; retrying in %.1fs (attempt %d). %s", delay.Seconds(), attempt, describeError(err))
-		},
-		func() error {
-			segments, err = client.Transcribe(ctx, audioPath, model, language)
-			return err
-		},
-	)
-	if retryErr != nil {
-		return nil, retryErr
+	pipeline := &subtitle.Pipeline{
+		Transcriber: client,
+		Translator:  client,
+		Reviewer:    client,
+		Workspace:   ws,
+		Progress:    progress,
 	}
-	return segments, nil
-}
-
-func transcribeInChunks(
-	ctx context.Context,
-	client *openAIClient,
-	audioPath, model, language string,
-	chunkSeconds int,
-	accurate bool,
-	logf func(string, ...any),
-) ([]Segment, error) {
-	duration, err := audioDuration(audioPath)
-	if err != nil {
-		return nil, err
+	backend := "openai"
+	if azure != "" {
+		backend = "azure"
 	}
-	if duration <= 0 {
-		return nil, errors.New("audio duration is zero")
+	if useProvider {
+		pipeline.Transcriber = provider.New(providerKey, client.HTTPClient)
+		backend = *sttProviderName
 	}
-
-	segments := []Segment{}
-	current := 0.0
-	chunkIndex := 0
-	baseDir := filepath.Dir(audioPath)
-
-	for current < duration-0.01 {
-		remaining := duration - current
-		segmentDuration := float64(chunkSeconds)
-		if remaining < segmentDuration {
-			segmentDuration = remaining
+	if *transcribePlugin != "" {
+		p, err := subtitle.StartPlugin(*transcribePlugin, plugin.MethodTranscribe)
+		if err != nil {
+			logger.Errorf("Failed to start transcription plugin: %v", err)
+			return exitMissingDep
 		}
-		chunkPath := filepath.Join(baseDir, fmt.Sprintf("chunk_%04d.wav", chunkIndex))
-		logf("Transcribing chunk %d at %.1fs...", chunkIndex+1, current)
-		if err := extractAudioSegment(audioPath, chunkPath, current, segmentDuration, accurate); err != nil {
-			return nil, err
+		defer p.Close()
+		pipeline.Transcriber = subtitle.PluginTranscriber{P: p}
+		backend = "plugin:" + *transcribePlugin
+	}
+	if transcribe && *sttFallback != "" {
+		backends := []subtitle.TranscriberBackend{{Name: backend, Transcriber: pipeline.Transcriber}}
+		for _, name := range splitList(*sttFallback) {
+			b := subtitle.TranscriberBackend{Name: name}
+			if command, ok := strings.CutPrefix(name, "plugin:"); ok {
+				p, err := subtitle.StartPlugin(command, plugin.MethodTranscribe)
+				if err != nil {
+					logger.Errorf("Failed to start transcription plugin: %v", err)
+					return exitMissingDep
+				}
+				defer p.Close()
+				b.Transcriber = subtitle.PluginTranscriber{P: p}
+			} else {
+				fallback, ok := subtitle.STTProviders[name]
+				if !ok {
+					logger.Errorf("Unknown --stt-fallback %q (want %s or plugin:COMMAND).", name, subtitle.STTProviderNames())
+					return exitUsage
+				}
+				env := fallback.KeyEnv
+				if fallback.New == nil {
+					env = keyEnv
+				}
+				key := strings.TrimSpace(os.Getenv(env))
+				if key == "" {
+					logger.Errorf("%s is not set (needed by --stt-fallback %s)", env, name)
+					return exitUsage
+				}
+				b.Transcriber, b.Model = client, *whisperModel
+				if fallback.New != nil {
+					b.Transcriber, b.Model = fallback.New(key, client.HTTPClient), fallback.DefaultModel
+				}
+			}
+			backends = append(backends, b)
+			backend += ">" + name
 		}
-		chunkSegments, err := transcribeWithRetry(ctx, client, chunkPath, model, language, logf)
+		pipeline.Transcriber = &subtitle.FailoverTranscriber{Backends: backends, Retry: retryPolicy, Progress: progress}
+	}
+	if backend != "openai" && backend != "azure" {
+		pipeline.TranscriberName = backend
+	}
+	if !*noCache {
+		if dir, err := subtitle.DefaultTranscriptCacheDir(); err != nil {
+			logger.Printf("Transcription cache disabled: %v", err)
+		} else {
+			cache := &subtitle.TranscriptCache{Dir: dir, Progress: progress}
+			pipeline.Transcriber = cache.Wrap(pipeline.Transcriber, backend)
+		}
+	}
+	if needTranslate && *translatePlugin != "" {
+		p, err := subtitle.StartPlugin(*translatePlugin, plugin.MethodTranslate)
 		if err != nil {
-			return nil, err
+			logger.Errorf("Failed to start translation plugin: %v", err)
+			return exitMissingDep
 		}
-		for _, seg := range chunkSegments {
-			seg.Start += current
-			seg.End += current
-			segments = append(segments, seg)
+		defer p.Close()
+		pipeline.Translator = subtitle.PluginTranslator{P: p}
+	}
+	if needTranslate && *llmPlugin != "" {
+		p, err := subtitle.StartPlugin(*llmPlugin, plugin.MethodComplete)
+		if err != nil {
+			logger.Errorf("Failed to start LLM plugin: %v", err)
+			return exitMissingDep
 		}
-		current += segmentDuration
-		chunkIndex++
+		defer p.Close()
+		pipeline.Translator = subtitle.LLMTranslator{LLM: p, Prompt: client.Prompt}
+		pipeline.Reviewer = subtitle.LLMTranslator{LLM: p}
 	}
-	return segments, nil
-}
 
-func translateSegments(
-	ctx context.Context,
-	client *openAIClient,
-	segments []Segment,
-	sourceLang, targetLang, model string,
-	workers int,
-	minTranslateChars int,
-	logf func(string, ...any),
-) ([]Segment, error) {
-	if workers <= 0 {
-		workers = 1
-	}
-	translated := make([]Segment, len(segments))
-	copy(translated, segments)
-
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-
-	jobs := make(chan int)
-	var wg sync.WaitGroup
-	errCh := make(chan error, 1)
-
-	workerFn := func() {
-		defer wg.Done()
-		for idx := range jobs {
-			if ctx.Err() != nil {
-				return
-			}
-			text := strings.TrimSpace(translated[idx].Text)
-			if text == "" {
-				continue
-			}
-			if isLowInfoText(text, minTranslateChars) {
-				continue
-			}
-			var output string
-			err := retry(
-				ctx,
-				maxRetries,
-				baseRetryDelay,
-				maxRetryDelay,
-				isRetryable,
-				func(attempt int, delay time.Duration, err error) {
-					logf("Translation failed; retrying in %.1fs (attempt %d). %s", delay.Seconds(), attempt, describeError(err))
-				},
-				func() error {
-					var err error
-					output, err = client.Translate(ctx, model, sourceLang, targetLang, text)
-					return err
-				},
-			)
-			if err != nil {
-				select {
-				case errCh <- err:
-				default:
+	if needTranslate && *translateFallback != "" {
+		primary := "openai"
+		if azure != "" {
+			primary = "azure"
+		}
+		if *translatePlugin != "" {
+			primary = "plugin:" + *translatePlugin
+		} else if *llmPlugin != "" {
+			primary = "llm-plugin:" + *llmPlugin
+		}
+		failover := &subtitle.FailoverTranslator{
+			Backends: []subtitle.TranslatorBackend{{Name: primary, Translator: pipeline.Translator}},
+			Retry:    retryPolicy,
+			Progress: progress,
+		}
+		for _, name := range splitList(*translateFallback) {
+			b := subtitle.TranslatorBackend{Name: name}
+			if name == "openai" {
+				if apiKey == "" {
+					logger.Errorf("%s is not set (needed by --translate-fallback openai)", keyEnv)
+					return exitUsage
 				}
-				cancel()
-				return
+				b.Translator = client
+			} else if command, ok := strings.CutPrefix(name, "plugin:"); ok {
+				p, err := subtitle.StartPlugin(command, plugin.MethodTranslate)
+				if err != nil {
+					logger.Errorf("Failed to start translation plugin: %v", err)
+					return exitMissingDep
+				}
+				defer p.Close()
+				b.Translator = subtitle.PluginTranslator{P: p}
+			} else if command, ok := strings.CutPrefix(name, "llm-plugin:"); ok {
+				p, err := subtitle.StartPlugin(command, plugin.MethodComplete)
+				if err != nil {
+					logger.Errorf("Failed to start LLM plugin: %v", err)
+					return exitMissingDep
+				}
+				defer p.Close()
+				b.Translator = subtitle.LLMTranslator{LLM: p, Prompt: client.Prompt}
+			} else {
+				logger.Errorf("Unknown --translate-fallback %q (want openai, plugin:COMMAND or llm-plugin:COMMAND).", name)
+				return exitUsage
 			}
-			translated[idx].Text = output
+			failover.Backends = append(failover.Backends, b)
 		}
-	}
-
-	for i := 0; i < workers; i++ {
-		wg.Add(1)
-		go workerFn()
-	}
-
-sendLoop:
-	for i := range segments {
-		select {
-		case <-ctx.Done():
-			break sendLoop
-		case jobs <- i:
+		pipeline.Translator = failover
+		// The review pass fails over too, between the backends that can
+		// run it; a plugin-only chain keeps the reviewer it had.
+		for _, b := range failover.Backends {
+			if _, ok := b.Translator.(subtitle.ChatCompleter); ok {
+				pipeline.Reviewer = failover
+				break
+			}
 		}
 	}
-	close(jobs)
-	wg.Wait()
-
-	select {
-	case err := <-errCh:
-		return nil, err
-	default:
+	if !transcribe && *keepAudio {
+		logger.Printf("Ignoring --keep-audio: nothing is transcribed.")
+		*keepAudio = false
 	}
-	return translated, nil
-}
 
-func copyFile(src, dst string) error {
-	input, err := os.Open(src)
-	if err != nil {
-		return err
+	if *highAccuracy {
+		*minTranslateChars = 0
 	}
-	defer input.Close()
 
-	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
-		return err
+	pipeline.Options = subtitle.Options{
+		Model:             transcribeModel,
+		SourceLang:        *sourceLang,
+		TranslateModel:    *translateModel,
+		AudioFormat:       format,
+		Extract:           subtitle.ExtractOptions{Track: *audioStream, Normalize: *normalizeAudio},
+		KeepAudio:         *keepAudio,
+		Start:             start,
+		End:               end,
+		Skip:              skipRanges,
+		SkipSilence:       *skipSilence,
+		SilenceDB:         *silenceDB,
+		MinSilence:        *minSilence,
+		ChunkSeconds:      *chunkSeconds,
+		ChunkOverlap:      *chunkOverlap,
+		NoChapters:        *noChapters,
+		MaxAudioMB:        maxUploadMB,
+		TranscribeWorkers: *transcribeWorkers,
+		Accurate:          *highAccuracy,
+		Prompt:            *transcribePrompt,
+		Temperature:       *transcribeTemperature,
+		ChainChunks:       *chainChunks,
+		Stream:            *stream,
+		Script:            script,
+		PreferEmbedded:    *preferEmbedded,
+		NoClean:           *noClean,
+		MergeUnder:        *mergeUnder,
+		MergeGap:          *mergeGap,
+		Retry:             retryPolicy,
+		TranslateWorkers:  *translateWorkers,
+		MinTranslateChars: *minTranslateChars,
+		ContextSegments:   *contextSegments,
+		RequestsPerMinute: *translateRPM,
+		TokensPerMinute:   *translateTPM,
+		Review:            *review,
+		ReviewModel:       *reviewModel,
+		ReviewBatch:       *reviewBatch,
+		NoNormalize:       *noNormalize,
+		Censor:            censor,
+		MaxCueSeconds:     *maxCueSeconds,
+		MaxLineChars:      *maxLineChars,
+		ShiftSeconds:      *shiftSeconds,
+		ScaleFactor:       *scaleFactor,
+		FixTiming:         *fixTiming,
+	}
+	timingLimits := func(lang string) subtitle.TimingLimits {
+		limits := subtitle.DefaultTimingLimits(lang)
+		limits.MinSeconds = *minCueSeconds
+		if *maxCPS > 0 {
+			limits.MaxCPS = *maxCPS
+		}
+		return limits
 	}
-	output, err := os.Create(dst)
-	if err != nil {
-		return err
+	pipeline.TimingLimits = timingLimits(*sourceLang)
+	if needTranslate {
+		pipeline.TargetLang = *targetLang
+		pipeline.TimingLimits = timingLimits(*targetLang)
 	}
-	defer output.Close()
 
-	if _, err := io.Copy(output, input); err != nil {
-		return err
+	cpKey := subtitle.InputCheckpointKey(info)
+	cpKey.Model = transcribeModel
+	if useProvider {
+		cpKey.Model = *sttProviderName + "/" + transcribeModel
 	}
-	return output.Sync()
-}
-
-func run() int {
-	quiet := flag.Bool("quiet", false, "Suppress progress output")
-	output := flag.String("output", "", "Output SRT path (defaults to input path with .srt)")
-	shortOutput := flag.String("o", "", "Output SRT path (shorthand)")
-	whisperModel := flag.String("whisper-model", defaultWhisperModel, "Whisper model")
-	sourceLang := flag.String("source-lang", defaultSourceLang, "Source language")
-	targetLang := flag.String("target-lang", defaultTargetLang, "Target language")
-	translateModel := flag.String("translate-model", defaultTranslateModel, "Translation model")
-	noTranslate := flag.Bool("no-translate", false, "Skip translation and output original transcript")
-	chunkSeconds := flag.Int("chunk-seconds", 0, "Split audio into chunks of N seconds before transcription")
-	maxAudioMB := flag.Int("max-audio-mb", defaultMaxAudioMB, "Auto-chunk when extracted audio exceeds this size (MB)")
-	keepAudio := flag.Bool("keep-audio", false, "Keep the extracted audio file")
-	translateWorkers := flag.Int("translate-workers", defaultTranslateWorkers, "Number of concurrent translation workers")
-	minTranslateChars := flag.Int("min-translate-chars", 4, "Skip translation for segments with fewer than N letters/numbers (0 to disable)")
-	timeoutSeconds := flag.Int("timeout-seconds", defaultTimeoutSeconds, "HTTP timeout for OpenAI requests (seconds)")
-	highAccuracy := flag.Bool("high-accuracy", false, "Use higher-accuracy transcription settings (slower)")
-	flag.Parse()
-
-	if flag.NArg() < 1 {
-		fmt.Fprintln(os.Stderr, "Input file is required.")
-		flag.Usage()
-		return 1
+	cpKey.Language = *sourceLang
+	if *audioStream >= 0 {
+		cpKey.AudioTrack = fmt.Sprint(*audioStream)
 	}
-
-	inputPath := flag.Arg(0)
-	info, err := os.Stat(inputPath)
-	if err != nil || info.IsDir() {
-		fmt.Fprintf(os.Stderr, "Input file not found: %s\n", inputPath)
-		return 1
+	if *normalizeAudio {
+		cpKey.AudioFilter = subtitle.NormalizeFilter
 	}
-
-	if _, err := exec.LookPath("ffmpeg"); err != nil {
-		fmt.Fprintln(os.Stderr, "ffmpeg is required on PATH.")
-		return 1
+	if trimming {
+		cpKey.Regions = fmt.Sprintf("%g-%g skip %v", start, end, skipRanges)
 	}
-
-	apiKey := strings.TrimSpace(os.Getenv("OPENAI_API_KEY"))
-	if apiKey == "" {
-		fmt.Fprintln(os.Stderr, "OPENAI_API_KEY is not set")
-		return 1
-	}
-
-	outputPath := *output
-	if outputPath == "" {
-		outputPath = *shortOutput
+	if *skipSilence {
+		cpKey.SkipSilence = fmt.Sprintf("%gdB/%gs", *silenceDB, *minSilence)
 	}
-	if outputPath == "" {
-		ext := filepath.Ext(inputPath)
-		outputPath = strings.TrimSuffix(inputPath, ext) + ".srt"
+	cp := subtitle.OpenCheckpoint(subtitle.CheckpointPath(inputPath), cpKey, *noResume)
+	if importMode || repairMode || stdinInput || joinParts {
+		cp = nil
 	}
+	defer cp.Save(true)
+	pipeline.Checkpoint = cp
 
-	client := newOpenAIClient(apiKey, time.Duration(*timeoutSeconds)*time.Second)
-	ctx := context.Background()
+	if *memoryPath != "" && needTranslate {
+		if *memorySimilarity < 0 || *memorySimilarity > 1 {
+			logger.Errorf("--memory-similarity must be between 0 and 1.")
+			return exitUsage
+		}
+		memory, err := subtitle.OpenTranslationMemory(*memoryPath)
+		if err != nil {
+			logger.Errorf("Failed to load translation memory: %v", err)
+			return exitUsage
+		}
+		memory.MinSimilarity = *memorySimilarity
+		logger.Printf("Loaded %d remembered translations from %s.", memory.Len(), *memoryPath)
+		pipeline.Memory = memory
+	}
 
-	logf := func(format string, args ...any) {
-		if *quiet {
+	// writePartial leaves the cues of a translation that stopped early in
+	// <output>.partial.<ext>, those it did not get to marked [untranslated]
+	// for --repair.
+	writePartial := func(r *subtitle.Result) {
+		if r == nil || len(r.Segments) == 0 {
+			return
+		}
+		pipeline.Finish(r)
+		path := partialOutputPath(outputPath)
+		if err := subtitle.WriteSubtitles(r.Segments, path); err != nil {
+			logger.Errorf("Failed to write partial subtitles: %v", err)
 			return
 		}
-		fmt.Fprintf(os.Stderr, format+"\n", args...)
+		logger.Printf("Wrote %d cues to %s (partial; --repair translates the ones marked [untranslated]).", len(r.Segments), path)
+		logger.Event("partial", "path", path, "segments", len(r.Segments))
+	}
+	// interrupted ends a run stopped by a signal. The cues go to the partial
+	// output; the checkpoint lets a rerun continue.
+	interrupted := func(r *subtitle.Result) int {
+		writePartial(r)
+		if cp != nil {
+			cp.Save(true)
+			logger.Printf("Progress is saved in %s; run the same command again to resume.", cp.Path())
+		}
+		logger.Errorf("Interrupted.")
+		return exitInterrupted
+	}
+	// failed reports a pipeline error with the exit status for its stage.
+	failed := func(err error) int {
+		var stageErr *subtitle.StageError
+		if !errors.As(err, &stageErr) {
+			logger.Errorf("%v", err)
+			return exitFailure
+		}
+		if errors.Is(err, workspace.ErrQuotaExceeded) {
+			logger.Errorf("%v", err)
+			return exitFailure
+		}
+		switch stageErr.Stage {
+		case "read":
+			logger.Errorf("Failed to read subtitles: %v", err)
+			return exitBadInput
+		case "extract_audio":
+			logger.Errorf("%v", err)
+			return exitBadInput
+		case "translate":
+			logger.Errorf("Translation failed: %v", err)
+			return exitTranslate
+		case "review":
+			logger.Errorf("Review failed: %v", err)
+			return exitTranslate
+		}
+		logger.Errorf("%v", err)
+		return exitTranscribe
 	}
 
-	tmpDir, err := os.MkdirTemp("", "video-subtitle-*")
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to create temp dir: %v\n", err)
-		return 1
+	var result *subtitle.Result
+	var imported subtitle.SegmentsFile
+	if importMode {
+		var source, segments []subtitle.Segment
+		imported, source, segments, err = subtitle.ImportSegmentsJSON(*importJSON)
+		if err != nil {
+			logger.Errorf("Failed to import segments: %v", err)
+			return exitBadInput
+		}
+		logger.Printf("Loaded %d segments from %s; skipping transcription and translation.", len(segments), *importJSON)
+		result = &subtitle.Result{Source: source, Segments: segments, Translated: imported.TargetLang != ""}
+		if result.Translated {
+			pipeline.TimingLimits = timingLimits(imported.TargetLang)
+		}
+	} else if repairMode {
+		segments, err := subtitle.ReadSubtitleFile(*repairPath)
+		if err != nil {
+			logger.Errorf("Failed to read subtitles: %v", err)
+			return exitBadInput
+		}
+		repaired, _, err := pipeline.Repair(ctx, segments)
+		result = &subtitle.Result{Source: segments, Segments: repaired, Translated: true}
+		if err != nil {
+			if ctx.Err() != nil {
+				return interrupted(result)
+			}
+			writePartial(result)
+			return failed(err)
+		}
+	} else {
+		if joinParts {
+			result, err = pipeline.TranscribeParts(ctx, parts)
+		} else {
+			result, err = pipeline.Transcribe(ctx, inputPath)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return interrupted(nil)
+			}
+			return failed(err)
+		}
+		if err := pipeline.Translate(ctx, result); err != nil {
+			if ctx.Err() != nil {
+				return interrupted(result)
+			}
+			writePartial(result)
+			return failed(err)
+		}
 	}
-	defer os.RemoveAll(tmpDir)
 
-	audioPath := filepath.Join(tmpDir, "audio.wav")
-	logf("Extracting audio...")
-	if err := extractAudio(inputPath, audioPath); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return 1
+	if *exportJSON != "" {
+		var translated []subtitle.Segment
+		if result.Translated {
+			translated = result.Segments
+		}
+		targetTag := *targetLang
+		if importMode {
+			targetTag = imported.TargetLang
+		}
+		if err := subtitle.ExportSegmentsJSON(*exportJSON, *sourceLang, targetTag, result.Source, translated); err != nil {
+			logger.Errorf("Failed to export segments: %v", err)
+			return exitWrite
+		}
+		logger.Printf("Wrote segments %s", *exportJSON)
 	}
 
-	audioSizeBytes, err := audioSize(audioPath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to read extracted audio: %v\n", err)
-		return 1
-	}
-	if audioSizeBytes < 1024 {
-		fmt.Fprintln(os.Stderr, "Extracted audio is empty or too small.")
-		return 1
-	}
+	pipeline.Finish(result)
+	segments, sourceSegments := result.Segments, result.Source
 
-	if *highAccuracy {
-		*minTranslateChars = 0
+	logger.Printf("Writing subtitles...")
+	stageDone := progress.Stage("write")
+	if err := subtitle.WriteSubtitles(segments, outputPath); err != nil {
+		logger.Errorf("Failed to write subtitles: %v", err)
+		return exitWrite
 	}
-
-	maxAudioBytes := int64(*maxAudioMB) * 1024 * 1024
-	useChunking := *chunkSeconds > 0 || audioSizeBytes > maxAudioBytes
-	chunkSecondsValue := *chunkSeconds
-
-	if useChunking {
-		if _, err := exec.LookPath("ffprobe"); err != nil {
-			fmt.Fprintln(os.Stderr, "ffprobe is required for chunked transcription.")
-			return 1
+	stageDone("segments", len(segments), "path", outputPath)
+	if *reviewUIFlag {
+		// Edits land before the timing check, --mux and --burn-in.
+		media := ""
+		if videoInput {
+			media = inputPath
 		}
-	}
-	if *chunkSeconds <= 0 && audioSizeBytes > maxAudioBytes {
-		chunkSecondsValue, err = chooseChunkSeconds(audioPath, defaultChunkSeconds, maxAudioBytes)
+		segments, err = runReviewUI(ctx, *reviewUIListen, media, outputPath, ws.Path("review.vtt"), segments, logger, *logFormat == "text")
 		if err != nil {
-			logf("Failed to calculate chunk size; using default %ds.", defaultChunkSeconds)
-			chunkSecondsValue = defaultChunkSeconds
+			logger.Errorf("Failed to serve the review page: %v", err)
+			return exitFailure
 		}
-		logf("Audio is large (%.1f MB); auto-chunking with %ds segments.", float64(audioSizeBytes)/(1024*1024), chunkSecondsValue)
-	} else if *chunkSeconds > 0 {
-		logf("Chunking audio into %ds segments.", chunkSecondsValue)
 	}
-
-	logf("Transcribing with Whisper...")
-	segments, err := func() ([]Segment, error) {
-		if useChunking {
-			return transcribeInChunks(ctx, client, audioPath, *whisperModel, *sourceLang, chunkSecondsValue, *highAccuracy, logf)
+	issues := subtitle.CheckTiming(segments, pipeline.TimingLimits)
+	if len(issues) > 0 {
+		counts := map[string]int{}
+		for _, issue := range issues {
+			counts[issue.Kind]++
 		}
-		return transcribeWithRetry(ctx, client, audioPath, *whisperModel, *sourceLang, logf)
-	}()
-	if err != nil {
-		if !useChunking && shouldFallbackToChunking(err) {
-			if _, errProbe := exec.LookPath("ffprobe"); errProbe != nil {
-				fmt.Fprintln(os.Stderr, "ffprobe is required for chunked transcription.")
-				return 1
+		var summary []string
+		for _, kind := range []string{subtitle.IssueOverlap, subtitle.IssueNegative, subtitle.IssueShort, subtitle.IssueReadingSpeed} {
+			if counts[kind] > 0 {
+				summary = append(summary, fmt.Sprintf("%d %s", counts[kind], kind))
 			}
-			logf("Whisper request failed; retrying in chunks. Chunk size: %ds.", defaultChunkSeconds)
-			segments, err = transcribeInChunks(ctx, client, audioPath, *whisperModel, *sourceLang, defaultChunkSeconds, *highAccuracy, logf)
+		}
+		hint := ""
+		if !*fixTiming {
+			hint = "; --fix-timing adjusts minor ones"
+		}
+		logger.Printf("Timing check warnings: %d (%s)%s", len(issues), strings.Join(summary, ", "), hint)
+		for i, issue := range issues {
+			if i == maxQCWarnings {
+				logger.Printf("  ... and %d more", len(issues)-i)
+				break
+			}
+			logger.Printf("  %s", issue)
 		}
 	}
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Transcription failed: %v\n", err)
-		return 1
+	logger.Event("qc", "issues", len(issues))
+	if *qcReport != "" {
+		if err := subtitle.WriteTimingReport(issues, *qcReport); err != nil {
+			logger.Errorf("Failed to write timing report: %v", err)
+			return exitWrite
+		}
+		logger.Printf("Wrote timing report %s", *qcReport)
 	}
-
-	if !*noTranslate && *sourceLang != *targetLang {
-		workers := *translateWorkers
-		if workers <= 0 {
-			workers = runtime.NumCPU()
+	if *saveTranscript && needTranslate {
+		path := subtitle.TranscriptPath(outputPath, *sourceLang, filepath.Ext(outputPath))
+		if err := subtitle.WriteSubtitles(sourceSegments, path); err != nil {
+			logger.Errorf("Failed to write transcript: %v", err)
+			return exitWrite
 		}
-		translatable := countTranslatableSegments(segments, *minTranslateChars)
-		if translatable == 0 {
-			logf("Skipping translation: segments are low-info.")
-		} else {
-			logf("Translating segments (%d of %d segments, %d workers)...", translatable, len(segments), workers)
-			translated, err := translateSegments(ctx, client, segments, *sourceLang, *targetLang, *translateModel, workers, *minTranslateChars, logf)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Translation failed: %v\n", err)
-				return 1
+		logger.Printf("Wrote transcript %s", path)
+	}
+	if *transcriptText {
+		path := subtitle.TranscriptPath(outputPath, *sourceLang, ".txt")
+		if err := subtitle.WriteTranscriptText(sourceSegments, path); err != nil {
+			logger.Errorf("Failed to write transcript: %v", err)
+			return exitWrite
+		}
+		logger.Printf("Wrote transcript %s", path)
+	}
+	if *perFile {
+		for i, partSegments := range pipeline.SplitParts(result) {
+			input := result.Parts[i].Input
+			path := strings.TrimSuffix(input, filepath.Ext(input)) + filepath.Ext(outputPath)
+			if err := subtitle.WriteSubtitles(partSegments, path); err != nil {
+				logger.Errorf("Failed to write subtitles for %s: %v", input, err)
+				return exitWrite
 			}
-			segments = translated
+			logger.Printf("Wrote %s", path)
 		}
 	}
-
-	logf("Writing SRT...")
-	if err := writeSRT(segments, outputPath); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to write SRT: %v\n", err)
-		return 1
+	if *mux {
+		muxPath := *muxOutput
+		if muxPath == "" {
+			muxPath = subtitle.MuxOutputPath(inputPath)
+		}
+		trackLang := *sourceLang
+		if needTranslate {
+			trackLang = *targetLang
+		}
+		logger.Printf("Embedding subtitles into %s...", muxPath)
+		stageDone := progress.Stage("mux")
+		if err := subtitle.MuxSubtitles(inputPath, outputPath, muxPath, trackLang); err != nil {
+			logger.Errorf("Failed to embed subtitles: %v", err)
+			return exitWrite
+		}
+		stageDone("path", muxPath)
+	}
+	if *burnIn {
+		burnPath := *burnInOutput
+		if burnPath == "" {
+			burnPath = subtitle.BurnInOutputPath(inputPath)
+		}
+		// Render from a copy with a plain name so the filter argument does
+		// not depend on how exotic the output path is.
+		burnSRT := ws.Path("burn-in" + filepath.Ext(outputPath))
+		if err := copyFile(outputPath, burnSRT); err != nil {
+			logger.Errorf("Failed to prepare subtitles for burn-in: %v", err)
+			return exitWrite
+		}
+		logger.Printf("Burning subtitles into %s (this re-encodes the video)...", burnPath)
+		stageDone := progress.Stage("burn_in")
+		err := subtitle.BurnInSubtitles(inputPath, burnSRT, burnPath, subtitle.BurnInOptions{
+			CRF:      *crf,
+			Preset:   *preset,
+			Font:     *font,
+			FontSize: *fontSize,
+		})
+		if err != nil {
+			logger.Errorf("Failed to burn in subtitles: %v", err)
+			return exitWrite
+		}
+		stageDone("path", burnPath)
+	}
+	if !*keepState {
+		if err := cp.Remove(); err != nil {
+			logger.Printf("Failed to remove checkpoint %s: %v", cp.Path(), err)
+		}
 	}
 
 	if *keepAudio {
-		kept := strings.TrimSuffix(inputPath, filepath.Ext(inputPath)) + ".wav"
-		if err := copyFile(audioPath, kept); err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to keep audio: %v\n", err)
-			return 1
+		kept := strings.TrimSuffix(inputPath, filepath.Ext(inputPath)) + format.Ext
+		if stdinInput {
+			kept = strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + format.Ext
+		}
+		if err := copyFile(result.AudioPath, kept); err != nil {
+			logger.Errorf("Failed to keep audio: %v", err)
+			return exitWrite
 		}
-		logf("Kept audio at %s", kept)
+		logger.Printf("Kept audio at %s", kept)
 	}
 
-	logf("Wrote %s", outputPath)
-	return 0
+	logger.Printf("Wrote %s", outputPath)
+	logger.Event("done", "path", outputPath, "segments", len(segments))
+	summary.Segments = len(segments)
+	return exitOK
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "watch":
+			os.Exit(runWatch(os.Args[2:]))
+		case "serve":
+			os.Exit(runServe(os.Args[2:]))
+		}
+	}
 	os.Exit(run())
 }
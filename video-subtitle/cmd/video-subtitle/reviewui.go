@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"video-subtitle/subtitle"
+)
+
+// reviewUI serves the --review-ui page: the video with the cues as a
+// track, next to the cue text to edit. Every save rewrites the output file,
+// so the subtitles on disk always match the page.
+type reviewUI struct {
+	// media is the video to play, or "" for a subtitle input.
+	media  string
+	output string
+	// track is a WebVTT copy of the cues for the video's <track>.
+	track string
+	done  chan struct{}
+	once  sync.Once
+
+	mu       sync.Mutex
+	segments []subtitle.Segment
+}
+
+// runReviewUI serves the page on listen until it is closed with its Done
+// button or ctx ends, and returns the cues as edited.
+func runReviewUI(ctx context.Context, listen, media, output, track string, segments []subtitle.Segment, logger *progressLog, textLog bool) ([]subtitle.Segment, error) {
+	ui := &reviewUI{
+		media:    media,
+		output:   output,
+		track:    track,
+		done:     make(chan struct{}),
+		segments: append([]subtitle.Segment{}, segments...),
+	}
+	if err := subtitle.WriteSubtitles(ui.segments, track); err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", ui.handlePage)
+	mux.HandleFunc("GET /media", ui.handleMedia)
+	mux.HandleFunc("GET /cues.vtt", ui.handleTrack)
+	mux.HandleFunc("PUT /cues", ui.handleSave)
+	mux.HandleFunc("GET /subtitles", ui.handleDownload)
+	mux.HandleFunc("POST /done", ui.handleDone)
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+
+	url := "http://" + listener.Addr().String() + "/"
+	if textLog {
+		fmt.Fprintf(os.Stderr, "Review the subtitles at %s (Done on the page or Ctrl-C to finish)\n", url)
+	}
+	logger.Event("review_ui", "url", url)
+	select {
+	case <-ui.done:
+	case <-ctx.Done():
+	}
+	shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	server.Shutdown(shutdown)
+
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	return ui.segments, nil
+}
+
+type reviewCue struct {
+	Start, End float64
+	Text       string
+}
+
+func (ui *reviewUI) handlePage(w http.ResponseWriter, r *http.Request) {
+	ui.mu.Lock()
+	cues := make([]reviewCue, len(ui.segments))
+	for i, seg := range ui.segments {
+		cues[i] = reviewCue{seg.Start, seg.End, seg.Text}
+	}
+	ui.mu.Unlock()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := reviewPage.Execute(w, map[string]any{
+		"Title":    filepath.Base(ui.output),
+		"HasMedia": ui.media != "",
+		"Cues":     cues,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (ui *reviewUI) handleMedia(w http.ResponseWriter, r *http.Request) {
+	if ui.media == "" {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeFile(w, r, ui.media)
+}
+
+func (ui *reviewUI) handleTrack(w http.ResponseWriter, r *http.Request) {
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	http.ServeFile(w, r, ui.track)
+}
+
+// handleSave takes the text of every cue, in order, and writes the output
+// file with it.
+func (ui *reviewUI) handleSave(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Texts []string `json:"texts"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	if len(body.Texts) != len(ui.segments) {
+		httpError(w, http.StatusBadRequest, fmt.Sprintf("want %d texts, got %d", len(ui.segments), len(body.Texts)))
+		return
+	}
+	edited := append([]subtitle.Segment{}, ui.segments...)
+	changed := 0
+	for i, text := range body.Texts {
+		if text != edited[i].Text {
+			edited[i].Text = text
+			changed++
+		}
+	}
+	err := subtitle.WriteSubtitles(edited, ui.output)
+	if err == nil {
+		err = subtitle.WriteSubtitles(edited, ui.track)
+	}
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	ui.segments = edited
+	writeJSON(w, http.StatusOK, map[string]any{"path": ui.output, "changed": changed})
+}
+
+func (ui *reviewUI) handleDownload(w http.ResponseWriter, r *http.Request) {
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(ui.output)))
+	http.ServeFile(w, r, ui.output)
+}
+
+func (ui *reviewUI) handleDone(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"path": ui.output})
+	ui.once.Do(func() { close(ui.done) })
+}
+
+var reviewPage = template.Must(template.New("review").Funcs(template.FuncMap{
+	"clock": func(seconds float64) string {
+		ms := int64(seconds*1000 + 0.5)
+		return fmt.Sprintf("%d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} - video-subtitle review</title>
+<style>
+body { font-family: sans-serif; margin: 0; display: flex; height: 100vh; }
+#player { flex: 1; display: flex; flex-direction: column; padding: 1em; gap: 1em; }
+video { width: 100%; max-height: 80vh; background: #000; }
+#cues { flex: 1; overflow-y: auto; padding: 1em; border-left: 1px solid #ccc; }
+.cue { display: flex; gap: .5em; margin-bottom: .5em; padding: .25em; }
+.cue.active { background: #fff3c4; }
+.cue button { font-family: monospace; white-space: nowrap; }
+.cue textarea { flex: 1; font: inherit; }
+#status { color: #666; }
+</style>
+</head>
+<body>
+<div id="player">
+{{if .HasMedia}}<video id="video" controls src="/media"><track id="track" kind="subtitles" src="/cues.vtt" default></video>{{end}}
+<div>
+<button id="save">Save</button>
+<a href="/subtitles">Download</a>
+<button id="done">Done</button>
+<span id="status"></span>
+</div>
+</div>
+<div id="cues">
+{{range .Cues}}<div class="cue" data-start="{{.Start}}" data-end="{{.End}}">
+<button title="Play from here">{{clock .Start}}</button>
+<textarea rows="2">{{.Text}}</textarea>
+</div>
+{{end}}</div>
+<script>
+const video = document.getElementById("video");
+const cues = [...document.querySelectorAll(".cue")];
+const status = document.getElementById("status");
+cues.forEach(cue => {
+  cue.querySelector("button").onclick = () => {
+    if (video) { video.currentTime = +cue.dataset.start; video.play(); }
+  };
+  cue.querySelector("textarea").oninput = () => { status.textContent = "Unsaved changes"; };
+});
+if (video) {
+  video.ontimeupdate = () => {
+    const t = video.currentTime;
+    cues.forEach(cue => cue.classList.toggle("active", t >= +cue.dataset.start && t < +cue.dataset.end));
+  };
+}
+async function save() {
+  const texts = cues.map(cue => cue.querySelector("textarea").value);
+  const resp = await fetch("/cues", {method: "PUT", headers: {"Content-Type": "application/json"}, body: JSON.stringify({texts})});
+  const result = await resp.json();
+  if (!resp.ok) { status.textContent = "Save failed: " + result.error; return false; }
+  status.textContent = "Saved " + result.path;
+  const track = document.getElementById("track");
+  if (track) { track.src = "/cues.vtt?" + Date.now(); video.textTracks[0].mode = "showing"; }
+  return true;
+}
+document.getElementById("save").onclick = save;
+document.getElementById("done").onclick = async () => {
+  if (status.textContent === "Unsaved changes" && !await save()) return;
+  await fetch("/done", {method: "POST"});
+  status.textContent = "Done; you can close this page.";
+};
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Job states reported by the serve API.
+const (
+	jobQueued  = "queued"
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+// jobRequest is the JSON body of POST /jobs. Exactly one of Path and URL is
+// set, unless the media is uploaded as the request body instead. Only these
+// options are accepted from clients; everything else comes from the flags
+// given to serve after "--".
+type jobRequest struct {
+	Path        string `json:"path,omitempty"`
+	URL         string `json:"url,omitempty"`
+	SourceLang  string `json:"source_lang,omitempty"`
+	TargetLang  string `json:"target_lang,omitempty"`
+	NoTranslate bool   `json:"no_translate,omitempty"`
+	Format      string `json:"format,omitempty"`
+}
+
+type job struct {
+	ID       string     `json:"id"`
+	Status   string     `json:"status"`
+	Input    string     `json:"input"`
+	Stage    string     `json:"stage,omitempty"`
+	Chunks   int        `json:"chunks,omitempty"`
+	ChunksOK int        `json:"chunks_done,omitempty"`
+	Segments int        `json:"segments,omitempty"`
+	Error    string     `json:"error,omitempty"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+
+	req    jobRequest
+	dir    string
+	media  string
+	output string
+}
+
+type jobServer struct {
+	dataDir  string
+	root     string
+	self     string
+	baseArgs []string
+	queue    chan *job
+
+	mu   sync.Mutex
+	jobs map[string]*job
+}
+
+// runServe implements "video-subtitle serve [-- flags...]": a small REST
+// API that queues subtitle jobs and runs them with this binary.
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: video-subtitle serve [options] [-- video-subtitle flags...]")
+		fs.PrintDefaults()
+	}
+	listen := fs.String("listen", "127.0.0.1:8080", "Address to serve the API on")
+	workers := fs.Int("jobs", 1, "Number of jobs run at the same time")
+	queueSize := fs.Int("queue", 16, "Jobs that may wait before new ones are refused")
+	dataDir := fs.String("data-dir", filepath.Join(os.TempDir(), "video-subtitle-serve"), "Directory for uploads and results")
+	root := fs.String("root", "", "Allow jobs for local files under this directory (path requests are refused without it)")
+	fs.Parse(args)
+
+	baseArgs := fs.Args()
+	if len(baseArgs) > 0 && baseArgs[0] == "--" {
+		baseArgs = baseArgs[1:]
+	}
+	if *workers <= 0 || *queueSize < 0 {
+		fmt.Fprintln(os.Stderr, "--jobs must be positive and --queue not negative.")
+		return 1
+	}
+	self, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to locate own binary: %v\n", err)
+		return 1
+	}
+	if err := os.MkdirAll(*dataDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create data dir: %v\n", err)
+		return 1
+	}
+	rootDir := ""
+	if *root != "" {
+		if rootDir, err = filepath.Abs(*root); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --root: %v\n", err)
+			return 1
+		}
+	}
+
+	s := &jobServer{
+		dataDir:  *dataDir,
+		root:     rootDir,
+		self:     self,
+		baseArgs: baseArgs,
+		queue:    make(chan *job, *queueSize),
+		jobs:     map[string]*job{},
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	for i := 0; i < *workers; i++ {
+		go s.work(ctx)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs", s.handleCreate)
+	mux.HandleFunc("GET /jobs", s.handleList)
+	mux.HandleFunc("GET /jobs/{id}", s.handleStatus)
+	mux.HandleFunc("GET /jobs/{id}/subtitles", s.handleDownload)
+	server := &http.Server{Addr: *listen, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdown)
+	}()
+
+	fmt.Fprintf(os.Stderr, "Serving on http://%s (%d concurrent jobs, queue %d)\n", *listen, *workers, *queueSize)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func httpError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// snapshot copies j under the lock for encoding.
+func (s *jobServer) snapshot(j *job) job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *j
+}
+
+func (s *jobServer) update(j *job, fn func(*job)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(j)
+}
+
+// handleCreate accepts either a JSON jobRequest or the media itself as the
+// body (any other content type), named by the "name" query parameter.
+// Options for uploads are passed as query parameters of the same names.
+func (s *jobServer) handleCreate(w http.ResponseWriter, r *http.Request) {
+	j := &job{ID: newJobID(), Status: jobQueued, Created: time.Now().UTC()}
+	j.dir = filepath.Join(s.dataDir, j.ID)
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&j.req); err != nil {
+			httpError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+	} else {
+		q := r.URL.Query()
+		j.req = jobRequest{
+			SourceLang:  q.Get("source_lang"),
+			TargetLang:  q.Get("target_lang"),
+			NoTranslate: q.Get("no_translate") == "true" || q.Get("no_translate") == "1",
+			Format:      q.Get("format"),
+		}
+	}
+	switch j.req.Format {
+	case "", "srt", "vtt", "ass":
+	default:
+		httpError(w, http.StatusBadRequest, "format must be srt, vtt or ass")
+		return
+	}
+
+	switch {
+	case j.req.Path != "" && j.req.URL != "":
+		httpError(w, http.StatusBadRequest, "give either path or url, not both")
+		return
+	case j.req.Path != "":
+		media, err := s.localPath(j.req.Path)
+		if err != nil {
+			httpError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		j.media, j.Input = media, media
+	case j.req.URL != "":
+		if !strings.HasPrefix(j.req.URL, "http://") && !strings.HasPrefix(j.req.URL, "https://") {
+			httpError(w, http.StatusBadRequest, "url must be http or https")
+			return
+		}
+		j.Input = j.req.URL
+	default:
+		name := filepath.Base(r.URL.Query().Get("name"))
+		if name == "." || name == "/" || name == "" {
+			name = "upload.mp4"
+		}
+		if err := os.MkdirAll(j.dir, 0755); err != nil {
+			httpError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		j.media, j.Input = filepath.Join(j.dir, name), name
+		if err := saveBody(j.media, r.Body); err != nil {
+			os.RemoveAll(j.dir)
+			httpError(w, http.StatusBadRequest, "upload failed: "+err.Error())
+			return
+		}
+	}
+
+	s.mu.Lock()
+	select {
+	case s.queue <- j:
+		s.jobs[j.ID] = j
+		s.mu.Unlock()
+	default:
+		s.mu.Unlock()
+		os.RemoveAll(j.dir)
+		httpError(w, http.StatusServiceUnavailable, "job queue is full")
+		return
+	}
+	w.Header().Set("Location", "/jobs/"+j.ID)
+	writeJSON(w, http.StatusAccepted, s.snapshot(j))
+}
+
+// localPath resolves a path request, which must name a file under --root.
+func (s *jobServer) localPath(path string) (string, error) {
+	if s.root == "" {
+		return "", errors.New("path jobs are disabled (start serve with --root)")
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+	if rel, err := filepath.Rel(s.root, abs); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside %s", path, s.root)
+	}
+	if info, err := os.Stat(abs); err != nil || info.IsDir() {
+		return "", fmt.Errorf("%s is not a file", path)
+	}
+	return abs, nil
+}
+
+func saveBody(path string, body io.Reader) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, body); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (s *jobServer) handleList(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	list := make([]job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		list = append(list, *j)
+	}
+	s.mu.Unlock()
+	sort.Slice(list, func(a, b int) bool { return list[a].Created.Before(list[b].Created) })
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *jobServer) lookup(w http.ResponseWriter, r *http.Request) *job {
+	s.mu.Lock()
+	j := s.jobs[r.PathValue("id")]
+	s.mu.Unlock()
+	if j == nil {
+		httpError(w, http.StatusNotFound, "no such job")
+	}
+	return j
+}
+
+func (s *jobServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if j := s.lookup(w, r); j != nil {
+		writeJSON(w, http.StatusOK, s.snapshot(j))
+	}
+}
+
+func (s *jobServer) handleDownload(w http.ResponseWriter, r *http.Request) {
+	j := s.lookup(w, r)
+	if j == nil {
+		return
+	}
+	snap := s.snapshot(j)
+	if snap.Status != jobDone {
+		httpError(w, http.StatusConflict, "job is "+snap.Status)
+		return
+	}
+	name := strings.TrimSuffix(filepath.Base(snap.Input), filepath.Ext(snap.Input)) + filepath.Ext(j.output)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	http.ServeFile(w, r, j.output)
+}
+
+func (s *jobServer) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case j := <-s.queue:
+			err := s.run(ctx, j)
+			s.update(j, func(j *job) {
+				now := time.Now().UTC()
+				j.Finished = &now
+				j.Stage = ""
+				if err != nil {
+					j.Status = jobFailed
+					if j.Error == "" {
+						j.Error = err.Error()
+					}
+					return
+				}
+				j.Status = jobDone
+			})
+		}
+	}
+}
+
+// run processes one job in a child process with --log-format json, and
+// turns its events into the job's progress fields.
+func (s *jobServer) run(ctx context.Context, j *job) error {
+	s.update(j, func(j *job) { j.Status = jobRunning })
+	if err := os.MkdirAll(j.dir, 0755); err != nil {
+		return err
+	}
+	if j.req.URL != "" {
+		s.update(j, func(j *job) { j.Stage = "download" })
+		media, err := downloadMedia(ctx, j.req.URL, j.dir)
+		if err != nil {
+			return fmt.Errorf("download failed: %w", err)
+		}
+		j.media = media
+	}
+	format := j.req.Format
+	if format == "" {
+		format = "srt"
+	}
+	j.output = filepath.Join(j.dir, "subtitles."+format)
+
+	args := append([]string{}, s.baseArgs...)
+	if j.req.SourceLang != "" {
+		args = append(args, "--source-lang", j.req.SourceLang)
+	}
+	if j.req.TargetLang != "" {
+		args = append(args, "--target-lang", j.req.TargetLang)
+	}
+	if j.req.NoTranslate {
+		args = append(args, "--no-translate")
+	}
+	args = append(args, "--log-format", "json", "--output", j.output, j.media)
+
+	cmd := exec.CommandContext(ctx, s.self, args...)
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(stderr)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event struct {
+			Msg      string `json:"msg"`
+			Stage    string `json:"stage"`
+			Count    int    `json:"count"`
+			Segments int    `json:"segments"`
+			Text     string `json:"text"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &event) != nil {
+			continue
+		}
+		s.update(j, func(j *job) {
+			switch event.Msg {
+			case "stage_start":
+				j.Stage = event.Stage
+			case "chunk_start":
+				j.Chunks = event.Count
+			case "chunk_end", "chunk_restored":
+				j.Chunks = event.Count
+				j.ChunksOK++
+			case "stage_end", "done":
+				if event.Segments > 0 {
+					j.Segments = event.Segments
+				}
+			case "error":
+				j.Error = event.Text
+			}
+		})
+	}
+	return cmd.Wait()
+}
+
+// downloadMedia fetches url into dir, keeping the extension of its path.
+func downloadMedia(ctx context.Context, url, dir string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	ext := filepath.Ext(req.URL.Path)
+	if ext == "" {
+		ext = ".mp4"
+	}
+	path := filepath.Join(dir, "download"+ext)
+	if err := saveBody(path, resp.Body); err != nil {
+		return "", err
+	}
+	return path, nil
+}
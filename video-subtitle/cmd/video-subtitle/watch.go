@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// watchStateName is the processed-files index kept in the watched dir.
+const watchStateName = ".video-subtitle-watch.json"
+
+const defaultWatchExts = "mp4,m4v,mov,mkv,webm,avi,flv,ts"
+
+// watchStopTimeout is how long a job has to wind down after Ctrl-C before
+// it is killed.
+const watchStopTimeout = 30 * time.Second
+
+// isGeneratedVideo reports whether name is a --mux or --burn-in output of
+// another file, which must not be picked up as a new recording.
+func isGeneratedVideo(name string) bool {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	return strings.HasSuffix(base, ".subtitled") || strings.HasSuffix(base, ".burned")
+}
+
+type watchEntry struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"`
+	Status  string `json:"status"` // "done" or "failed"
+	Error   string `json:"error,omitempty"`
+	Updated string `json:"updated"`
+}
+
+type watchState struct {
+	path  string
+	Files map[string]watchEntry `json:"files"`
+}
+
+func loadWatchState(dir string) (*watchState, error) {
+	s := &watchState{path: filepath.Join(dir, watchStateName), Files: map[string]watchEntry{}}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("%s: %v", s.path, err)
+	}
+	if s.Files == nil {
+		s.Files = map[string]watchEntry{}
+	}
+	return s, nil
+}
+
+func (s *watchState) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// handled reports whether name was already processed in its current form.
+// A file that changed since is processed again.
+func (s *watchState) handled(name string, info os.FileInfo) bool {
+	e, ok := s.Files[name]
+	return ok && e.Size == info.Size() && e.ModTime == info.ModTime().UnixNano()
+}
+
+// pendingFile is a candidate seen on an earlier poll; it is processed once
+// its size and mtime have stopped changing for the settle time, so files
+// still being recorded or copied are left alone.
+type pendingFile struct {
+	size    int64
+	modTime time.Time
+	stable  time.Time
+}
+
+// runWatch implements "video-subtitle watch <dir> [-- flags...]": it polls
+// dir for new media files and runs this binary on each, with the flags
+// after "--", writing subtitles next to them.
+func runWatch(args []string) int {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: video-subtitle watch [options] <dir> [-- video-subtitle flags...]")
+		fs.PrintDefaults()
+	}
+	interval := fs.Duration("interval", 5*time.Second, "How often to scan the directory")
+	settle := fs.Duration("settle", 10*time.Second, "How long a file's size must stay unchanged before it is processed")
+	exts := fs.String("ext", defaultWatchExts, "Comma-separated file extensions to process")
+	once := fs.Bool("once", false, "Process the files already there and exit instead of watching")
+	retryFailed := fs.Bool("retry-failed", false, "Process files that failed on an earlier run again")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return 1
+	}
+	dir := fs.Arg(0)
+	pipelineArgs := fs.Args()[1:]
+	if len(pipelineArgs) > 0 && pipelineArgs[0] == "--" {
+		pipelineArgs = pipelineArgs[1:]
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		fmt.Fprintf(os.Stderr, "Not a directory: %s\n", dir)
+		return 1
+	}
+	self, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to locate own binary: %v\n", err)
+		return 1
+	}
+	state, err := loadWatchState(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load watch state: %v\n", err)
+		return 1
+	}
+	if *retryFailed {
+		for name, e := range state.Files {
+			if e.Status == "failed" {
+				delete(state.Files, name)
+			}
+		}
+	}
+	wanted := map[string]bool{}
+	for _, ext := range strings.Split(*exts, ",") {
+		if ext = strings.TrimPrefix(strings.TrimSpace(strings.ToLower(ext)), "."); ext != "" {
+			wanted["."+ext] = true
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	pending := map[string]*pendingFile{}
+	failures := 0
+	if !*once {
+		fmt.Fprintf(os.Stderr, "Watching %s (Ctrl-C to stop)...\n", dir)
+	}
+	for {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read %s: %v\n", dir, err)
+			return 1
+		}
+		var ready []string
+		now := time.Now()
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || strings.HasPrefix(name, ".") || !wanted[strings.ToLower(filepath.Ext(name))] || isGeneratedVideo(name) {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil || state.handled(name, info) {
+				continue
+			}
+			p := pending[name]
+			if p == nil || p.size != info.Size() || !p.modTime.Equal(info.ModTime()) {
+				p = &pendingFile{size: info.Size(), modTime: info.ModTime(), stable: now}
+				pending[name] = p
+			}
+			// With --once there is nothing to wait for.
+			if *once || now.Sub(p.stable) >= *settle {
+				ready = append(ready, name)
+			}
+		}
+		sort.Strings(ready)
+
+		for _, name := range ready {
+			if ctx.Err() != nil {
+				return 130
+			}
+			delete(pending, name)
+			path := filepath.Join(dir, name)
+			info, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "Processing %s...\n", path)
+			cmd := exec.CommandContext(ctx, self, append(append([]string{}, pipelineArgs...), path)...)
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+			// Stop the job as Ctrl-C stops a run, so that it writes its
+			// partial output and saves its checkpoint; kill it only if that
+			// takes too long.
+			cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+			cmd.WaitDelay = watchStopTimeout
+			ownProcessGroup(cmd)
+			entry := watchEntry{
+				Size:    info.Size(),
+				ModTime: info.ModTime().UnixNano(),
+				Status:  "done",
+				Updated: time.Now().Format(time.RFC3339),
+			}
+			if err := cmd.Run(); err != nil {
+				if ctx.Err() != nil {
+					return 130
+				}
+				entry.Status, entry.Error = "failed", err.Error()
+				failures++
+				fmt.Fprintf(os.Stderr, "Failed %s: %v\n", path, err)
+			}
+			state.Files[name] = entry
+			if err := state.save(); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to save watch state: %v\n", err)
+				return 1
+			}
+		}
+
+		if *once {
+			if failures > 0 {
+				return 1
+			}
+			return 0
+		}
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-time.After(*interval):
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// ownProcessGroup keeps Ctrl-C on the terminal from reaching cmd, so that
+// it hears of it once, from the watcher, rather than twice, which would
+// make it quit without saving its work.
+func ownProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package main
+
+import "os/exec"
+
+// ownProcessGroup does nothing on Windows, where Ctrl-C reaches every
+// process of the console and cannot be sent to one.
+func ownProcessGroup(cmd *exec.Cmd) {}
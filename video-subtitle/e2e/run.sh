@@ -0,0 +1,89 @@
+#!/usr/bin/env bash
+# End-to-end checks for video-subtitle: runs the real binary against fake
+# ffmpeg/ffprobe and replayed OpenAI responses, so neither media tools nor an
+# API key are needed.
+#
+# Each directory under cases/ holds:
+#   args           extra CLI flags, one per line; relative paths resolve in
+#                  the case's work dir, next to the output
+#   input.srt/.vtt optional subtitle input (default: an empty input.mp4)
+#   inputs         optional further inputs, one per line, passed after the
+#                  input; they resolve in the work dir, like args
+#   env            optional KEY=value lines exported for the run
+#   cassette.json  HTTP interactions to replay (see pkg/httpreplay)
+#   files/         optional files copied into the work dir before the run
+#   expected.srt   golden output (expected.vtt or expected.ass to render
+#                  that format instead)
+#   expected-NAME  optional golden for another file the run writes next to
+#                  the output (e.g. expected-output.ja.srt)
+#
+# To refresh a cassette against the live API, run the tool with
+# VIDEO_SUBTITLE_HTTP_RECORD=path/to/cassette.json and real media.
+set -euo pipefail
+
+here="$(cd "$(dirname "$0")" && pwd)"
+work="$(mktemp -d)"
+trap 'rm -rf "$work"' EXIT
+
+go build -o "$work/video-subtitle" "$here/../cmd/video-subtitle"
+
+export PATH="$here/bin:$PATH"
+export OPENAI_API_KEY=e2e-dummy
+unset OPENAI_BASE_URL
+# Keep a developer's own config file out of the runs.
+export XDG_CONFIG_HOME="$work/xdg-config"
+
+# diff_extras compares each expected-NAME golden in $1 with NAME in $2.
+diff_extras() {
+  status=0
+  for extra in "$1"/expected-*; do
+    [ -e "$extra" ] || continue
+    diff -u "$extra" "$2/${extra##*/expected-}" || status=1
+  done
+  return "$status"
+}
+
+failed=0
+for dir in "$here"/cases/*/; do
+  name="$(basename "$dir")"
+  mkdir -p "$work/$name"
+  input="$work/$name/input.mp4"
+  expected="$(ls "$dir"/expected.* | head -n 1)"
+  output="$work/$name/output.${expected##*.}"
+  : > "$input"
+  if [ -d "$dir/files" ]; then cp -R "$dir/files/." "$work/$name/"; fi
+  for sub in "$dir"/input.srt "$dir"/input.vtt; do
+    if [ -f "$sub" ]; then
+      input="$work/$name/$(basename "$sub")"
+      cp "$sub" "$input"
+    fi
+  done
+
+  args=()
+  while IFS= read -r line || [ -n "$line" ]; do
+    [ -n "$line" ] && args+=("$line")
+  done < "$dir/args"
+  inputs=()
+  if [ -f "$dir/inputs" ]; then
+    while IFS= read -r line || [ -n "$line" ]; do
+      [ -n "$line" ] && inputs+=("$line")
+    done < "$dir/inputs"
+  fi
+
+  if (
+    cd "$work/$name"
+    # Cases share the fake audio, so each gets a transcription cache of its own.
+    export XDG_CACHE_HOME="$work/$name/cache"
+    if [ -f "$dir/env" ]; then set -a; . "$dir/env"; set +a; fi
+    VIDEO_SUBTITLE_HTTP_REPLAY="$dir/cassette.json" \
+      "$work/video-subtitle" --quiet ${args[@]+"${args[@]}"} --output "$output" "$input" ${inputs[@]+"${inputs[@]}"}
+  ) > "$work/$name/log" 2>&1 && diff -u "$expected" "$output" > "$work/$name/diff" &&
+    diff_extras "$dir" "$work/$name" >> "$work/$name/diff"; then
+    echo "ok    $name"
+  else
+    echo "FAIL  $name"
+    cat "$work/$name/log" "$work/$name/diff" 2>/dev/null | sed 's/^/      /'
+    failed=1
+  fi
+done
+exit "$failed"
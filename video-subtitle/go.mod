@@ -1,3 +1,7 @@
 module video-subtitle
 
 go 1.22
+
+require bag-of-tricks/pkg v0.0.0
+
+replace bag-of-tricks/pkg => ../pkg
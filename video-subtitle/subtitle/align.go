@@ -0,0 +1,190 @@
+package subtitle
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LoadScript reads the known text of a recording for Options.Script: one
+// cue per non-blank line.
+func LoadScript(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("%s: no text", path)
+	}
+	return lines, nil
+}
+
+// timedRune is one letter or digit of a transcript, with the stretch of
+// its cue it is assumed to take.
+type timedRune struct {
+	R     rune
+	Start float64
+	End   float64
+}
+
+// timedRunes spreads the letters and digits of each cue evenly over its
+// time.
+func timedRunes(segments []Segment) []timedRune {
+	var out []timedRune
+	for _, seg := range segments {
+		runes := []rune(normalizeCueText(seg.Text))
+		step := (seg.End - seg.Start) / float64(max(len(runes), 1))
+		for i, r := range runes {
+			start := seg.Start + float64(i)*step
+			out = append(out, timedRune{R: r, Start: start, End: start + step})
+		}
+	}
+	return out
+}
+
+// Alignment scores: matching characters pull a script line onto the
+// transcript, anything else costs a little.
+const (
+	alignMatch = 2
+	alignMiss  = -1
+	// alignSlack is how many transcript characters beyond twice the
+	// line's length are searched for it, for ad-libs and misheard words.
+	alignSlack = 200
+)
+
+// alignScript times each line of script by finding it in the transcript,
+// in order, and returns one cue per line with how many lines were found.
+// Lines the transcript has no trace of get the time between their
+// neighbours, shared by length.
+func alignScript(script []string, segments []Segment) ([]Segment, int) {
+	transcript := timedRunes(segments)
+	out := make([]Segment, len(script))
+	found := make([]bool, len(script))
+	aligned := 0
+	pos, window := 0, 0
+	for i, line := range script {
+		out[i].Text = line
+		want := []rune(normalizeCueText(line))
+		if len(want) == 0 {
+			continue
+		}
+		window += 2*len(want) + alignSlack
+		from, to, matched := alignLine(want, transcript[pos:min(pos+window, len(transcript))])
+		// Half the line has to be heard for the match to count.
+		if matched*2 < len(want) {
+			continue
+		}
+		out[i].Start = transcript[pos+from].Start
+		out[i].End = transcript[pos+to-1].End
+		found[i] = true
+		aligned++
+		pos += to
+		window = 0
+	}
+	fillUnaligned(out, found, segments)
+	return out, aligned
+}
+
+// alignLine finds want in text, allowing for misheard, missing and extra
+// characters, and returns the part of text it covers and how many
+// characters matched.
+func alignLine(want []rune, text []timedRune) (from, to, matched int) {
+	n, m := len(want), len(text)
+	if m == 0 {
+		return 0, 0, 0
+	}
+	// score[i][j] aligns want[:i] with text ending at j; text before the
+	// line costs nothing.
+	score := make([][]int, n+1)
+	for i := range score {
+		score[i] = make([]int, m+1)
+		if i > 0 {
+			score[i][0] = score[i-1][0] + alignMiss
+		}
+	}
+	for i := 1; i <= n; i++ {
+		for j := 1; j <= m; j++ {
+			diag := score[i-1][j-1] + alignMiss
+			if want[i-1] == text[j-1].R {
+				diag = score[i-1][j-1] + alignMatch
+			}
+			score[i][j] = max(diag, score[i-1][j]+alignMiss, score[i][j-1]+alignMiss)
+		}
+	}
+	// Text after the line costs nothing either.
+	to = 0
+	for j := 1; j <= m; j++ {
+		if score[n][j] > score[n][to] {
+			to = j
+		}
+	}
+	i, j := n, to
+	for i > 0 && j > 0 {
+		switch {
+		case want[i-1] == text[j-1].R && score[i][j] == score[i-1][j-1]+alignMatch:
+			matched++
+			i, j = i-1, j-1
+		case score[i][j] == score[i-1][j-1]+alignMiss:
+			i, j = i-1, j-1
+		case score[i][j] == score[i-1][j]+alignMiss:
+			i--
+		default:
+			j--
+		}
+	}
+	if to == 0 {
+		return 0, 0, 0
+	}
+	return j, to, matched
+}
+
+// fillUnaligned times the lines alignScript did not find from the end of
+// the line before to the start of the one after, split by length.
+func fillUnaligned(out []Segment, found []bool, segments []Segment) {
+	end := 0.0
+	if len(segments) > 0 {
+		end = segments[len(segments)-1].End
+	}
+	for i := 0; i < len(out); {
+		if found[i] {
+			i++
+			continue
+		}
+		j := i
+		for j < len(out) && !found[j] {
+			j++
+		}
+		from, to := 0.0, end
+		if i > 0 {
+			from = out[i-1].End
+		}
+		if j < len(out) {
+			to = out[j].Start
+		}
+		total := 0
+		for k := i; k < j; k++ {
+			total += max(len([]rune(out[k].Text)), 1)
+		}
+		t := from
+		for k := i; k < j; k++ {
+			share := (to - from) * float64(max(len([]rune(out[k].Text)), 1)) / float64(total)
+			out[k].Start, out[k].End = t, t+share
+			t += share
+		}
+		i = j
+	}
+}
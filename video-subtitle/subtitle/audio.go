@@ -0,0 +1,166 @@
+package subtitle
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+func runCommand(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return fmt.Errorf("%s failed: %s", name, message)
+	}
+	return nil
+}
+
+func runCommandOutput(name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return "", fmt.Errorf("%s failed: %s", name, message)
+	}
+	return stdout.String(), nil
+}
+
+// AudioFormat is how extracted audio is encoded for upload. Speech at 16kHz
+// mono compresses well, so Opus keeps an hour of audio around 11MB, under the
+// API limit, where WAV needs chunking after ~12 minutes.
+type AudioFormat struct {
+	Ext  string
+	Args []string
+}
+
+// AudioFormats are the upload encodings by name: opus, mp3 and wav.
+// Opus is written bitexact because the ogg muxer otherwise picks a random
+// stream serial, and identical audio must hash the same for TranscriptCache.
+var AudioFormats = map[string]AudioFormat{
+	"opus": {Ext: ".ogg", Args: []string{"-c:a", "libopus", "-b:a", "24k", "-application", "voip", "-fflags", "+bitexact", "-f", "ogg"}},
+	"mp3":  {Ext: ".mp3", Args: []string{"-c:a", "libmp3lame", "-b:a", "32k", "-f", "mp3"}},
+	"wav":  {Ext: ".wav", Args: []string{"-f", "wav"}},
+}
+
+// NormalizeFilter cuts rumble below 80Hz and evens out loudness (EBU R128,
+// single pass), which helps recognition on quiet or noisy recordings.
+const NormalizeFilter = "highpass=f=80,loudnorm=I=-16:TP=-1.5:LRA=11"
+
+// ExtractOptions select what ExtractAudio takes from the input.
+type ExtractOptions struct {
+	// Track picks an audio stream ("-map 0:a:N"); negative leaves the
+	// choice to ffmpeg.
+	Track     int
+	Normalize bool
+}
+
+// ExtractAudio writes the input's audio as 16kHz mono.
+func ExtractAudio(inputPath, outputPath string, opts ExtractOptions, format AudioFormat) error {
+	args := []string{"-y", "-i", inputPath}
+	if opts.Track >= 0 {
+		args = append(args, "-map", fmt.Sprintf("0:a:%d", opts.Track))
+	}
+	args = append(args, "-vn")
+	if opts.Normalize {
+		args = append(args, "-af", NormalizeFilter)
+	}
+	args = append(args, "-ac", "1", "-ar", "16000")
+	args = append(args, format.Args...)
+	return runCommand("ffmpeg", append(args, outputPath)...)
+}
+
+func extractAudioSegment(inputPath, outputPath string, startSeconds, durationSeconds float64, accurate bool, format AudioFormat) error {
+	args := []string{"-y"}
+	if !accurate {
+		args = append(args, "-ss", fmt.Sprintf("%.3f", startSeconds))
+	}
+	args = append(args, "-i", inputPath)
+	if accurate {
+		args = append(args, "-ss", fmt.Sprintf("%.3f", startSeconds))
+	}
+	args = append(
+		args,
+		"-t",
+		fmt.Sprintf("%.3f", durationSeconds),
+		"-vn",
+		"-ac",
+		"1",
+		"-ar",
+		"16000",
+	)
+	args = append(args, format.Args...)
+	return runCommand("ffmpeg", append(args, outputPath)...)
+}
+
+func audioDuration(path string) (float64, error) {
+	output, err := runCommandOutput(
+		"ffprobe",
+		"-v",
+		"error",
+		"-show_entries",
+		"format=duration",
+		"-of",
+		"default=noprint_wrappers=1:nokey=1",
+		path,
+	)
+	if err != nil {
+		return 0, err
+	}
+	value := strings.TrimSpace(output)
+	duration, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse audio duration: %w", err)
+	}
+	return duration, nil
+}
+
+func audioSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func chooseChunkSeconds(path string, defaultChunk int, maxAudioBytes int64) (int, error) {
+	duration, err := audioDuration(path)
+	if err != nil {
+		return defaultChunk, err
+	}
+	if duration <= 0 {
+		return defaultChunk, nil
+	}
+	sizeBytes, err := audioSize(path)
+	if err != nil {
+		return defaultChunk, err
+	}
+	bytesPerSecond := float64(sizeBytes) / duration
+	if bytesPerSecond <= 0 {
+		return defaultChunk, nil
+	}
+	estimated := int(float64(maxAudioBytes) / bytesPerSecond)
+	if estimated <= 0 {
+		return defaultChunk, nil
+	}
+	if estimated < 30 {
+		return 30, nil
+	}
+	if estimated > defaultChunk {
+		return defaultChunk, nil
+	}
+	return estimated, nil
+}
@@ -0,0 +1,79 @@
+package subtitle
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BurnInOptions are the x264 and libass settings for BurnInSubtitles.
+type BurnInOptions struct {
+	CRF      int
+	Preset   string
+	Font     string
+	FontSize int
+}
+
+// BurnInOutputPath is the default burn-in video name: video.mkv becomes
+// video.burned.mp4.
+func BurnInOutputPath(inputPath string) string {
+	return strings.TrimSuffix(inputPath, filepath.Ext(inputPath)) + ".burned.mp4"
+}
+
+// escapeFilterValue quotes a value for an ffmpeg filter option, then for the
+// filtergraph around it (see "Notes on filtergraph escaping" in ffmpeg-filters).
+func escapeFilterValue(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `:`, `\:`).Replace(value)
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`, `[`, `\[`, `]`, `\]`, `,`, `\,`, `;`, `\;`).Replace(value)
+}
+
+func subtitlesFilter(srtPath string, opts BurnInOptions) string {
+	filter := "subtitles=filename=" + escapeFilterValue(srtPath)
+	var style []string
+	if opts.Font != "" {
+		style = append(style, "FontName="+opts.Font)
+	}
+	if opts.FontSize > 0 {
+		style = append(style, fmt.Sprintf("FontSize=%d", opts.FontSize))
+	}
+	if len(style) > 0 {
+		filter += ":force_style=" + escapeFilterValue(strings.Join(style, ","))
+	}
+	return filter
+}
+
+// BurnInSubtitles re-encodes inputPath to an H.264 mp4 with the subtitles
+// rendered into the picture. Audio is copied when the source is already in
+// an mp4-family container and re-encoded to AAC otherwise.
+func BurnInSubtitles(inputPath, srtPath, outputPath string, opts BurnInOptions) error {
+	audioCodec := "aac"
+	switch strings.ToLower(filepath.Ext(inputPath)) {
+	case ".mp4", ".m4v", ".mov":
+		audioCodec = "copy"
+	}
+	err := runCommand(
+		"ffmpeg",
+		"-y",
+		"-i",
+		inputPath,
+		"-vf",
+		subtitlesFilter(srtPath, opts),
+		"-c:v",
+		"libx264",
+		"-crf",
+		fmt.Sprint(opts.CRF),
+		"-preset",
+		opts.Preset,
+		"-c:a",
+		audioCodec,
+		"-movflags",
+		"+faststart",
+		outputPath,
+	)
+	if err != nil {
+		os.Remove(outputPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package subtitle
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// TranscriptCache keeps transcription results on disk, keyed by a hash of
+// the audio sent and the request settings, so the same audio is never paid
+// for twice: re-running with other translation settings reuses the
+// transcript of every chunk. Entries are never expired; delete the
+// directory to reclaim the space.
+type TranscriptCache struct {
+	Dir      string
+	Progress *Progress
+}
+
+// DefaultTranscriptCacheDir is ~/.cache/video-subtitle (or the platform's
+// equivalent).
+func DefaultTranscriptCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "video-subtitle"), nil
+}
+
+// Wrap returns t with the cache in front of it. backend names the service
+// and is part of the key, since providers transcribe the same audio
+// differently. A nil cache returns t unchanged.
+func (c *TranscriptCache) Wrap(t Transcriber, backend string) Transcriber {
+	if c == nil {
+		return t
+	}
+	return cachedTranscriber{cache: c, next: t, backend: backend}
+}
+
+type cachedTranscriber struct {
+	cache   *TranscriptCache
+	next    Transcriber
+	backend string
+}
+
+type transcriptCacheKey struct {
+	Audio       string  `json:"audio"`
+	Backend     string  `json:"backend"`
+	Model       string  `json:"model"`
+	Language    string  `json:"language"`
+	Prompt      string  `json:"prompt,omitempty"`
+	Previous    string  `json:"previous,omitempty"`
+	Temperature float64 `json:"temperature,omitempty"`
+}
+
+func (t cachedTranscriber) Transcribe(ctx context.Context, audioPath, model, language string, hints TranscribeHints) ([]Segment, error) {
+	audioHash, err := hashFile(audioPath)
+	if err != nil {
+		return nil, err
+	}
+	key, err := json.Marshal(transcriptCacheKey{
+		Audio:       audioHash,
+		Backend:     t.backend,
+		Model:       model,
+		Language:    language,
+		Prompt:      hints.Prompt,
+		Previous:    hints.Previous,
+		Temperature: hints.Temperature,
+	})
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(key)
+	name := hex.EncodeToString(sum[:])
+	path := filepath.Join(t.cache.Dir, "transcripts", name[:2], name+".json")
+
+	if data, err := os.ReadFile(path); err == nil {
+		var segments []Segment
+		if json.Unmarshal(data, &segments) == nil {
+			t.cache.Progress.Printf("Using cached transcription of %s.", filepath.Base(audioPath))
+			return segments, nil
+		}
+	}
+	segments, err := t.next.Transcribe(ctx, audioPath, model, language, hints)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeCacheEntry(path, segments); err != nil {
+		t.cache.Progress.Printf("Failed to cache transcription: %v", err)
+	}
+	return segments, nil
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func writeCacheEntry(path string, segments []Segment) error {
+	if segments == nil {
+		segments = []Segment{}
+	}
+	data, err := json.Marshal(segments)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic writes data to a temp file next to path and renames it
+// into place, so readers never see half a file.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,180 @@
+package subtitle
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Censor modes: CensorMask replaces each character of a listed word with
+// "*", CensorDrop removes the word (and cues left empty), CensorTag
+// replaces it with CensorPlaceholder.
+const (
+	CensorMask = "mask"
+	CensorDrop = "drop"
+	CensorTag  = "tag"
+)
+
+// CensorPlaceholder is what CensorTag puts in place of a listed word.
+const CensorPlaceholder = "[censored]"
+
+// Censor filters listed words out of cue text. Matching is plain string
+// comparison, so the same input always gives the same output.
+type Censor struct {
+	Mode  string
+	Words []CensorWord
+	// Transcript and Translation pick the text that is filtered. A
+	// transcript that is not translated is the output, so Transcript
+	// covers it.
+	Transcript  bool
+	Translation bool
+}
+
+// CensorWord is a word or phrase to filter, lower-cased. Prefix also
+// matches longer words that start with it (a trailing "*" in the list).
+type CensorWord struct {
+	Text   []rune
+	Prefix bool
+}
+
+// LoadCensorWords reads a word list: one word or phrase per line, blank
+// lines and # comments skipped, "word*" matching any word that starts with
+// "word". Words are matched case-insensitively and as whole words, except
+// in Chinese, Japanese and Korean, which do not space words apart.
+func LoadCensorWords(path string) ([]CensorWord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var words []CensorWord
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		word := CensorWord{}
+		line, word.Prefix = strings.CutSuffix(line, "*")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			return nil, fmt.Errorf("%s:%d: empty word", path, n)
+		}
+		word.Text = lowerRunes(line)
+		words = append(words, word)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("%s: no words", path)
+	}
+	// Longest first, so "bad word" wins over "bad".
+	sort.SliceStable(words, func(i, j int) bool { return len(words[i].Text) > len(words[j].Text) })
+	return words, nil
+}
+
+// Apply filters segments and returns the result with the number of words
+// filtered. In CensorDrop mode cues left without text are removed.
+func (c *Censor) Apply(segments []Segment) ([]Segment, int) {
+	if c == nil || len(c.Words) == 0 {
+		return segments, 0
+	}
+	total := 0
+	out := make([]Segment, 0, len(segments))
+	for _, seg := range segments {
+		text, n := c.filter(seg.Text)
+		total += n
+		if n > 0 && strings.TrimSpace(text) == "" {
+			continue
+		}
+		seg.Text = text
+		out = append(out, seg)
+	}
+	return out, total
+}
+
+func (c *Censor) filter(text string) (string, int) {
+	runes := []rune(text)
+	lower := lowerRunes(text)
+	var out []rune
+	count := 0
+	for i := 0; i < len(runes); {
+		end := c.match(lower, i)
+		if end < 0 {
+			out = append(out, runes[i])
+			i++
+			continue
+		}
+		count++
+		switch c.Mode {
+		case CensorDrop:
+			// Leave one space where the word was between two others.
+			for len(out) > 0 && out[len(out)-1] == ' ' {
+				out = out[:len(out)-1]
+			}
+			for end < len(runes) && runes[end] == ' ' {
+				end++
+			}
+			if len(out) > 0 && end < len(runes) && !isCJK(out[len(out)-1]) && !unicode.IsPunct(runes[end]) {
+				out = append(out, ' ')
+			}
+		case CensorTag:
+			out = append(out, []rune(CensorPlaceholder)...)
+		default:
+			for _, r := range runes[i:end] {
+				if unicode.IsSpace(r) {
+					out = append(out, r)
+				} else {
+					out = append(out, '*')
+				}
+			}
+		}
+		i = end
+	}
+	if count == 0 {
+		return text, 0
+	}
+	return string(out), count
+}
+
+// match returns where the first listed word starting at text[i] ends, or -1.
+func (c *Censor) match(text []rune, i int) int {
+	if i > 0 && isWordRune(text[i-1]) && isWordRune(text[i]) {
+		return -1
+	}
+	for _, word := range c.Words {
+		end := i + len(word.Text)
+		if end > len(text) || string(text[i:end]) != string(word.Text) {
+			continue
+		}
+		if word.Prefix {
+			for end < len(text) && isWordRune(text[end]) {
+				end++
+			}
+		}
+		if end < len(text) && isWordRune(text[end-1]) && isWordRune(text[end]) {
+			continue
+		}
+		return end
+	}
+	return -1
+}
+
+// isWordRune reports whether r is part of a space-separated word. CJK
+// characters are not, so listed words match anywhere in CJK text.
+func isWordRune(r rune) bool {
+	return (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '\'') && !isCJK(r)
+}
+
+func lowerRunes(s string) []rune {
+	runes := []rune(s)
+	for i, r := range runes {
+		runes[i] = unicode.ToLower(r)
+	}
+	return runes
+}
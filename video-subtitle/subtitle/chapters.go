@@ -0,0 +1,89 @@
+package subtitle
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Chapter is a chapter marker of the input container, in seconds.
+type Chapter struct {
+	Start float64
+	End   float64
+	Title string
+}
+
+type ffprobeChapters struct {
+	Chapters []struct {
+		StartTime string            `json:"start_time"`
+		EndTime   string            `json:"end_time"`
+		Tags      map[string]string `json:"tags"`
+	} `json:"chapters"`
+}
+
+// ListChapters asks ffprobe for the chapters of path, in order. A file
+// without chapters gives none and no error.
+func ListChapters(path string) ([]Chapter, error) {
+	output, err := runCommandOutput("ffprobe", "-v", "error", "-show_chapters", "-of", "json", path)
+	if err != nil {
+		return nil, err
+	}
+	var probe ffprobeChapters
+	if err := json.Unmarshal([]byte(output), &probe); err != nil {
+		return nil, fmt.Errorf("failed to parse ffprobe chapters: %w", err)
+	}
+	chapters := make([]Chapter, 0, len(probe.Chapters))
+	for _, c := range probe.Chapters {
+		start, err := strconv.ParseFloat(c.StartTime, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse chapter start %q: %w", c.StartTime, err)
+		}
+		end, err := strconv.ParseFloat(c.EndTime, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse chapter end %q: %w", c.EndTime, err)
+		}
+		chapters = append(chapters, Chapter{Start: start, End: end, Title: c.Tags["title"]})
+	}
+	sort.SliceStable(chapters, func(i, j int) bool { return chapters[i].Start < chapters[j].Start })
+	return chapters, nil
+}
+
+// minChapterGap keeps chunk cuts from landing within this many seconds of
+// the start or end of the audio, where they would make a sliver of a chunk.
+const minChapterGap = 1.0
+
+// chapterCuts returns where chunks start when cutting only at chapter
+// starts: consecutive chapters share a chunk while it stays within
+// chunkSeconds, and a chapter longer than that is split evenly.
+func chapterCuts(chapters []Chapter, duration float64, chunkSeconds int) []float64 {
+	limit := float64(chunkSeconds)
+	bounds := []float64{0}
+	for _, c := range chapters {
+		if c.Start >= bounds[len(bounds)-1]+minChapterGap && c.Start <= duration-minChapterGap {
+			bounds = append(bounds, c.Start)
+		}
+	}
+	bounds = append(bounds, duration)
+
+	cuts := []float64{0}
+	start := 0.0
+	for i := 1; i < len(bounds); i++ {
+		if bounds[i]-start <= limit {
+			continue
+		}
+		if bounds[i-1] > start {
+			start = bounds[i-1]
+			cuts = append(cuts, start)
+		}
+		if length := bounds[i] - start; length > limit {
+			pieces := math.Ceil(length / limit)
+			for k := 1.0; k < pieces; k++ {
+				cuts = append(cuts, start+k*length/pieces)
+			}
+			start = cuts[len(cuts)-1]
+		}
+	}
+	return cuts
+}
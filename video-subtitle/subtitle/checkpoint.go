@@ -0,0 +1,243 @@
+package subtitle
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	checkpointVersion   = 1
+	checkpointSaveEvery = 2 * time.Second
+)
+
+// CheckpointKey identifies the input and the settings a Checkpoint was made
+// with; any mismatch invalidates the stored results.
+type CheckpointKey struct {
+	InputSize    int64  `json:"input_size"`
+	InputModTime int64  `json:"input_mtime"`
+	Model        string `json:"model"`
+	Language     string `json:"language"`
+	SkipSilence  string `json:"skip_silence,omitempty"`
+	Regions      string `json:"regions,omitempty"`
+	AudioTrack   string `json:"audio_track,omitempty"`
+	AudioFilter  string `json:"audio_filter,omitempty"`
+	Version      int    `json:"version"`
+}
+
+type translationKey struct {
+	Model      string `json:"model"`
+	SourceLang string `json:"source_lang"`
+	TargetLang string `json:"target_lang"`
+}
+
+type checkpointTranslation struct {
+	Source string `json:"source"`
+	Text   string `json:"text"`
+}
+
+type checkpointState struct {
+	Key          CheckpointKey                 `json:"key"`
+	Chunks       map[string][]Segment          `json:"chunks,omitempty"`
+	Transcript   []Segment                     `json:"transcript,omitempty"`
+	Translation  translationKey                `json:"translation"`
+	Translations map[int]checkpointTranslation `json:"translations,omitempty"`
+}
+
+// Checkpoint persists per-chunk transcriptions and per-segment translations
+// to a sidecar file so an interrupted run can pick up where it stopped.
+// A nil *Checkpoint is valid and does nothing.
+type Checkpoint struct {
+	path string
+
+	mu       sync.Mutex
+	state    checkpointState
+	dirty    bool
+	lastSave time.Time
+	removed  bool
+}
+
+// CheckpointPath is the sidecar next to the input: video.mp4 becomes
+// video.subtitle-state.json.
+func CheckpointPath(inputPath string) string {
+	return strings.TrimSuffix(inputPath, filepath.Ext(inputPath)) + ".subtitle-state.json"
+}
+
+// OpenCheckpoint loads path if it was written for the same key, and starts
+// fresh otherwise (or when fresh is set).
+func OpenCheckpoint(path string, key CheckpointKey, fresh bool) *Checkpoint {
+	key.Version = checkpointVersion
+	c := &Checkpoint{path: path}
+	if !fresh {
+		if b, err := os.ReadFile(path); err == nil {
+			var st checkpointState
+			if json.Unmarshal(b, &st) == nil && st.Key == key {
+				c.state = st
+			}
+		}
+	}
+	c.state.Key = key
+	if c.state.Chunks == nil {
+		c.state.Chunks = map[string][]Segment{}
+	}
+	if c.state.Translations == nil {
+		c.state.Translations = map[int]checkpointTranslation{}
+	}
+	return c
+}
+
+// Path is where the checkpoint is kept ("" for a nil checkpoint).
+func (c *Checkpoint) Path() string {
+	if c == nil {
+		return ""
+	}
+	return c.path
+}
+
+// InputCheckpointKey starts a key from the input file's size and mtime;
+// the caller adds the transcription settings.
+func InputCheckpointKey(info os.FileInfo) CheckpointKey {
+	return CheckpointKey{InputSize: info.Size(), InputModTime: info.ModTime().UnixNano()}
+}
+
+func (c *Checkpoint) transcript() ([]Segment, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state.Transcript == nil {
+		return nil, false
+	}
+	out := make([]Segment, len(c.state.Transcript))
+	copy(out, c.state.Transcript)
+	return out, true
+}
+
+func (c *Checkpoint) setTranscript(segments []Segment) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.state.Transcript = append([]Segment{}, segments...)
+	c.state.Chunks = map[string][]Segment{}
+	c.dirty = true
+	c.mu.Unlock()
+	c.Save(true)
+}
+
+func (c *Checkpoint) chunk(key string) ([]Segment, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	segs, ok := c.state.Chunks[key]
+	return segs, ok
+}
+
+func (c *Checkpoint) setChunk(key string, segments []Segment) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.state.Chunks[key] = append([]Segment{}, segments...)
+	c.dirty = true
+	c.mu.Unlock()
+	// Chunks are expensive and infrequent; always persist them immediately.
+	c.Save(true)
+}
+
+// useTranslation drops stored translations made with different settings.
+func (c *Checkpoint) useTranslation(key translationKey) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state.Translation != key {
+		c.state.Translation = key
+		c.state.Translations = map[int]checkpointTranslation{}
+		c.dirty = true
+	}
+}
+
+func (c *Checkpoint) translation(idx int, source string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.state.Translations[idx]
+	if !ok || t.Source != source {
+		return "", false
+	}
+	return t.Text, true
+}
+
+func (c *Checkpoint) translationCount() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.state.Translations)
+}
+
+func (c *Checkpoint) setTranslation(idx int, source, text string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.state.Translations[idx] = checkpointTranslation{Source: source, Text: text}
+	c.dirty = true
+	c.mu.Unlock()
+	c.Save(false)
+}
+
+// Save writes the state if it changed; unless force is set, writes are
+// throttled so per-segment updates stay cheap.
+func (c *Checkpoint) Save(force bool) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.removed || !c.dirty {
+		return nil
+	}
+	if !force && time.Since(c.lastSave) < checkpointSaveEvery {
+		return nil
+	}
+	b, err := json.Marshal(&c.state)
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return err
+	}
+	c.dirty = false
+	c.lastSave = time.Now()
+	return nil
+}
+
+// Remove deletes the sidecar once the output has been written.
+func (c *Checkpoint) Remove() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removed = true
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
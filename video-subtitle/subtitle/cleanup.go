@@ -0,0 +1,66 @@
+package subtitle
+
+import "strings"
+
+// minRepeatRun is how many consecutive identical cues count as a Whisper
+// repetition loop rather than someone actually repeating themselves.
+const minRepeatRun = 3
+
+// junkPhrases are outros Whisper invents over music and silence, taken from
+// the captions it was trained on. Compared after normalizeCueText.
+var junkPhrases = []string{
+	"thanksforwatching",
+	"thankyouforwatching",
+	"thankyousomuchforwatching",
+	"pleasesubscribe",
+	"likeandsubscribe",
+	"subtitlesbytheamaraorgcommunity",
+	"ご視聴ありがとうございました",
+	"チャンネル登録よろしくお願いします",
+	"チャンネル登録お願いします",
+	"最後までご視聴いただきありがとうございます",
+	"請不吝點贊訂閱轉發打賞支持明鏡與點點欄目",
+	"字幕由amaraorg社區提供",
+	"謝謝觀看",
+	"谢谢观看",
+	"感謝收看",
+	"시청해주셔서감사합니다",
+}
+
+// cleanSegments drops classic Whisper hallucinations: zero-length cues,
+// all but the first cue of a run of minRepeatRun or more identical cues, and
+// junk outro phrases. It returns the kept segments and how many were dropped.
+func cleanSegments(segments []Segment) ([]Segment, int) {
+	cleaned := make([]Segment, 0, len(segments))
+	for i := 0; i < len(segments); {
+		seg := segments[i]
+		norm := normalizeCueText(seg.Text)
+		run := 1
+		for i+run < len(segments) && norm != "" && normalizeCueText(segments[i+run].Text) == norm {
+			run++
+		}
+		if run >= minRepeatRun {
+			i += run
+		} else {
+			// A short repeat is plausible speech; keep each cue.
+			i++
+		}
+		// A lone zero-length segment is the whole-text fallback used when
+		// the API returns no timings; that one is real.
+		zeroLength := seg.End <= seg.Start && len(segments) > 1
+		if zeroLength || isJunkPhrase(norm) {
+			continue
+		}
+		cleaned = append(cleaned, seg)
+	}
+	return cleaned, len(segments) - len(cleaned)
+}
+
+func isJunkPhrase(norm string) bool {
+	for _, phrase := range junkPhrases {
+		if strings.Contains(norm, phrase) && len([]rune(norm))-len([]rune(phrase)) < 4 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,239 @@
+package subtitle
+
+import (
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Break classes, best first: after a sentence, after a clause, at
+// whitespace, between CJK characters, and (last resort) inside a word.
+const (
+	breakSentence = iota
+	breakClause
+	breakSpace
+	breakCJK
+	breakWord
+)
+
+// splitLongSegments splits cues longer than maxSeconds, or with more text
+// than fits on two lines of maxLineChars, at the most natural boundaries,
+// giving each piece a share of the time proportional to its length. Zero
+// disables either limit. Cue numbers from a subtitle input are dropped if
+// anything was split, since they would no longer be unique.
+func splitLongSegments(segments []Segment, maxSeconds float64, maxLineChars int) []Segment {
+	out := make([]Segment, 0, len(segments))
+	for _, seg := range segments {
+		out = append(out, splitCue(seg, maxSeconds, maxLineChars)...)
+	}
+	if len(out) != len(segments) {
+		for i := range out {
+			out[i].Index = 0
+		}
+	}
+	return out
+}
+
+func splitCue(seg Segment, maxSeconds float64, maxLineChars int) []Segment {
+	runes := []rune(strings.TrimSpace(seg.Text))
+	pieces := 1
+	if maxSeconds > 0 {
+		pieces = int(math.Ceil((seg.End - seg.Start) / maxSeconds))
+	}
+	if maxLineChars > 0 {
+		if n := (len(runes) + 2*maxLineChars - 1) / (2 * maxLineChars); n > pieces {
+			pieces = n
+		}
+	}
+	if pieces > len(runes)/2 {
+		pieces = len(runes) / 2
+	}
+	if pieces <= 1 {
+		return []Segment{seg}
+	}
+
+	cuts := []int{0}
+	for k := 1; k < pieces; k++ {
+		target := k * len(runes) / pieces
+		window := len(runes) / (2 * pieces)
+		lo := max(cuts[len(cuts)-1]+1, target-window)
+		hi := min(len(runes)-1, target+window)
+		cuts = append(cuts, bestBreak(runes, lo, hi, target))
+	}
+	cuts = append(cuts, len(runes))
+
+	var out []Segment
+	duration := seg.End - seg.Start
+	for i := 0; i+1 < len(cuts); i++ {
+		text := strings.TrimSpace(string(runes[cuts[i]:cuts[i+1]]))
+		if text == "" {
+			continue
+		}
+		piece := seg
+		piece.Start = seg.Start + duration*float64(cuts[i])/float64(len(runes))
+		piece.End = seg.Start + duration*float64(cuts[i+1])/float64(len(runes))
+		piece.Text = text
+		out = append(out, piece)
+	}
+	return out
+}
+
+// bestBreak picks a split position in [lo, hi] (text before p stays on the
+// left), preferring the best break class and then the one nearest target.
+func bestBreak(runes []rune, lo, hi, target int) int {
+	best, bestClass, bestDist := target, breakWord+1, 0
+	for p := lo; p <= hi; p++ {
+		if p <= 0 || p >= len(runes) {
+			continue
+		}
+		class := breakClass(runes[p-1], runes[p])
+		dist := p - target
+		if dist < 0 {
+			dist = -dist
+		}
+		if class < bestClass || (class == bestClass && dist < bestDist) {
+			best, bestClass, bestDist = p, class, dist
+		}
+	}
+	return best
+}
+
+func breakClass(before, after rune) int {
+	switch {
+	case strings.ContainsRune("。！？.!?…", before) && !unicode.IsPunct(after) && !unicode.IsDigit(after):
+		return breakSentence
+	case strings.ContainsRune("、，,;；:：", before) && !unicode.IsPunct(after) && !unicode.IsDigit(after):
+		return breakClause
+	case unicode.IsSpace(before) || unicode.IsSpace(after):
+		return breakSpace
+	case isCJK(before) || isCJK(after):
+		return breakCJK
+	}
+	return breakWord
+}
+
+// sentenceCues cuts text into one cue per sentence (or line) and spreads
+// duration over them by length, for transcripts that come without times.
+func sentenceCues(text string, duration float64) []Segment {
+	runes := []rune(strings.TrimSpace(text))
+	cuts := []int{0}
+	for p := 1; p < len(runes); p++ {
+		if runes[p-1] == '\n' || breakClass(runes[p-1], runes[p]) == breakSentence {
+			cuts = append(cuts, p)
+		}
+	}
+	cuts = append(cuts, len(runes))
+	var out []Segment
+	for i := 0; i+1 < len(cuts); i++ {
+		text := strings.TrimSpace(string(runes[cuts[i]:cuts[i+1]]))
+		if text == "" {
+			continue
+		}
+		out = append(out, Segment{
+			Start: duration * float64(cuts[i]) / float64(len(runes)),
+			End:   duration * float64(cuts[i+1]) / float64(len(runes)),
+			Text:  text,
+		})
+	}
+	return out
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// wrapCueText breaks text longer than maxLineChars into two lines, at the
+// best break that keeps both lines within the limit (or near the middle if
+// none does). Text that already has line breaks is left alone.
+func wrapCueText(text string, maxLineChars int) string {
+	text = strings.TrimSpace(text)
+	runes := []rune(text)
+	if maxLineChars <= 0 || len(runes) <= maxLineChars || strings.Contains(text, "\n") {
+		return text
+	}
+	mid := len(runes) / 2
+	lo, hi := len(runes)-maxLineChars, maxLineChars
+	if lo > hi {
+		lo, hi = mid-mid/2, mid+mid/2
+	}
+	p := bestBreak(runes, lo, hi, mid)
+	return strings.TrimSpace(string(runes[:p])) + "\n" + strings.TrimSpace(string(runes[p:]))
+}
+
+func wrapSegments(segments []Segment, maxLineChars int) []Segment {
+	if maxLineChars <= 0 {
+		return segments
+	}
+	out := make([]Segment, len(segments))
+	for i, seg := range segments {
+		seg.Text = wrapCueText(seg.Text, maxLineChars)
+		out[i] = seg
+	}
+	return out
+}
+
+// maxMergedSeconds caps how long a cue built by mergeShortSegments may get.
+const maxMergedSeconds = 7.0
+
+// mergeShortSegments joins a cue shorter than minSeconds with its neighbour
+// when the gap between them is at most maxGap, repeating until the cue is
+// long enough or would exceed maxMergedSeconds. Cue numbers from a subtitle
+// input are dropped if anything was merged.
+func mergeShortSegments(segments []Segment, minSeconds, maxGap float64) []Segment {
+	if minSeconds <= 0 || len(segments) == 0 {
+		return segments
+	}
+	out := []Segment{segments[0]}
+	for _, seg := range segments[1:] {
+		prev := &out[len(out)-1]
+		short := prev.End-prev.Start < minSeconds || seg.End-seg.Start < minSeconds
+		if short && seg.Start-prev.End <= maxGap && seg.End-prev.Start <= maxMergedSeconds {
+			prev.End = seg.End
+			prev.Text = joinCueText(prev.Text, seg.Text)
+			continue
+		}
+		out = append(out, seg)
+	}
+	if len(out) != len(segments) {
+		for i := range out {
+			out[i].Index = 0
+		}
+	}
+	return out
+}
+
+// joinCueText concatenates two cues, with a space unless the join is
+// between CJK characters.
+func joinCueText(a, b string) string {
+	a, b = strings.TrimSpace(a), strings.TrimSpace(b)
+	if a == "" || b == "" {
+		return a + b
+	}
+	last, _ := utf8.DecodeLastRuneInString(a)
+	first, _ := utf8.DecodeRuneInString(b)
+	if isCJK(last) || isCJK(first) || strings.ContainsRune("。、，！？", last) {
+		return a + b
+	}
+	return a + " " + b
+}
+
+// retimeSegments maps every cue time t to t*scale + shift, for subtitles
+// meant for a trimmed or differently timed copy of the video. Cues that end
+// up entirely before zero are dropped and ones straddling it are clipped.
+func retimeSegments(segments []Segment, shift, scale float64) []Segment {
+	if shift == 0 && scale == 1 {
+		return segments
+	}
+	out := make([]Segment, 0, len(segments))
+	for _, seg := range segments {
+		seg.Start = seg.Start*scale + shift
+		seg.End = seg.End*scale + shift
+		if seg.End < 0 || (seg.End == 0 && seg.Start < 0) {
+			continue
+		}
+		seg.Start = max(seg.Start, 0)
+		out = append(out, seg)
+	}
+	return out
+}
@@ -0,0 +1,151 @@
+package subtitle
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// SubtitleTrack is one subtitle stream of the input, numbered like
+// ffmpeg's "-map 0:s:N".
+type SubtitleTrack struct {
+	Number   int
+	Codec    string
+	Language string
+	Title    string
+	Default  bool
+	// Forced tracks only carry signs and foreign-language lines.
+	Forced bool
+}
+
+// Text reports whether the track is text that can be read as cues; image
+// subtitles (DVD, Blu-ray PGS, DVB) would need OCR.
+func (t SubtitleTrack) Text() bool {
+	switch t.Codec {
+	case "subrip", "srt", "ass", "ssa", "webvtt", "mov_text", "text":
+		return true
+	}
+	return false
+}
+
+// ListSubtitleTracks asks ffprobe for the subtitle streams of path.
+func ListSubtitleTracks(path string) ([]SubtitleTrack, error) {
+	output, err := runCommandOutput(
+		"ffprobe",
+		"-v",
+		"error",
+		"-select_streams",
+		"s",
+		"-show_entries",
+		"stream=codec_name:stream_tags=language,title:stream_disposition=default,forced",
+		"-of",
+		"json",
+		path,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var probe ffprobeStreams
+	if err := json.Unmarshal([]byte(output), &probe); err != nil {
+		return nil, fmt.Errorf("failed to parse ffprobe streams: %w", err)
+	}
+	tracks := make([]SubtitleTrack, 0, len(probe.Streams))
+	for i, s := range probe.Streams {
+		tracks = append(tracks, SubtitleTrack{
+			Number:   i,
+			Codec:    s.CodecName,
+			Language: s.Tags["language"],
+			Title:    s.Tags["title"],
+			Default:  s.Disposition["default"] == 1,
+			Forced:   s.Disposition["forced"] == 1,
+		})
+	}
+	return tracks, nil
+}
+
+// iso639_2T maps the terminology codes some containers use to the
+// bibliographic ones containerLanguage returns.
+var iso639_2T = map[string]string{
+	"deu": "ger",
+	"fra": "fre",
+	"zho": "chi",
+}
+
+func sameLanguage(lang, tag string) bool {
+	a, b := containerLanguage(lang), containerLanguage(tag)
+	if code, ok := iso639_2T[a]; ok {
+		a = code
+	}
+	if code, ok := iso639_2T[b]; ok {
+		b = code
+	}
+	return a != "" && a == b
+}
+
+// embeddedTrack picks the text subtitle track in lang to use instead of a
+// transcript: a full track over a forced one, then the default one, then
+// the first.
+func embeddedTrack(tracks []SubtitleTrack, lang string) (SubtitleTrack, bool) {
+	best, found := SubtitleTrack{}, false
+	rank := func(t SubtitleTrack) int {
+		r := 0
+		if !t.Forced {
+			r += 2
+		}
+		if t.Default {
+			r++
+		}
+		return r
+	}
+	for _, t := range tracks {
+		if !t.Text() || !sameLanguage(lang, t.Language) {
+			continue
+		}
+		if !found || rank(t) > rank(best) {
+			best, found = t, true
+		}
+	}
+	return best, found
+}
+
+// extractSubtitleTrack writes subtitle stream number of input to
+// outputPath as SRT.
+func extractSubtitleTrack(input string, number int, outputPath string) error {
+	return runCommand(
+		"ffmpeg",
+		"-y",
+		"-v",
+		"error",
+		"-i",
+		input,
+		"-map",
+		fmt.Sprintf("0:s:%d", number),
+		"-c:s",
+		"srt",
+		outputPath,
+	)
+}
+
+// trimCues keeps the cues whose midpoint is in [start, end) (end 0 meaning
+// no end) and outside the skipped ranges, as Options.Start, End and Skip
+// limit a transcript.
+func trimCues(segments []Segment, start, end float64, skip []TimeRange) []Segment {
+	var out []Segment
+	for _, seg := range segments {
+		mid := (seg.Start + seg.End) / 2
+		if mid < start || (end > 0 && mid >= end) {
+			continue
+		}
+		skipped := false
+		for _, r := range skip {
+			if mid >= r.Start && mid < r.End {
+				skipped = true
+				break
+			}
+		}
+		if !skipped && strings.TrimSpace(seg.Text) != "" {
+			out = append(out, seg)
+		}
+	}
+	return out
+}
@@ -0,0 +1,190 @@
+package subtitle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// failoverCooldown is how long a backend that failed is tried only after
+// the others.
+const failoverCooldown = 5 * time.Minute
+
+// TranscriberBackend is one entry of a FailoverTranscriber.
+type TranscriberBackend struct {
+	Name        string
+	Transcriber Transcriber
+	// Model, if set, replaces the requested model, which is meant for the
+	// first backend.
+	Model string
+}
+
+// FailoverTranscriber tries its backends in order. Each gets the full
+// Retry policy; when one still fails, or fails with an error retrying
+// cannot fix, the next takes over and the failed one goes to the back of
+// the line for a few minutes. Wrap the chain's caller with no further
+// retries: the error after the last backend is final.
+type FailoverTranscriber struct {
+	Backends []TranscriberBackend
+	Retry    RetryPolicy
+	Progress *Progress
+	chain    failoverChain
+}
+
+func (f *FailoverTranscriber) Transcribe(ctx context.Context, audioPath, model, language string, hints TranscribeHints) ([]Segment, error) {
+	var segments []Segment
+	err := f.chain.run(ctx, f.names(), f.Retry, f.Progress, "transcribe", filepath.Base(audioPath), func(i int) error {
+		b := f.Backends[i]
+		var err error
+		segments, err = b.Transcriber.Transcribe(ctx, audioPath, backendModel(b.Model, model), language, hints)
+		return err
+	})
+	return segments, err
+}
+
+// TranslatorBackend is one entry of a FailoverTranslator.
+type TranslatorBackend struct {
+	Name       string
+	Translator Translator
+	// Model, if set, replaces the requested model.
+	Model string
+}
+
+// FailoverTranslator is FailoverTranscriber for translation. It is also a
+// ChatCompleter, for the review pass, over the backends that are.
+type FailoverTranslator struct {
+	Backends []TranslatorBackend
+	Retry    RetryPolicy
+	Progress *Progress
+	chain    failoverChain
+	chat     failoverChain
+}
+
+func (f *FailoverTranslator) Translate(ctx context.Context, model, sourceLang, targetLang, text string, history []TranslationPair) (string, error) {
+	var output string
+	err := f.chain.run(ctx, f.names(), f.Retry, f.Progress, "translate", "", func(i int) error {
+		b := f.Backends[i]
+		var err error
+		output, err = b.Translator.Translate(ctx, backendModel(b.Model, model), sourceLang, targetLang, text, history)
+		return err
+	})
+	return output, err
+}
+
+// Complete fails over between the backends that are ChatCompleters.
+func (f *FailoverTranslator) Complete(ctx context.Context, model string, messages []ChatMessage) (string, error) {
+	var names []string
+	var backends []TranslatorBackend
+	for _, b := range f.Backends {
+		if _, ok := b.Translator.(ChatCompleter); ok {
+			names = append(names, b.Name)
+			backends = append(backends, b)
+		}
+	}
+	if len(backends) == 0 {
+		return "", errNoChat
+	}
+	var reply string
+	err := f.chat.run(ctx, names, f.Retry, f.Progress, "review", "", func(i int) error {
+		b := backends[i]
+		var err error
+		reply, err = b.Translator.(ChatCompleter).Complete(ctx, backendModel(b.Model, model), messages)
+		return err
+	})
+	return reply, err
+}
+
+var errNoChat = errors.New("no backend can run a review pass")
+
+func (f *FailoverTranscriber) names() []string {
+	names := make([]string, len(f.Backends))
+	for i, b := range f.Backends {
+		names[i] = b.Name
+	}
+	return names
+}
+
+func (f *FailoverTranslator) names() []string {
+	names := make([]string, len(f.Backends))
+	for i, b := range f.Backends {
+		names[i] = b.Name
+	}
+	return names
+}
+
+// backendModel is the model a backend is asked for: its own, if set.
+func backendModel(own, requested string) string {
+	if own != "" {
+		return own
+	}
+	return requested
+}
+
+// failoverChain remembers which backends failed recently.
+type failoverChain struct {
+	mu        sync.Mutex
+	downUntil []time.Time
+}
+
+// run calls try with each backend in turn until one succeeds: first those
+// that have not failed within failoverCooldown, in order, then the rest.
+// item names what is processed, for the log of who handled it ("" logs
+// only failovers).
+func (c *failoverChain) run(ctx context.Context, names []string, policy RetryPolicy, progress *Progress, stage, item string, try func(i int) error) error {
+	c.mu.Lock()
+	if c.downUntil == nil {
+		c.downUntil = make([]time.Time, len(names))
+	}
+	now := time.Now()
+	var order, down []int
+	for i := range names {
+		if now.Before(c.downUntil[i]) {
+			down = append(down, i)
+		} else {
+			order = append(order, i)
+		}
+	}
+	order = append(order, down...)
+	c.mu.Unlock()
+
+	var errs []string
+	for n, i := range order {
+		err := retry(
+			ctx,
+			policy,
+			isRetryable,
+			func(attempt int, delay time.Duration, err error) {
+				progress.Printf("%s failed; retrying in %.1fs (attempt %d). %s", names[i], delay.Seconds(), attempt, describeError(err))
+				progress.Event("retry", "stage", stage, "provider", names[i], "attempt", attempt, "delay_seconds", delay.Seconds(), "error", describeError(err))
+			},
+			func() error { return try(i) },
+		)
+		if err == nil {
+			if item != "" {
+				if i > 0 {
+					progress.Printf("%s handled by %s.", item, names[i])
+				}
+				progress.Event("provider", "stage", stage, "provider", names[i], "item", item)
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		c.mu.Lock()
+		c.downUntil[i] = time.Now().Add(failoverCooldown)
+		c.mu.Unlock()
+		errs = append(errs, fmt.Sprintf("%s: %s", names[i], describeError(err)))
+		if n+1 < len(order) {
+			next := names[order[n+1]]
+			progress.Printf("%s failed (%s); failing over to %s.", names[i], describeError(err), next)
+			progress.Event("failover", "stage", stage, "from", names[i], "to", next, "error", describeError(err))
+		}
+	}
+	// Not an *apiError, so callers do not retry the whole chain again.
+	return fmt.Errorf("all providers failed: %s", strings.Join(errs, "; "))
+}
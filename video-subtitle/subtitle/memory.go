@@ -0,0 +1,241 @@
+package subtitle
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// DefaultMemorySimilarity is how alike a line must be to a remembered one
+// for TranslationMemory to reuse its translation.
+const DefaultMemorySimilarity = 0.9
+
+// TranslationMemory remembers finished translations in a JSON file and
+// answers repeated lines from it instead of the API: lines that match once
+// letters and digits are compared (case, spacing and punctuation aside),
+// and, at MinSimilarity or more, lines that differ by a few characters but
+// not in their numbers. Pipeline.Translate consults and updates it.
+type TranslationMemory struct {
+	Path string
+	// MinSimilarity is the least edit-distance similarity (0-1) of a fuzzy
+	// match; 1 reuses exact matches only.
+	MinSimilarity float64
+
+	mu      sync.Mutex
+	entries map[memoryKey]memoryEntry
+	exact   int
+	fuzzy   int
+}
+
+type memoryKey struct {
+	SourceLang string
+	TargetLang string
+	// Source is the line as normalizeCueText has it.
+	Source string
+}
+
+type memoryEntry struct {
+	SourceLang string `json:"source_lang"`
+	TargetLang string `json:"target_lang"`
+	Source     string `json:"source"`
+	Target     string `json:"target"`
+}
+
+type memoryFile struct {
+	Entries []memoryEntry `json:"entries"`
+}
+
+// OpenTranslationMemory loads the memory at path; a missing file is an
+// empty memory, created by the first Save.
+func OpenTranslationMemory(path string) (*TranslationMemory, error) {
+	m := &TranslationMemory{Path: path, MinSimilarity: DefaultMemorySimilarity, entries: map[memoryKey]memoryEntry{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file memoryFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	for _, e := range file.Entries {
+		if key := (memoryKey{e.SourceLang, e.TargetLang, normalizeCueText(e.Source)}); key.Source != "" {
+			m.entries[key] = e
+		}
+	}
+	return m, nil
+}
+
+// Len returns the number of remembered lines.
+func (m *TranslationMemory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.entries)
+}
+
+// Hits returns how many lines were answered from the memory so far, by
+// exact and fuzzy matches.
+func (m *TranslationMemory) Hits() (exact, fuzzy int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.exact, m.fuzzy
+}
+
+// Wrap returns t with the memory in front of it. A nil memory returns t
+// unchanged.
+func (m *TranslationMemory) Wrap(t Translator) Translator {
+	if m == nil {
+		return t
+	}
+	return memoryTranslator{memory: m, next: t}
+}
+
+type memoryTranslator struct {
+	memory *TranslationMemory
+	next   Translator
+}
+
+func (t memoryTranslator) Translate(ctx context.Context, model, sourceLang, targetLang, text string, history []TranslationPair) (string, error) {
+	if target, ok := t.memory.lookup(sourceLang, targetLang, text); ok {
+		return target, nil
+	}
+	return t.next.Translate(ctx, model, sourceLang, targetLang, text, history)
+}
+
+func (m *TranslationMemory) lookup(sourceLang, targetLang, text string) (string, bool) {
+	key := memoryKey{sourceLang, targetLang, normalizeCueText(text)}
+	if key.Source == "" {
+		return "", false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.entries[key]; ok {
+		m.exact++
+		return e.Target, true
+	}
+	if m.MinSimilarity <= 0 || m.MinSimilarity >= 1 {
+		return "", false
+	}
+	want := []rune(key.Source)
+	digits := digitsOf(key.Source)
+	best, bestScore := memoryEntry{}, m.MinSimilarity
+	bestKey, found := "", false
+	for k, e := range m.entries {
+		if k.SourceLang != sourceLang || k.TargetLang != targetLang || digitsOf(k.Source) != digits {
+			continue
+		}
+		have := []rune(k.Source)
+		longer := max(len(want), len(have))
+		// Too different in length to reach the threshold.
+		if float64(abs(len(want)-len(have))) > (1-bestScore)*float64(longer) {
+			continue
+		}
+		score := 1 - float64(editDistance(want, have))/float64(longer)
+		// Ties go to the first line in sort order, for the same result
+		// every run.
+		if score > bestScore || (score == bestScore && (!found || k.Source < bestKey)) {
+			best, bestScore, bestKey, found = e, score, k.Source, true
+		}
+	}
+	if !found {
+		return "", false
+	}
+	m.fuzzy++
+	return best.Target, true
+}
+
+// Learn remembers each translated line of source (parallel to
+// translated) and returns how many were new or changed. Lines left as
+// they were are skipped.
+func (m *TranslationMemory) Learn(sourceLang, targetLang string, source, translated []Segment) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	changed := 0
+	for i := range source {
+		if i >= len(translated) {
+			break
+		}
+		src, dst := strings.TrimSpace(source[i].Text), strings.TrimSpace(translated[i].Text)
+		key := memoryKey{sourceLang, targetLang, normalizeCueText(src)}
+		if key.Source == "" || dst == "" || dst == src {
+			continue
+		}
+		if e, ok := m.entries[key]; ok && e.Target == dst {
+			continue
+		}
+		m.entries[key] = memoryEntry{SourceLang: sourceLang, TargetLang: targetLang, Source: src, Target: dst}
+		changed++
+	}
+	return changed
+}
+
+// Save writes the memory to Path, sorted so the file diffs well.
+func (m *TranslationMemory) Save() error {
+	m.mu.Lock()
+	file := memoryFile{Entries: make([]memoryEntry, 0, len(m.entries))}
+	for _, e := range m.entries {
+		file.Entries = append(file.Entries, e)
+	}
+	m.mu.Unlock()
+	sort.Slice(file.Entries, func(i, j int) bool {
+		a, b := file.Entries[i], file.Entries[j]
+		if a.SourceLang != b.SourceLang {
+			return a.SourceLang < b.SourceLang
+		}
+		if a.TargetLang != b.TargetLang {
+			return a.TargetLang < b.TargetLang
+		}
+		return a.Source < b.Source
+	})
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(m.Path, append(data, '\n'))
+}
+
+// digitsOf returns the digits of s, which a fuzzy match must keep: "episode
+// 3" is not "episode 4".
+func digitsOf(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
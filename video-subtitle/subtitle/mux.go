@@ -0,0 +1,92 @@
+package subtitle
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MuxSubtitleCodec picks the soft-subtitle codec the container can carry.
+func MuxSubtitleCodec(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp4", ".m4v", ".mov":
+		return "mov_text", nil
+	case ".mkv":
+		return "srt", nil
+	case ".webm":
+		return "webvtt", nil
+	}
+	return "", fmt.Errorf("--mux supports mp4, m4v, mov, mkv and webm inputs, not %q", filepath.Ext(path))
+}
+
+// MuxOutputPath is the default --mux copy name: video.mp4 becomes
+// video.subtitled.mp4.
+func MuxOutputPath(inputPath string) string {
+	ext := filepath.Ext(inputPath)
+	return strings.TrimSuffix(inputPath, ext) + ".subtitled" + ext
+}
+
+// Containers tag streams with ISO 639-2 codes; map the language names this
+// tool is usually given and pass anything else through.
+var iso639_2 = map[string]string{
+	"ar": "ara",
+	"de": "ger",
+	"en": "eng",
+	"es": "spa",
+	"fr": "fre",
+	"id": "ind",
+	"it": "ita",
+	"ja": "jpn",
+	"ko": "kor",
+	"pt": "por",
+	"ru": "rus",
+	"th": "tha",
+	"vi": "vie",
+	"zh": "chi",
+}
+
+func containerLanguage(lang string) string {
+	base, _, _ := strings.Cut(strings.ToLower(lang), "-")
+	if code, ok := iso639_2[base]; ok {
+		return code
+	}
+	return base
+}
+
+// MuxSubtitles copies inputPath to outputPath with srtPath added as the first,
+// default subtitle track. Existing streams are kept untouched.
+func MuxSubtitles(inputPath, srtPath, outputPath, lang string) error {
+	codec, err := MuxSubtitleCodec(inputPath)
+	if err != nil {
+		return err
+	}
+	err = runCommand(
+		"ffmpeg",
+		"-y",
+		"-i",
+		inputPath,
+		"-i",
+		srtPath,
+		"-map",
+		"1:s:0",
+		"-map",
+		"0",
+		"-c",
+		"copy",
+		"-c:s:0",
+		codec,
+		"-metadata:s:s:0",
+		"language="+containerLanguage(lang),
+		"-metadata:s:s:0",
+		"title="+lang,
+		"-disposition:s:0",
+		"default",
+		outputPath,
+	)
+	if err != nil {
+		os.Remove(outputPath)
+		return err
+	}
+	return nil
+}
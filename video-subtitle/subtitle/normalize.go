@@ -0,0 +1,170 @@
+package subtitle
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// cjkLanguage returns "zh", "ja" or "ko" for a language tag in one of
+// those languages (zh-TW, ja-JP, yue, ...), or "".
+func cjkLanguage(lang string) string {
+	base, _, _ := strings.Cut(strings.ToLower(lang), "-")
+	base, _, _ = strings.Cut(base, "_")
+	switch base {
+	case "zh", "cmn", "yue", "chinese":
+		return "zh"
+	case "ja", "japanese":
+		return "ja"
+	case "ko", "korean":
+		return "ko"
+	}
+	return ""
+}
+
+var (
+	ellipsisRun = regexp.MustCompile(`\.{3,}|…+|。{3,}|・{3,}|．{3,}`)
+	dashRun     = regexp.MustCompile(`-{2,}|[—―]+|－{2,}`)
+)
+
+// fullWidthPunct is the Chinese and Japanese form of ASCII punctuation.
+// Japanese writes the comma as 、.
+var fullWidthPunct = map[string]map[rune]rune{
+	"zh": {',': '，', '.': '。', '!': '！', '?': '？', ':': '：', ';': '；', '(': '（', ')': '）'},
+	"ja": {',': '、', '.': '。', '!': '！', '?': '？', ':': '：', ';': '；', '(': '（', ')': '）'},
+}
+
+// halfWidthPunct is the reverse for Korean, which spaces words and uses
+// Western punctuation.
+var halfWidthPunct = map[rune]rune{
+	'，': ',', '、': ',', '。': '.', '！': '!', '？': '?', '：': ':', '；': ';', '（': '(', '）': ')',
+}
+
+// normalizeSegments evens out the punctuation style LLM translations into
+// Chinese, Japanese or Korean mix from cue to cue. Other languages are
+// returned as is. It returns how many cues changed.
+func normalizeSegments(segments []Segment, lang string) ([]Segment, int) {
+	family := cjkLanguage(lang)
+	if family == "" {
+		return segments, 0
+	}
+	out := make([]Segment, len(segments))
+	changed := 0
+	for i, seg := range segments {
+		text := normalizeCJKText(seg.Text, family)
+		if text != seg.Text {
+			changed++
+		}
+		seg.Text = text
+		out[i] = seg
+	}
+	return out, changed
+}
+
+// normalizeCJKText turns full-width letters and digits into ASCII and, for
+// Chinese and Japanese, writes ellipses as …… and dashes as ——, makes ASCII
+// punctuation after CJK text full-width and removes the spaces between CJK
+// characters. Korean gets its full-width punctuation made ASCII instead,
+// followed by a space, and ellipses written as ….
+func normalizeCJKText(text, family string) string {
+	runes := []rune(text)
+	for i, r := range runes {
+		switch {
+		case r >= '０' && r <= '９', r >= 'Ａ' && r <= 'Ｚ', r >= 'ａ' && r <= 'ｚ':
+			runes[i] = r - 0xFEE0
+		case r == '　':
+			runes[i] = ' '
+		}
+	}
+	// A full-width point or comma inside a number goes with its digits.
+	for i := 1; i+1 < len(runes); i++ {
+		if (runes[i] == '．' || runes[i] == '，') && unicode.IsDigit(runes[i-1]) && unicode.IsDigit(runes[i+1]) {
+			runes[i] -= 0xFEE0
+		}
+	}
+	if family == "ko" {
+		return normalizeKorean(runes)
+	}
+	text = ellipsisRun.ReplaceAllString(string(runes), "……")
+	text = dashRun.ReplaceAllString(text, "——")
+
+	runes = []rune(text)
+	punct := fullWidthPunct[family]
+	for i, r := range runes {
+		full, ok := punct[r]
+		if !ok {
+			continue
+		}
+		if r == '(' {
+			if next := nextNonSpace(runes, i); next >= 0 && isCJKText(runes[next]) {
+				runes[i] = full
+			}
+			continue
+		}
+		if prev := prevNonSpace(runes, i); prev >= 0 && isCJKText(runes[prev]) {
+			runes[i] = full
+		}
+	}
+
+	var b strings.Builder
+	for i, r := range runes {
+		if r == ' ' {
+			prev, next := prevNonSpace(runes, i), nextNonSpace(runes, i)
+			if prev >= 0 && next >= 0 && isCJKText(runes[prev]) && isCJKText(runes[next]) {
+				continue
+			}
+			if prev >= 0 && next >= 0 && (isFullWidthPunct(runes[prev]) || isFullWidthPunct(runes[next])) {
+				continue
+			}
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func normalizeKorean(runes []rune) string {
+	text := ellipsisRun.ReplaceAllString(string(runes), "…")
+	text = strings.ReplaceAll(text, "……", "…")
+	runes = []rune(text)
+	var b strings.Builder
+	for i, r := range runes {
+		half, ok := halfWidthPunct[r]
+		if !ok {
+			b.WriteRune(r)
+			continue
+		}
+		b.WriteRune(half)
+		if half != '(' && i+1 < len(runes) && (unicode.IsLetter(runes[i+1]) || unicode.IsDigit(runes[i+1])) {
+			b.WriteRune(' ')
+		}
+	}
+	return b.String()
+}
+
+// isCJKText reports whether r is a CJK character or CJK punctuation.
+func isCJKText(r rune) bool {
+	return isCJK(r) || isFullWidthPunct(r) || r == '…' || r == '—' || r == 'ー'
+}
+
+func isFullWidthPunct(r rune) bool {
+	return (r >= 0x3000 && r <= 0x303F) || (r >= 0xFF01 && r <= 0xFF0F) || (r >= 0xFF1A && r <= 0xFF20) ||
+		(r >= 0xFF3B && r <= 0xFF40) || (r >= 0xFF5B && r <= 0xFF65)
+}
+
+func prevNonSpace(runes []rune, i int) int {
+	for i--; i >= 0; i-- {
+		if runes[i] != ' ' {
+			return i
+		}
+	}
+	return -1
+}
+
+func nextNonSpace(runes []rune, i int) int {
+	for i++; i < len(runes); i++ {
+		if runes[i] != ' ' {
+			return i
+		}
+	}
+	return -1
+}
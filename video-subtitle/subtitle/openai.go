@@ -0,0 +1,335 @@
+package subtitle
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type apiError struct {
+	StatusCode int
+	Message    string
+	Type       string
+	Code       string
+	// Provider names the service for non-OpenAI backends.
+	Provider string
+	// RetryAfter is how long the server asked us to wait, if it said.
+	RetryAfter time.Duration
+}
+
+func (e *apiError) Error() string {
+	provider := e.Provider
+	if provider == "" {
+		provider = "openai"
+	}
+	if e.Message == "" {
+		return fmt.Sprintf("%s error (%d)", provider, e.StatusCode)
+	}
+	return fmt.Sprintf("%s error (%d): %s", provider, e.StatusCode, e.Message)
+}
+
+// OpenAIClient talks to the OpenAI API (or a compatible one at
+// OPENAI_BASE_URL, or an Azure OpenAI resource): Whisper for transcription
+// and chat completions for translation. Prompt, when set, replaces the
+// built-in translation prompts.
+type OpenAIClient struct {
+	apiKey     string
+	baseURL    string
+	HTTPClient *http.Client
+	Prompt     *TranslationPrompt
+	// azureAPIVersion is set for Azure, which routes by deployment
+	// instead of by the model in the request.
+	azureAPIVersion string
+}
+
+// NewOpenAIClient returns a client with the given request timeout (0 for
+// the default).
+func NewOpenAIClient(apiKey string, timeout time.Duration) *OpenAIClient {
+	baseURL := strings.TrimRight(os.Getenv("OPENAI_BASE_URL"), "/")
+	if baseURL == "" {
+		baseURL = "https://api.openai.com/v1"
+	}
+	if timeout <= 0 {
+		timeout = time.Duration(DefaultTimeoutSeconds) * time.Second
+	}
+	return &OpenAIClient{
+		apiKey:  apiKey,
+		baseURL: baseURL,
+		HTTPClient: &http.Client{
+			Timeout: timeout,
+		},
+	}
+}
+
+// DefaultAzureAPIVersion is the Azure OpenAI API version used unless
+// another is asked for.
+const DefaultAzureAPIVersion = "2024-06-01"
+
+// NewAzureOpenAIClient returns a client for the Azure OpenAI resource at
+// endpoint (https://NAME.openai.azure.com). Azure has no model names of its
+// own: the model a request asks for is taken as the deployment to call.
+func NewAzureOpenAIClient(endpoint, apiKey, apiVersion string, timeout time.Duration) *OpenAIClient {
+	c := NewOpenAIClient(apiKey, timeout)
+	c.baseURL = strings.TrimRight(endpoint, "/")
+	c.azureAPIVersion = apiVersion
+	if c.azureAPIVersion == "" {
+		c.azureAPIVersion = DefaultAzureAPIVersion
+	}
+	return c
+}
+
+// endpoint returns the URL of an API path such as /chat/completions for
+// model.
+func (c *OpenAIClient) endpoint(model, path string) string {
+	if c.azureAPIVersion == "" {
+		return c.baseURL + path
+	}
+	return c.baseURL + "/openai/deployments/" + url.PathEscape(model) + path + "?api-version=" + url.QueryEscape(c.azureAPIVersion)
+}
+
+type transcriptionResponse struct {
+	Text     string                 `json:"text"`
+	Segments []transcriptionSegment `json:"segments"`
+}
+
+type transcriptionSegment struct {
+	Start      float64 `json:"start"`
+	End        float64 `json:"end"`
+	Text       string  `json:"text"`
+	AvgLogprob float64 `json:"avg_logprob"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	} `json:"choices"`
+}
+
+type openAIErrorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+		Code    string `json:"code"`
+	} `json:"error"`
+}
+
+func (c *OpenAIClient) do(req *http.Request) ([]byte, error) {
+	if c.azureAPIVersion != "" {
+		req.Header.Set("api-key", c.apiKey)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	req.Header.Set("User-Agent", "video-subtitle/0.1")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		apiErr := parseAPIError(resp.StatusCode, body)
+		apiErr.RetryAfter = rateLimitDelay(resp.Header)
+		if c.azureAPIVersion != "" {
+			apiErr.Provider = "azure"
+		}
+		return nil, apiErr
+	}
+	return body, nil
+}
+
+// timestampedModel reports whether a transcription model returns timed
+// segments (verbose_json). The gpt-4o transcribe models only return text.
+func timestampedModel(model string) bool {
+	return !strings.Contains(model, "-transcribe")
+}
+
+// Transcribe sends the audio file to /audio/transcriptions. Text from a
+// model without timestamps is cut into sentences timed by their length
+// over the audio's duration.
+func (c *OpenAIClient) Transcribe(ctx context.Context, audioPath, model, language string, hints TranscribeHints) ([]Segment, error) {
+	timestamped := timestampedModel(model)
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	if err := writer.WriteField("model", model); err != nil {
+		return nil, err
+	}
+	if language != "" {
+		if err := writer.WriteField("language", language); err != nil {
+			return nil, err
+		}
+	}
+	if !timestamped {
+		if err := writer.WriteField("response_format", "json"); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := writer.WriteField("response_format", "verbose_json"); err != nil {
+			return nil, err
+		}
+		if err := writer.WriteField("timestamp_granularities[]", "segment"); err != nil {
+			return nil, err
+		}
+	}
+	if prompt := hints.whisperPrompt(); prompt != "" {
+		if err := writer.WriteField("prompt", prompt); err != nil {
+			return nil, err
+		}
+	}
+	if hints.Temperature > 0 {
+		if err := writer.WriteField("temperature", strconv.FormatFloat(hints.Temperature, 'f', -1, 64)); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := os.Open(audioPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	part, err := writer.CreateFormFile("file", filepath.Base(audioPath))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint(model, "/audio/transcriptions"), &buf)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	body, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp transcriptionResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+
+	segments := make([]Segment, 0, len(resp.Segments))
+	for _, seg := range resp.Segments {
+		segments = append(segments, Segment{
+			Start:      seg.Start,
+			End:        seg.End,
+			Text:       seg.Text,
+			Confidence: logprobConfidence(seg.AvgLogprob),
+		})
+	}
+	if len(segments) == 0 && strings.TrimSpace(resp.Text) != "" {
+		duration, err := audioDuration(audioPath)
+		if err != nil {
+			return nil, fmt.Errorf("%s returned no timestamps, and timing its text needs the audio duration: %w", model, err)
+		}
+		segments = sentenceCues(resp.Text, duration)
+	}
+	return segments, nil
+}
+
+// logprobConfidence turns Whisper's average token log probability into a
+// 0-1 score (0 when the response had none).
+func logprobConfidence(avgLogprob float64) float64 {
+	if avgLogprob == 0 {
+		return 0
+	}
+	return math.Round(math.Exp(avgLogprob)*1000) / 1000
+}
+
+// Translate renders the translation prompt and sends it as a chat.
+func (c *OpenAIClient) Translate(ctx context.Context, model, sourceLang, targetLang, text string, history []TranslationPair) (string, error) {
+	messages, err := c.Prompt.messages(sourceLang, targetLang, text, history)
+	if err != nil {
+		return "", err
+	}
+	return c.Complete(ctx, model, messages)
+}
+
+// Complete sends a chat and returns the reply.
+func (c *OpenAIClient) Complete(ctx context.Context, model string, messages []ChatMessage) (string, error) {
+	payload := map[string]any{
+		"model":       model,
+		"messages":    messages,
+		"temperature": 0,
+	}
+	bodyBytes, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint(model, "/chat/completions"), bytes.NewReader(bodyBytes))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	body, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+
+	var resp chatResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", errors.New("chat completion returned no choices")
+	}
+	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+}
+
+func parseAPIError(statusCode int, body []byte) *apiError {
+	var resp openAIErrorResponse
+	if err := json.Unmarshal(body, &resp); err == nil && resp.Error.Message != "" {
+		return &apiError{
+			StatusCode: statusCode,
+			Message:    resp.Error.Message,
+			Type:       resp.Error.Type,
+			Code:       resp.Error.Code,
+		}
+	}
+	message := strings.TrimSpace(string(body))
+	if message == "" {
+		message = http.StatusText(statusCode)
+	}
+	return &apiError{StatusCode: statusCode, Message: message}
+}
+
+func describeError(err error) string {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		errType := apiErr.Type
+		if errType == "" {
+			errType = "api_error"
+		}
+		return fmt.Sprintf("%s (%d)", errType, apiErr.StatusCode)
+	}
+	return err.Error()
+}
@@ -0,0 +1,646 @@
+package subtitle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+
+	"bag-of-tricks/pkg/workspace"
+)
+
+// Options configures a Pipeline. Start from DefaultOptions: several zero
+// values (Extract.Track, ScaleFactor, MergeGap) are not the defaults.
+type Options struct {
+	// Model is the transcription model.
+	Model string
+	// SourceLang is the spoken language.
+	SourceLang string
+	// TargetLang is the translation language; empty or equal to SourceLang
+	// skips translation.
+	TargetLang     string
+	TranslateModel string
+
+	// AudioFormat is how audio is encoded for upload.
+	AudioFormat AudioFormat
+	Extract     ExtractOptions
+	// KeepAudio extracts the audio even when the transcript comes from the
+	// checkpoint, so Result.AudioPath is always set for a media input.
+	KeepAudio bool
+	// Start and End (0 for the end of the input) limit transcription to
+	// that part of the input, and Skip leaves further ranges out. Cue times
+	// still follow the whole input.
+	Start float64
+	End   float64
+	Skip  []TimeRange
+	// SkipSilence only sends speech, found with ffmpeg's silencedetect at
+	// SilenceDB for pauses of at least MinSilence seconds.
+	SkipSilence bool
+	SilenceDB   float64
+	MinSilence  float64
+
+	// ChunkSeconds forces chunked transcription; audio over MaxAudioMB is
+	// chunked regardless.
+	ChunkSeconds      int
+	ChunkOverlap      float64
+	MaxAudioMB        int
+	TranscribeWorkers int
+	// NoChapters chunks at fixed intervals even when the input has chapter
+	// markers. Chapters are not used with SkipSilence or trimming either.
+	NoChapters bool
+	// Accurate seeks chunks precisely, at the cost of decoding from the
+	// start of the file for each.
+	Accurate bool
+	// Prompt and Temperature are passed to the transcriber as hints.
+	Prompt      string
+	Temperature float64
+	// ChainChunks sends the end of each chunk's transcript as context for
+	// the next, which makes chunks run one at a time.
+	ChainChunks bool
+	// Stream translates each chunk as soon as it is transcribed, while the
+	// later ones are still being transcribed, instead of after the whole
+	// transcript. It has no effect without chunking, a translation, or with
+	// Script or MergeUnder.
+	Stream bool
+
+	// Script, if set, is the known text of the recording, one cue per
+	// entry (see LoadScript). The transcript is then only used to time it.
+	Script []string
+
+	// PreferEmbedded reads a text subtitle track of the input in SourceLang,
+	// if it has one, instead of transcribing the audio.
+	PreferEmbedded bool
+
+	// NoClean keeps the repeated and junk cues Whisper tends to invent.
+	NoClean bool
+	// MergeUnder joins cues shorter than this many seconds with neighbours
+	// at most MergeGap away (0 disables).
+	MergeUnder float64
+	MergeGap   float64
+
+	// Retry is how failed transcription, translation and review requests
+	// are retried.
+	Retry RetryPolicy
+
+	TranslateWorkers int
+	// MinTranslateChars leaves cues with fewer letters and digits as they
+	// are (0 translates everything).
+	MinTranslateChars int
+	// ContextSegments is how many earlier lines go along with each one.
+	ContextSegments   int
+	RequestsPerMinute int
+	TokensPerMinute   int
+	// Review sends the translations through a proofreading pass with
+	// ReviewModel (default TranslateModel), ReviewBatch cues at a time.
+	Review      bool
+	ReviewModel string
+	ReviewBatch int
+
+	// NoNormalize keeps the punctuation and spacing of translations into
+	// Chinese, Japanese and Korean as the translator wrote them.
+	NoNormalize bool
+	// Censor, if set, filters listed words out of the finished cues.
+	Censor *Censor
+
+	// MaxCueSeconds and MaxLineChars split and wrap long cues (0 disables).
+	MaxCueSeconds float64
+	MaxLineChars  int
+	// Output times are t*ScaleFactor + ShiftSeconds.
+	ShiftSeconds float64
+	ScaleFactor  float64
+	// FixTiming adjusts cue ends to clear the issues CheckTiming finds
+	// against TimingLimits.
+	FixTiming    bool
+	TimingLimits TimingLimits
+}
+
+// DefaultOptions returns the settings the command line starts from.
+func DefaultOptions() Options {
+	return Options{
+		Model:             DefaultWhisperModel,
+		SourceLang:        DefaultSourceLang,
+		TargetLang:        DefaultTargetLang,
+		TranslateModel:    DefaultTranslateModel,
+		AudioFormat:       AudioFormats["opus"],
+		Extract:           ExtractOptions{Track: -1},
+		SilenceDB:         -35,
+		MinSilence:        2,
+		MaxAudioMB:        DefaultMaxAudioMB,
+		TranscribeWorkers: DefaultTranscribeWorkers,
+		MergeGap:          0.5,
+		Retry:             DefaultRetryPolicy(),
+		TranslateWorkers:  DefaultTranslateWorkers,
+		MinTranslateChars: 4,
+		ContextSegments:   DefaultContextSegments,
+		ReviewBatch:       DefaultReviewBatch,
+		ScaleFactor:       1,
+	}
+}
+
+// Pipeline turns a video (or an .srt/.vtt file) into subtitles: audio
+// extraction, chunked transcription, cleanup, translation, review and cue
+// shaping. Run does it all; Transcribe, Translate and Finish are the same
+// steps for callers that want to act in between.
+type Pipeline struct {
+	Options
+	Transcriber Transcriber
+	// TranscriberName names the Transcriber in progress messages, such as
+	// deepgram; empty means Whisper.
+	TranscriberName string
+	Translator      Translator
+	// Reviewer runs the Review pass; when nil, the Translator is used if
+	// it can also complete chats.
+	Reviewer ChatCompleter
+	// Workspace holds the extracted audio and chunks. When nil, each call
+	// uses a temp dir of its own and removes it before returning.
+	Workspace *workspace.Workspace
+	// Checkpoint, if set, saves progress as it is made and resumes from it.
+	Checkpoint *Checkpoint
+	// Memory, if set, answers lines translated in earlier runs and learns
+	// the translations of this one.
+	Memory   *TranslationMemory
+	Progress *Progress
+}
+
+// Result is what the pipeline produced.
+type Result struct {
+	// Source is the transcript, or the cues of a subtitle input.
+	Source []Segment
+	// Segments are the output cues: the translation, or Source when
+	// nothing was translated. Parallel to Source until Finish.
+	Segments   []Segment
+	Translated bool
+	// AudioPath is the extracted audio in the Workspace, if any.
+	AudioPath string
+	// Parts are the inputs of TranscribeParts, in order.
+	Parts []Part
+
+	// stream holds the lines translated during transcription, with Stream.
+	stream *streamTranslation
+}
+
+// Part is one input of a recording split across several files, placed
+// Offset seconds into the whole.
+type Part struct {
+	Input    string
+	Offset   float64
+	Duration float64
+}
+
+// StageError reports the pipeline stage that failed: "read",
+// "extract_audio", "skip_silence", "transcribe", "translate" or "review".
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *StageError) Error() string { return e.Err.Error() }
+
+func (e *StageError) Unwrap() error { return e.Err }
+
+// Translating reports whether the options ask for a translation.
+func (o Options) Translating() bool {
+	return o.TargetLang != "" && o.TargetLang != o.SourceLang
+}
+
+// Run produces finished subtitles for input. When interrupted during
+// translation it returns the cues, those not finished marked
+// [untranslated], along with the error.
+func (p *Pipeline) Run(ctx context.Context, input string) (*Result, error) {
+	if p.Workspace == nil {
+		ws, err := workspace.New("video-subtitle", workspace.Options{})
+		if err != nil {
+			return nil, err
+		}
+		defer ws.Close()
+		q := *p
+		q.Workspace = ws
+		p = &q
+	}
+	r, err := p.Transcribe(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Translate(ctx, r); err != nil {
+		p.Finish(r)
+		return r, err
+	}
+	p.Finish(r)
+	return r, nil
+}
+
+// Transcribe reads a subtitle input, or extracts and transcribes the audio
+// of anything else, then cleans up and merges cues per the options.
+func (p *Pipeline) Transcribe(ctx context.Context, input string) (*Result, error) {
+	var segments []Segment
+	r := &Result{}
+	if IsSubtitleFile(input) {
+		var err error
+		segments, err = ReadSubtitleFile(input)
+		if err != nil {
+			return nil, &StageError{"read", err}
+		}
+		p.Progress.Printf("Loaded %d cues from %s; skipping transcription.", len(segments), input)
+	} else {
+		ws := p.Workspace
+		if ws == nil {
+			var err error
+			if ws, err = workspace.New("video-subtitle", workspace.Options{}); err != nil {
+				return nil, err
+			}
+			defer ws.Close()
+		}
+		var err error
+		embedded, haveEmbedded := p.embeddedCues(ws, input)
+		if haveEmbedded {
+			segments = embedded
+			if p.KeepAudio {
+				r.AudioPath = ws.Path("audio" + p.AudioFormat.Ext)
+				if err := ExtractAudio(input, r.AudioPath, p.Extract, p.AudioFormat); err != nil {
+					return nil, &StageError{"extract_audio", err}
+				}
+			}
+		} else {
+			segments, r.AudioPath, r.stream, err = p.transcribeMedia(ctx, ws, input)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if p.Workspace == nil {
+			r.AudioPath = ""
+		}
+		if len(p.Script) > 0 {
+			var aligned int
+			segments, aligned = alignScript(p.Script, segments)
+			p.Progress.Printf("Aligned %d of %d script lines with the transcript.", aligned, len(p.Script))
+			if aligned < len(p.Script) {
+				p.Progress.Printf("Lines not heard in the audio were timed between their neighbours.")
+			}
+			p.Progress.Event("align", "aligned", aligned, "segments", len(segments))
+		} else if !p.NoClean && !haveEmbedded {
+			var dropped int
+			segments, dropped = cleanSegments(segments)
+			if dropped > 0 {
+				p.Progress.Printf("Cleanup dropped %d hallucinated segments (--no-clean to keep them).", dropped)
+			}
+			p.Progress.Event("cleanup", "dropped", dropped, "segments", len(segments))
+		}
+	}
+	if p.MergeUnder > 0 {
+		before := len(segments)
+		segments = mergeShortSegments(segments, p.MergeUnder, p.MergeGap)
+		if len(segments) < before {
+			p.Progress.Printf("Merged short cues: %d -> %d.", before, len(segments))
+		}
+		p.Progress.Event("merge", "before", before, "segments", len(segments))
+	}
+	r.Source, r.Segments = segments, segments
+	return r, nil
+}
+
+// TranscribeParts transcribes inputs that are consecutive parts of one
+// recording (part1.mp4, part2.mp4, ...) as a whole: each part's cues are
+// moved later by the duration of the parts before it. Subtitle inputs have
+// no duration and are not accepted. The Checkpoint, which belongs to a
+// single input, is not used.
+func (p *Pipeline) TranscribeParts(ctx context.Context, inputs []string) (*Result, error) {
+	q := *p
+	q.Checkpoint = nil
+	r := &Result{}
+	offset := 0.0
+	for i, input := range inputs {
+		if IsSubtitleFile(input) {
+			return nil, &StageError{"read", fmt.Errorf("%s: only media files can be joined", input)}
+		}
+		duration, err := audioDuration(input)
+		if err != nil {
+			return nil, &StageError{"read", fmt.Errorf("%s: %w", input, err)}
+		}
+		p.Progress.Printf("Part %d/%d: %s (%.1fs)", i+1, len(inputs), input, duration)
+		p.Progress.Event("part", "index", i+1, "count", len(inputs), "input", input, "offset", offset)
+		part, err := q.Transcribe(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		r.stream = r.stream.merge(part.stream)
+		for _, seg := range part.Source {
+			seg.Start += offset
+			// Whisper sometimes runs the last cue past the end of the audio.
+			seg.End = min(seg.End+offset, max(offset+duration, seg.Start))
+			seg.Index = 0
+			r.Source = append(r.Source, seg)
+		}
+		r.Parts = append(r.Parts, Part{Input: input, Offset: offset, Duration: duration})
+		offset += duration
+	}
+	r.Segments = r.Source
+	return r, nil
+}
+
+// SplitParts divides the finished cues of a TranscribeParts result back
+// into one list per part, timed from the start of that part. A cue goes to
+// the part its midpoint falls in.
+func (p *Pipeline) SplitParts(r *Result) [][]Segment {
+	if len(r.Parts) == 0 {
+		return nil
+	}
+	scale := p.ScaleFactor
+	if scale == 0 {
+		scale = 1
+	}
+	parts := make([][]Segment, len(r.Parts))
+	for _, seg := range r.Segments {
+		mid := ((seg.Start+seg.End)/2 - p.ShiftSeconds) / scale
+		i := len(r.Parts) - 1
+		for i > 0 && mid < r.Parts[i].Offset {
+			i--
+		}
+		seg.Start -= r.Parts[i].Offset * scale
+		seg.End -= r.Parts[i].Offset * scale
+		seg.Start = max(seg.Start, 0)
+		parts[i] = append(parts[i], seg)
+	}
+	return parts
+}
+
+// embeddedCues reads the input's own text subtitle track in SourceLang,
+// with PreferEmbedded, trimmed like a transcript would be. Without one, or
+// when it cannot be read, the input is transcribed instead.
+func (p *Pipeline) embeddedCues(ws *workspace.Workspace, input string) ([]Segment, bool) {
+	if !p.PreferEmbedded {
+		return nil, false
+	}
+	tracks, err := ListSubtitleTracks(input)
+	if err != nil {
+		p.Progress.Printf("Cannot look for embedded subtitles; transcribing. %v", err)
+		return nil, false
+	}
+	track, ok := embeddedTrack(tracks, p.SourceLang)
+	if !ok {
+		p.Progress.Printf("No embedded %s text subtitles; transcribing.", p.SourceLang)
+		return nil, false
+	}
+	path := ws.Path(fmt.Sprintf("embedded_%d.srt", track.Number))
+	if err := extractSubtitleTrack(input, track.Number, path); err != nil {
+		p.Progress.Printf("Failed to extract embedded subtitle track %d; transcribing. %v", track.Number, err)
+		return nil, false
+	}
+	segments, err := ReadSubtitleFile(path)
+	if err != nil {
+		p.Progress.Printf("Failed to read embedded subtitle track %d; transcribing. %v", track.Number, err)
+		return nil, false
+	}
+	segments = trimCues(segments, p.Start, p.End, p.Skip)
+	if len(segments) == 0 {
+		p.Progress.Printf("Embedded subtitle track %d has no cues; transcribing.", track.Number)
+		return nil, false
+	}
+	// The track's own numbers have gaps once trimmed.
+	for i := range segments {
+		segments[i].Index = 0
+	}
+	p.Progress.Printf("Using embedded subtitle track %d (%s, %s) instead of transcribing: %d cues.", track.Number, track.Codec, track.Language, len(segments))
+	p.Progress.Event("embedded", "track", track.Number, "codec", track.Codec, "language", track.Language, "segments", len(segments))
+	return segments, true
+}
+
+// transcribeMedia returns the raw transcript of input, the path of its
+// extracted audio ("" if the transcript came from the checkpoint and the
+// audio was not wanted) and, with Stream, the lines translated meanwhile.
+func (p *Pipeline) transcribeMedia(ctx context.Context, ws *workspace.Workspace, input string) ([]Segment, string, *streamTranslation, error) {
+	cp := p.Checkpoint
+	segments, haveTranscript := cp.transcript()
+	if haveTranscript {
+		p.Progress.Printf("Resuming: loaded %d transcribed segments from %s", len(segments), cp.path)
+	}
+
+	audioPath := ""
+	if !haveTranscript || p.KeepAudio {
+		audioPath = ws.Path("audio" + p.AudioFormat.Ext)
+		p.Progress.Printf("Extracting audio...")
+		stageDone := p.Progress.Stage("extract_audio")
+		if err := ExtractAudio(input, audioPath, p.Extract, p.AudioFormat); err != nil {
+			return nil, "", nil, &StageError{"extract_audio", err}
+		}
+		if err := ws.CheckQuota(); err != nil {
+			return nil, "", nil, &StageError{"extract_audio", err}
+		}
+		stageDone()
+	}
+	if haveTranscript {
+		return segments, audioPath, nil, nil
+	}
+
+	transcribePath := audioPath
+	var kept, regions []TimeRange
+	trimming := p.Start > 0 || p.End > 0 || len(p.Skip) > 0
+	if trimming {
+		var err error
+		transcribePath, kept, err = trimAudio(ws, audioPath, p.Start, p.End, p.Skip, p.AudioFormat, p.Progress)
+		if err != nil {
+			return nil, "", nil, &StageError{"extract_audio", err}
+		}
+	}
+	if p.SkipSilence {
+		stageDone := p.Progress.Stage("skip_silence")
+		var err error
+		transcribePath, regions, err = removeSilence(ws, transcribePath, p.SilenceDB, p.MinSilence, p.AudioFormat, p.Progress)
+		if err != nil {
+			return nil, "", nil, &StageError{"skip_silence", err}
+		}
+		stageDone("regions", len(regions))
+	}
+	var chapters []Chapter
+	if !p.NoChapters && !p.SkipSilence && !trimming {
+		if _, err := exec.LookPath("ffprobe"); err == nil {
+			var err error
+			if chapters, err = ListChapters(input); err != nil {
+				p.Progress.Printf("Ignoring chapters: %v", err)
+			}
+		}
+	}
+	var stream *streamTranslation
+	var onChunk func([]Segment)
+	streamCtx, stopStream := context.WithCancel(ctx)
+	defer stopStream()
+	if p.streaming() {
+		stream = p.startStream(streamCtx)
+		onChunk = stream.add
+	}
+	stageDone := p.Progress.Stage("transcribe")
+	segments, err := transcribeAudio(ctx, p.Transcriber, ws, cp, transcribePath, transcribeOptions{
+		Backend:      p.TranscriberName,
+		Model:        p.Model,
+		Language:     p.SourceLang,
+		ChunkSeconds: p.ChunkSeconds,
+		ChunkOverlap: p.ChunkOverlap,
+		MaxAudioMB:   p.MaxAudioMB,
+		Workers:      p.TranscribeWorkers,
+		Accurate:     p.Accurate,
+		Format:       p.AudioFormat,
+		Prompt:       p.Prompt,
+		Temperature:  p.Temperature,
+		ChainChunks:  p.ChainChunks,
+		Retry:        p.Retry,
+		Chapters:     chapters,
+		OnChunk:      onChunk,
+	}, p.Progress)
+	if err != nil {
+		stopStream()
+		stream.finish()
+		return nil, "", nil, &StageError{"transcribe", err}
+	}
+	if regions != nil {
+		segments = remapSegments(regions, segments)
+	}
+	if kept != nil {
+		segments = remapSegments(kept, segments)
+	}
+	stageDone("segments", len(segments))
+	cp.setTranscript(segments)
+	// The last chunks are still being translated.
+	stream.finish()
+	return segments, audioPath, stream, nil
+}
+
+// Translate replaces r.Segments with their translation, when the options
+// ask for one, and reviews it if Review is set. On failure r.Segments holds
+// every cue, those not finished with their source text marked
+// [untranslated].
+func (p *Pipeline) Translate(ctx context.Context, r *Result) error {
+	if !p.Translating() {
+		return nil
+	}
+	cp := p.Checkpoint
+	cp.useTranslation(translationKey{Model: p.TranslateModel, SourceLang: p.SourceLang, TargetLang: p.TargetLang})
+	if n := cp.translationCount(); n > 0 {
+		p.Progress.Printf("Resuming: %d segments already translated.", n)
+	}
+	workers := p.TranslateWorkers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	translatable := countTranslatableSegments(r.Source, p.MinTranslateChars)
+	r.Translated = true
+	if translatable == 0 {
+		p.Progress.Printf("Skipping translation: segments are low-info.")
+		return nil
+	}
+
+	p.Progress.Printf("Translating segments (%d of %d segments, %d workers)...", translatable, len(r.Source), workers)
+	stageDone := p.Progress.Stage("translate")
+	// Share the stream's limiter, whose window may still be full.
+	limiter := newRateLimiter(p.RequestsPerMinute, p.TokensPerMinute)
+	if r.stream != nil {
+		limiter = r.stream.limiter
+	}
+	translated, err := translateSegments(ctx, p.Memory.Wrap(p.Translator), r.Source, p.SourceLang, p.TargetLang, p.TranslateModel, workers, p.MinTranslateChars, p.ContextSegments, limiter, p.Retry, cp, r.stream, p.Progress)
+	r.Segments = translated
+	if err != nil {
+		return &StageError{"translate", err}
+	}
+	stageDone("segments", len(translated), "translated", translatable)
+
+	if !p.Review {
+		p.remember(r)
+		return nil
+	}
+	reviewer := p.Reviewer
+	if reviewer == nil {
+		reviewer, _ = p.Translator.(ChatCompleter)
+	}
+	if reviewer == nil {
+		return &StageError{"review", errors.New("review needs a Reviewer")}
+	}
+	model := p.ReviewModel
+	if model == "" {
+		model = p.TranslateModel
+	}
+	stageDone = p.Progress.Stage("review")
+	reviewed, changed, err := reviewTranslations(ctx, reviewer, model, p.SourceLang, p.TargetLang, r.Source, r.Segments, p.ReviewBatch, p.MinTranslateChars, p.Retry, p.Progress)
+	if err != nil {
+		return &StageError{"review", err}
+	}
+	p.Progress.Printf("Review revised %d of %d cues.", changed, translatable)
+	stageDone("segments", len(reviewed), "changed", changed)
+	r.Segments = reviewed
+	p.remember(r)
+	return nil
+}
+
+// remember adds the finished translations to the Memory, if any, and
+// saves it.
+func (p *Pipeline) remember(r *Result) {
+	if p.Memory == nil {
+		return
+	}
+	added := p.Memory.Learn(p.SourceLang, p.TargetLang, r.Source, r.Segments)
+	exact, fuzzy := p.Memory.Hits()
+	p.Progress.Printf("Translation memory: %d lines reused (%d fuzzy matches), %d learned.", exact+fuzzy, fuzzy, added)
+	p.Progress.Event("memory", "reused", exact+fuzzy, "fuzzy", fuzzy, "learned", added)
+	if err := p.Memory.Save(); err != nil {
+		p.Progress.Printf("Failed to save the translation memory: %v", err)
+	}
+}
+
+// Finish normalizes CJK punctuation in translations, censors, splits and
+// wraps long cues, retimes and fixes timing. It changes both r.Segments and
+// r.Source, which may no longer line up afterwards.
+func (p *Pipeline) Finish(r *Result) {
+	if r.Translated && !p.NoNormalize && cjkLanguage(p.TargetLang) != "" {
+		var changed int
+		r.Segments, changed = normalizeSegments(r.Segments, p.TargetLang)
+		if changed > 0 {
+			p.Progress.Printf("Normalized punctuation in %d cues (--no-normalize to keep it).", changed)
+		}
+		p.Progress.Event("normalize", "changed", changed, "segments", len(r.Segments))
+	}
+	if c := p.Censor; c != nil {
+		filtered := 0
+		if c.Transcript {
+			r.Source, filtered = c.Apply(r.Source)
+		}
+		if r.Translated && c.Translation {
+			var n int
+			r.Segments, n = c.Apply(r.Segments)
+			filtered += n
+		} else if !r.Translated && c.Transcript {
+			r.Segments, _ = c.Apply(r.Segments)
+		}
+		if filtered > 0 {
+			p.Progress.Printf("Censored %d words.", filtered)
+		}
+		p.Progress.Event("censor", "words", filtered, "segments", len(r.Segments))
+	}
+
+	if p.MaxCueSeconds > 0 || p.MaxLineChars > 0 {
+		before := len(r.Segments)
+		r.Segments = wrapSegments(splitLongSegments(r.Segments, p.MaxCueSeconds, p.MaxLineChars), p.MaxLineChars)
+		if len(r.Segments) > before {
+			p.Progress.Printf("Split long cues: %d -> %d.", before, len(r.Segments))
+		}
+		p.Progress.Event("split", "before", before, "segments", len(r.Segments))
+		r.Source = wrapSegments(splitLongSegments(r.Source, p.MaxCueSeconds, p.MaxLineChars), p.MaxLineChars)
+	}
+
+	scale := p.ScaleFactor
+	if scale == 0 {
+		scale = 1
+	}
+	if p.ShiftSeconds != 0 || scale != 1 {
+		r.Segments = retimeSegments(r.Segments, p.ShiftSeconds, scale)
+		r.Source = retimeSegments(r.Source, p.ShiftSeconds, scale)
+		p.Progress.Printf("Retimed cues: x%g %+gs.", scale, p.ShiftSeconds)
+	}
+
+	if p.FixTiming {
+		var fixed int
+		r.Segments, fixed = FixTiming(r.Segments, p.TimingLimits)
+		r.Source, _ = FixTiming(r.Source, p.TimingLimits)
+		if fixed > 0 {
+			p.Progress.Printf("Fixed the timing of %d cues.", fixed)
+		}
+		p.Progress.Event("fix_timing", "fixed", fixed, "segments", len(r.Segments))
+	}
+}
@@ -0,0 +1,82 @@
+package subtitle
+
+import (
+	"context"
+	"fmt"
+
+	"bag-of-tricks/pkg/plugin"
+)
+
+// StartPlugin launches an external backend (see pkg/plugin) and checks that
+// it implements the method we are going to call.
+func StartPlugin(command, method string) (*plugin.Process, error) {
+	p, err := plugin.StartCommand(command)
+	if err != nil {
+		return nil, err
+	}
+	if !p.Supports(method) {
+		_ = p.Close()
+		return nil, fmt.Errorf("plugin %s does not implement %q", p.Name(), method)
+	}
+	return p, nil
+}
+
+// PluginTranscriber adapts a transcription plugin to Transcriber.
+type PluginTranscriber struct {
+	P plugin.Transcriber
+}
+
+func (t PluginTranscriber) Transcribe(ctx context.Context, audioPath, model, language string, hints TranscribeHints) ([]Segment, error) {
+	segs, err := t.P.Transcribe(ctx, plugin.TranscribeRequest{
+		AudioPath:   audioPath,
+		Model:       model,
+		Language:    language,
+		Prompt:      hints.whisperPrompt(),
+		Temperature: hints.Temperature,
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Segment, 0, len(segs))
+	for _, s := range segs {
+		out = append(out, Segment{Start: s.Start, End: s.End, Text: s.Text})
+	}
+	return out, nil
+}
+
+// PluginTranslator adapts a translation plugin to Translator.
+type PluginTranslator struct {
+	P plugin.Translator
+}
+
+func (t PluginTranslator) Translate(ctx context.Context, model, sourceLang, targetLang, text string, history []TranslationPair) (string, error) {
+	req := plugin.TranslateRequest{Model: model, SourceLang: sourceLang, TargetLang: targetLang, Text: text}
+	for _, pair := range history {
+		req.Context = append(req.Context, plugin.TranslationPair{Source: pair.Source, Target: pair.Target})
+	}
+	return t.P.Translate(ctx, req)
+}
+
+// LLMTranslator sends our own translation prompts to an external LLM, for
+// providers that only offer chat completion. A nil Prompt uses the built-in
+// prompts.
+type LLMTranslator struct {
+	LLM    plugin.LLMProvider
+	Prompt *TranslationPrompt
+}
+
+func (t LLMTranslator) Translate(ctx context.Context, model, sourceLang, targetLang, text string, history []TranslationPair) (string, error) {
+	messages, err := t.Prompt.messages(sourceLang, targetLang, text, history)
+	if err != nil {
+		return "", err
+	}
+	return t.Complete(ctx, model, messages)
+}
+
+func (t LLMTranslator) Complete(ctx context.Context, model string, messages []ChatMessage) (string, error) {
+	req := plugin.ChatRequest{Model: model}
+	for _, m := range messages {
+		req.Messages = append(req.Messages, plugin.Message{Role: m.Role, Content: m.Content})
+	}
+	return t.LLM.Complete(ctx, req)
+}
@@ -0,0 +1,47 @@
+package subtitle
+
+import (
+	"fmt"
+	"time"
+)
+
+// Progress receives what the pipeline is doing. Both callbacks are
+// optional, and a nil *Progress discards everything.
+type Progress struct {
+	// OnMessage gets human-readable progress lines such as
+	// "Transcribing chunk 2/5 at 600.0s...".
+	OnMessage func(text string)
+	// OnEvent gets structured events with log/slog-style key/value pairs:
+	// stage_start and stage_end (with "stage"), part, chunk_start, chunk_end,
+	// chunk_restored, stream, retry, provider, failover, embedded, align,
+	// cleanup, merge, memory, repair, normalize, censor, split and
+	// fix_timing.
+	OnEvent func(name string, args ...any)
+}
+
+// Printf reports a progress message.
+func (p *Progress) Printf(format string, args ...any) {
+	if p == nil || p.OnMessage == nil {
+		return
+	}
+	p.OnMessage(fmt.Sprintf(format, args...))
+}
+
+// Event emits a structured event.
+func (p *Progress) Event(name string, args ...any) {
+	if p == nil || p.OnEvent == nil {
+		return
+	}
+	p.OnEvent(name, args...)
+}
+
+// Stage emits stage_start and returns a func that emits the matching
+// stage_end with the elapsed time plus any extra key/value pairs.
+func (p *Progress) Stage(name string) func(args ...any) {
+	p.Event("stage_start", "stage", name)
+	start := time.Now()
+	return func(args ...any) {
+		args = append([]any{"stage", name, "duration_ms", time.Since(start).Milliseconds()}, args...)
+		p.Event("stage_end", args...)
+	}
+}
@@ -0,0 +1,236 @@
+package subtitle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// promptData is what translation prompt templates can refer to.
+type promptData struct {
+	SourceLang string
+	TargetLang string
+	Text       string
+	// Glossary is the --glossary file as "source: target" lines.
+	Glossary string
+	// HasContext is set when earlier lines are replayed as prior turns.
+	HasContext bool
+	// Speaker is the speaker tag of the line and Register the style
+	// --speaker-styles gives them (user prompt), when it lists them.
+	Speaker  string
+	Register string
+}
+
+const defaultSystemPrompt = `You are a precise translator. Return only the translation.
+{{- if .HasContext}} The earlier turns are preceding subtitle lines from the same video; keep names, pronouns, honorifics and tone consistent with them.{{end}}
+{{- if .Glossary}}
+
+Always translate these names and terms as given:
+{{.Glossary}}{{end}}`
+
+const defaultUserPrompt = `Translate the following text from {{.SourceLang}} to {{.TargetLang}}. Preserve punctuation and line breaks.
+{{- if .Register}} {{.Speaker}} speaks this line; match their register: {{.Register}}.{{end}}
+
+{{.Text}}`
+
+// TranslationPrompt renders the chat sent for each segment. A nil
+// *TranslationPrompt uses the built-in prompts without a glossary.
+type TranslationPrompt struct {
+	system   *template.Template
+	user     *template.Template
+	glossary string
+	// speakers maps speaker tags to registers.
+	speakers map[string]string
+}
+
+var defaultTranslationPrompt = &TranslationPrompt{
+	system: template.Must(template.New("system").Parse(defaultSystemPrompt)),
+	user:   template.Must(template.New("user").Parse(defaultUserPrompt)),
+}
+
+// LoadTranslationPrompt reads --prompt-template, --glossary and
+// --speaker-styles; any may be empty. The template file overrides the system prompt, the user prompt
+// or both with {{define "system"}}...{{end}} and {{define "user"}}...{{end}}
+// blocks; a file without blocks replaces the system prompt as a whole.
+func LoadTranslationPrompt(templatePath, glossaryPath, speakersPath string) (*TranslationPrompt, error) {
+	p := *defaultTranslationPrompt
+	if templatePath != "" {
+		data, err := os.ReadFile(templatePath)
+		if err != nil {
+			return nil, err
+		}
+		t, err := template.New("file").Parse(string(data))
+		if err != nil {
+			return nil, err
+		}
+		system, user := t.Lookup("system"), t.Lookup("user")
+		if system == nil && user == nil {
+			system = t
+		}
+		if system != nil {
+			p.system = system
+		}
+		if user != nil {
+			p.user = user
+		}
+		// Catch references to unknown fields now rather than mid-run.
+		if err := p.check(); err != nil {
+			return nil, fmt.Errorf("%s: %v", templatePath, err)
+		}
+	}
+	if glossaryPath != "" {
+		glossary, err := readGlossary(glossaryPath)
+		if err != nil {
+			return nil, err
+		}
+		p.glossary = glossary
+	}
+	if speakersPath != "" {
+		speakers, err := readSpeakerStyles(speakersPath)
+		if err != nil {
+			return nil, err
+		}
+		p.speakers = speakers
+	}
+	return &p, nil
+}
+
+// readGlossary reads "source = target" lines (blank lines and # comments
+// are skipped) into the "source: target" list given to the prompt.
+func readGlossary(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		source, target, ok := strings.Cut(line, "=")
+		source, target = strings.TrimSpace(source), strings.TrimSpace(target)
+		if !ok || source == "" || target == "" {
+			return "", fmt.Errorf("%s:%d: want \"source = target\"", path, n)
+		}
+		lines = append(lines, source+": "+target)
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// readSpeakerStyles reads "speaker = register" lines, such as
+// "部長 = formal and curt; refers to himself as 私", into a map.
+func readSpeakerStyles(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	speakers := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		speaker, register, ok := strings.Cut(line, "=")
+		speaker, register = strings.TrimSpace(speaker), strings.TrimSpace(register)
+		if !ok || speaker == "" || register == "" {
+			return nil, fmt.Errorf("%s:%d: want \"speaker = register\"", path, n)
+		}
+		speakers[strings.ToLower(speaker)] = strings.TrimSuffix(register, ".")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return speakers, nil
+}
+
+// speakerTagPattern matches the speaker tag subtitles and scripts put
+// before a line, after any dialogue dash: "Name: ", "名前：", "[Name] " or
+// "（名前）".
+var speakerTagPattern = regexp.MustCompile(`^\s*(?:[-–—]\s*)?(?:[\[(（]([^\])）\n]{1,30})[\])）]|([^-–—\s:：\[(（][^:：\n]{0,29}?)\s*[:：])`)
+
+// speakerTag returns the speaker tag text starts with, or "".
+func speakerTag(text string) string {
+	m := speakerTagPattern.FindStringSubmatch(text)
+	if m == nil {
+		return ""
+	}
+	return strings.TrimSpace(m[1] + m[2])
+}
+
+// register returns the speaker of text and their register, if
+// --speaker-styles lists them.
+func (p *TranslationPrompt) register(text string) (string, string) {
+	if len(p.speakers) == 0 {
+		return "", ""
+	}
+	speaker := speakerTag(text)
+	if register, ok := p.speakers[strings.ToLower(speaker)]; ok && speaker != "" {
+		return speaker, register
+	}
+	return "", ""
+}
+
+// check renders both templates with sample data.
+func (p *TranslationPrompt) check() error {
+	data := promptData{SourceLang: "ja", TargetLang: "en", Text: "text", Glossary: "term: term", HasContext: true, Speaker: "A", Register: "formal"}
+	if err := p.system.Execute(io.Discard, data); err != nil {
+		return err
+	}
+	return p.user.Execute(io.Discard, data)
+}
+
+func (p *TranslationPrompt) userPrompt(sourceLang, targetLang, text string) (string, error) {
+	var buf strings.Builder
+	speaker, register := p.register(text)
+	err := p.user.Execute(&buf, promptData{SourceLang: sourceLang, TargetLang: targetLang, Text: text, Glossary: p.glossary, Speaker: speaker, Register: register})
+	return buf.String(), err
+}
+
+// messages builds the chat for one segment. Earlier segments are replayed
+// as prior user/assistant turns, so the model sees the dialogue so far
+// without being asked to translate it again.
+func (p *TranslationPrompt) messages(sourceLang, targetLang, text string, history []TranslationPair) ([]ChatMessage, error) {
+	if p == nil {
+		p = defaultTranslationPrompt
+	}
+	var system strings.Builder
+	err := p.system.Execute(&system, promptData{
+		SourceLang: sourceLang,
+		TargetLang: targetLang,
+		Glossary:   p.glossary,
+		HasContext: len(history) > 0,
+	})
+	if err != nil {
+		return nil, err
+	}
+	messages := []ChatMessage{{Role: "system", Content: system.String()}}
+	for _, pair := range history {
+		prompt, err := p.userPrompt(sourceLang, targetLang, pair.Source)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages,
+			ChatMessage{Role: "user", Content: prompt},
+			ChatMessage{Role: "assistant", Content: pair.Target},
+		)
+	}
+	prompt, err := p.userPrompt(sourceLang, targetLang, text)
+	if err != nil {
+		return nil, err
+	}
+	return append(messages, ChatMessage{Role: "user", Content: prompt}), nil
+}
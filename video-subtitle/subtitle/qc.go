@@ -0,0 +1,143 @@
+package subtitle
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// TimingLimits are the thresholds CheckTiming and FixTiming hold cues to.
+type TimingLimits struct {
+	// MinSeconds is the shortest time a cue should stay on screen.
+	MinSeconds float64
+	// MaxCPS is the fastest reading speed, in characters per second
+	// (line breaks not counted).
+	MaxCPS float64
+}
+
+// DefaultTimingLimits returns 0.5s and the reading speeds common subtitle
+// style guides use for lang: 9 cps for Chinese, 4 for Japanese, 12 for
+// Korean and 17 otherwise.
+func DefaultTimingLimits(lang string) TimingLimits {
+	limits := TimingLimits{MinSeconds: 0.5, MaxCPS: 17}
+	switch cjkLanguage(lang) {
+	case "zh":
+		limits.MaxCPS = 9
+	case "ja":
+		limits.MaxCPS = 4
+	case "ko":
+		limits.MaxCPS = 12
+	}
+	return limits
+}
+
+// Timing issue kinds.
+const (
+	IssueOverlap      = "overlap"
+	IssueNegative     = "negative_duration"
+	IssueShort        = "short"
+	IssueReadingSpeed = "reading_speed"
+)
+
+// maxFixedCueSeconds caps how far FixTiming lengthens a cue.
+const maxFixedCueSeconds = 7.0
+
+// TimingIssue is one problem CheckTiming found. Cue is the 1-based position
+// of the cue in the output.
+type TimingIssue struct {
+	Cue    int
+	Start  float64
+	Kind   string
+	Detail string
+}
+
+func (i TimingIssue) String() string {
+	return fmt.Sprintf("cue %d at %s: %s: %s", i.Cue, formatSRTTimestamp(i.Start), i.Kind, i.Detail)
+}
+
+// CheckTiming finds cues that end after the next one starts, end before
+// they start, are shorter than limits.MinSeconds, or need reading faster
+// than limits.MaxCPS (a zero limit is not checked).
+func CheckTiming(segments []Segment, limits TimingLimits) []TimingIssue {
+	var issues []TimingIssue
+	for i, seg := range segments {
+		report := func(kind, format string, args ...any) {
+			issues = append(issues, TimingIssue{Cue: i + 1, Start: seg.Start, Kind: kind, Detail: fmt.Sprintf(format, args...)})
+		}
+		duration := seg.End - seg.Start
+		switch {
+		case duration == 0:
+			report(IssueNegative, "starts and ends at the same time")
+		case duration < 0:
+			report(IssueNegative, "ends %.3fs before it starts", -duration)
+		case limits.MinSeconds > 0 && duration < limits.MinSeconds:
+			report(IssueShort, "on screen for %.3fs", duration)
+		}
+		if i+1 < len(segments) && seg.End > segments[i+1].Start {
+			report(IssueOverlap, "ends %.3fs after cue %d starts", seg.End-segments[i+1].Start, i+2)
+		}
+		if cps := readingSpeed(seg); limits.MaxCPS > 0 && duration > 0 && cps > limits.MaxCPS {
+			report(IssueReadingSpeed, "%.1f characters per second", cps)
+		}
+	}
+	return issues
+}
+
+// FixTiming makes the small adjustments that clear most issues: a cue that
+// overlaps the next one ends where it starts, and one that is too short,
+// inverted or too fast to read is lengthened as far as the limits ask, up
+// to the start of the next cue and 7s. It returns the cues and how many
+// were changed.
+func FixTiming(segments []Segment, limits TimingLimits) ([]Segment, int) {
+	out := make([]Segment, len(segments))
+	copy(out, segments)
+	changed := 0
+	for i := range out {
+		seg := &out[i]
+		before := *seg
+		next := -1.0
+		if i+1 < len(out) {
+			next = out[i+1].Start
+		}
+		if next >= 0 && seg.End > next && next > seg.Start {
+			seg.End = next
+		}
+		want := max(limits.MinSeconds, 0)
+		if limits.MaxCPS > 0 {
+			want = max(want, float64(cueChars(seg.Text))/limits.MaxCPS)
+		}
+		want = min(want, maxFixedCueSeconds)
+		if seg.End-seg.Start < want {
+			// Round up to the millisecond the subtitle formats keep.
+			end := math.Ceil((seg.Start+want)*1000) / 1000
+			if next >= 0 && end > next {
+				end = max(next, seg.End)
+			}
+			seg.End = end
+		}
+		if seg.End != before.End {
+			changed++
+		}
+	}
+	return out, changed
+}
+
+// WriteTimingReport writes one line per issue to path.
+func WriteTimingReport(issues []TimingIssue, path string) error {
+	var buf strings.Builder
+	for _, issue := range issues {
+		buf.WriteString(issue.String())
+		buf.WriteString("\n")
+	}
+	return os.WriteFile(path, []byte(buf.String()), 0644)
+}
+
+func readingSpeed(seg Segment) float64 {
+	return float64(cueChars(seg.Text)) / (seg.End - seg.Start)
+}
+
+func cueChars(text string) int {
+	return utf8.RuneCountInString(strings.ReplaceAll(strings.TrimSpace(text), "\n", ""))
+}
@@ -0,0 +1,159 @@
+package subtitle
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// maxRateLimitDelay caps how long a server-provided Retry-After is honoured,
+// so a bogus header cannot stall the run indefinitely.
+const maxRateLimitDelay = 2 * time.Minute
+
+// rateLimitDelay reads how long the server asked us to wait: Retry-After
+// (seconds or an HTTP date), OpenAI's retry-after-ms, or failing those the
+// longest of the x-ratelimit-reset-* headers ("1s", "6m0s", "20ms").
+func rateLimitDelay(header http.Header) time.Duration {
+	if ms, err := strconv.ParseFloat(header.Get("Retry-After-Ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	if value := header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+			return time.Duration(seconds * float64(time.Second))
+		}
+		if at, err := http.ParseTime(value); err == nil {
+			if d := time.Until(at); d > 0 {
+				return d
+			}
+		}
+	}
+	var longest time.Duration
+	for _, name := range []string{"X-Ratelimit-Reset-Requests", "X-Ratelimit-Reset-Tokens"} {
+		if d, err := time.ParseDuration(header.Get(name)); err == nil && d > longest {
+			longest = d
+		}
+	}
+	return longest
+}
+
+// retryAfter returns the wait the server asked for with err, if any.
+func retryAfter(err error) time.Duration {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return min(apiErr.RetryAfter, maxRateLimitDelay)
+	}
+	return 0
+}
+
+// rateLimiter spaces requests shared by all translation workers: at most
+// rpm requests and tpm estimated tokens per minute (zero disables either),
+// and a pause that every worker honours once one of them is told to back
+// off. A nil *rateLimiter never waits.
+type rateLimiter struct {
+	mu          sync.Mutex
+	interval    time.Duration
+	next        time.Time
+	tpm         float64
+	tokens      float64
+	refilled    time.Time
+	pausedUntil time.Time
+}
+
+func newRateLimiter(rpm, tpm int) *rateLimiter {
+	l := &rateLimiter{tpm: float64(tpm), tokens: float64(tpm), refilled: time.Now()}
+	if rpm > 0 {
+		l.interval = time.Minute / time.Duration(rpm)
+	}
+	return l
+}
+
+// Wait blocks until a request of the given estimated size may be sent.
+func (l *rateLimiter) Wait(ctx context.Context, tokens int) error {
+	if l == nil {
+		return nil
+	}
+	for {
+		delay := l.reserve(float64(tokens))
+		if delay <= 0 {
+			return nil
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve takes a request slot and the tokens if both are free now, and
+// otherwise returns how long to wait before trying again.
+func (l *rateLimiter) reserve(tokens float64) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Before(l.pausedUntil) {
+		return l.pausedUntil.Sub(now)
+	}
+	if l.interval > 0 && now.Before(l.next) {
+		return l.next.Sub(now)
+	}
+	if l.tpm > 0 {
+		l.tokens = min(l.tpm, l.tokens+l.tpm*now.Sub(l.refilled).Minutes())
+		l.refilled = now
+		tokens = min(tokens, l.tpm)
+		if l.tokens < tokens {
+			return time.Duration((tokens - l.tokens) / l.tpm * float64(time.Minute))
+		}
+		l.tokens -= tokens
+	}
+	if l.interval > 0 {
+		l.next = now.Add(l.interval)
+	}
+	return 0
+}
+
+// Pause holds back every worker for d, e.g. after a 429 with Retry-After.
+func (l *rateLimiter) Pause(d time.Duration) {
+	if l == nil || d <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// estimateTokens roughly sizes a translation request: a token per CJK
+// character, one per four other characters, the same again for the reply,
+// plus the prompt around it.
+func estimateTokens(texts ...string) int {
+	total := 0.0
+	for _, text := range texts {
+		for _, r := range text {
+			switch {
+			case isCJK(r):
+				total++
+			case !unicode.IsSpace(r):
+				total += 0.25
+			}
+		}
+	}
+	return int(2*total) + 50
+}
+
+// translationTokens estimates one translation request, replayed history
+// included.
+func translationTokens(text string, history []TranslationPair) int {
+	texts := []string{text}
+	for _, pair := range history {
+		texts = append(texts, pair.Source, pair.Target)
+	}
+	return estimateTokens(texts...)
+}
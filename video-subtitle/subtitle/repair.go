@@ -0,0 +1,113 @@
+package subtitle
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"unicode"
+)
+
+// repairMarkers are prefixes that mark a cue as failed, left in front of
+// the source text by a failed run, by hand or by other tools.
+var repairMarkers = []string{untranslatedMarker, "[translation failed]"}
+
+// needsRepair returns the text to translate again if a cue of a
+// sourceLang to targetLang translation was left untranslated or marked as
+// failed.
+func needsRepair(text, sourceLang, targetLang string) (string, bool) {
+	text = strings.TrimSpace(text)
+	lower := strings.ToLower(text)
+	for _, marker := range repairMarkers {
+		if strings.HasPrefix(lower, marker) {
+			rest := strings.TrimSpace(text[len(marker):])
+			return rest, rest != ""
+		}
+	}
+	return text, looksUntranslated(text, sourceLang, targetLang)
+}
+
+// looksUntranslated reports whether text is written in the script of
+// sourceLang rather than targetLang. Pairs that share a script (English to
+// French, Chinese to Japanese kanji-only lines) cannot be told apart and
+// report false.
+func looksUntranslated(text, sourceLang, targetLang string) bool {
+	var kana, hangul, han, other int
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana) && r != 'ー':
+			kana++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.IsLetter(r):
+			other++
+		}
+	}
+	source, target := cjkLanguage(sourceLang), cjkLanguage(targetLang)
+	if source == target {
+		return false
+	}
+	switch source {
+	case "ja":
+		return kana > 0 || (target != "zh" && han > 0)
+	case "ko":
+		return hangul > 0
+	case "zh":
+		return han > 0 && (target != "ja" || kana == 0)
+	}
+	// A language written in letters, into Chinese, Japanese or Korean.
+	return other > 0 && kana+hangul+han == 0
+}
+
+// Repair translates the cues of a finished translation that were left
+// untranslated or marked as failed, and returns the cues with those
+// replaced and how many there were. The other cues are not touched. On
+// failure the cues translated so far are kept.
+func (p *Pipeline) Repair(ctx context.Context, segments []Segment) ([]Segment, int, error) {
+	var source []Segment
+	var indexes []int
+	for i, seg := range segments {
+		text, ok := needsRepair(seg.Text, p.SourceLang, p.TargetLang)
+		if !ok || isLowInfoText(text, p.MinTranslateChars) {
+			continue
+		}
+		seg.Text = text
+		source = append(source, seg)
+		indexes = append(indexes, i)
+	}
+	out := append([]Segment{}, segments...)
+	if len(source) == 0 {
+		p.Progress.Printf("Nothing to repair: every cue is translated.")
+		p.Progress.Event("repair", "repaired", 0, "segments", len(segments))
+		return out, 0, nil
+	}
+	workers := p.TranslateWorkers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	p.Progress.Printf("Repairing %d of %d cues...", len(source), len(segments))
+	stageDone := p.Progress.Stage("translate")
+	// Neighbouring cues are translations already, so each cue goes alone.
+	translated, err := translateSegments(ctx, p.Memory.Wrap(p.Translator), source, p.SourceLang, p.TargetLang, p.TranslateModel, workers, p.MinTranslateChars, 0, newRateLimiter(p.RequestsPerMinute, p.TokensPerMinute), p.Retry, nil, nil, p.Progress)
+	if err != nil {
+		// The cues that did not finish come back marked, for the next
+		// --repair.
+		repaired := 0
+		for k, i := range indexes {
+			out[i].Text = translated[k].Text
+			if !strings.HasPrefix(translated[k].Text, untranslatedMarker) {
+				repaired++
+			}
+		}
+		return out, repaired, &StageError{"translate", err}
+	}
+	for k, i := range indexes {
+		out[i].Text = translated[k].Text
+	}
+	stageDone("segments", len(source))
+	p.Progress.Printf("Repaired %d of %d cues.", len(source), len(segments))
+	p.Progress.Event("repair", "repaired", len(source), "segments", len(segments))
+	p.remember(&Result{Source: source, Segments: translated})
+	return out, len(source), nil
+}
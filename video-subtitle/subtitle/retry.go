@@ -0,0 +1,109 @@
+package subtitle
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+)
+
+// RetryPolicy is how failed API requests are retried: up to MaxRetries
+// times, waiting BaseDelay doubled on each attempt up to MaxDelay (or what
+// the server's Retry-After asks for), plus up to 25% random jitter so
+// parallel workers do not retry in lockstep.
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+// DefaultRetryPolicy retries 4 times, starting at 1s and waiting at most 20s.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxRetries: 4, BaseDelay: time.Second, MaxDelay: 20 * time.Second}
+}
+
+func retry(
+	ctx context.Context,
+	policy RetryPolicy,
+	shouldRetry func(error) bool,
+	onRetry func(int, time.Duration, error),
+	fn func() error,
+) error {
+	for attempt := 0; ; attempt++ {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if attempt >= policy.MaxRetries {
+			return err
+		}
+		if shouldRetry != nil && !shouldRetry(err) {
+			return err
+		}
+		delay := policy.MaxDelay
+		// Past 2^30 the shift overflows long before any sane MaxDelay.
+		if attempt < 30 && policy.BaseDelay < policy.MaxDelay>>attempt {
+			delay = policy.BaseDelay << attempt
+		}
+		if after := retryAfter(err); after > 0 {
+			delay = after
+		}
+		// The top-level math/rand source is seeded randomly per process.
+		delay += time.Duration(float64(delay) * 0.25 * rand.Float64())
+		if onRetry != nil {
+			onRetry(attempt+1, delay, err)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case 408, 409, 429, 500, 502, 503, 504:
+			return true
+		default:
+			return false
+		}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return false
+}
+
+func shouldFallbackToChunking(err error) bool {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		message := strings.ToLower(apiErr.Message)
+		if strings.Contains(message, "reading your request") {
+			return true
+		}
+		if strings.Contains(strings.ToLower(apiErr.Type), "invalid_request_error") {
+			return true
+		}
+		if apiErr.StatusCode == 413 {
+			return true
+		}
+		if apiErr.StatusCode >= 500 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package subtitle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const DefaultReviewBatch = 20
+
+const reviewSystemPrompt = `You are an editor proofreading %s subtitles translated from %s.
+You receive a JSON array of {"id", "source", "draft"} cues in playback order. Fix mistranslations, omissions, inconsistent names and awkward or unnatural phrasing; keep drafts that are already good unchanged. Each cue is shown on screen on its own, so never move text between cues, merge or split them.
+Reply with only a JSON array of {"id", "translation"} with one entry per input cue, in the same order.`
+
+type reviewItem struct {
+	ID     int    `json:"id"`
+	Source string `json:"source"`
+	Draft  string `json:"draft"`
+}
+
+type reviewResult struct {
+	ID          int    `json:"id"`
+	Translation string `json:"translation"`
+}
+
+// reviewTranslations sends (source, draft) pairs in batches through a
+// second LLM pass and takes its corrections. Cue count, order and timing
+// never change: a reply that cannot be read, or that leaves a cue out,
+// keeps the draft for those cues.
+func reviewTranslations(
+	ctx context.Context,
+	llm ChatCompleter,
+	model, sourceLang, targetLang string,
+	source, translated []Segment,
+	batchSize, minTranslateChars int,
+	policy RetryPolicy,
+	progress *Progress,
+) ([]Segment, int, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultReviewBatch
+	}
+	out := make([]Segment, len(translated))
+	copy(out, translated)
+
+	var items []reviewItem
+	for i := range translated {
+		text := strings.TrimSpace(source[i].Text)
+		if text == "" || isLowInfoText(text, minTranslateChars) {
+			continue
+		}
+		items = append(items, reviewItem{ID: i + 1, Source: text, Draft: strings.TrimSpace(translated[i].Text)})
+	}
+
+	changed := 0
+	for start := 0; start < len(items); start += batchSize {
+		batch := items[start:min(start+batchSize, len(items))]
+		progress.Printf("Reviewing cues %d-%d of %d...", start+1, start+len(batch), len(items))
+		results, err := reviewBatch(ctx, llm, model, sourceLang, targetLang, batch, policy, progress)
+		if err != nil {
+			return nil, 0, err
+		}
+		if results == nil {
+			progress.Printf("Review reply for cues %d-%d was unreadable; keeping the drafts.", start+1, start+len(batch))
+			continue
+		}
+		for _, item := range batch {
+			text, ok := results[item.ID]
+			if !ok || text == "" || text == item.Draft {
+				continue
+			}
+			out[item.ID-1].Text = text
+			changed++
+		}
+	}
+	return out, changed, nil
+}
+
+// reviewBatch returns the corrected text by cue id, or nil if the reply was
+// not the JSON asked for.
+func reviewBatch(
+	ctx context.Context,
+	llm ChatCompleter,
+	model, sourceLang, targetLang string,
+	batch []reviewItem,
+	policy RetryPolicy,
+	progress *Progress,
+) (map[int]string, error) {
+	payload, err := json.Marshal(batch)
+	if err != nil {
+		return nil, err
+	}
+	messages := []ChatMessage{
+		{Role: "system", Content: fmt.Sprintf(reviewSystemPrompt, targetLang, sourceLang)},
+		{Role: "user", Content: string(payload)},
+	}
+	var reply string
+	err = retry(
+		ctx,
+		policy,
+		isRetryable,
+		func(attempt int, delay time.Duration, err error) {
+			progress.Printf("Review failed; retrying in %.1fs (attempt %d). %s", delay.Seconds(), attempt, describeError(err))
+			progress.Event("retry", "stage", "review", "attempt", attempt, "delay_seconds", delay.Seconds(), "error", describeError(err))
+		},
+		func() error {
+			var err error
+			reply, err = llm.Complete(ctx, model, messages)
+			return err
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []reviewResult
+	if err := json.Unmarshal([]byte(stripCodeFence(reply)), &results); err != nil {
+		return nil, nil
+	}
+	byID := make(map[int]string, len(results))
+	for _, r := range results {
+		byID[r.ID] = strings.TrimSpace(r.Translation)
+	}
+	return byID, nil
+}
+
+// stripCodeFence removes a ```json ... ``` wrapper models like to add.
+func stripCodeFence(reply string) string {
+	reply = strings.TrimSpace(reply)
+	if !strings.HasPrefix(reply, "```") {
+		return reply
+	}
+	reply = strings.TrimPrefix(reply, "```")
+	if i := strings.IndexByte(reply, '\n'); i >= 0 {
+		reply = reply[i+1:]
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(reply), "```"))
+}
@@ -0,0 +1,85 @@
+package subtitle
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const segmentsFileVersion = 1
+
+// SegmentsFile is the --export-json/--import-json format: one entry per cue
+// with the source text and its translation side by side, for external
+// post-processing or hand edits that are rendered again without any API.
+type SegmentsFile struct {
+	Version    int            `json:"version"`
+	SourceLang string         `json:"source_lang,omitempty"`
+	TargetLang string         `json:"target_lang,omitempty"`
+	Segments   []SegmentEntry `json:"segments"`
+}
+
+// SegmentEntry is one cue of a SegmentsFile.
+type SegmentEntry struct {
+	Start       float64 `json:"start"`
+	End         float64 `json:"end"`
+	Source      string  `json:"source"`
+	Translation string  `json:"translation,omitempty"`
+	Confidence  float64 `json:"confidence,omitempty"`
+}
+
+// ExportSegmentsJSON writes source and translated segments, which must be
+// parallel (translated may be nil when nothing was translated).
+func ExportSegmentsJSON(path, sourceLang, targetLang string, source, translated []Segment) error {
+	file := SegmentsFile{Version: segmentsFileVersion, SourceLang: sourceLang, TargetLang: targetLang}
+	for i, seg := range source {
+		entry := SegmentEntry{
+			Start:      seg.Start,
+			End:        seg.End,
+			Source:     strings.TrimSpace(seg.Text),
+			Confidence: seg.Confidence,
+		}
+		if translated != nil {
+			entry.Translation = strings.TrimSpace(translated[i].Text)
+		}
+		file.Segments = append(file.Segments, entry)
+	}
+	if translated == nil {
+		file.TargetLang = ""
+	}
+	b, err := json.MarshalIndent(&file, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// ImportSegmentsJSON reads a segments file, returning the source segments
+// and the segments to render (the translation where there is one).
+func ImportSegmentsJSON(path string) (SegmentsFile, []Segment, []Segment, error) {
+	var file SegmentsFile
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return file, nil, nil, err
+	}
+	if err := json.Unmarshal(b, &file); err != nil {
+		return file, nil, nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if file.Version > segmentsFileVersion {
+		return file, nil, nil, fmt.Errorf("%s: unsupported version %d", path, file.Version)
+	}
+	if len(file.Segments) == 0 {
+		return file, nil, nil, fmt.Errorf("%s: no segments", path)
+	}
+	source := make([]Segment, 0, len(file.Segments))
+	rendered := make([]Segment, 0, len(file.Segments))
+	for _, entry := range file.Segments {
+		seg := Segment{Start: entry.Start, End: entry.End, Text: entry.Source, Confidence: entry.Confidence}
+		source = append(source, seg)
+		if entry.Translation != "" {
+			seg.Text = entry.Translation
+		}
+		rendered = append(rendered, seg)
+	}
+	return file, source, rendered, nil
+}
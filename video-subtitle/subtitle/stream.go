@@ -0,0 +1,142 @@
+package subtitle
+
+import (
+	"cmp"
+	"context"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// streamTranslation translates the chunks of a transcript as they are
+// transcribed, while later chunks are still with the transcriber, and
+// keeps each line's translation for Pipeline.Translate to pick up. Lines
+// that cleanup or the chunk merge change are translated again there.
+type streamTranslation struct {
+	limiter *rateLimiter
+
+	mu     sync.Mutex
+	queue  [][]Segment
+	closed bool
+	// lines maps the trimmed text of a transcribed line to its translation.
+	lines map[string]string
+	wake  chan struct{}
+	done  chan struct{}
+}
+
+// streaming reports whether the transcript is translated chunk by chunk
+// during transcription. Script alignment and merging replace the lines
+// afterwards, so there is nothing to gain with them.
+func (p *Pipeline) streaming() bool {
+	return p.Stream && p.Translating() && len(p.Script) == 0 && p.MergeUnder <= 0
+}
+
+// startStream starts translating the chunks passed to add, until finish.
+func (p *Pipeline) startStream(ctx context.Context) *streamTranslation {
+	s := &streamTranslation{
+		limiter: newRateLimiter(p.RequestsPerMinute, p.TokensPerMinute),
+		lines:   map[string]string{},
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	workers := p.TranslateWorkers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	go func() {
+		defer close(s.done)
+		translator := p.Memory.Wrap(p.Translator)
+		for {
+			s.mu.Lock()
+			batch, closed := s.queue, s.closed
+			s.queue = nil
+			s.mu.Unlock()
+			if len(batch) == 0 {
+				if closed {
+					return
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-s.wake:
+				}
+				continue
+			}
+			var segments []Segment
+			for _, chunk := range batch {
+				segments = append(segments, chunk...)
+			}
+			p.Progress.Printf("Translating %d transcribed segments while transcription goes on...", len(segments))
+			translated, err := translateSegments(ctx, translator, segments, p.SourceLang, p.TargetLang, p.TranslateModel, workers, p.MinTranslateChars, p.ContextSegments, s.limiter, p.Retry, nil, nil, p.Progress)
+			if err != nil {
+				// The lines are translated after transcription instead,
+				// where a lasting error is reported.
+				if ctx.Err() == nil {
+					p.Progress.Printf("Streaming translation stopped; the rest is translated after transcription. %s", describeError(err))
+				}
+				return
+			}
+			s.mu.Lock()
+			for i, seg := range segments {
+				if text := strings.TrimSpace(seg.Text); text != "" {
+					s.lines[text] = translated[i].Text
+				}
+			}
+			s.mu.Unlock()
+			p.Progress.Event("stream", "segments", len(segments))
+		}
+	}()
+	return s
+}
+
+// add queues the segments of a finished chunk. It does not block.
+func (s *streamTranslation) add(segments []Segment) {
+	s.mu.Lock()
+	s.queue = append(s.queue, segments)
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// finish waits for the queued chunks to be translated. A nil stream has
+// nothing to wait for.
+func (s *streamTranslation) finish() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	<-s.done
+}
+
+// merge adds the lines of other, a stream of a later part, to s.
+func (s *streamTranslation) merge(other *streamTranslation) *streamTranslation {
+	if s == nil || other == nil {
+		return cmp.Or(s, other)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for text, t := range other.lines {
+		s.lines[text] = t
+	}
+	return s
+}
+
+// translation returns the streamed translation of a line, if any. A nil
+// stream has none.
+func (s *streamTranslation) translation(text string) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.lines[text]
+	return t, ok
+}
@@ -0,0 +1,118 @@
+package subtitle
+
+import (
+	"io"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// STTProvider describes a speech-to-text backend selectable with
+// --stt-provider. Each maps its response onto Segment.
+type STTProvider struct {
+	KeyEnv       string
+	DefaultModel string
+	// MaxUploadMB is the largest audio file sent in one request before
+	// auto-chunking, unless --max-audio-mb says otherwise.
+	MaxUploadMB int
+	New         func(apiKey string, httpClient *http.Client) Transcriber
+}
+
+// STTProviders are the speech-to-text backends by name. "openai" has no
+// New: it is the OpenAIClient itself.
+var STTProviders = map[string]STTProvider{
+	"openai": {
+		KeyEnv:       "OPENAI_API_KEY",
+		DefaultModel: DefaultWhisperModel,
+		MaxUploadMB:  DefaultMaxAudioMB,
+	},
+	"deepgram": {
+		KeyEnv:       "DEEPGRAM_API_KEY",
+		DefaultModel: "nova-2",
+		MaxUploadMB:  500,
+		New: func(apiKey string, httpClient *http.Client) Transcriber {
+			return &deepgramClient{apiKey: apiKey, baseURL: "https://api.deepgram.com/v1", httpClient: httpClient}
+		},
+	},
+	"assemblyai": {
+		KeyEnv:       "ASSEMBLYAI_API_KEY",
+		DefaultModel: "best",
+		MaxUploadMB:  500,
+		New: func(apiKey string, httpClient *http.Client) Transcriber {
+			return &assemblyAIClient{apiKey: apiKey, baseURL: "https://api.assemblyai.com/v2", httpClient: httpClient}
+		},
+	},
+	"google": {
+		KeyEnv:       "GOOGLE_API_KEY",
+		DefaultModel: "latest_long",
+		// Inline audio is limited to 10MB; base64 adds a third.
+		MaxUploadMB: 7,
+		New: func(apiKey string, httpClient *http.Client) Transcriber {
+			return &googleSTTClient{apiKey: apiKey, baseURL: "https://speech.googleapis.com", httpClient: httpClient}
+		},
+	},
+}
+
+// STTProviderNames lists the provider names for messages.
+func STTProviderNames() string {
+	names := make([]string, 0, len(STTProviders))
+	for name := range STTProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// doProviderRequest sends req and returns the body, turning non-2xx
+// responses into *apiError so the shared retry policy applies.
+func doProviderRequest(httpClient *http.Client, provider string, req *http.Request) ([]byte, error) {
+	req.Header.Set("User-Agent", "video-subtitle/0.1")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message := strings.TrimSpace(string(body))
+		if message == "" {
+			message = http.StatusText(resp.StatusCode)
+		}
+		return nil, &apiError{
+			StatusCode: resp.StatusCode,
+			Message:    message,
+			Provider:   provider,
+			RetryAfter: rateLimitDelay(resp.Header),
+		}
+	}
+	return body, nil
+}
+
+func audioContentType(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ogg":
+		return "audio/ogg"
+	case ".mp3":
+		return "audio/mpeg"
+	case ".wav":
+		return "audio/wav"
+	}
+	return "application/octet-stream"
+}
+
+// promptTerms splits --transcribe-prompt into the keyword lists the other
+// providers take instead of a free-text prompt.
+func promptTerms(prompt string) []string {
+	var terms []string
+	for _, term := range strings.FieldsFunc(prompt, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if term = strings.TrimSpace(term); term != "" {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
@@ -0,0 +1,119 @@
+package subtitle
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// sttPollInterval is how long asynchronous providers are given between
+// status checks.
+var sttPollInterval = 3 * time.Second
+
+// assemblyAIClient uploads the audio, queues a transcript, polls it until it
+// completes and then fetches the sentence breakdown, which carries timings.
+type assemblyAIClient struct {
+	apiKey     string
+	baseURL    string
+	httpClient *http.Client
+}
+
+type assemblyAITranscript struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Text   string `json:"text"`
+	Error  string `json:"error"`
+}
+
+type assemblyAISentences struct {
+	Sentences []struct {
+		Text       string  `json:"text"`
+		Start      int64   `json:"start"`
+		End        int64   `json:"end"`
+		Confidence float64 `json:"confidence"`
+	} `json:"sentences"`
+}
+
+func (c *assemblyAIClient) call(ctx context.Context, method, path string, body []byte, contentType string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", c.apiKey)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := doProviderRequest(c.httpClient, "assemblyai", req)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(resp, out)
+}
+
+func (c *assemblyAIClient) Transcribe(ctx context.Context, audioPath, model, language string, hints TranscribeHints) ([]Segment, error) {
+	audio, err := os.ReadFile(audioPath)
+	if err != nil {
+		return nil, err
+	}
+	var upload struct {
+		UploadURL string `json:"upload_url"`
+	}
+	if err := c.call(ctx, http.MethodPost, "/upload", audio, "application/octet-stream", &upload); err != nil {
+		return nil, err
+	}
+
+	request := map[string]any{
+		"audio_url":    upload.UploadURL,
+		"speech_model": model,
+	}
+	if language != "" {
+		request["language_code"] = language
+	}
+	if terms := promptTerms(hints.Prompt); len(terms) > 0 {
+		request["word_boost"] = terms
+	}
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	var transcript assemblyAITranscript
+	if err := c.call(ctx, http.MethodPost, "/transcript", payload, "application/json", &transcript); err != nil {
+		return nil, err
+	}
+
+	for transcript.Status != "completed" {
+		if transcript.Status == "error" {
+			return nil, fmt.Errorf("assemblyai transcription failed: %s", transcript.Error)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(sttPollInterval):
+		}
+		if err := c.call(ctx, http.MethodGet, "/transcript/"+transcript.ID, nil, "", &transcript); err != nil {
+			return nil, err
+		}
+	}
+
+	var sentences assemblyAISentences
+	if err := c.call(ctx, http.MethodGet, "/transcript/"+transcript.ID+"/sentences", nil, "", &sentences); err != nil {
+		return nil, err
+	}
+	segments := make([]Segment, 0, len(sentences.Sentences))
+	for _, s := range sentences.Sentences {
+		segments = append(segments, Segment{
+			Start:      float64(s.Start) / 1000,
+			End:        float64(s.End) / 1000,
+			Text:       s.Text,
+			Confidence: s.Confidence,
+		})
+	}
+	if len(segments) == 0 && transcript.Text != "" {
+		segments = append(segments, Segment{Text: transcript.Text})
+	}
+	return segments, nil
+}
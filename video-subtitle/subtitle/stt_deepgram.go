@@ -0,0 +1,88 @@
+package subtitle
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// deepgramClient sends the audio file as the request body to the
+// pre-recorded /listen endpoint and maps its utterances onto segments.
+type deepgramClient struct {
+	apiKey     string
+	baseURL    string
+	httpClient *http.Client
+}
+
+type deepgramResponse struct {
+	Results struct {
+		Channels []struct {
+			Alternatives []struct {
+				Transcript string  `json:"transcript"`
+				Confidence float64 `json:"confidence"`
+			} `json:"alternatives"`
+		} `json:"channels"`
+		Utterances []struct {
+			Start      float64 `json:"start"`
+			End        float64 `json:"end"`
+			Transcript string  `json:"transcript"`
+			Confidence float64 `json:"confidence"`
+		} `json:"utterances"`
+	} `json:"results"`
+}
+
+func (c *deepgramClient) Transcribe(ctx context.Context, audioPath, model, language string, hints TranscribeHints) ([]Segment, error) {
+	file, err := os.Open(audioPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	query := url.Values{}
+	query.Set("model", model)
+	query.Set("utterances", "true")
+	query.Set("smart_format", "true")
+	query.Set("punctuate", "true")
+	if language != "" {
+		query.Set("language", language)
+	}
+	for _, term := range promptTerms(hints.Prompt) {
+		query.Add("keywords", term)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/listen?"+query.Encode(), file)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Token "+c.apiKey)
+	req.Header.Set("Content-Type", audioContentType(audioPath))
+
+	body, err := doProviderRequest(c.httpClient, "deepgram", req)
+	if err != nil {
+		return nil, err
+	}
+	var resp deepgramResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+
+	segments := make([]Segment, 0, len(resp.Results.Utterances))
+	for _, u := range resp.Results.Utterances {
+		segments = append(segments, Segment{
+			Start:      u.Start,
+			End:        u.End,
+			Text:       u.Transcript,
+			Confidence: u.Confidence,
+		})
+	}
+	if len(segments) == 0 {
+		for _, ch := range resp.Results.Channels {
+			if len(ch.Alternatives) > 0 && strings.TrimSpace(ch.Alternatives[0].Transcript) != "" {
+				segments = append(segments, Segment{Text: ch.Alternatives[0].Transcript})
+			}
+		}
+	}
+	return segments, nil
+}
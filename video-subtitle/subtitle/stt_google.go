@@ -0,0 +1,169 @@
+package subtitle
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// googleSTTClient sends the audio inline to Cloud Speech-to-Text's
+// long-running recognize and polls the operation. Each result becomes a
+// segment, timed by its first and last word.
+type googleSTTClient struct {
+	apiKey     string
+	baseURL    string
+	httpClient *http.Client
+}
+
+type googleOperation struct {
+	Name  string `json:"name"`
+	Done  bool   `json:"done"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+	Response struct {
+		Results []struct {
+			Alternatives []struct {
+				Transcript string  `json:"transcript"`
+				Confidence float64 `json:"confidence"`
+				Words      []struct {
+					StartTime string `json:"startTime"`
+					EndTime   string `json:"endTime"`
+				} `json:"words"`
+			} `json:"alternatives"`
+			ResultEndTime string `json:"resultEndTime"`
+		} `json:"results"`
+	} `json:"response"`
+}
+
+// Speech-to-Text wants a BCP-47 tag with a region; fill one in for the
+// bare language codes this tool is usually given.
+var googleLanguageRegions = map[string]string{
+	"de": "de-DE",
+	"en": "en-US",
+	"es": "es-ES",
+	"fr": "fr-FR",
+	"it": "it-IT",
+	"ja": "ja-JP",
+	"ko": "ko-KR",
+	"pt": "pt-BR",
+	"ru": "ru-RU",
+	"zh": "cmn-Hans-CN",
+}
+
+func googleLanguageCode(lang string) string {
+	if code, ok := googleLanguageRegions[strings.ToLower(lang)]; ok {
+		return code
+	}
+	return lang
+}
+
+func googleEncoding(audioPath string) string {
+	switch strings.ToLower(filepath.Ext(audioPath)) {
+	case ".ogg":
+		return "OGG_OPUS"
+	case ".mp3":
+		return "MP3"
+	case ".wav":
+		return "LINEAR16"
+	}
+	return "ENCODING_UNSPECIFIED"
+}
+
+// parseGoogleDuration reads durations such as "1.200s".
+func parseGoogleDuration(value string) float64 {
+	seconds, _ := strconv.ParseFloat(strings.TrimSuffix(value, "s"), 64)
+	return seconds
+}
+
+func (c *googleSTTClient) call(ctx context.Context, method, path string, body []byte, out any) error {
+	endpoint := c.baseURL + path + "?key=" + url.QueryEscape(c.apiKey)
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := doProviderRequest(c.httpClient, "google", req)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(resp, out)
+}
+
+func (c *googleSTTClient) Transcribe(ctx context.Context, audioPath, model, language string, hints TranscribeHints) ([]Segment, error) {
+	audio, err := os.ReadFile(audioPath)
+	if err != nil {
+		return nil, err
+	}
+	config := map[string]any{
+		"encoding":                   googleEncoding(audioPath),
+		"sampleRateHertz":            16000,
+		"model":                      model,
+		"enableAutomaticPunctuation": true,
+		"enableWordTimeOffsets":      true,
+	}
+	if language != "" {
+		config["languageCode"] = googleLanguageCode(language)
+	}
+	if terms := promptTerms(hints.Prompt); len(terms) > 0 {
+		config["speechContexts"] = []map[string]any{{"phrases": terms}}
+	}
+	payload, err := json.Marshal(map[string]any{
+		"config": config,
+		"audio":  map[string]string{"content": base64.StdEncoding.EncodeToString(audio)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var op googleOperation
+	if err := c.call(ctx, http.MethodPost, "/v1p1beta1/speech:longrunningrecognize", payload, &op); err != nil {
+		return nil, err
+	}
+	for !op.Done {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(sttPollInterval):
+		}
+		if err := c.call(ctx, http.MethodGet, "/v1p1beta1/operations/"+op.Name, nil, &op); err != nil {
+			return nil, err
+		}
+	}
+	if op.Error != nil {
+		return nil, fmt.Errorf("google transcription failed: %s", op.Error.Message)
+	}
+
+	var segments []Segment
+	start := 0.0
+	for _, result := range op.Response.Results {
+		end := parseGoogleDuration(result.ResultEndTime)
+		if len(result.Alternatives) == 0 {
+			start = end
+			continue
+		}
+		alt := result.Alternatives[0]
+		seg := Segment{Start: start, End: end, Text: alt.Transcript, Confidence: alt.Confidence}
+		if len(alt.Words) > 0 {
+			seg.Start = parseGoogleDuration(alt.Words[0].StartTime)
+			seg.End = parseGoogleDuration(alt.Words[len(alt.Words)-1].EndTime)
+		}
+		if strings.TrimSpace(seg.Text) != "" {
+			segments = append(segments, seg)
+		}
+		start = end
+	}
+	return segments, nil
+}
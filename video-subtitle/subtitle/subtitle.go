@@ -0,0 +1,83 @@
+// Package subtitle is the video-subtitle pipeline as a library: extract a
+// video's audio with ffmpeg, transcribe it (Whisper or another speech-to-text
+// service, chunked for long recordings), translate the cues with a chat
+// model, and write SRT, WebVTT or ASS. Pipeline ties the steps together;
+// the cmd/video-subtitle command is a thin wrapper around it.
+//
+// ffmpeg and ffprobe must be on PATH for media inputs.
+package subtitle
+
+import (
+	"context"
+	"strings"
+)
+
+const (
+	DefaultWhisperModel      = "whisper-1"
+	DefaultTranslateModel    = "gpt-4o-mini"
+	DefaultSourceLang        = "ja"
+	DefaultTargetLang        = "zh-TW"
+	defaultChunkSeconds      = 600
+	DefaultMaxAudioMB        = 24
+	DefaultTranslateWorkers  = 4
+	DefaultTranscribeWorkers = 4
+	DefaultContextSegments   = 3
+	DefaultTimeoutSeconds    = 900
+)
+
+// Segment is one cue: a time range in seconds and its text.
+type Segment struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+	// Index is the cue number from a subtitle input; 0 means number by position.
+	Index int `json:"index,omitempty"`
+	// Confidence is the transcriber's 0-1 estimate, when it reports one.
+	Confidence float64 `json:"confidence,omitempty"`
+}
+
+// Transcriber turns an audio file into timed segments.
+type Transcriber interface {
+	Transcribe(ctx context.Context, audioPath, model, language string, hints TranscribeHints) ([]Segment, error)
+}
+
+// TranscribeHints carry optional guidance for one transcription request.
+type TranscribeHints struct {
+	// Prompt is vocabulary or context for the recording.
+	Prompt string
+	// Previous is the end of the preceding chunk's transcript, for
+	// continuity across chunk boundaries.
+	Previous string
+	// Temperature is the sampling temperature; 0 keeps the API default.
+	Temperature float64
+}
+
+// whisperPrompt joins the hints into Whisper's prompt field, which only
+// looks at its final 224 tokens, so the previous chunk's text goes last.
+func (h TranscribeHints) whisperPrompt() string {
+	return strings.TrimSpace(h.Prompt + "\n" + h.Previous)
+}
+
+// TranslationPair is a previously translated segment, sent along with the
+// next one so names, pronouns and tone stay consistent across lines.
+type TranslationPair struct {
+	Source string
+	Target string
+}
+
+// Translator translates one line, given the lines before it.
+type Translator interface {
+	Translate(ctx context.Context, model, sourceLang, targetLang, text string, history []TranslationPair) (string, error)
+}
+
+// ChatCompleter runs a free-form chat, for passes that are not a plain
+// segment translation.
+type ChatCompleter interface {
+	Complete(ctx context.Context, model string, messages []ChatMessage) (string, error)
+}
+
+// ChatMessage is one turn of a chat completion request.
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
@@ -0,0 +1,271 @@
+package subtitle
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// IsSubtitleFile reports whether path is an .srt or .vtt file, judging by
+// its extension.
+func IsSubtitleFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".srt", ".vtt":
+		return true
+	}
+	return false
+}
+
+// ReadSubtitleFile parses an SRT or WebVTT file into segments, keeping the
+// original cue numbers where the file has them.
+func ReadSubtitleFile(path string) ([]Segment, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	vtt := strings.EqualFold(filepath.Ext(path), ".vtt")
+
+	var segments []Segment
+	for _, block := range splitCueBlocks(string(data)) {
+		lines := strings.Split(block, "\n")
+		if vtt && isVTTMetadataBlock(lines[0]) {
+			continue
+		}
+		timing := -1
+		for i, line := range lines {
+			if strings.Contains(line, "-->") {
+				timing = i
+				break
+			}
+		}
+		if timing < 0 {
+			continue
+		}
+		start, end, err := parseCueTiming(lines[timing])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		seg := Segment{
+			Start: start,
+			End:   end,
+			Text:  strings.TrimSpace(strings.Join(lines[timing+1:], "\n")),
+		}
+		if timing > 0 {
+			if n, err := strconv.Atoi(strings.TrimSpace(lines[timing-1])); err == nil && n > 0 {
+				seg.Index = n
+			}
+		}
+		segments = append(segments, seg)
+	}
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("%s: no subtitle cues found", path)
+	}
+	return segments, nil
+}
+
+func splitCueBlocks(content string) []string {
+	var blocks []string
+	var current []string
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			if len(current) > 0 {
+				blocks = append(blocks, strings.Join(current, "\n"))
+				current = nil
+			}
+			continue
+		}
+		current = append(current, line)
+	}
+	if len(current) > 0 {
+		blocks = append(blocks, strings.Join(current, "\n"))
+	}
+	return blocks
+}
+
+func isVTTMetadataBlock(first string) bool {
+	for _, prefix := range []string{"WEBVTT", "NOTE", "STYLE", "REGION"} {
+		if first == prefix || strings.HasPrefix(first, prefix+" ") || strings.HasPrefix(first, prefix+"\t") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCueTiming reads "start --> end", ignoring any trailing WebVTT cue
+// settings.
+func parseCueTiming(line string) (float64, float64, error) {
+	left, right, _ := strings.Cut(line, "-->")
+	fields := strings.Fields(right)
+	if len(fields) == 0 {
+		return 0, 0, fmt.Errorf("invalid cue timing %q", line)
+	}
+	start, err := parseCueTimestamp(strings.TrimSpace(left))
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseCueTimestamp(fields[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+// parseCueTimestamp accepts "hh:mm:ss,mmm" (SRT) and "[hh:]mm:ss.mmm" (VTT).
+func parseCueTimestamp(value string) (float64, error) {
+	clock, frac, _ := strings.Cut(strings.Replace(value, ",", ".", 1), ".")
+	parts := strings.Split(clock, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid timestamp %q", value)
+	}
+	var total int64
+	for _, part := range parts {
+		n, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid timestamp %q", value)
+		}
+		total = total*60 + n
+	}
+	millis := total * 1000
+	if frac != "" {
+		for len(frac) < 3 {
+			frac += "0"
+		}
+		n, err := strconv.ParseInt(frac[:3], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp %q", value)
+		}
+		millis += n
+	}
+	return float64(millis) / 1000, nil
+}
+
+// WriteSubtitles renders segments in the format named by the output
+// extension: .vtt, .ass, or SRT for anything else.
+func WriteSubtitles(segments []Segment, outputPath string) error {
+	switch strings.ToLower(filepath.Ext(outputPath)) {
+	case ".vtt":
+		return writeVTT(segments, outputPath)
+	case ".ass":
+		return writeASS(segments, outputPath)
+	}
+	return writeSRT(segments, outputPath)
+}
+
+func formatVTTTimestamp(seconds float64) string {
+	return strings.Replace(formatSRTTimestamp(seconds), ",", ".", 1)
+}
+
+func writeVTT(segments []Segment, outputPath string) error {
+	var buf strings.Builder
+	buf.WriteString("WEBVTT\n\n")
+	for _, seg := range segments {
+		buf.WriteString(formatVTTTimestamp(seg.Start))
+		buf.WriteString(" --> ")
+		buf.WriteString(formatVTTTimestamp(seg.End))
+		buf.WriteString("\n")
+		buf.WriteString(strings.TrimSpace(seg.Text))
+		buf.WriteString("\n\n")
+	}
+	return os.WriteFile(outputPath, []byte(buf.String()), 0644)
+}
+
+// formatASSTimestamp renders h:mm:ss.cc (centiseconds).
+func formatASSTimestamp(seconds float64) string {
+	centis := int64(math.Round(seconds * 100))
+	return fmt.Sprintf("%d:%02d:%02d.%02d", centis/360000, centis/6000%60, centis/100%60, centis%100)
+}
+
+const assHeader = `[Script Info]
+ScriptType: v4.00+
+PlayResX: 1920
+PlayResY: 1080
+WrapStyle: 0
+ScaledBorderAndShadow: yes
+
+[V4+ Styles]
+Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding
+Style: Default,Arial,64,&H00FFFFFF,&H000000FF,&H00000000,&H80000000,0,0,0,0,100,100,0,0,1,3,1,2,60,60,50,1
+
+[Events]
+Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+`
+
+func writeASS(segments []Segment, outputPath string) error {
+	var buf strings.Builder
+	buf.WriteString(assHeader)
+	for _, seg := range segments {
+		text := strings.ReplaceAll(strings.TrimSpace(seg.Text), "\n", `\N`)
+		fmt.Fprintf(&buf, "Dialogue: 0,%s,%s,Default,,0,0,0,,%s\n", formatASSTimestamp(seg.Start), formatASSTimestamp(seg.End), text)
+	}
+	return os.WriteFile(outputPath, []byte(buf.String()), 0644)
+}
+
+func formatSRTTimestamp(seconds float64) string {
+	millis := int64(math.Round(seconds * 1000))
+	hours := millis / 3600000
+	millis %= 3600000
+	minutes := millis / 60000
+	millis %= 60000
+	secs := millis / 1000
+	millis %= 1000
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", hours, minutes, secs, millis)
+}
+
+func writeSRT(segments []Segment, outputPath string) error {
+	var buf strings.Builder
+	for idx, seg := range segments {
+		start := formatSRTTimestamp(seg.Start)
+		end := formatSRTTimestamp(seg.End)
+		number := seg.Index
+		if number <= 0 {
+			number = idx + 1
+		}
+		buf.WriteString(strconv.Itoa(number))
+		buf.WriteString("\n")
+		buf.WriteString(start)
+		buf.WriteString(" --> ")
+		buf.WriteString(end)
+		buf.WriteString("\n")
+		buf.WriteString(strings.TrimSpace(seg.Text))
+		buf.WriteString("\n\n")
+	}
+	return os.WriteFile(outputPath, []byte(buf.String()), 0644)
+}
+
+// TranscriptPath names a source-language file next to the translated output,
+// e.g. video.srt -> video.ja.srt.
+func TranscriptPath(outputPath, sourceLang, ext string) string {
+	base := strings.TrimSuffix(outputPath, filepath.Ext(outputPath))
+	path := base + "." + sourceLang + ext
+	if path == outputPath {
+		path = base + ".source" + ext
+	}
+	return path
+}
+
+// WriteTranscriptText writes the cue text as plain lines, one per cue.
+func WriteTranscriptText(segments []Segment, outputPath string) error {
+	var buf strings.Builder
+	for _, seg := range segments {
+		text := strings.TrimSpace(seg.Text)
+		if text == "" {
+			continue
+		}
+		line := ""
+		for _, part := range strings.Split(text, "\n") {
+			line = joinCueText(line, part)
+		}
+		buf.WriteString(line)
+		buf.WriteString("\n")
+	}
+	return os.WriteFile(outputPath, []byte(buf.String()), 0644)
+}
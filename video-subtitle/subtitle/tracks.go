@@ -0,0 +1,88 @@
+package subtitle
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// AudioTrack is one audio stream of the input, numbered like ffmpeg's
+// "-map 0:a:N" (0 is the first audio stream).
+type AudioTrack struct {
+	Number   int
+	Codec    string
+	Channels int
+	Language string
+	Title    string
+	Default  bool
+}
+
+type ffprobeStreams struct {
+	Streams []struct {
+		CodecName   string            `json:"codec_name"`
+		Channels    int               `json:"channels"`
+		Tags        map[string]string `json:"tags"`
+		Disposition map[string]int    `json:"disposition"`
+	} `json:"streams"`
+}
+
+// ListAudioTracks asks ffprobe for the audio streams of path, in the order
+// ExtractOptions.Track counts them.
+func ListAudioTracks(path string) ([]AudioTrack, error) {
+	output, err := runCommandOutput(
+		"ffprobe",
+		"-v",
+		"error",
+		"-select_streams",
+		"a",
+		"-show_entries",
+		"stream=codec_name,channels:stream_tags=language,title:stream_disposition=default",
+		"-of",
+		"json",
+		path,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var probe ffprobeStreams
+	if err := json.Unmarshal([]byte(output), &probe); err != nil {
+		return nil, fmt.Errorf("failed to parse ffprobe streams: %w", err)
+	}
+	tracks := make([]AudioTrack, 0, len(probe.Streams))
+	for i, s := range probe.Streams {
+		tracks = append(tracks, AudioTrack{
+			Number:   i,
+			Codec:    s.CodecName,
+			Channels: s.Channels,
+			Language: s.Tags["language"],
+			Title:    s.Tags["title"],
+			Default:  s.Disposition["default"] == 1,
+		})
+	}
+	return tracks, nil
+}
+
+// PrintAudioTracks writes one line per track for --list-tracks.
+func PrintAudioTracks(w io.Writer, tracks []AudioTrack) {
+	if len(tracks) == 0 {
+		fmt.Fprintln(w, "No audio tracks.")
+		return
+	}
+	for _, t := range tracks {
+		fields := []string{fmt.Sprintf("%d:", t.Number), t.Codec}
+		if t.Channels > 0 {
+			fields = append(fields, fmt.Sprintf("%dch", t.Channels))
+		}
+		if t.Language != "" {
+			fields = append(fields, t.Language)
+		}
+		if t.Title != "" {
+			fields = append(fields, fmt.Sprintf("%q", t.Title))
+		}
+		if t.Default {
+			fields = append(fields, "(default)")
+		}
+		fmt.Fprintln(w, strings.Join(fields, " "))
+	}
+}
@@ -0,0 +1,409 @@
+package subtitle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"bag-of-tricks/pkg/workspace"
+)
+
+type transcribeOptions struct {
+	// Backend names the transcriber in messages; empty means Whisper.
+	Backend      string
+	Model        string
+	Language     string
+	ChunkSeconds int
+	ChunkOverlap float64
+	MaxAudioMB   int
+	Workers      int
+	Accurate     bool
+	Format       AudioFormat
+	Prompt       string
+	Temperature  float64
+	ChainChunks  bool
+	Retry        RetryPolicy
+	// Chapters of the input, if any; chunks are then cut at chapter starts.
+	Chapters []Chapter
+	// OnChunk, if set, gets the segments of each chunk (times relative to
+	// the chunk) as soon as it and the chunks before it are done.
+	OnChunk func(segments []Segment)
+}
+
+// transcribeAudio decides between a single request and chunking (by flag or
+// by size), and falls back to chunking when a single request is rejected.
+func transcribeAudio(
+	ctx context.Context,
+	transcriber Transcriber,
+	ws *workspace.Workspace,
+	cp *Checkpoint,
+	audioPath string,
+	opts transcribeOptions,
+	progress *Progress,
+) ([]Segment, error) {
+	audioSizeBytes, err := audioSize(audioPath)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read extracted audio: %v", err)
+	}
+	if audioSizeBytes < 1024 {
+		return nil, errors.New("Extracted audio is empty or too small.")
+	}
+
+	maxAudioBytes := int64(opts.MaxAudioMB) * 1024 * 1024
+	useChunking := opts.ChunkSeconds > 0 || audioSizeBytes > maxAudioBytes
+	chunkSecondsValue := opts.ChunkSeconds
+
+	if useChunking {
+		if _, err := exec.LookPath("ffprobe"); err != nil {
+			return nil, errors.New("ffprobe is required for chunked transcription.")
+		}
+	}
+	if opts.ChunkSeconds <= 0 && audioSizeBytes > maxAudioBytes {
+		chunkSecondsValue, err = chooseChunkSeconds(audioPath, defaultChunkSeconds, maxAudioBytes)
+		if err != nil {
+			progress.Printf("Failed to calculate chunk size; using default %ds.", defaultChunkSeconds)
+			chunkSecondsValue = defaultChunkSeconds
+		}
+		progress.Printf("Audio is large (%.1f MB); auto-chunking with %ds segments.", float64(audioSizeBytes)/(1024*1024), chunkSecondsValue)
+	} else if opts.ChunkSeconds > 0 {
+		progress.Printf("Chunking audio into %ds segments.", chunkSecondsValue)
+	}
+	if useChunking && opts.ChunkOverlap*2 >= float64(chunkSecondsValue) {
+		return nil, fmt.Errorf("--chunk-overlap must be less than half the chunk size (%ds)", chunkSecondsValue)
+	}
+
+	if !timestampedModel(opts.Model) && !useChunking {
+		progress.Printf("%s returns no timestamps, so cue times are estimated from sentence lengths; --chunk-seconds 60 keeps them close.", opts.Model)
+	}
+	backend := opts.Backend
+	if backend == "" {
+		backend = "Whisper"
+	}
+	progress.Printf("Transcribing with %s...", backend)
+	segments, err := func() ([]Segment, error) {
+		if useChunking {
+			return transcribeInChunks(ctx, transcriber, ws, cp, audioPath, chunkSecondsValue, opts, progress)
+		}
+		return transcribeWithRetry(ctx, transcriber, audioPath, opts.Model, opts.Language, TranscribeHints{Prompt: opts.Prompt, Temperature: opts.Temperature}, opts.Retry, progress)
+	}()
+	if err != nil {
+		if !useChunking && shouldFallbackToChunking(err) {
+			if _, errProbe := exec.LookPath("ffprobe"); errProbe != nil {
+				return nil, errors.New("ffprobe is required for chunked transcription.")
+			}
+			progress.Printf("%s request failed; retrying in chunks. Chunk size: %ds.", backend, defaultChunkSeconds)
+			segments, err = transcribeInChunks(ctx, transcriber, ws, cp, audioPath, defaultChunkSeconds, opts, progress)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Transcription failed: %v", err)
+	}
+	return segments, nil
+}
+
+func transcribeWithRetry(
+	ctx context.Context,
+	client Transcriber,
+	audioPath, model, language string,
+	hints TranscribeHints,
+	policy RetryPolicy,
+	progress *Progress,
+) ([]Segment, error) {
+	var segments []Segment
+	var err error
+	retryErr := retry(
+		ctx,
+		policy,
+		isRetryable,
+		func(attempt int, delay time.Duration, err error) {
+			progress.Printf("Transcription failed; retrying in %.1fs (attempt %d). %s", delay.Seconds(), attempt, describeError(err))
+			progress.Event("retry", "stage", "transcribe", "attempt", attempt, "delay_seconds", delay.Seconds(), "error", describeError(err))
+		},
+		func() error {
+			segments, err = client.Transcribe(ctx, audioPath, model, language, hints)
+			return err
+		},
+	)
+	if retryErr != nil {
+		return nil, retryErr
+	}
+	return segments, nil
+}
+
+type audioChunk struct {
+	Index    int
+	Start    float64
+	Duration float64
+	// Segments are kept only if their midpoint falls in [KeepFrom, KeepTo),
+	// which splits each overlap between the two chunks that share it.
+	KeepFrom float64
+	KeepTo   float64
+}
+
+// planChunks cuts the audio every chunkSeconds.
+func planChunks(duration float64, chunkSeconds int, overlap float64) []audioChunk {
+	var cuts []float64
+	for current := 0.0; current < duration-0.01; current += float64(chunkSeconds) {
+		cuts = append(cuts, current)
+	}
+	return chunksAt(cuts, duration, overlap)
+}
+
+// chunksAt makes a chunk starting at each cut; with overlap > 0 each chunk
+// also runs overlap seconds into the next, so speech at a cut is heard whole
+// by at least one of them.
+func chunksAt(cuts []float64, duration, overlap float64) []audioChunk {
+	var chunks []audioChunk
+	for i, current := range cuts {
+		end := duration
+		if i+1 < len(cuts) {
+			end = cuts[i+1]
+		}
+		chunks = append(chunks, audioChunk{
+			Index:    len(chunks),
+			Start:    current,
+			Duration: math.Min(end-current+overlap, duration-current),
+			KeepFrom: current + overlap/2,
+			KeepTo:   end + overlap/2,
+		})
+	}
+	if len(chunks) > 0 {
+		chunks[0].KeepFrom = math.Inf(-1)
+		chunks[len(chunks)-1].KeepTo = math.Inf(1)
+	}
+	return chunks
+}
+
+// mergeChunkSegments offsets each chunk's segments to absolute time, keeps
+// those owned by the chunk, and drops cues repeated across a boundary.
+func mergeChunkSegments(chunks []audioChunk, results [][]Segment) []Segment {
+	segments := []Segment{}
+	for i, chunk := range chunks {
+		for _, seg := range results[i] {
+			seg.Start += chunk.Start
+			seg.End += chunk.Start
+			mid := (seg.Start + seg.End) / 2
+			if mid < chunk.KeepFrom || mid >= chunk.KeepTo {
+				continue
+			}
+			if n := len(segments); n > 0 && seg.Start < segments[n-1].End {
+				prev := &segments[n-1]
+				if sameCueText(prev.Text, seg.Text) {
+					prev.End = math.Max(prev.End, seg.End)
+					continue
+				}
+				if seg.End > prev.End {
+					seg.Start = prev.End
+				}
+			}
+			segments = append(segments, seg)
+		}
+	}
+	return segments
+}
+
+// normalizeCueText keeps only lower-cased letters and digits, for comparing
+// cues that differ in punctuation or spacing.
+func normalizeCueText(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, s)
+}
+
+func sameCueText(a, b string) bool {
+	na, nb := normalizeCueText(a), normalizeCueText(b)
+	if na == "" || nb == "" {
+		return false
+	}
+	return strings.Contains(na, nb) || strings.Contains(nb, na)
+}
+
+// transcribeInChunks splits the audio and transcribes the chunks with a pool
+// of workers. Results are reassembled in offset order regardless of which
+// chunk finishes first.
+func transcribeInChunks(
+	ctx context.Context,
+	client Transcriber,
+	ws *workspace.Workspace,
+	cp *Checkpoint,
+	audioPath string,
+	chunkSeconds int,
+	opts transcribeOptions,
+	progress *Progress,
+) ([]Segment, error) {
+	duration, err := audioDuration(audioPath)
+	if err != nil {
+		return nil, err
+	}
+	if duration <= 0 {
+		return nil, errors.New("audio duration is zero")
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	chunks := planChunks(duration, chunkSeconds, opts.ChunkOverlap)
+	if len(opts.Chapters) > 1 {
+		chunks = chunksAt(chapterCuts(opts.Chapters, duration, chunkSeconds), duration, opts.ChunkOverlap)
+		progress.Printf("Cutting chunks at chapter boundaries: %d chapters, %d chunks.", len(opts.Chapters), len(chunks))
+	}
+	results := make([][]Segment, len(chunks))
+	// finished[i] is closed once results[i] is set, for --chain-chunks.
+	finished := make([]chan struct{}, len(chunks))
+	for i := range finished {
+		finished[i] = make(chan struct{})
+	}
+	// emit hands the finished chunks to OnChunk in order; next is the first
+	// one it has not had yet.
+	var emitMu sync.Mutex
+	next := 0
+	emit := func() {
+		if opts.OnChunk == nil {
+			return
+		}
+		emitMu.Lock()
+		defer emitMu.Unlock()
+		for next < len(chunks) {
+			select {
+			case <-finished[next]:
+			default:
+				return
+			}
+			opts.OnChunk(results[next])
+			next++
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan audioChunk)
+	var wg sync.WaitGroup
+	errCh := make(chan error, 1)
+	fail := func(err error) {
+		select {
+		case errCh <- err:
+		default:
+		}
+		cancel()
+	}
+
+	workerFn := func() {
+		defer wg.Done()
+		for chunk := range jobs {
+			if ctx.Err() != nil {
+				return
+			}
+			key := fmt.Sprintf("%.3f+%.3f", chunk.Start, chunk.Duration)
+			if chunkSegments, ok := cp.chunk(key); ok {
+				progress.Printf("Chunk %d/%d at %.1fs restored from checkpoint.", chunk.Index+1, len(chunks), chunk.Start)
+				progress.Event("chunk_restored", "index", chunk.Index+1, "count", len(chunks), "start", chunk.Start, "segments", len(chunkSegments))
+				results[chunk.Index] = chunkSegments
+				close(finished[chunk.Index])
+				emit()
+				continue
+			}
+			chunkPath := ws.Path(fmt.Sprintf("chunk_%04d%s", chunk.Index, opts.Format.Ext))
+			progress.Printf("Transcribing chunk %d/%d at %.1fs...", chunk.Index+1, len(chunks), chunk.Start)
+			progress.Event("chunk_start", "index", chunk.Index+1, "count", len(chunks), "start", chunk.Start)
+			if err := extractAudioSegment(audioPath, chunkPath, chunk.Start, chunk.Duration, opts.Accurate, opts.Format); err != nil {
+				fail(err)
+				return
+			}
+			if err := ws.CheckQuota(); err != nil {
+				fail(err)
+				return
+			}
+			hints := TranscribeHints{Prompt: opts.Prompt, Temperature: opts.Temperature}
+			if opts.ChainChunks && chunk.Index > 0 {
+				// Chunks are handed out in order, so the previous one is
+				// already being worked on.
+				select {
+				case <-ctx.Done():
+					return
+				case <-finished[chunk.Index-1]:
+				}
+				hints.Previous = transcriptTail(results[chunk.Index-1], chainPromptRunes)
+			}
+			chunkSegments, err := transcribeWithRetry(ctx, client, chunkPath, opts.Model, opts.Language, hints, opts.Retry, progress)
+			if err != nil {
+				fail(err)
+				return
+			}
+			progress.Event("chunk_end", "index", chunk.Index+1, "count", len(chunks), "segments", len(chunkSegments))
+			cp.setChunk(key, chunkSegments)
+			results[chunk.Index] = chunkSegments
+			close(finished[chunk.Index])
+			emit()
+		}
+	}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go workerFn()
+	}
+
+sendLoop:
+	for _, chunk := range chunks {
+		select {
+		case <-ctx.Done():
+			break sendLoop
+		case jobs <- chunk:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	select {
+	case err := <-errCh:
+		return nil, err
+	default:
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return mergeChunkSegments(chunks, results), nil
+}
+
+// chainPromptRunes is how much of the previous chunk --chain-chunks sends;
+// Whisper only reads the last 224 tokens of a prompt anyway.
+const chainPromptRunes = 200
+
+// transcriptTail returns about the last maxRunes characters of the
+// segments' text, starting at a segment boundary where possible.
+func transcriptTail(segments []Segment, maxRunes int) string {
+	var parts []string
+	total := 0
+	for i := len(segments) - 1; i >= 0; i-- {
+		text := strings.TrimSpace(segments[i].Text)
+		if text == "" {
+			continue
+		}
+		n := utf8.RuneCountInString(text)
+		if total+n > maxRunes {
+			if len(parts) == 0 {
+				runes := []rune(text)
+				parts = append(parts, string(runes[len(runes)-maxRunes:]))
+			}
+			break
+		}
+		parts = append(parts, text)
+		total += n + 1
+	}
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,212 @@
+package subtitle
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+func informativeRuneCount(text string) int {
+	count := 0
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			count++
+		}
+	}
+	return count
+}
+
+func isLowInfoText(text string, minChars int) bool {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return true
+	}
+	if minChars <= 0 {
+		return false
+	}
+	return informativeRuneCount(trimmed) < minChars
+}
+
+func countTranslatableSegments(segments []Segment, minChars int) int {
+	total := 0
+	for _, seg := range segments {
+		if !isLowInfoText(seg.Text, minChars) {
+			total++
+		}
+	}
+	return total
+}
+
+// translateSegments translates segments with a pool of workers. Lines the
+// checkpoint or stream already has are not sent again. On error, including
+// cancellation, it still returns every segment, with the text of those not
+// finished marked as untranslated.
+func translateSegments(
+	ctx context.Context,
+	client Translator,
+	segments []Segment,
+	sourceLang, targetLang, model string,
+	workers int,
+	minTranslateChars int,
+	contextSegments int,
+	limiter *rateLimiter,
+	policy RetryPolicy,
+	cp *Checkpoint,
+	stream *streamTranslation,
+	progress *Progress,
+) ([]Segment, error) {
+	if workers <= 0 {
+		workers = 1
+	}
+	translated := make([]Segment, len(segments))
+	copy(translated, segments)
+	// finished marks the segments whose final text is known, so a failed run
+	// can still hand back what it got through.
+	finished := make([]bool, len(segments))
+
+	// Without context every segment is independent. With context, each
+	// worker takes a contiguous run and translates it in order, so the
+	// previous lines' translations are available; only run boundaries start
+	// without history.
+	runSize := 1
+	if contextSegments > 0 {
+		runSize = (len(segments) + workers - 1) / workers
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	errCh := make(chan error, 1)
+
+	translateRun := func(start int) bool {
+		var history []TranslationPair
+		for idx := start; idx < start+runSize && idx < len(translated); idx++ {
+			if ctx.Err() != nil {
+				return false
+			}
+			text := strings.TrimSpace(translated[idx].Text)
+			if text == "" {
+				finished[idx] = true
+				continue
+			}
+			if isLowInfoText(text, minTranslateChars) {
+				finished[idx] = true
+				continue
+			}
+			if done, ok := cp.translation(idx, text); ok {
+				translated[idx].Text = done
+				finished[idx] = true
+				history = appendHistory(history, TranslationPair{Source: text, Target: done}, contextSegments)
+				continue
+			}
+			if done, ok := stream.translation(text); ok {
+				translated[idx].Text = done
+				finished[idx] = true
+				cp.setTranslation(idx, text, done)
+				history = appendHistory(history, TranslationPair{Source: text, Target: done}, contextSegments)
+				continue
+			}
+			var output string
+			err := retry(
+				ctx,
+				policy,
+				isRetryable,
+				func(attempt int, delay time.Duration, err error) {
+					progress.Printf("Translation failed; retrying in %.1fs (attempt %d). %s", delay.Seconds(), attempt, describeError(err))
+					progress.Event("retry", "stage", "translate", "segment", idx+1, "attempt", attempt, "delay_seconds", delay.Seconds(), "error", describeError(err))
+				},
+				func() error {
+					if err := limiter.Wait(ctx, translationTokens(text, history)); err != nil {
+						return err
+					}
+					var err error
+					output, err = client.Translate(ctx, model, sourceLang, targetLang, text, history)
+					limiter.Pause(retryAfter(err))
+					return err
+				},
+			)
+			if err != nil {
+				select {
+				case errCh <- err:
+				default:
+				}
+				cancel()
+				return false
+			}
+			translated[idx].Text = output
+			finished[idx] = true
+			cp.setTranslation(idx, text, output)
+			history = appendHistory(history, TranslationPair{Source: text, Target: output}, contextSegments)
+		}
+		return true
+	}
+
+	workerFn := func() {
+		defer wg.Done()
+		for start := range jobs {
+			if !translateRun(start) {
+				return
+			}
+		}
+	}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go workerFn()
+	}
+
+sendLoop:
+	for i := 0; i < len(segments); i += runSize {
+		select {
+		case <-ctx.Done():
+			break sendLoop
+		case jobs <- i:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	select {
+	case err := <-errCh:
+		return markUnfinished(translated, finished), err
+	default:
+	}
+	if ctx.Err() != nil {
+		return markUnfinished(translated, finished), ctx.Err()
+	}
+	return translated, nil
+}
+
+// untranslatedMarker starts the cues a failed or interrupted translation
+// did not get to, followed by their source text, so that --repair finds
+// them even between languages written in the same script.
+const untranslatedMarker = "[untranslated]"
+
+// markUnfinished returns segments with the source text of those not
+// finished behind untranslatedMarker.
+func markUnfinished(segments []Segment, finished []bool) []Segment {
+	out := make([]Segment, len(segments))
+	for i, seg := range segments {
+		if !finished[i] {
+			seg.Text = untranslatedMarker + " " + strings.TrimSpace(seg.Text)
+		}
+		out[i] = seg
+	}
+	return out
+}
+
+// appendHistory keeps the last limit pairs.
+func appendHistory(history []TranslationPair, pair TranslationPair, limit int) []TranslationPair {
+	if limit <= 0 {
+		return nil
+	}
+	history = append(history, pair)
+	if len(history) > limit {
+		history = history[len(history)-limit:]
+	}
+	return history
+}
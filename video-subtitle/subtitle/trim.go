@@ -0,0 +1,109 @@
+package subtitle
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"bag-of-tricks/pkg/workspace"
+)
+
+// ParseClock reads a time given as seconds ("90", "90.5") or as
+// [hh:]mm:ss[.mmm] ("1:30", "01:02:03.5").
+func ParseClock(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	if !strings.Contains(value, ":") {
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil || seconds < 0 {
+			return 0, fmt.Errorf("invalid time %q", value)
+		}
+		return seconds, nil
+	}
+	seconds, err := parseCueTimestamp(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	return seconds, nil
+}
+
+// ParseTimeRange reads "START-END", each side as ParseClock reads it.
+func ParseTimeRange(value string) (TimeRange, error) {
+	left, right, ok := strings.Cut(value, "-")
+	if !ok {
+		return TimeRange{}, fmt.Errorf("invalid range %q (want START-END)", value)
+	}
+	start, err := ParseClock(left)
+	if err != nil {
+		return TimeRange{}, err
+	}
+	end, err := ParseClock(right)
+	if err != nil {
+		return TimeRange{}, err
+	}
+	if end <= start {
+		return TimeRange{}, fmt.Errorf("invalid range %q: it ends before it starts", value)
+	}
+	return TimeRange{Start: start, End: end}, nil
+}
+
+// keptRegions returns [start, end) of the audio (end 0 meaning its end)
+// without the skipped ranges.
+func keptRegions(start, end float64, skip []TimeRange, duration float64) []TimeRange {
+	if end <= 0 || end > duration {
+		end = duration
+	}
+	skip = append([]TimeRange{}, skip...)
+	sort.Slice(skip, func(i, j int) bool { return skip[i].Start < skip[j].Start })
+	var regions []TimeRange
+	cursor := start
+	for _, s := range skip {
+		if s.Start > cursor {
+			regions = append(regions, TimeRange{Start: cursor, End: min(s.Start, end)})
+		}
+		cursor = max(cursor, s.End)
+		if cursor >= end {
+			break
+		}
+	}
+	if cursor < end {
+		regions = append(regions, TimeRange{Start: cursor, End: end})
+	}
+	// Drop what lies past the end, and slivers left between ranges.
+	out := regions[:0]
+	for _, r := range regions {
+		if r.End-r.Start > 0.01 {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// trimAudio writes the parts of audioPath that Start, End and Skip keep,
+// back to back, and returns it with the kept regions, for mapping
+// timestamps back afterwards.
+func trimAudio(ws *workspace.Workspace, audioPath string, start, end float64, skip []TimeRange, format AudioFormat, progress *Progress) (string, []TimeRange, error) {
+	if _, err := exec.LookPath("ffprobe"); err != nil {
+		return "", nil, errors.New("ffprobe is required for --start, --end and --skip.")
+	}
+	duration, err := audioDuration(audioPath)
+	if err != nil {
+		return "", nil, err
+	}
+	regions := keptRegions(start, end, skip, duration)
+	if len(regions) == 0 {
+		return "", nil, errors.New("Nothing left to transcribe after --start, --end and --skip.")
+	}
+	kept := speechSeconds(regions)
+	progress.Printf("Transcribing %.0fs of %.0fs in %d ranges.", kept, duration, len(regions))
+	trimmedPath := ws.Path("trimmed" + format.Ext)
+	if err := condenseAudio(audioPath, trimmedPath, regions, format); err != nil {
+		return "", nil, err
+	}
+	if err := ws.CheckQuota(); err != nil {
+		return "", nil, err
+	}
+	return trimmedPath, regions, nil
+}
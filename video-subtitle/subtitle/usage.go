@@ -0,0 +1,191 @@
+package subtitle
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProviderUsage is what one API was asked to do in a run.
+type ProviderUsage struct {
+	Provider string `json:"provider"`
+	Requests int    `json:"requests"`
+	// AudioSeconds is the audio the provider reported transcribing.
+	AudioSeconds     float64 `json:"audio_seconds"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+}
+
+// Usage adds up the API requests of a run, per provider, for billing. It
+// watches the HTTP traffic through Transport, so it sees every backend that
+// shares the http.Client, and takes the numbers from the usage fields of
+// the responses. Plugins are not counted.
+type Usage struct {
+	mu        sync.Mutex
+	providers map[string]*ProviderUsage
+}
+
+// Transport returns a RoundTripper that counts the requests sent through
+// next (http.DefaultTransport if nil).
+func (u *Usage) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return usageTransport{usage: u, next: next}
+}
+
+// Providers returns the usage of each provider that was sent a request,
+// by name.
+func (u *Usage) Providers() []ProviderUsage {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	out := make([]ProviderUsage, 0, len(u.providers))
+	for _, p := range u.providers {
+		out = append(out, *p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Provider < out[j].Provider })
+	return out
+}
+
+// Table formats the usage as a plain-text table with a total row.
+func (u *Usage) Table() string {
+	var b strings.Builder
+	var total ProviderUsage
+	row := func(p ProviderUsage) {
+		fmt.Fprintf(&b, "%-12s %8d %12.1f %14d %18d\n", p.Provider, p.Requests, p.AudioSeconds/60, p.PromptTokens, p.CompletionTokens)
+	}
+	fmt.Fprintf(&b, "%-12s %8s %12s %14s %18s\n", "PROVIDER", "REQUESTS", "AUDIO (MIN)", "PROMPT TOKENS", "COMPLETION TOKENS")
+	for _, p := range u.Providers() {
+		row(p)
+		total.Requests += p.Requests
+		total.AudioSeconds += p.AudioSeconds
+		total.PromptTokens += p.PromptTokens
+		total.CompletionTokens += p.CompletionTokens
+	}
+	total.Provider = "total"
+	row(total)
+	return b.String()
+}
+
+// WriteReport writes the usage to path as JSON, with the inputs it was for.
+func (u *Usage) WriteReport(path string, inputs []string) error {
+	report := struct {
+		Inputs    []string        `json:"inputs"`
+		Providers []ProviderUsage `json:"providers"`
+	}{Inputs: inputs, Providers: u.Providers()}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+func (u *Usage) add(provider string, fn func(p *ProviderUsage)) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.providers == nil {
+		u.providers = map[string]*ProviderUsage{}
+	}
+	p := u.providers[provider]
+	if p == nil {
+		p = &ProviderUsage{Provider: provider}
+		u.providers[provider] = p
+	}
+	fn(p)
+}
+
+type usageTransport struct {
+	usage *Usage
+	next  http.RoundTripper
+}
+
+// usageResponse holds the usage fields of the APIs we call: chat
+// completions report tokens, and each speech-to-text API reports the audio
+// length its own way.
+type usageResponse struct {
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		// The gpt-4o transcribe models.
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+	// OpenAI verbose_json transcriptions.
+	Duration float64 `json:"duration"`
+	// Deepgram.
+	Metadata *struct {
+		Duration float64 `json:"duration"`
+	} `json:"metadata"`
+	// AssemblyAI, once the transcript is completed.
+	Status        string  `json:"status"`
+	AudioDuration float64 `json:"audio_duration"`
+	// Google, once the operation is done.
+	Response *struct {
+		TotalBilledTime string `json:"totalBilledTime"`
+	} `json:"response"`
+}
+
+func (t usageTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	provider := usageProvider(req)
+	t.usage.add(provider, func(p *ProviderUsage) { p.Requests++ })
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode < 200 || resp.StatusCode >= 300 || !strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	var r usageResponse
+	if json.Unmarshal(body, &r) != nil {
+		return resp, nil
+	}
+	t.usage.add(provider, func(p *ProviderUsage) {
+		if r.Usage != nil {
+			p.PromptTokens += r.Usage.PromptTokens + r.Usage.InputTokens
+			p.CompletionTokens += r.Usage.CompletionTokens + r.Usage.OutputTokens
+		}
+		switch {
+		case r.Duration > 0:
+			p.AudioSeconds += r.Duration
+		case r.Metadata != nil:
+			p.AudioSeconds += r.Metadata.Duration
+		case r.Status == "completed":
+			p.AudioSeconds += r.AudioDuration
+		case r.Response != nil:
+			if d, err := time.ParseDuration(r.Response.TotalBilledTime); err == nil {
+				p.AudioSeconds += d.Seconds()
+			}
+		}
+	})
+	return resp, nil
+}
+
+// usageProvider names the API a request goes to by its host; any other
+// host (OPENAI_BASE_URL) is named as is.
+func usageProvider(req *http.Request) string {
+	host := req.URL.Hostname()
+	switch {
+	case host == "api.openai.com":
+		return "openai"
+	case strings.HasSuffix(host, ".openai.azure.com"):
+		return "azure"
+	case host == "api.deepgram.com":
+		return "deepgram"
+	case host == "api.assemblyai.com":
+		return "assemblyai"
+	case host == "speech.googleapis.com":
+		return "google"
+	}
+	return host
+}
@@ -0,0 +1,207 @@
+package subtitle
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"bag-of-tricks/pkg/workspace"
+)
+
+// speechPadding is silence kept on each side of speech so words are not
+// clipped at the edges of a region.
+const speechPadding = 0.3
+
+// TimeRange is a span of the input, in seconds.
+type TimeRange struct {
+	Start float64
+	End   float64
+}
+
+// detectSilences runs ffmpeg's silencedetect filter over the audio.
+func detectSilences(path string, noiseDB, minSilence float64) ([]TimeRange, error) {
+	cmd := exec.Command(
+		"ffmpeg",
+		"-hide_banner",
+		"-nostats",
+		"-i",
+		path,
+		"-af",
+		fmt.Sprintf("silencedetect=noise=%gdB:d=%g", noiseDB, minSilence),
+		"-f",
+		"null",
+		"-",
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return nil, fmt.Errorf("ffmpeg silencedetect failed: %s", message)
+	}
+	return parseSilences(stderr.String()), nil
+}
+
+func parseSilences(output string) []TimeRange {
+	var silences []TimeRange
+	open := -1.0
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if v, ok := silenceValue(line, "silence_start:"); ok {
+			open = v
+		} else if v, ok := silenceValue(line, "silence_end:"); ok && open >= 0 {
+			silences = append(silences, TimeRange{Start: open, End: v})
+			open = -1
+		}
+	}
+	if open >= 0 {
+		// Silence running to the end of the file has no silence_end line.
+		silences = append(silences, TimeRange{Start: open, End: -1})
+	}
+	return silences
+}
+
+func silenceValue(line, key string) (float64, bool) {
+	_, rest, ok := strings.Cut(line, key)
+	if !ok {
+		return 0, false
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, false
+	}
+	if v < 0 {
+		v = 0
+	}
+	return v, true
+}
+
+// speechRegions returns the complement of silences within [0, duration],
+// with each silence shrunk by speechPadding on both sides.
+func speechRegions(silences []TimeRange, duration float64) []TimeRange {
+	var regions []TimeRange
+	cursor := 0.0
+	for _, s := range silences {
+		end := s.End
+		if end < 0 || end > duration {
+			end = duration
+		}
+		start := s.Start + speechPadding
+		if s.Start <= 0 {
+			start = 0
+		}
+		stop := end - speechPadding
+		if end >= duration {
+			stop = duration
+		}
+		if stop <= start {
+			continue
+		}
+		if start > cursor {
+			regions = append(regions, TimeRange{Start: cursor, End: start})
+		}
+		cursor = stop
+	}
+	if cursor < duration {
+		regions = append(regions, TimeRange{Start: cursor, End: duration})
+	}
+	return regions
+}
+
+func speechSeconds(regions []TimeRange) float64 {
+	total := 0.0
+	for _, r := range regions {
+		total += r.End - r.Start
+	}
+	return total
+}
+
+// removeSilence writes a copy of audioPath with long pauses cut out and
+// returns it with the kept regions, for mapping timestamps back afterwards.
+func removeSilence(
+	ws *workspace.Workspace,
+	audioPath string,
+	noiseDB, minSilence float64,
+	format AudioFormat,
+	progress *Progress,
+) (string, []TimeRange, error) {
+	if _, err := exec.LookPath("ffprobe"); err != nil {
+		return "", nil, errors.New("ffprobe is required for --skip-silence.")
+	}
+	progress.Printf("Detecting silence...")
+	duration, err := audioDuration(audioPath)
+	if err != nil {
+		return "", nil, err
+	}
+	silences, err := detectSilences(audioPath, noiseDB, minSilence)
+	if err != nil {
+		return "", nil, err
+	}
+	regions := speechRegions(silences, duration)
+	if len(regions) == 0 {
+		return "", nil, errors.New("No speech detected; try a lower --silence-db.")
+	}
+	speech := speechSeconds(regions)
+	progress.Printf("Sending %.0fs of speech in %d regions (skipping %.0f%% silence).", speech, len(regions), 100*(1-speech/duration))
+	speechPath := ws.Path("speech" + format.Ext)
+	if err := condenseAudio(audioPath, speechPath, regions, format); err != nil {
+		return "", nil, err
+	}
+	if err := ws.CheckQuota(); err != nil {
+		return "", nil, err
+	}
+	return speechPath, regions, nil
+}
+
+// condenseAudio writes only the speech regions of inputPath, back to back.
+func condenseAudio(inputPath, outputPath string, regions []TimeRange, format AudioFormat) error {
+	if len(regions) == 0 {
+		return errors.New("no speech detected")
+	}
+	terms := make([]string, 0, len(regions))
+	for _, r := range regions {
+		terms = append(terms, fmt.Sprintf("between(t,%.3f,%.3f)", r.Start, r.End))
+	}
+	filter := fmt.Sprintf("aselect='%s',asetpts=N/SR/TB", strings.Join(terms, "+"))
+	args := []string{"-y", "-i", inputPath, "-af", filter, "-ac", "1", "-ar", "16000"}
+	args = append(args, format.Args...)
+	return runCommand("ffmpeg", append(args, outputPath)...)
+}
+
+// toOriginalTime maps a timestamp in the condensed audio back to the source.
+// A time exactly at a join belongs to the earlier region when it ends a cue.
+func toOriginalTime(regions []TimeRange, t float64, isEnd bool) float64 {
+	offset := 0.0
+	for i, r := range regions {
+		length := r.End - r.Start
+		if t < offset+length || (isEnd && t <= offset+length) || i == len(regions)-1 {
+			return r.Start + t - offset
+		}
+		offset += length
+	}
+	return t
+}
+
+func remapSegments(regions []TimeRange, segments []Segment) []Segment {
+	out := make([]Segment, len(segments))
+	for i, seg := range segments {
+		seg.Start = toOriginalTime(regions, seg.Start, false)
+		seg.End = toOriginalTime(regions, seg.End, true)
+		if seg.End < seg.Start {
+			seg.End = seg.Start
+		}
+		out[i] = seg
+	}
+	return out
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultAuthPath is where the credentials are read from when -auth is
+// not given.
+const defaultAuthPath = "~/.config/url-downloader/auth.json"
+
+// authProfile holds the credentials sent to some hosts.
+type authProfile struct {
+	// Hosts are the host names the profile applies to, with * wildcards
+	// as in *.example.com.
+	Hosts []string `json:"hosts"`
+	// User and Password are sent with basic auth.
+	User     string `json:"user,omitempty"`
+	Password string `json:"password,omitempty"`
+	// Bearer is sent as an "Authorization: Bearer" token.
+	Bearer string `json:"bearer,omitempty"`
+	// Cookies is a cookies.txt file (the Netscape format browsers export
+	// and wget and yt-dlp read) of a logged-in session.
+	Cookies string `json:"cookies,omitempty"`
+
+	jar []fileCookie
+}
+
+// authProfiles are searched in order; the first whose hosts match a URL
+// is used for it.
+type authProfiles []*authProfile
+
+// loadAuth reads the profiles of authPath, or of defaultAuthPath when it is
+// "". A missing default file is no profiles.
+func loadAuth(authPath string) (authProfiles, error) {
+	explicit := authPath != ""
+	if !explicit {
+		authPath = defaultAuthPath
+	}
+	p, err := expandPath(authPath)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(p); err == nil && info.Mode().Perm()&0o077 != 0 {
+		fmt.Fprintf(os.Stderr, "warning: %s holds credentials but others can read it (chmod 600 it)\n", p)
+	}
+	var file struct {
+		Profiles authProfiles `json:"profiles"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", p, err)
+	}
+	for _, prof := range file.Profiles {
+		if len(prof.Hosts) == 0 {
+			return nil, fmt.Errorf("%s: a profile has no hosts", p)
+		}
+		for _, pattern := range prof.Hosts {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("%s: bad pattern %q", p, pattern)
+			}
+		}
+		if prof.Cookies == "" {
+			continue
+		}
+		if prof.Cookies, err = expandPath(prof.Cookies); err != nil {
+			return nil, err
+		}
+		if prof.jar, err = readCookies(prof.Cookies); err != nil {
+			return nil, err
+		}
+	}
+	return file.Profiles, nil
+}
+
+// forURL returns the profile of targetURL's host, or nil.
+func (ap authProfiles) forURL(targetURL string) *authProfile {
+	host := hostOf(targetURL)
+	for _, prof := range ap {
+		for _, pattern := range prof.Hosts {
+			if ok, _ := path.Match(strings.ToLower(pattern), host); ok {
+				return prof
+			}
+		}
+	}
+	return nil
+}
+
+// header returns the Authorization and Cookie headers of targetURL, if any.
+func (ap authProfiles) header(targetURL string) http.Header {
+	prof := ap.forURL(targetURL)
+	if prof == nil {
+		return nil
+	}
+	h := http.Header{}
+	switch {
+	case prof.Bearer != "":
+		h.Set("Authorization", "Bearer "+prof.Bearer)
+	case prof.User != "":
+		h.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(prof.User+":"+prof.Password)))
+	}
+	if u, err := url.Parse(targetURL); err == nil {
+		var pairs []string
+		for _, c := range prof.jar {
+			if c.matches(u) {
+				pairs = append(pairs, c.name+"="+c.value)
+			}
+		}
+		if len(pairs) > 0 {
+			h.Set("Cookie", strings.Join(pairs, "; "))
+		}
+	}
+	return h
+}
+
+// headerLines formats h as "Name: value" lines for external tools.
+func headerLines(h http.Header) []string {
+	var lines []string
+	for name, values := range h {
+		for _, v := range values {
+			lines = append(lines, name+": "+v)
+		}
+	}
+	return lines
+}
+
+// fileCookie is one line of a cookies.txt file.
+type fileCookie struct {
+	domain     string
+	subdomains bool
+	path       string
+	secure     bool
+	expires    time.Time
+	name       string
+	value      string
+}
+
+// readCookies reads a Netscape cookies.txt file.
+func readCookies(file string) ([]fileCookie, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var cookies []fileCookie
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		line = strings.TrimPrefix(line, "#HttpOnly_")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			continue
+		}
+		c := fileCookie{
+			domain:     strings.ToLower(strings.TrimPrefix(fields[0], ".")),
+			subdomains: strings.EqualFold(fields[1], "TRUE"),
+			path:       fields[2],
+			secure:     strings.EqualFold(fields[3], "TRUE"),
+			name:       fields[5],
+			value:      fields[6],
+		}
+		if secs, err := strconv.ParseInt(fields[4], 10, 64); err == nil && secs > 0 {
+			c.expires = time.Unix(secs, 0)
+		}
+		cookies = append(cookies, c)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", file, err)
+	}
+	return cookies, nil
+}
+
+func (c fileCookie) matches(u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	if host != c.domain && !(c.subdomains && strings.HasSuffix(host, "."+c.domain)) {
+		return false
+	}
+	if c.secure && u.Scheme != "https" {
+		return false
+	}
+	if !c.expires.IsZero() && time.Now().After(c.expires) {
+		return false
+	}
+	p := u.Path
+	if p == "" {
+		p = "/"
+	}
+	return strings.HasPrefix(p, c.path)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// duplicateModes are the values of -duplicates.
+var duplicateModes = []string{"ask", "keep", "delete", "link"}
+
+func validDuplicateMode(mode string) bool {
+	for _, m := range duplicateModes {
+		if mode == m {
+			return true
+		}
+	}
+	return false
+}
+
+// duplicate is a file downloaded from one URL that is byte for byte the
+// same as one already in the download directory from another.
+type duplicate struct {
+	URL, Path string
+	// Original is the file that was there first and OriginalURL where it
+	// came from.
+	Original, OriginalURL string
+}
+
+// filePath returns the path of a recorded file. m.mu must be held.
+func (m *manifest) filePath(e manifestEntry) string {
+	if e.File == "" || filepath.IsAbs(e.File) {
+		return e.File
+	}
+	return filepath.Join(m.dir, e.File)
+}
+
+// duplicates finds the files of results whose checksum matches a file
+// recorded before them, from another URL, that is still on disk.
+func (m *manifest) duplicates(results []downloadResult) []duplicate {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var dups []duplicate
+	for _, res := range results {
+		if !res.OK || res.Path == "" || res.SHA256 == "" {
+			continue
+		}
+		own, ok := m.byURL[res.URL]
+		if !ok {
+			continue
+		}
+		for _, e := range m.entries[:own] {
+			if e.SHA256 != res.SHA256 {
+				continue
+			}
+			orig := m.filePath(e)
+			if orig == "" || sameFile(orig, res.Path) {
+				continue
+			}
+			dups = append(dups, duplicate{URL: res.URL, Path: res.Path, Original: orig, OriginalURL: e.URL})
+			break
+		}
+	}
+	return dups
+}
+
+// sameFile reports whether a and b are one file, or a is gone.
+func sameFile(a, b string) bool {
+	ia, err := os.Stat(a)
+	if err != nil {
+		return true
+	}
+	ib, err := os.Stat(b)
+	return err == nil && os.SameFile(ia, ib)
+}
+
+// repoint records that url's download now lives in path.
+func (m *manifest) repoint(url, path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i, ok := m.byURL[url]
+	if !ok {
+		return nil
+	}
+	m.entries[i].File = path
+	if rel, err := filepath.Rel(m.dir, path); err == nil && filepath.IsLocal(rel) {
+		m.entries[i].File = rel
+	}
+	return m.save()
+}
+
+// handleDuplicates lists the duplicates a batch produced and deletes them,
+// replaces them with hard links to the originals or keeps them, as mode
+// says. "ask" asks on r when stdin is a terminal and keeps them otherwise.
+func handleDuplicates(m *manifest, results []downloadResult, mode string, r *bufio.Reader) {
+	dups := m.duplicates(results)
+	if len(dups) == 0 {
+		return
+	}
+	fmt.Printf("Duplicate %d file(s):\n", len(dups))
+	for _, d := range dups {
+		fmt.Printf("- %s :: %s is the same as %s (%s)\n", d.URL, d.Path, d.Original, d.OriginalURL)
+	}
+	if mode == "ask" {
+		mode = "keep"
+		if isTerminal(os.Stdin) {
+			mode = askDuplicates(r)
+		}
+	}
+	if mode == "keep" {
+		return
+	}
+	handled := 0
+	for _, d := range dups {
+		var err error
+		if mode == "delete" {
+			if err = os.Remove(d.Path); err == nil {
+				os.Remove(d.Path + sidecarSuffix)
+				err = m.repoint(d.URL, d.Original)
+			}
+		} else {
+			err = linkDuplicate(d)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: %v\n", mode, d.Path, err)
+			continue
+		}
+		handled++
+	}
+	if mode == "delete" {
+		fmt.Printf("Deleted %d duplicate(s).\n", handled)
+	} else {
+		fmt.Printf("Hard-linked %d duplicate(s) to the originals.\n", handled)
+	}
+}
+
+func askDuplicates(r *bufio.Reader) string {
+	for {
+		fmt.Print("Keep, delete or hard-link them to the originals? [K/d/l] ")
+		line, err := r.ReadString('\n')
+		answer := strings.ToLower(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(answer, "d"):
+			return "delete"
+		case strings.HasPrefix(answer, "l"):
+			return "link"
+		case answer == "", strings.HasPrefix(answer, "k"), err != nil:
+			return "keep"
+		}
+	}
+}
+
+// linkDuplicate replaces the duplicate with a hard link to the original,
+// through a temporary name so a failed link leaves the file in place.
+func linkDuplicate(d duplicate) error {
+	tmp := d.Path + ".link"
+	os.Remove(tmp)
+	if err := os.Link(d.Original, tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, d.Path)
+}
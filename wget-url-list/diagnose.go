@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// The kinds of failure the report groups failed downloads by.
+const (
+	kindDNS         = "dns"
+	kindTLS         = "tls"
+	kindForbidden   = "forbidden"
+	kindNotFound    = "not-found"
+	kindRateLimited = "rate-limited"
+	kindServer      = "server-error"
+	kindHTTP        = "http"
+	kindTimeout     = "timeout"
+	kindDiskFull    = "disk-full"
+	kindNetwork     = "network"
+	kindMissingTool = "missing-tool"
+)
+
+// hints say what to do about each kind of failure.
+var hints = map[string]string{
+	kindDNS:         "the host name did not resolve; check the URL for typos and your network or DNS",
+	kindTLS:         "the secure connection failed; check the system clock and CA certificates, or a proxy that intercepts HTTPS",
+	kindForbidden:   "the server refused access; the link may need a login (see -auth) or have expired, so copy a fresh one",
+	kindNotFound:    "the file is gone or the link expired; copy a fresh link from the page",
+	kindRateLimited: "the server is throttling you; lower -workers or -per-host, or set -limit-rate",
+	kindServer:      "the server had an error; try again later",
+	kindHTTP:        "the server refused the request; run with -verbose to see its answer",
+	kindTimeout:     "the server stopped answering; run again to resume, or raise -timeout for slow servers",
+	kindDiskFull:    "the disk is full; free space in the download directory and run again to resume",
+	kindNetwork:     "the connection failed or dropped; run again to resume",
+	kindMissingTool: "install the tool, or pick another downloader",
+}
+
+// statusError is an HTTP response that is not the file.
+type statusError struct {
+	Code   int
+	Status string
+}
+
+func (e *statusError) Error() string {
+	return "server replied " + e.Status
+}
+
+func replied(resp *http.Response) error {
+	return &statusError{Code: resp.StatusCode, Status: resp.Status}
+}
+
+// stallError is a transfer that sent nothing for too long.
+type stallError struct {
+	timeout time.Duration
+}
+
+func (e *stallError) Error() string {
+	return fmt.Sprintf("no data for %s", e.timeout)
+}
+
+// errorKind classifies an error of the built-in downloader, falling back
+// to the text of the message for the errors of external tools.
+func errorKind(err error) string {
+	var status *statusError
+	var dns *net.DNSError
+	var netErr net.Error
+	var stall *stallError
+	var record tls.RecordHeaderError
+	var verify *tls.CertificateVerificationError
+	var unknownCA x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	switch {
+	case errors.As(err, &status):
+		return statusKind(status.Code)
+	case errors.As(err, &dns):
+		return kindDNS
+	case errors.As(err, &record), errors.As(err, &verify), errors.As(err, &unknownCA),
+		errors.As(err, &hostname), errors.As(err, &invalid):
+		return kindTLS
+	case errors.Is(err, syscall.ENOSPC), errors.Is(err, syscall.EDQUOT):
+		return kindDiskFull
+	case errors.As(err, &stall), errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return kindTimeout
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, io.ErrUnexpectedEOF):
+		return kindNetwork
+	case errors.Is(err, exec.ErrNotFound):
+		return kindMissingTool
+	}
+	return textKind(err.Error())
+}
+
+func statusKind(code int) string {
+	switch {
+	case code == http.StatusUnauthorized, code == http.StatusForbidden:
+		return kindForbidden
+	case code == http.StatusNotFound, code == http.StatusGone:
+		return kindNotFound
+	case code == http.StatusTooManyRequests:
+		return kindRateLimited
+	case code >= 500:
+		return kindServer
+	}
+	return kindHTTP
+}
+
+// textKinds map what wget, yt-dlp and ffmpeg print to a kind of failure,
+// in the order they are looked for.
+var textKinds = []struct{ text, kind string }{
+	{"not found; install", kindMissingTool},
+	{"no space left on device", kindDiskFull},
+	{"disk quota exceeded", kindDiskFull},
+	{"unable to resolve host", kindDNS},
+	{"name or service not known", kindDNS},
+	{"temporary failure in name resolution", kindDNS},
+	{"nodename nor servname", kindDNS},
+	{"certificate", kindTLS},
+	{"ssl", kindTLS},
+	{"tls", kindTLS},
+	{"too many requests", kindRateLimited},
+	{"unauthorized", kindForbidden},
+	{"forbidden", kindForbidden},
+	{"sign in", kindForbidden},
+	{"login required", kindForbidden},
+	{"not found", kindNotFound},
+	{"gone", kindNotFound},
+	{"video unavailable", kindNotFound},
+	{"server error", kindServer},
+	{"bad gateway", kindServer},
+	{"service unavailable", kindServer},
+	{"timed out", kindTimeout},
+	{"timeout", kindTimeout},
+	{"connection refused", kindNetwork},
+	{"connection reset", kindNetwork},
+}
+
+func textKind(msg string) string {
+	msg = strings.ToLower(msg)
+	for _, t := range textKinds {
+		if strings.Contains(msg, t.text) {
+			return t.kind
+		}
+	}
+	return ""
+}
+
+// wgetExits explain the exit statuses of wget.
+var wgetExits = map[int]string{
+	1: "generic error",
+	2: "bad option",
+	3: "file I/O error",
+	4: "network failure",
+	5: "SSL verification failure",
+	6: "authentication failure",
+	7: "protocol error",
+	8: "the server issued an error response",
+}
+
+// lastError returns the last line of a tool's output that reports an
+// error, or its last line if none does.
+func lastError(output string) string {
+	last := ""
+	lines := strings.FieldsFunc(output, func(r rune) bool { return r == '\n' || r == '\r' })
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+		if last == "" {
+			last = line
+		}
+		lower := strings.ToLower(line)
+		if strings.Contains(lower, "error") || strings.Contains(lower, "failed") || strings.Contains(lower, "unable") {
+			return line
+		}
+	}
+	return last
+}
+
+var wgetTime = regexp.MustCompile(`^\d{4}-\d\d-\d\d \d\d:\d\d:\d\d `)
+
+// wgetFailure sums up a failed wget run: the last error line of its output,
+// the meaning of its exit status and the kind of failure.
+func wgetFailure(err error, output []byte) (string, string) {
+	// wget starts its error lines with the time.
+	msg := wgetTime.ReplaceAllString(lastError(string(output)), "")
+	if msg == "" {
+		msg = err.Error()
+	}
+	kind := textKind(msg)
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		code := exit.ExitCode()
+		if meaning, ok := wgetExits[code]; ok {
+			msg += fmt.Sprintf(" (wget exit status %d: %s)", code, meaning)
+		}
+		if kind == "" {
+			switch code {
+			case 4:
+				kind = kindNetwork
+			case 5:
+				kind = kindTLS
+			case 6:
+				kind = kindForbidden
+			}
+		}
+	}
+	return msg, kind
+}
+
+// printHints lists the hint of every kind of failure in results.
+func printHints(results []downloadResult) {
+	counts := map[string]int{}
+	for _, res := range results {
+		if !res.OK && !res.Interrupted && res.Kind != "" {
+			counts[res.Kind]++
+		}
+	}
+	if len(counts) == 0 {
+		return
+	}
+	kinds := make([]string, 0, len(counts))
+	for kind := range counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	fmt.Println("Hints:")
+	for _, kind := range kinds {
+		fmt.Printf("  %s (%d): %s\n", kind, counts[kind], hints[kind])
+	}
+}
+
+// verboseLog streams what the downloaders do, one line at a time so that
+// parallel downloads do not mix within a line. A nil *verboseLog is quiet.
+type verboseLog struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func (v *verboseLog) printf(format string, args ...any) {
+	if v == nil {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	fmt.Fprintf(v.out, format+"\n", args...)
+}
+
+// tee returns a writer that copies to w and, when v is on, to v with
+// every line prefixed by prefix.
+func (v *verboseLog) tee(w io.Writer, prefix string) io.Writer {
+	if v == nil {
+		return w
+	}
+	return io.MultiWriter(w, &prefixWriter{log: v, prefix: prefix})
+}
+
+type prefixWriter struct {
+	log    *verboseLog
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		// wget and ffmpeg redraw progress lines with \r.
+		i := bytes.IndexAny(p.buf, "\r\n")
+		if i < 0 {
+			return len(b), nil
+		}
+		if line := strings.TrimSpace(string(p.buf[:i])); line != "" {
+			p.log.printf("%s%s", p.prefix, line)
+		}
+		p.buf = p.buf[i+1:]
+	}
+}
+
+// verboseTransport logs every request of the built-in downloader and its
+// answer, redirects included.
+type verboseTransport struct {
+	next http.RoundTripper
+	log  *verboseLog
+}
+
+func (t *verboseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	extra := ""
+	if r := req.Header.Get("Range"); r != "" {
+		extra = " (Range: " + r + ")"
+	}
+	t.log.printf("> %s %s%s", req.Method, req.URL, extra)
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.log.printf("! %s %s: %v", req.Method, req.URL, err)
+		return nil, err
+	}
+	var details []string
+	for _, name := range []string{"Location", "Content-Type", "Content-Length", "Content-Range", "Server"} {
+		if v := resp.Header.Get(name); v != "" {
+			details = append(details, name+": "+v)
+		}
+	}
+	t.log.printf("< %s %s (%s)", resp.Status, req.URL, strings.Join(details, ", "))
+	return resp, nil
+}
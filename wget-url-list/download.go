@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxRedirects matches wget's default --max-redirect.
+const maxRedirects = 20
+
+// partSuffix marks a file that is still being downloaded. It is renamed to
+// its final name once the body has been read to the end. It is kept next
+// to the download rather than in a workspace, which is removed with the
+// run, because a later run resumes from it, as does retrying a failed URL.
+const partSuffix = ".part"
+
+// httpDownloader fetches URLs with net/http, resuming partial files with
+// Range requests the way "wget -c" does.
+type httpDownloader struct {
+	client    *http.Client
+	userAgent string
+	// timeout bounds connecting, waiting for the response headers and
+	// each stall while reading the body; 0 waits forever.
+	timeout time.Duration
+	// progress shows the bytes of every active download (nil for none).
+	progress *progress
+	// totalRate is shared by every download; fileRate is the cap of each
+	// one in bytes per second (0 for none).
+	totalRate *rateLimiter
+	fileRate  float64
+	// connections splits large files into that many parallel Range
+	// requests when above 1.
+	connections int
+	// auth holds the credentials of the hosts that need them.
+	auth authProfiles
+	// claims keeps two URLs ending in the same name apart.
+	claims *fileClaims
+	// verbose logs every request and ffmpeg's output (nil for none).
+	verbose *verboseLog
+}
+
+func newHTTPDownloader(timeout time.Duration, userAgent string, progress *progress) *httpDownloader {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = timeout
+	transport.ResponseHeaderTimeout = timeout
+	return &httpDownloader{
+		client: &http.Client{
+			Transport: transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= maxRedirects {
+					return fmt.Errorf("stopped after %d redirects", maxRedirects)
+				}
+				return nil
+			},
+		},
+		userAgent: userAgent,
+		timeout:   timeout,
+		progress:  progress,
+		claims:    &fileClaims{},
+	}
+}
+
+// setVerbose logs every request, response and redirect to v.
+func (d *httpDownloader) setVerbose(v *verboseLog) {
+	d.verbose = v
+	if v != nil {
+		d.client.Transport = &verboseTransport{next: d.client.Transport, log: v}
+	}
+}
+
+func (d *httpDownloader) fetch(ctx context.Context, targetURL, destDir string) downloadResult {
+	dest, err := d.download(ctx, targetURL, destDir)
+	if err != nil {
+		return downloadResult{URL: targetURL, OK: false, Msg: err.Error(), Kind: errorKind(err)}
+	}
+	return downloadResult{URL: targetURL, OK: true, Msg: "ok", Path: dest}
+}
+
+// download saves targetURL in destDir under the last element of its path
+// and returns the file's path. A file left by an earlier attempt, finished
+// or not, is continued from its end; one that another URL left gets a
+// numbered name instead.
+func (d *httpDownloader) download(ctx context.Context, targetURL, destDir string) (string, error) {
+	dest := d.claims.claim(filepath.Join(destDir, fileNameFor(targetURL)), targetURL)
+	part := dest + partSuffix
+	if _, err := os.Stat(part); errors.Is(err, os.ErrNotExist) {
+		if _, err := os.Stat(dest); err == nil {
+			if err := os.Rename(dest, part); err != nil {
+				return "", err
+			}
+		}
+	}
+	if d.connections > 1 {
+		if handled, err := d.downloadRanged(ctx, targetURL, part); handled {
+			if err != nil {
+				return "", err
+			}
+			return dest, os.Rename(part, dest)
+		}
+	}
+	var offset int64
+	if info, err := os.Stat(part); err == nil {
+		offset = info.Size()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	byteRange := ""
+	if offset > 0 {
+		byteRange = fmt.Sprintf("bytes=%d-", offset)
+	}
+	resp, err := d.get(ctx, targetURL, byteRange)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	size := resp.ContentLength
+	switch {
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// The file was already complete.
+		return dest, os.Rename(part, dest)
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		flags |= os.O_APPEND
+		size = contentRangeSize(resp.Header.Get("Content-Range"))
+	case resp.StatusCode == http.StatusOK:
+		// No range support: start over.
+		flags |= os.O_TRUNC
+		offset = 0
+	default:
+		return "", replied(resp)
+	}
+
+	f, err := os.OpenFile(part, flags, 0o644)
+	if err != nil {
+		return "", err
+	}
+	t := d.progress.track(targetURL, filepath.Base(dest), offset, size)
+	defer t.finish()
+	body := io.Reader(&stallReader{r: resp.Body, timeout: d.timeout, cancel: cancel})
+	if d.totalRate != nil || d.fileRate > 0 {
+		body = &limitedReader{r: body, limiters: []*rateLimiter{d.totalRate, newRateLimiter(d.fileRate)}}
+	}
+	_, err = io.Copy(io.MultiWriter(f, t), body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w (partial file kept for resume)", err)
+	}
+	return dest, os.Rename(part, dest)
+}
+
+// newRequest makes a request to targetURL with the User-Agent and the
+// credentials of its host.
+func (d *httpDownloader) newRequest(ctx context.Context, method, targetURL string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, targetURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", d.userAgent)
+	for name, values := range d.auth.header(targetURL) {
+		req.Header[name] = values
+	}
+	return req, nil
+}
+
+// get sends a GET for targetURL, asking for byteRange (a Range header
+// value) unless it is "".
+func (d *httpDownloader) get(ctx context.Context, targetURL, byteRange string) (*http.Response, error) {
+	req, err := d.newRequest(ctx, http.MethodGet, targetURL)
+	if err != nil {
+		return nil, err
+	}
+	if byteRange != "" {
+		req.Header.Set("Range", byteRange)
+	}
+	return d.client.Do(req)
+}
+
+// contentRangeSize returns the full length from a "bytes 100-199/200"
+// Content-Range header, or 0 if it is unknown.
+func contentRangeSize(header string) int64 {
+	_, total, ok := strings.Cut(header, "/")
+	if !ok {
+		return 0
+	}
+	size, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return size
+}
+
+// stallReader cancels the request when a read takes longer than timeout.
+type stallReader struct {
+	r       io.Reader
+	timeout time.Duration
+	cancel  context.CancelFunc
+	// stalled is set once a read timed out.
+	stalled atomic.Bool
+}
+
+func (s *stallReader) Read(p []byte) (int, error) {
+	if s.timeout <= 0 {
+		return s.r.Read(p)
+	}
+	timer := time.AfterFunc(s.timeout, func() {
+		s.stalled.Store(true)
+		s.cancel()
+	})
+	defer timer.Stop()
+	n, err := s.r.Read(p)
+	if err != nil && s.stalled.Load() {
+		err = &stallError{timeout: s.timeout}
+	}
+	return n, err
+}
+
+// fileClaims hands out the files downloads are written to, so that a URL
+// whose name another URL already took in this session, or in an earlier one
+// as owner says, gets "NAME (1).ext" instead of resuming the other's file.
+type fileClaims struct {
+	// owner returns the URL a file was downloaded from, or "" if unknown.
+	owner func(path string) string
+
+	mu     sync.Mutex
+	byPath map[string]string
+}
+
+// claim returns the file targetURL downloads to in place of dest.
+func (c *fileClaims) claim(dest, targetURL string) string {
+	if c == nil {
+		return dest
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.byPath == nil {
+		c.byPath = map[string]string{}
+	}
+	ext := filepath.Ext(dest)
+	for i := 0; ; i++ {
+		p := dest
+		if i > 0 {
+			p = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(dest, ext), i, ext)
+		}
+		if u, ok := c.byPath[p]; ok {
+			if u == targetURL {
+				return p
+			}
+			continue
+		}
+		if c.owner != nil {
+			if u := c.owner(p); u != "" && u != targetURL {
+				continue
+			}
+		}
+		c.byPath[p] = targetURL
+		return p
+	}
+}
+
+// fileNameFor names a download like wget does: after the last element of
+// the URL's path, or index.html when there is none.
+func fileNameFor(targetURL string) string {
+	name := ""
+	if parsed, err := url.Parse(targetURL); err == nil {
+		name = path.Base(parsed.Path)
+	}
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == "/" {
+		return "index.html"
+	}
+	return name
+}
@@ -0,0 +1,79 @@
+#!/usr/bin/env bash
+# End-to-end checks for url-downloader: runs the real binary against a fake
+# HTTP server (e2e/server) that generates its files and fails on purpose, so
+# nothing is fetched from the network.
+#
+# Each directory under cases/ holds:
+#   args      flags and URLs, one per line; $SERVER stands for the fake
+#             server's base URL, and -dir is set to the case's download dir
+#   rerun     optional args of a second run in the same download dir, after
+#             the first (to resume what it left, say)
+#   files/    optional files copied into the download dir before the run
+#   status    optional exit status expected of the last run (default 0)
+#   expected  golden listing of the download dir afterwards: "SHA256  ./NAME"
+#             for every file not starting with a dot
+set -euo pipefail
+
+here="$(cd "$(dirname "$0")" && pwd)"
+work="$(mktemp -d)"
+server_pid=""
+cleanup() {
+  if [ -n "$server_pid" ]; then kill "$server_pid" 2>/dev/null || true; fi
+  rm -rf "$work"
+}
+trap cleanup EXIT
+
+(cd "$here/.." && go build -o "$work/url-downloader" . && go build -o "$work/server" ./e2e/server)
+
+"$work/server" > "$work/server.url" 2> "$work/server.log" &
+server_pid=$!
+for _ in $(seq 50); do
+  [ -s "$work/server.url" ] && break
+  sleep 0.1
+done
+SERVER="$(head -n 1 "$work/server.url")"
+# Keep a developer's own rules and credentials out of the runs.
+export HOME="$work/home"
+
+# run_tool runs the tool for case dir $1 with the args in file $2.
+run_tool() {
+  args=()
+  while IFS= read -r line || [ -n "$line" ]; do
+    [ -n "$line" ] && args+=("${line//\$SERVER/$SERVER}")
+  done < "$2"
+  "$work/url-downloader" -dir "$work/$1/dl" -progress=false -duplicates keep "${args[@]}" < /dev/null
+}
+
+# listing prints the golden listing of download dir $1.
+listing() {
+  (cd "$1" && find . -type f ! -name '.*' -print0 | sort -z | xargs -0 -r sha256sum)
+}
+
+failed=0
+for dir in "$here"/cases/*/; do
+  name="$(basename "$dir")"
+  mkdir -p "$work/$name/dl"
+  if [ -d "$dir/files" ]; then cp -R "$dir/files/." "$work/$name/dl/"; fi
+  want=0
+  if [ -f "$dir/status" ]; then want="$(cat "$dir/status")"; fi
+
+  got=0
+  {
+    run_tool "$name" "$dir/args" || got=$?
+    if [ -f "$dir/rerun" ]; then
+      echo "--- rerun"
+      got=0
+      run_tool "$name" "$dir/rerun" || got=$?
+    fi
+  } > "$work/$name/log" 2>&1
+  listing "$work/$name/dl" > "$work/$name/listing"
+
+  if [ "$got" = "$want" ] && diff -u "$dir/expected" "$work/$name/listing" > "$work/$name/diff"; then
+    echo "ok    $name"
+  else
+    echo "FAIL  $name (exit status $got, want $want)"
+    cat "$work/$name/log" "$work/$name/diff" 2>/dev/null | sed 's/^/      /'
+    failed=1
+  fi
+done
+exit "$failed"
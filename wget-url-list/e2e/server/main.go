@@ -0,0 +1,155 @@
+// Command server is the fake HTTP server of the url-downloader end-to-end
+// checks. It serves generated files, so cases need no fixtures, and fails
+// in the ways real servers do.
+//
+//	/mp4/NAME?size=N        a valid MP4 of N bytes (default 64 KiB) whose
+//	                        payload depends on the path
+//	/bin/NAME?size=N        N bytes of data depending on the path
+//	/status/CODE/NAME       that status and no file
+//	/drop/NAME?size=N       the MP4 of /mp4/NAME, but the first request is
+//	                        cut off halfway and later ones must ask for
+//	                        the rest with a Range header
+//	/norange/NAME?size=N    the MP4 of /mp4/NAME, ignoring Range headers
+//	/corrupt-once/NAME      a truncated MP4 the first time, then the MP4 of
+//	                        /mp4/NAME
+//	/redirect/PATH          a redirect to /PATH
+//
+// It listens on a free port of 127.0.0.1 and prints its base URL.
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultSize = 64 << 10
+
+// data returns size bytes that depend on seed.
+func data(seed string, size int) []byte {
+	out := make([]byte, 0, size+sha256.Size)
+	block := sha256.Sum256([]byte(seed))
+	for len(out) < size {
+		out = append(out, block[:]...)
+		block = sha256.Sum256(block[:])
+	}
+	return out[:size]
+}
+
+// mp4 returns an MP4 of size bytes: ftyp, moov and an mdat of data.
+func mp4(seed string, size int) []byte {
+	var b bytes.Buffer
+	box := func(kind string, payload []byte) {
+		binary.Write(&b, binary.BigEndian, uint32(8+len(payload)))
+		b.WriteString(kind)
+		b.Write(payload)
+	}
+	box("ftyp", []byte("isom\x00\x00\x02\x00isomiso2mp41"))
+	box("moov", data("moov "+seed, 64))
+	box("mdat", data(seed, max(size-b.Len()-8, 0)))
+	return b.Bytes()
+}
+
+func sizeOf(r *http.Request) int {
+	if n, err := strconv.Atoi(r.URL.Query().Get("size")); err == nil && n > 0 {
+		return n
+	}
+	return defaultSize
+}
+
+// firstTime reports whether path is asked for the first time.
+type firstTime struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func (f *firstTime) check(path string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.seen[path] {
+		return false
+	}
+	f.seen[path] = true
+	return true
+}
+
+func serve(w http.ResponseWriter, r *http.Request, name string, body []byte) {
+	http.ServeContent(w, r, name, time.Unix(0, 0), bytes.NewReader(body))
+}
+
+func main() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mp4/", func(w http.ResponseWriter, r *http.Request) {
+		serve(w, r, r.URL.Path, mp4(r.URL.Path, sizeOf(r)))
+	})
+	mux.HandleFunc("/bin/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		serve(w, r, r.URL.Path, data(r.URL.Path, sizeOf(r)))
+	})
+	mux.HandleFunc("/status/", func(w http.ResponseWriter, r *http.Request) {
+		code, err := strconv.Atoi(strings.Split(strings.TrimPrefix(r.URL.Path, "/status/"), "/")[0])
+		if err != nil {
+			code = http.StatusBadRequest
+		}
+		http.Error(w, http.StatusText(code), code)
+	})
+	dropped := &firstTime{seen: map[string]bool{}}
+	mux.HandleFunc("/drop/", func(w http.ResponseWriter, r *http.Request) {
+		body := mp4("/mp4/"+strings.TrimPrefix(r.URL.Path, "/drop/"), sizeOf(r))
+		if !dropped.check(r.URL.Path) {
+			if r.Header.Get("Range") == "" {
+				http.Error(w, "resume with a Range header", http.StatusTeapot)
+				return
+			}
+			serve(w, r, r.URL.Path, body)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(body[:len(body)/2])
+		w.(http.Flusher).Flush()
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	})
+	mux.HandleFunc("/norange/", func(w http.ResponseWriter, r *http.Request) {
+		body := mp4("/mp4/"+strings.TrimPrefix(r.URL.Path, "/norange/"), sizeOf(r))
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write(body)
+	})
+	corrupted := &firstTime{seen: map[string]bool{}}
+	mux.HandleFunc("/corrupt-once/", func(w http.ResponseWriter, r *http.Request) {
+		body := mp4("/mp4/"+strings.TrimPrefix(r.URL.Path, "/corrupt-once/"), sizeOf(r))
+		if corrupted.check(r.URL.Path) {
+			body = body[:len(body)-100]
+		}
+		serve(w, r, r.URL.Path, body)
+	})
+	mux.HandleFunc("/redirect/", func(w http.ResponseWriter, r *http.Request) {
+		target := strings.TrimPrefix(r.URL.Path, "/redirect")
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, http.StatusFound)
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("http://%s\n", ln.Addr())
+	if err := http.Serve(ln, mux); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
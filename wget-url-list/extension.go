@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// fileType is a kind of file told apart by its first bytes: the extension
+// it gets and every extension it may already have.
+type fileType struct {
+	ext  string
+	exts []string
+}
+
+// isoExtensions hold ISO media files (MP4 and its relatives).
+var isoExtensions = []string{".mp4", ".m4v", ".m4a", ".m4s", ".mov", ".3gp", ".f4v"}
+
+// matroskaExtensions hold Matroska and WebM files.
+var matroskaExtensions = []string{".mkv", ".mka", ".webm"}
+
+// sniffedTypes map the types http.DetectContentType finds to file types.
+var sniffedTypes = map[string]fileType{
+	"image/jpeg":      {".jpg", []string{".jpg", ".jpeg", ".jpe"}},
+	"image/png":       {".png", []string{".png"}},
+	"image/gif":       {".gif", []string{".gif"}},
+	"image/webp":      {".webp", []string{".webp"}},
+	"audio/mpeg":      {".mp3", []string{".mp3"}},
+	"application/ogg": {".ogg", []string{".ogg", ".ogv", ".oga", ".opus"}},
+	"audio/wave":      {".wav", []string{".wav"}},
+	"video/avi":       {".avi", []string{".avi"}},
+	"application/pdf": {".pdf", []string{".pdf"}},
+}
+
+// placeholderExtensions are what a server-side script or a bare URL leaves
+// on a file; they are replaced rather than kept before the real one.
+var placeholderExtensions = []string{".html", ".htm", ".php", ".asp", ".aspx", ".jsp", ".cgi", ".bin", ".dat"}
+
+// sniffType tells the type of a file from its first bytes, or returns
+// false if it is none this program names files after.
+func sniffType(head []byte) (fileType, bool) {
+	if len(head) >= 12 && string(head[4:8]) == "ftyp" {
+		switch string(head[8:12]) {
+		case "qt  ":
+			return fileType{".mov", isoExtensions}, true
+		case "M4A ":
+			return fileType{".m4a", isoExtensions}, true
+		}
+		return fileType{".mp4", isoExtensions}, true
+	}
+	if bytes.HasPrefix(head, []byte("\x1a\x45\xdf\xa3")) {
+		// The EBML header names the document type.
+		if bytes.Contains(head[:min(len(head), 64)], []byte("webm")) {
+			return fileType{".webm", matroskaExtensions}, true
+		}
+		return fileType{".mkv", matroskaExtensions}, true
+	}
+	t, ok := sniffedTypes[mediaType(http.DetectContentType(head))]
+	return t, ok
+}
+
+// extensionFetch renames each file fetch downloads whose extension is
+// missing or belongs to another type than its first bytes show, such as
+// "video?format=mp4" saved as "video", before it is verified and recorded.
+// An extension it does not know is kept in front of the new one.
+func extensionFetch(enabled bool, d *httpDownloader, fetch fetchFunc) fetchFunc {
+	if !enabled {
+		return fetch
+	}
+	return func(ctx context.Context, targetURL, destDir string) downloadResult {
+		res := fetch(ctx, targetURL, destDir)
+		if !res.OK || res.Path == "" {
+			return res
+		}
+		if fixed, err := fixExtension(d, res.Path, targetURL); err != nil {
+			fmt.Fprintf(os.Stderr, "fix extension of %s: %v\n", res.Path, err)
+		} else {
+			res.Path = fixed
+		}
+		return res
+	}
+}
+
+// fixExtension renames path, downloaded from targetURL, after the type of
+// its content and returns its new path. A file is never overwritten unless
+// it came from targetURL too.
+func fixExtension(d *httpDownloader, path, targetURL string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return path, err
+	}
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	f.Close()
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return path, err
+	}
+	t, ok := sniffType(head[:n])
+	ext := strings.ToLower(filepath.Ext(path))
+	if !ok || slices.Contains(t.exts, ext) {
+		return path, nil
+	}
+	base := path
+	if ext != "" && (slices.Contains(placeholderExtensions, ext) || knownExtension(ext)) {
+		base = strings.TrimSuffix(path, filepath.Ext(path))
+	}
+	dest := d.claims.claim(base+t.ext, targetURL)
+	if _, err := os.Stat(dest); err == nil && (d.claims.owner == nil || d.claims.owner(dest) != targetURL) {
+		return path, nil
+	}
+	if err := os.Rename(path, dest); err != nil {
+		return path, err
+	}
+	return dest, nil
+}
+
+// knownExtension reports whether ext belongs to a type sniffType tells.
+func knownExtension(ext string) bool {
+	if slices.Contains(isoExtensions, ext) || slices.Contains(matroskaExtensions, ext) {
+		return true
+	}
+	for _, t := range sniffedTypes {
+		if slices.Contains(t.exts, ext) {
+			return true
+		}
+	}
+	return false
+}
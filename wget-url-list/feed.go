@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type xmlURL struct {
+	URL string `xml:"url,attr"`
+}
+
+type xmlLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Text string `xml:",chardata"`
+}
+
+// xmlItem is an RSS item or an Atom entry. Media are the Media RSS
+// media:content elements feeds such as YouTube's use for their videos.
+type xmlItem struct {
+	Links      []xmlLink `xml:"link"`
+	Enclosures []xmlURL  `xml:"enclosure"`
+	Media      []xmlURL  `xml:"http://search.yahoo.com/mrss/ content"`
+	Groups     []struct {
+		Media []xmlURL `xml:"http://search.yahoo.com/mrss/ content"`
+	} `xml:"http://search.yahoo.com/mrss/ group"`
+}
+
+type xmlFeed struct {
+	Items   []xmlItem `xml:"channel>item"`
+	Entries []xmlItem `xml:"entry"`
+}
+
+type jsonFeed struct {
+	Items []struct {
+		URL         string `json:"url"`
+		Attachments []struct {
+			URL string `json:"url"`
+		} `json:"attachments"`
+	} `json:"items"`
+}
+
+// feedItemURLs returns the media of each item of an RSS, Atom or JSON
+// feed: its enclosures or attachments, else its media:content, else its
+// link when that is a video or a page yt-dlp reads. Relative URLs are
+// resolved against base.
+func feedItemURLs(data []byte, base *url.URL) ([]string, error) {
+	var items [][]string
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var feed jsonFeed
+		if err := json.Unmarshal(trimmed, &feed); err != nil {
+			return nil, fmt.Errorf("parse JSON feed: %w", err)
+		}
+		for _, item := range feed.Items {
+			var urls []string
+			for _, a := range item.Attachments {
+				urls = append(urls, a.URL)
+			}
+			if len(urls) == 0 {
+				urls = itemLink(item.URL)
+			}
+			items = append(items, urls)
+		}
+	} else {
+		var feed xmlFeed
+		if err := xml.Unmarshal(data, &feed); err != nil {
+			return nil, fmt.Errorf("parse feed: %w", err)
+		}
+		for _, item := range append(feed.Items, feed.Entries...) {
+			items = append(items, item.urls())
+		}
+	}
+
+	var urls []string
+	for _, item := range items {
+		for _, raw := range item {
+			ref, err := url.Parse(strings.TrimSpace(raw))
+			if err != nil || raw == "" {
+				continue
+			}
+			if base != nil {
+				ref = base.ResolveReference(ref)
+			}
+			urls = append(urls, ref.String())
+		}
+	}
+	return urls, nil
+}
+
+func (item xmlItem) urls() []string {
+	var urls []string
+	for _, e := range item.Enclosures {
+		urls = append(urls, e.URL)
+	}
+	for _, l := range item.Links {
+		if l.Rel == "enclosure" {
+			urls = append(urls, l.Href)
+		}
+	}
+	if len(urls) > 0 {
+		return urls
+	}
+	media := item.Media
+	for _, g := range item.Groups {
+		media = append(media, g.Media...)
+	}
+	for _, m := range media {
+		urls = append(urls, m.URL)
+	}
+	if len(urls) > 0 {
+		return urls
+	}
+	for _, l := range item.Links {
+		switch {
+		case l.Href != "" && (l.Rel == "" || l.Rel == "alternate"):
+			return itemLink(l.Href)
+		case l.Href == "" && strings.TrimSpace(l.Text) != "":
+			return itemLink(l.Text)
+		}
+	}
+	return nil
+}
+
+// itemLink keeps the link of a feed item if it can be downloaded.
+func itemLink(link string) []string {
+	link = strings.TrimSpace(link)
+	if link != "" && (mediaLink(link) || needsExtractor(link)) {
+		return []string{link}
+	}
+	return nil
+}
+
+// feedURLs fetches the feed at feedURL and returns the media of its items.
+func (d *httpDownloader) feedURLs(ctx context.Context, feedURL string) ([]string, error) {
+	resp, err := d.get(ctx, feedURL, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, replied(resp)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return nil, err
+	}
+	return feedItemURLs(body, resp.Request.URL)
+}
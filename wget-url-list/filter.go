@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+// downloadFilter skips URLs by the size and type their server reports
+// before anything is downloaded.
+type downloadFilter struct {
+	// MinSize and MaxSize bound the Content-Length (0 for no bound).
+	MinSize, MaxSize int64
+	// Types are the allowed media types, such as video/mp4 or video/*.
+	Types []string
+}
+
+func (f downloadFilter) active() bool {
+	return f.MinSize > 0 || f.MaxSize > 0 || len(f.Types) > 0
+}
+
+// parseTypes splits a -content-type list.
+func parseTypes(list string) []string {
+	var types []string
+	for _, t := range strings.Split(list, ",") {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// probeResult is what the server says about a URL before it is
+// downloaded.
+type probeResult struct {
+	// Size is -1 when unknown.
+	Size int64
+	Type string
+	Err  error
+}
+
+// probe asks for the size and type of targetURL with a HEAD request,
+// falling back to a one-byte GET for servers that refuse HEAD.
+func (d *httpDownloader) probe(ctx context.Context, targetURL string) probeResult {
+	if resp, err := d.head(ctx, targetURL); err == nil {
+		return probeResult{Size: resp.ContentLength, Type: mediaType(resp.Header.Get("Content-Type"))}
+	}
+	resp, err := d.get(ctx, targetURL, "bytes=0-0")
+	if err != nil {
+		return probeResult{Size: -1, Err: err}
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		size := contentRangeSize(resp.Header.Get("Content-Range"))
+		if size == 0 {
+			size = -1
+		}
+		return probeResult{Size: size, Type: mediaType(resp.Header.Get("Content-Type"))}
+	case http.StatusOK:
+		return probeResult{Size: resp.ContentLength, Type: mediaType(resp.Header.Get("Content-Type"))}
+	}
+	return probeResult{Size: -1, Err: replied(resp)}
+}
+
+func mediaType(header string) string {
+	t, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(header))
+	}
+	return t
+}
+
+// skipReason says why the filter skips a probed URL, or "" to keep it.
+// What the server does not report passes.
+func (f downloadFilter) skipReason(p probeResult) string {
+	if p.Size >= 0 {
+		if f.MinSize > 0 && p.Size < f.MinSize {
+			return "smaller than " + formatBytes(f.MinSize)
+		}
+		if f.MaxSize > 0 && p.Size > f.MaxSize {
+			return "larger than " + formatBytes(f.MaxSize)
+		}
+	}
+	if len(f.Types) > 0 && p.Type != "" {
+		for _, pattern := range f.Types {
+			if ok, _ := path.Match(pattern, p.Type); ok || pattern == p.Type {
+				return ""
+			}
+		}
+		return "type " + p.Type
+	}
+	return ""
+}
+
+// planDownloads probes urls, prints what will be downloaded and what is
+// skipped and why, and returns the URLs to download. Page links and HLS
+// playlists are not probed; their size is only known once downloaded.
+func planDownloads(ctx context.Context, d *httpDownloader, urls []string, f downloadFilter, workers int) []string {
+	probes := make([]probeResult, len(urls))
+	probed := make([]bool, len(urls))
+	sem := make(chan struct{}, max(workers, 1))
+	var wg sync.WaitGroup
+	for i, u := range urls {
+		if isHLS(u) || needsExtractor(u) {
+			continue
+		}
+		probed[i] = true
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			probes[i] = d.probe(ctx, u)
+		}()
+	}
+	wg.Wait()
+
+	var keep []string
+	fmt.Println("Plan:")
+	for i, u := range urls {
+		size, kind, reason := "?", "", ""
+		if probed[i] {
+			p := probes[i]
+			if p.Size >= 0 {
+				size = formatBytes(p.Size)
+			}
+			kind = p.Type
+			reason = f.skipReason(p)
+			if p.Err != nil {
+				kind = "(" + p.Err.Error() + ")"
+			}
+		}
+		if reason != "" {
+			fmt.Printf("  skip      %10s  %-24s  %s (%s)\n", size, kind, u, reason)
+			continue
+		}
+		fmt.Printf("  download  %10s  %-24s  %s\n", size, kind, u)
+		keep = append(keep, u)
+	}
+	return keep
+}
@@ -1,3 +1,7 @@
 module url-downloader
 
 go 1.25.4
+
+require bag-of-tricks/pkg v0.0.0
+
+replace bag-of-tricks/pkg => ../pkg
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"bag-of-tricks/pkg/workspace"
+)
+
+// maxPlaylistSize bounds how much of a playlist is read.
+const maxPlaylistSize = 4 << 20
+
+// hlsWorkspace names the directories ffmpeg writes HLS downloads to, in
+// the directory of the download. Unlike .part files, ffmpeg's output
+// cannot be resumed, so it is removed when the download ends and swept by
+// the next one when a crash left it.
+const hlsWorkspace = ".url-downloader-hls"
+
+// isHLS reports whether targetURL is an HLS playlist.
+func isHLS(targetURL string) bool {
+	parsed, err := url.Parse(targetURL)
+	return err == nil && strings.EqualFold(path.Ext(parsed.Path), ".m3u8")
+}
+
+// hlsVariant is one rendition listed by a master playlist.
+type hlsVariant struct {
+	URI       string
+	Bandwidth int64
+	// Audio is the GROUP-ID of the separate audio renditions it plays
+	// with, if any.
+	Audio string
+}
+
+// hlsPlaylist is what downloading needs from an HLS playlist.
+type hlsPlaylist struct {
+	// Variants is empty for a media playlist, which lists segments.
+	Variants []hlsVariant
+	// Audio maps an audio GROUP-ID to the URI of the rendition to use.
+	Audio map[string]string
+}
+
+// parsePlaylist reads the variants and audio renditions of a playlist,
+// resolving their URIs against base.
+func parsePlaylist(r io.Reader, base *url.URL) (hlsPlaylist, error) {
+	pl := hlsPlaylist{Audio: map[string]string{}}
+	defaults := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxPlaylistSize)
+	first := true
+	var pending *hlsVariant
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if first {
+			if strings.TrimPrefix(line, "\ufeff") != "#EXTM3U" {
+				return pl, fmt.Errorf("not an HLS playlist")
+			}
+			first = false
+			continue
+		}
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			attrs := playlistAttrs(strings.TrimPrefix(line, "#EXT-X-STREAM-INF:"))
+			bandwidth, _ := strconv.ParseInt(attrs["BANDWIDTH"], 10, 64)
+			pending = &hlsVariant{Bandwidth: bandwidth, Audio: attrs["AUDIO"]}
+		case strings.HasPrefix(line, "#EXT-X-MEDIA:"):
+			attrs := playlistAttrs(strings.TrimPrefix(line, "#EXT-X-MEDIA:"))
+			group, uri := attrs["GROUP-ID"], attrs["URI"]
+			if attrs["TYPE"] != "AUDIO" || uri == "" || defaults[group] {
+				continue
+			}
+			if _, ok := pl.Audio[group]; !ok || attrs["DEFAULT"] == "YES" {
+				pl.Audio[group] = resolveURI(base, uri)
+				defaults[group] = attrs["DEFAULT"] == "YES"
+			}
+		case strings.HasPrefix(line, "#"):
+		case pending != nil:
+			pending.URI = resolveURI(base, line)
+			pl.Variants = append(pl.Variants, *pending)
+			pending = nil
+		}
+	}
+	if first {
+		return pl, fmt.Errorf("empty playlist")
+	}
+	return pl, scanner.Err()
+}
+
+// playlistAttrs splits an attribute list such as
+// BANDWIDTH=1280000,CODECS="avc1.4d401f,mp4a.40.2" into its values, with
+// quotes removed.
+func playlistAttrs(list string) map[string]string {
+	attrs := map[string]string{}
+	for list != "" {
+		name, rest, ok := strings.Cut(list, "=")
+		if !ok {
+			break
+		}
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+			rest = strings.TrimPrefix(rest, ",")
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		attrs[strings.TrimSpace(name)] = value
+		list = rest
+	}
+	return attrs
+}
+
+func resolveURI(base *url.URL, uri string) string {
+	ref, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	return base.ResolveReference(ref).String()
+}
+
+// bestVariant returns the variant with the highest bandwidth.
+func bestVariant(variants []hlsVariant) hlsVariant {
+	best := variants[0]
+	for _, v := range variants[1:] {
+		if v.Bandwidth > best.Bandwidth {
+			best = v
+		}
+	}
+	return best
+}
+
+// hlsFetch downloads HLS playlists into one MP4: it picks the
+// highest-bandwidth variant of a master playlist and has ffmpeg fetch its
+// segments (and those of its audio rendition) and remux them.
+func hlsFetch(d *httpDownloader, ffmpeg string) fetchFunc {
+	return func(ctx context.Context, targetURL, destDir string) downloadResult {
+		name := strings.TrimSuffix(fileNameFor(targetURL), path.Ext(fileNameFor(targetURL))) + ".mp4"
+		dest := d.claims.claim(filepath.Join(destDir, name), targetURL)
+		if err := d.downloadHLS(ctx, ffmpeg, targetURL, dest); err != nil {
+			return downloadResult{URL: targetURL, OK: false, Msg: err.Error(), Kind: errorKind(err)}
+		}
+		return downloadResult{URL: targetURL, OK: true, Msg: "ok", Path: dest}
+	}
+}
+
+func (d *httpDownloader) downloadHLS(ctx context.Context, ffmpeg, targetURL, dest string) error {
+	pl, base, err := d.fetchPlaylist(ctx, targetURL)
+	if err != nil {
+		return err
+	}
+	video, audio := base.String(), ""
+	if len(pl.Variants) > 0 {
+		v := bestVariant(pl.Variants)
+		video, audio = v.URI, pl.Audio[v.Audio]
+	}
+
+	headers := "User-Agent: " + d.userAgent + "\r\n"
+	for _, line := range headerLines(d.auth.header(video)) {
+		headers += line + "\r\n"
+	}
+	level := "error"
+	if d.verbose != nil {
+		level = "info"
+	}
+	args := []string{"-y", "-v", level, "-headers", headers, "-i", video}
+	if audio != "" {
+		args = append(args, "-headers", headers, "-i", audio, "-map", "0:v?", "-map", "1:a")
+	} else {
+		args = append(args, "-map", "0:v?", "-map", "0:a?")
+	}
+	ws, err := workspace.New(hlsWorkspace, workspace.Options{Root: filepath.Dir(dest)})
+	if err != nil {
+		return err
+	}
+	defer ws.Close()
+	part := ws.Path(filepath.Base(dest))
+	args = append(args, "-c", "copy", "-f", "mp4", part)
+	cmd := exec.CommandContext(ctx, ffmpeg, args...)
+	var output bytes.Buffer
+	cmd.Stdout = d.verbose.tee(&output, "["+targetURL+"] ")
+	cmd.Stderr = cmd.Stdout
+	if err := cmd.Run(); err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("%s not found; install ffmpeg to download HLS streams", ffmpeg)
+		}
+		if msg := lastError(output.String()); msg != "" {
+			return fmt.Errorf("ffmpeg: %s", msg)
+		}
+		return fmt.Errorf("ffmpeg: %w", err)
+	}
+	return os.Rename(part, dest)
+}
+
+// fetchPlaylist downloads and parses a playlist, returning it with its URL
+// after redirects.
+func (d *httpDownloader) fetchPlaylist(ctx context.Context, playlistURL string) (hlsPlaylist, *url.URL, error) {
+	resp, err := d.get(ctx, playlistURL, "")
+	if err != nil {
+		return hlsPlaylist{}, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return hlsPlaylist{}, nil, replied(resp)
+	}
+	base := resp.Request.URL
+	pl, err := parsePlaylist(io.LimitReader(resp.Body, maxPlaylistSize), base)
+	return pl, base, err
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// parseBytes reads a size, or a rate in bytes per second, like wget's
+// --limit-rate: a number with an optional k, m or g suffix (powers of
+// 1024). "" and 0 mean no limit.
+func parseBytes(s string) (float64, error) {
+	orig := s
+	s = strings.TrimSpace(strings.ToLower(s))
+	if s == "" {
+		return 0, nil
+	}
+	mult := 1.0
+	switch s[len(s)-1] {
+	case 'k':
+		mult = 1 << 10
+	case 'm':
+		mult = 1 << 20
+	case 'g':
+		mult = 1 << 30
+	}
+	if mult != 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (want e.g. 500k or 2m)", orig)
+	}
+	return n * mult, nil
+}
+
+// rateLimiter spaces out reads so they average rate bytes per second. A
+// nil *rateLimiter does not limit.
+type rateLimiter struct {
+	rate float64
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+func newRateLimiter(rate float64) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{rate: rate}
+}
+
+// wait blocks until n more bytes fit in the rate.
+func (l *rateLimiter) wait(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / l.rate * float64(time.Second)))
+	until := l.next
+	l.mu.Unlock()
+	time.Sleep(time.Until(until))
+}
+
+// limitChunk caps each read of a limited body, so a slow rate is kept
+// smoothly rather than in bursts of a full buffer.
+const limitChunk = 16 * 1024
+
+// limitedReader reads from r at no more than the rate of every limiter.
+type limitedReader struct {
+	r        io.Reader
+	limiters []*rateLimiter
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > limitChunk {
+		p = p[:limitChunk]
+	}
+	n, err := l.r.Read(p)
+	for _, limiter := range l.limiters {
+		limiter.wait(n)
+	}
+	return n, err
+}
+
+// jobQueue hands out URLs in order, skipping those whose host already has
+// perHost downloads running (0 for no cap) until one of them finishes.
+type jobQueue struct {
+	perHost int
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []string
+	active  map[string]int
+	// open keeps next waiting for more URLs when the queue runs dry, until
+	// close.
+	open bool
+}
+
+func newJobQueue(urls []string, perHost int) *jobQueue {
+	q := &jobQueue{perHost: perHost, pending: append([]string{}, urls...), active: map[string]int{}}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// next returns the next URL to download, waiting for a host to free up if
+// need be. It returns false once every URL has been handed out and the
+// queue is not open.
+func (q *jobQueue) next() (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		if len(q.pending) == 0 && !q.open {
+			return "", false
+		}
+		for i, u := range q.pending {
+			host := hostOf(u)
+			if q.perHost > 0 && q.active[host] >= q.perHost {
+				continue
+			}
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			q.active[host]++
+			return u, true
+		}
+		q.cond.Wait()
+	}
+}
+
+// done frees the host slot of a URL from next.
+func (q *jobQueue) done(u string) {
+	q.mu.Lock()
+	q.active[hostOf(u)]--
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+// push adds a URL at the end of the queue.
+func (q *jobQueue) push(u string) {
+	q.mu.Lock()
+	q.pending = append(q.pending, u)
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+// drop takes a URL that has not been handed out yet off the queue.
+func (q *jobQueue) drop(u string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, p := range q.pending {
+		if p == u {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// reorder puts the waiting URLs in the order they have in order; those
+// missing from it keep their place after the others.
+func (q *jobQueue) reorder(order []string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	rank := map[string]int{}
+	for i, u := range order {
+		rank[u] = i
+	}
+	slices.SortStableFunc(q.pending, func(a, b string) int {
+		ra, oka := rank[a]
+		rb, okb := rank[b]
+		switch {
+		case oka && okb:
+			return ra - rb
+		case oka:
+			return -1
+		case okb:
+			return 1
+		}
+		return 0
+	})
+}
+
+// close stops an open queue: next hands out nothing more.
+func (q *jobQueue) close() {
+	q.mu.Lock()
+	q.open = false
+	q.pending = nil
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+func hostOf(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
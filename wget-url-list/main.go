@@ -2,68 +2,529 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"flag"
 	"fmt"
+	"io"
+	"maps"
 	"net/url"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
+
+	"bag-of-tricks/pkg/plugin"
 )
 
 type downloadResult struct {
 	URL string
 	OK  bool
 	Msg string
+	// Kind is the kind of failure, one of the kind constants or "" if
+	// unknown.
+	Kind string
+	// Path is the downloaded file, when the downloader says where it is.
+	Path string
+	// SHA256 is the checksum of Path once it has been verified.
+	SHA256 string
+	// Corrupt marks a file that was downloaded but failed verification.
+	Corrupt bool
+	// Interrupted marks a download stopped before it finished, by Ctrl-C
+	// or a pause.
+	Interrupted bool
+	// Bytes is the size of Path and Elapsed how long the download took.
+	Bytes   int64
+	Elapsed time.Duration
 }
 
+// fetchFunc downloads one URL into destDir.
+type fetchFunc func(ctx context.Context, targetURL, destDir string) downloadResult
+
 var urlToken = regexp.MustCompile(`(https?://\S+|video\.twimg\.com/\S+)`)
 
 func main() {
+	os.Exit(run())
+}
+
+func run() int {
 	destFlag := flag.String("dir", "~/Downloads/mobile/", "download directory")
 	workersFlag := flag.Int("workers", defaultWorkers(), "number of parallel downloads")
+	pluginFlag := flag.String("downloader-plugin", "", "command of an external downloader plugin (JSON-RPC over stdio) used instead of the built-in downloader")
+	useWgetFlag := flag.Bool("use-wget", false, "download with the wget command instead of the built-in downloader")
+	timeoutFlag := flag.Duration("timeout", 60*time.Second, "connect, response and read-stall timeout of the built-in downloader (0 for none)")
+	userAgentFlag := flag.String("user-agent", "url-downloader", "User-Agent header of the built-in downloader")
+	ytdlpFlag := flag.String("yt-dlp", "yt-dlp", "yt-dlp command used for page links (YouTube, X/Twitter posts, Reddit, ...); empty to download them directly")
+	formatFlag := flag.String("format", "bv*+ba/b", "yt-dlp format selection (-f) for page links")
+	ffmpegFlag := flag.String("ffmpeg", "ffmpeg", "ffmpeg command used to download HLS (.m3u8) streams")
+	progressFlag := flag.Bool("progress", true, "show the live progress of every download on a terminal")
+	verboseFlag := flag.Bool("verbose", false, "print the requests and responses of the built-in downloader and the output of wget, yt-dlp and ffmpeg for every URL")
+	limitRateFlag := flag.String("limit-rate", "", "cap on the total download rate of a batch, e.g. 2m or 500k (built-in downloader only)")
+	fileRateFlag := flag.String("limit-rate-per-file", "", "cap on the rate of each download, e.g. 500k")
+	connectionsFlag := flag.Int("connections-per-file", 1, "split files of 8 MiB or more into this many parallel Range requests (built-in downloader)")
+	perHostFlag := flag.Int("per-host", 0, "most downloads from one host at a time (0 for no cap)")
+	organizeFlag := flag.String("organize", "", "put downloads in subdirectories: by-domain, by-date or by-batch")
+	fixExtensionsFlag := flag.Bool("fix-extensions", true, "rename downloads whose extension is missing or does not match their content, e.g. video?format=mp4 saved as video")
+	redownloadFlag := flag.Bool("redownload-corrupt", false, "delete and download again, once, a file that fails its checksum or MP4 check")
+	resumeFlag := flag.Bool("resume", false, "download the unfinished URLs of an earlier session without asking")
+	tuiFlag := flag.Bool("tui", false, "manage the queue on a full-screen view while downloading (interactive use)")
+	minSizeFlag := flag.String("min-size", "", "skip files the server reports as smaller than this, e.g. 100k")
+	maxSizeFlag := flag.String("max-size", "", "skip files the server reports as larger than this, e.g. 2g")
+	contentTypeFlag := flag.String("content-type", "", "comma-separated Content-Types to download, e.g. video/*,audio/mp4; others are skipped")
+	scheduleFlag := flag.String("schedule", "", "only download inside this daily window of local time, e.g. 02:00-07:00, waiting outside it")
+	startAtFlag := flag.String("start-at", "", "wait until this time (15:04, 2006-01-02 15:04 or RFC 3339) before the first download")
+	duplicatesFlag := flag.String("duplicates", "ask", "what to do with a download identical to a file already downloaded from another URL: ask, keep, delete or link (hard link)")
+	authFlag := flag.String("auth", "", "JSON file of credentials (basic auth, bearer token, cookies.txt) per host (default "+defaultAuthPath+" if it exists)")
+	rulesFlag := flag.String("rules", "", "JSON file of URL cleaning rules (default "+defaultRulesPath+" if it exists)")
+	sidecarFlag := flag.Bool("sidecar", false, "write NAME.json next to each download with its source URL and page, time, checksum and response headers")
+	reportFlag := flag.String("report", "", "write a JSON report of every batch (status, bytes, duration and speed per URL) to this file")
+	dryRunFlag := flag.Bool("dry-run", false, "only print what would be downloaded and skipped")
+	forceFlag := flag.Bool("force", false, "download URLs again even if the download history says they were downloaded before")
+	feedFlag := flag.String("feed", "", "RSS, Atom or JSON feed to watch, downloading the media of new items")
+	intervalFlag := flag.Duration("interval", 15*time.Minute, "how often -feed is checked (0 to check once and exit)")
+	inputFlag := flag.String("input", "", "file of URLs to download without prompting (- for stdin)")
+	quietFlag := flag.Bool("quiet", false, "print only errors (batch and -feed runs)")
+	porcelainFlag := flag.Bool("porcelain", false, "print only a tab-separated line per URL: status, URL, file, bytes, error kind and error (batch and -feed runs)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [URL...]\n\nWith URLs, -input or piped stdin the URLs are downloaded as one batch without prompting.\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
+	batch := *inputFlag != "" || flag.NArg() > 0 || !isTerminal(os.Stdin)
+	quiet := *quietFlag || *porcelainFlag
+	if quiet && (*tuiFlag || (*feedFlag == "" && !batch)) {
+		fmt.Fprintln(os.Stderr, "-quiet and -porcelain only apply to batch and -feed runs")
+		return 1
+	}
+	if *tuiFlag && (*scheduleFlag != "" || *startAtFlag != "") {
+		fmt.Fprintln(os.Stderr, "-schedule and -start-at do not apply to -tui")
+		return 1
+	}
+	if *tuiFlag && (*minSizeFlag != "" || *maxSizeFlag != "" || *contentTypeFlag != "" || *dryRunFlag) {
+		fmt.Fprintln(os.Stderr, "-min-size, -max-size, -content-type and -dry-run do not apply to -tui")
+		return 1
+	}
+	if *tuiFlag && (*duplicatesFlag != "ask" || *reportFlag != "") {
+		fmt.Fprintln(os.Stderr, "-duplicates and -report do not apply to -tui")
+		return 1
+	}
+	var porcelain *porcelainLog
+	if *porcelainFlag {
+		porcelain = &porcelainLog{out: os.Stdout}
+	}
+	if quiet {
+		// Messages and the report go to stdout; errors go to stderr.
+		devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "open %s: %v\n", os.DevNull, err)
+			return 1
+		}
+		defer devNull.Close()
+		os.Stdout = devNull
+	}
+
 	destDir, err := expandPath(*destFlag)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "resolve download directory: %v\n", err)
-		os.Exit(1)
+		return 1
 	}
 
 	if err := os.MkdirAll(destDir, 0o755); err != nil {
 		fmt.Fprintf(os.Stderr, "create download directory: %v\n", err)
-		os.Exit(1)
+		return 1
+	}
+
+	if !validOrganizeMode(*organizeFlag) {
+		fmt.Fprintf(os.Stderr, "-organize must be one of %s\n", strings.Join(organizeModes, ", "))
+		return 1
+	}
+	if !validDuplicateMode(*duplicatesFlag) {
+		fmt.Fprintf(os.Stderr, "-duplicates must be one of %s\n", strings.Join(duplicateModes, ", "))
+		return 1
+	}
+	totalRate, err := parseBytes(*limitRateFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-limit-rate: %v\n", err)
+		return 1
+	}
+	fileRate, err := parseBytes(*fileRateFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-limit-rate-per-file: %v\n", err)
+		return 1
+	}
+
+	minSize, err := parseBytes(*minSizeFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-min-size: %v\n", err)
+		return 1
+	}
+	maxSize, err := parseBytes(*maxSizeFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-max-size: %v\n", err)
+		return 1
+	}
+	filter := downloadFilter{MinSize: int64(minSize), MaxSize: int64(maxSize), Types: parseTypes(*contentTypeFlag)}
+
+	window, err := parseWindow(*scheduleFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-schedule: %v\n", err)
+		return 1
+	}
+	startAt, err := parseStartAt(*startAtFlag, time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-start-at: %v\n", err)
+		return 1
+	}
+
+	rules, err := loadRules(*rulesFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read URL rules: %v\n", err)
+		return 1
+	}
+
+	auth, err := loadAuth(*authFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read credentials: %v\n", err)
+		return 1
+	}
+
+	history, err := loadManifest(destDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read download history: %v\n", err)
+		return 1
+	}
+	queue, err := loadQueue(destDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read download queue: %v\n", err)
+		return 1
+	}
+
+	// verbose streams the requests and tool output of every download; its
+	// lines would be drawn over by the live progress block.
+	var verbose *verboseLog
+	if *verboseFlag {
+		verbose = &verboseLog{out: os.Stderr}
+	}
+	var prog *progress
+	if !quiet {
+		prog = newProgress(os.Stderr, *progressFlag && verbose == nil)
+	}
+	downloader := newHTTPDownloader(*timeoutFlag, *userAgentFlag, prog)
+	downloader.setVerbose(verbose)
+	downloader.totalRate = newRateLimiter(totalRate)
+	downloader.fileRate = fileRate
+	downloader.connections = *connectionsFlag
+	downloader.auth = auth
+	downloader.claims.owner = func(path string) string {
+		return history.ownerOf(path)
+	}
+	fetch := fetchFunc(downloader.fetch)
+	if *useWgetFlag {
+		fetch = wgetFetch(*fileRateFlag, auth, verbose)
+	}
+	if *ytdlpFlag != "" {
+		fetch = routeFetch(needsExtractor, ytdlpFetch(*ytdlpFlag, *formatFlag, *fileRateFlag, auth, verbose), fetch)
+	}
+	fetch = routeFetch(isHLS, hlsFetch(downloader, *ffmpegFlag), fetch)
+	if *pluginFlag != "" {
+		p, err := plugin.StartCommand(*pluginFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "start downloader plugin: %v\n", err)
+			return 1
+		}
+		defer p.Close()
+		if !p.Supports(plugin.MethodDownload) {
+			fmt.Fprintf(os.Stderr, "plugin %s does not implement %q\n", p.Name(), plugin.MethodDownload)
+			return 1
+		}
+		fetch = pluginFetch(p)
 	}
 
 	reader := bufio.NewReader(os.Stdin)
+	// workers can be changed between batches with :workers, and destDir
+	// with :dir, which switches history and queue to that directory's.
+	workers := *workersFlag
+	// sources holds the page or feed URLs were found on, for sidecars.
+	var sources *pageSources
+	if *sidecarFlag {
+		sources = &pageSources{}
+	}
+	// checksums holds the SHA-256 given after a URL in the input.
+	checksums := map[string]string{}
+	// downloadBatch also reports whether Ctrl-C stopped the batch before
+	// every URL was done.
+	downloadBatch := func(urls []string) (results []downloadResult, interrupted bool) {
+		if !*forceFlag {
+			var pending, skipped []string
+			for _, u := range urls {
+				if history.has(u) {
+					skipped = append(skipped, u)
+				} else {
+					pending = append(pending, u)
+				}
+			}
+			if len(skipped) > 0 {
+				fmt.Printf("Skipping %d URL(s) downloaded before (use -force to download them again).\n", len(skipped))
+				porcelain.list("skipped", skipped, "downloaded before")
+			}
+			// A run killed between recording a download and dequeuing it
+			// leaves it queued; it is done, so take it off.
+			for _, u := range skipped {
+				if err := queue.remove(u); err != nil {
+					fmt.Fprintf(os.Stderr, "update download queue: %v\n", err)
+					break
+				}
+			}
+			urls = pending
+			if len(urls) == 0 {
+				return nil, false
+			}
+		}
+		if filter.active() || *dryRunFlag {
+			planned := planDownloads(context.Background(), downloader, urls, filter, workers)
+			porcelain.list("skipped", missing(urls, planned), "filtered out")
+			if urls = planned; *dryRunFlag || len(urls) == 0 {
+				porcelain.list("planned", urls, "")
+				return nil, false
+			}
+		}
+		if err := queue.add(urls, checksums); err != nil {
+			fmt.Fprintf(os.Stderr, "update download queue: %v\n", err)
+		}
+		ctx, stop := interruptible(prog)
+		if wait := time.Until(startAt); wait > 0 {
+			fmt.Printf("Waiting until %s to start (%s)...\n", startAt.Format("Mon 2006-01-02 15:04"), formatDuration(wait))
+			if sleepUntil(ctx, startAt) != nil {
+				stop()
+				fmt.Printf("Interrupted; %d download(s) stay queued.\n", len(urls))
+				porcelain.list("interrupted", urls, "")
+				return nil, true
+			}
+		}
+		workerCount := clampWorkers(workers, len(urls))
+		fmt.Printf("Downloading %d file(s) to %s with %d worker(s)...\n", len(urls), destDir, workerCount)
+
+		started := time.Now()
+		prog.begin(len(urls))
+		batchFetch := porcelain.wrap(prog.wrap(queue.wrap(history.wrap(sidecarFetch(downloader, sources, timeFetch(verifyFetch(checksums, *redownloadFlag, extensionFetch(*fixExtensionsFlag, downloader, organizeFetch(*organizeFlag, started, scheduleFetch(window, prog, fetch))))))))))
+		results = downloadAll(ctx, urls, destDir, workerCount, *perHostFlag, batchFetch)
+		stop()
+		prog.end()
+		elapsed := time.Since(started)
+		report(results, elapsed)
+		if *quietFlag {
+			printFailures(results)
+		}
+		interrupted = len(results) < len(urls) || finished(results) < len(results)
+		if interrupted {
+			var begun []string
+			for _, res := range results {
+				begun = append(begun, res.URL)
+			}
+			porcelain.list("interrupted", missing(urls, begun), "not started")
+			fmt.Printf("Interrupted: %d download(s) did not finish and stay queued, with their partial files kept for resume.\n", len(urls)-finished(results))
+		}
+		handleDuplicates(history, results, *duplicatesFlag, reader)
+		if *reportFlag != "" {
+			if err := writeReport(*reportFlag, results, started, elapsed); err != nil {
+				fmt.Fprintf(os.Stderr, "write report: %v\n", err)
+			}
+		}
+		return results, interrupted
+	}
+
+	if *feedFlag != "" {
+		for {
+			ok, failed := true, 0
+			found, err := downloader.feedURLs(context.Background(), *feedFlag)
+			sources.add(found, *feedFlag, rules)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "read feed %s: %v\n", *feedFlag, err)
+				ok = false
+			}
+			var fresh []string
+			for _, u := range gatherURLs(found, rules) {
+				if !history.has(u) {
+					fresh = append(fresh, u)
+				}
+			}
+			if err == nil && len(fresh) == 0 {
+				fmt.Printf("No new items in %s.\n", *feedFlag)
+			}
+			if len(fresh) > 0 {
+				results, interrupted := downloadBatch(fresh)
+				if interrupted {
+					return exitInterrupted
+				}
+				for _, res := range results {
+					if !res.OK {
+						failed++
+					}
+				}
+			}
+			if *intervalFlag <= 0 {
+				if !ok {
+					return exitFailed
+				}
+				return exitStatus(len(fresh)-failed, failed)
+			}
+			next := time.Now().Add(*intervalFlag)
+			fmt.Printf("Checking the feed again at %s.\n\n", next.Format("15:04"))
+			time.Sleep(time.Until(next))
+		}
+	}
+
+	unfinished, unfinishedSums := queue.pending()
+
+	if batch {
+		raw, err := batchInput(*inputFlag, flag.Args())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "read URLs: %v\n", err)
+			return 1
+		}
+		urls := gatherURLs(raw, rules)
+		maps.Copy(checksums, expectedChecksums(raw, rules))
+		if *resumeFlag {
+			maps.Copy(checksums, unfinishedSums)
+			urls = gatherURLs(append(unfinished, urls...), rules)
+		} else if len(unfinished) > 0 {
+			fmt.Fprintf(os.Stderr, "%d unfinished download(s) from an earlier session are queued; pass -resume to download them.\n", len(unfinished))
+		}
+		urls = putFirst(urls, priorityURLs(raw, rules))
+		if len(urls) == 0 {
+			fmt.Fprintln(os.Stderr, "No URLs provided.")
+			return 1
+		}
+		results, interrupted := downloadBatch(urls)
+		if interrupted {
+			return exitInterrupted
+		}
+		// Every URL that was not skipped ran to an end.
+		_, ok := batchTotals(results)
+		failed := len(results) - ok
+		return exitStatus(len(urls)-failed, failed)
+	}
+
+	commands := promptCommands{
+		scrape: func(pageURL string) ([]string, error) {
+			found, err := downloader.scrapePage(context.Background(), pageURL)
+			sources.add(found, pageURL, rules)
+			return found, err
+		},
+		dir: func(dir string) error {
+			if dir == "" {
+				fmt.Printf("Downloads go to %s.\n", destDir)
+				return nil
+			}
+			newDir, err := expandPath(dir)
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(newDir, 0o755); err != nil {
+				return err
+			}
+			newHistory, err := loadManifest(newDir)
+			if err != nil {
+				return fmt.Errorf("read download history: %w", err)
+			}
+			newQueue, err := loadQueue(newDir)
+			if err != nil {
+				return fmt.Errorf("read download queue: %w", err)
+			}
+			destDir, history, queue = newDir, newHistory, newQueue
+			fmt.Printf("Downloads go to %s.\n", destDir)
+			if left, _ := queue.pending(); len(left) > 0 {
+				fmt.Printf("%d unfinished download(s) from an earlier session are queued there; restart with -dir %s to resume them.\n", len(left), destDir)
+			}
+			return nil
+		},
+		workers: func(n int) {
+			if n > 0 {
+				workers = n
+			}
+			fmt.Printf("Downloading with up to %d worker(s).\n", workers)
+		},
+	}
+	if len(unfinished) > 0 {
+		resume := *resumeFlag
+		if !resume {
+			switch askResume(reader, len(unfinished)) {
+			case "y":
+				resume = true
+			case "d":
+				if err := queue.clear(); err != nil {
+					fmt.Fprintf(os.Stderr, "update download queue: %v\n", err)
+				}
+			}
+		}
+		if resume {
+			maps.Copy(checksums, unfinishedSums)
+		} else {
+			unfinished = nil
+		}
+	}
+	if *tuiFlag {
+		err := runTUI(tuiConfig{
+			destDir:  destDir,
+			workers:  *workersFlag,
+			fetch:    queue.wrap(history.wrap(sidecarFetch(downloader, sources, verifyFetch(checksums, *redownloadFlag, extensionFetch(*fixExtensionsFlag, downloader, organizeFetch(*organizeFlag, time.Now(), fetch)))))),
+			progress: prog,
+			history:  history,
+			saved:    queue,
+			force:    *forceFlag,
+			pending:  unfinished,
+			perHost:  *perHostFlag,
+			rules:    rules,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "queue screen: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	if len(unfinished) > 0 {
+		downloadBatch(unfinished)
+		fmt.Print("Batch complete.\n\n")
+	}
 	for {
-		rawURLs, shouldQuit := promptURLs(reader)
-		urls := gatherURLs(rawURLs)
+		rawURLs, shouldQuit := promptURLs(reader, commands)
+		if plain, markup := splitPastedHTML(rawURLs); markup != "" {
+			rawURLs = append(plain, confirmURLs(reader, extractMediaURLs(markup, nil))...)
+		}
+		urls := putFirst(gatherURLs(rawURLs, rules), priorityURLs(rawURLs, rules))
+		maps.Copy(checksums, expectedChecksums(rawURLs, rules))
 
 		if shouldQuit && len(urls) == 0 {
 			fmt.Println("Goodbye.")
-			return
+			return 0
 		}
 		if len(urls) == 0 {
 			fmt.Println("No URLs provided. Paste URLs or type :q to quit.")
 			if shouldQuit {
-				return
+				return 0
 			}
 			continue
 		}
+		if urls = reviewURLs(reader, urls); len(urls) == 0 {
+			if shouldQuit {
+				return 0
+			}
+			fmt.Println()
+			continue
+		}
 
-		workerCount := clampWorkers(*workersFlag, len(urls))
-		fmt.Printf("Downloading %d file(s) to %s with %d worker(s)...\n", len(urls), destDir, workerCount)
-
-		results := downloadAll(urls, destDir, workerCount)
-		report(results)
+		downloadBatch(urls)
 
-		fmt.Println("Batch complete.\n")
+		fmt.Print("Batch complete.\n\n")
 		if shouldQuit {
-			return
+			return 0
 		}
 	}
 }
@@ -97,8 +558,19 @@ func expandPath(path string) (string, error) {
 	return filepath.Clean(path), nil
 }
 
-func promptURLs(r *bufio.Reader) ([]string, bool) {
-	fmt.Println("Paste MP4 URLs (one per line). Blank lines are ignored. Type ':go' to start, ':q' to quit.")
+// promptCommands carry out the prompt commands that reach outside the
+// list being pasted.
+type promptCommands struct {
+	// scrape returns the media URLs of a page.
+	scrape func(pageURL string) ([]string, error)
+	// dir switches the download directory, or shows it given "".
+	dir func(dir string) error
+	// workers sets the number of parallel downloads, or shows it given 0.
+	workers func(n int)
+}
+
+func promptURLs(r *bufio.Reader, commands promptCommands) ([]string, bool) {
+	fmt.Println("Paste MP4 URLs (one per line) or HTML. Blank lines are ignored. Type ':scrape <page URL>' to pick videos from a page, ':dir <path>' or ':workers N' to change where and how many at a time the next batches download, ':go' to review and start, ':q' to quit.")
 
 	var urls []string
 	for {
@@ -119,6 +591,38 @@ func promptURLs(r *bufio.Reader) ([]string, bool) {
 		case ":go", ":start", ":run":
 			return urls, false
 		}
+		if pageURL, ok := strings.CutPrefix(stripped, ":scrape"); ok {
+			pageURL, ok := cleanURL(pageURL)
+			if !ok {
+				fmt.Println("Usage: :scrape <page URL>")
+				continue
+			}
+			found, err := commands.scrape(pageURL)
+			if err != nil {
+				fmt.Printf("Scrape %s: %v\n", pageURL, err)
+				continue
+			}
+			urls = append(urls, confirmURLs(r, found)...)
+			continue
+		}
+		if dir, ok := strings.CutPrefix(stripped, ":dir"); ok && (dir == "" || dir[0] == ' ') {
+			if err := commands.dir(strings.TrimSpace(dir)); err != nil {
+				fmt.Printf("Change download directory: %v\n", err)
+			}
+			continue
+		}
+		if n, ok := strings.CutPrefix(stripped, ":workers"); ok {
+			count := 0
+			if n = strings.TrimSpace(n); n != "" {
+				var err error
+				if count, err = strconv.Atoi(n); err != nil || count < 1 {
+					fmt.Println("Usage: :workers N (N at least 1)")
+					continue
+				}
+			}
+			commands.workers(count)
+			continue
+		}
 		if stripped == "" {
 			continue
 		}
@@ -126,11 +630,72 @@ func promptURLs(r *bufio.Reader) ([]string, bool) {
 	}
 }
 
-func gatherURLs(raw []string) []string {
+// batchInput returns the URL lines to download without prompting: those
+// of inputPath ("-" for stdin) and args, or of stdin when there are
+// neither.
+func batchInput(inputPath string, args []string) ([]string, error) {
+	lines := append([]string{}, args...)
+	switch {
+	case inputPath == "-" || (inputPath == "" && len(args) == 0):
+		more, err := readLines(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, more...)
+	case inputPath != "":
+		f, err := os.Open(inputPath)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		more, err := readLines(f)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, more...)
+	}
+	return lines, nil
+}
+
+// readLines returns the lines of r that are neither blank nor # comments.
+func readLines(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// askResume asks what to do with the unfinished downloads of an earlier
+// session: "y" to download them now, "n" to keep them queued for later or
+// "d" to forget them.
+func askResume(r *bufio.Reader, count int) string {
+	for {
+		fmt.Printf("%d download(s) from an earlier session did not finish. Resume them now? [Y/n/d(iscard)] ", count)
+		line, err := r.ReadString('\n')
+		answer := strings.ToLower(strings.TrimSpace(line))
+		switch {
+		case answer == "" && err == nil, strings.HasPrefix(answer, "y"):
+			return "y"
+		case strings.HasPrefix(answer, "d"):
+			return "d"
+		case strings.HasPrefix(answer, "n"), err != nil:
+			return "n"
+		}
+	}
+}
+
+func gatherURLs(raw []string, rules urlRules) []string {
 	seen := make(map[string]bool)
 	var cleaned []string
 	for _, candidate := range raw {
-		if url, ok := cleanURL(candidate); ok && !seen[url] {
+		if url, ok := rules.clean(candidate); ok && !seen[url] {
 			seen[url] = true
 			cleaned = append(cleaned, url)
 		}
@@ -159,11 +724,6 @@ func cleanURL(raw string) (string, bool) {
 		return "", false
 	}
 
-	query := parsed.Query()
-	if len(query) > 0 {
-		delete(query, "tag")
-		parsed.RawQuery = query.Encode()
-	}
 	parsed.Fragment = ""
 
 	normalized := parsed.String()
@@ -171,18 +731,53 @@ func cleanURL(raw string) (string, bool) {
 	return normalized, true
 }
 
-func downloadAll(urls []string, destDir string, workers int) []downloadResult {
+// interruptible returns a context that the first Ctrl-C cancels, so the
+// downloads in flight stop cleanly; a second one exits at once. stop
+// restores the default handling.
+func interruptible(p *progress) (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-signals:
+		case <-done:
+			return
+		}
+		p.notef("\nStopping; press Ctrl-C again to quit now.")
+		cancel()
+		select {
+		case <-signals:
+			os.Exit(130)
+		case <-done:
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		close(done)
+		cancel()
+	}
+}
+
+// downloadAll fetches urls with up to workers at a time, starting them in
+// their order unless -per-host holds one back. Once ctx is cancelled no
+// more downloads start, and only those started are returned.
+func downloadAll(ctx context.Context, urls []string, destDir string, workers, perHost int, fetch fetchFunc) []downloadResult {
 	if workers <= 1 {
 		results := make([]downloadResult, 0, len(urls))
 		for _, u := range urls {
-			results = append(results, downloadOne(u, destDir))
+			if ctx.Err() != nil {
+				break
+			}
+			results = append(results, fetch(ctx, u, destDir))
 		}
 		return results
 	}
 
-	// Buffer channels so fast workers don't block when the main goroutine
-	// hasn't started reading from results yet.
-	jobs := make(chan string, len(urls))
+	// Buffer the results so fast workers don't block when the main
+	// goroutine hasn't started reading them yet.
+	queue := newJobQueue(urls, perHost)
 	results := make(chan downloadResult, len(urls))
 	var wg sync.WaitGroup
 
@@ -190,8 +785,13 @@ func downloadAll(urls []string, destDir string, workers int) []downloadResult {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for u := range jobs {
-				results <- downloadOne(u, destDir)
+			for {
+				u, ok := queue.next()
+				if !ok || ctx.Err() != nil {
+					return
+				}
+				results <- fetch(ctx, u, destDir)
+				queue.done(u)
 			}
 		}()
 	}
@@ -201,11 +801,6 @@ func downloadAll(urls []string, destDir string, workers int) []downloadResult {
 		close(results)
 	}()
 
-	for _, u := range urls {
-		jobs <- u
-	}
-	close(jobs)
-
 	var collected []downloadResult
 	for res := range results {
 		collected = append(collected, res)
@@ -213,22 +808,54 @@ func downloadAll(urls []string, destDir string, workers int) []downloadResult {
 	return collected
 }
 
-func downloadOne(targetURL, destDir string) downloadResult {
-	cmd := exec.Command("wget", "-c", "-P", destDir, targetURL)
-	output, err := cmd.CombinedOutput()
+// wgetFetch downloads with "wget -c", at no more than rate (a
+// --limit-rate value, "" for no limit), with the credentials auth has for
+// the host, streaming wget's output to verbose.
+func wgetFetch(rate string, auth authProfiles, verbose *verboseLog) fetchFunc {
+	return func(ctx context.Context, targetURL, destDir string) downloadResult {
+		args := []string{"-c", "-P", destDir}
+		if rate != "" {
+			args = append(args, "--limit-rate="+rate)
+		}
+		for _, line := range headerLines(auth.header(targetURL)) {
+			args = append(args, "--header="+line)
+		}
+		return runWget(ctx, append(args, targetURL), targetURL, destDir, verbose)
+	}
+}
+
+func runWget(ctx context.Context, args []string, targetURL, destDir string, verbose *verboseLog) downloadResult {
+	cmd := exec.CommandContext(ctx, "wget", args...)
+	var output bytes.Buffer
+	cmd.Stdout = verbose.tee(&output, "["+targetURL+"] ")
+	cmd.Stderr = cmd.Stdout
+	err := cmd.Run()
 	if err == nil {
-		return downloadResult{URL: targetURL, OK: true, Msg: "ok"}
+		// With -c wget keeps the name of an earlier file instead of adding
+		// a .1 suffix.
+		return downloadResult{URL: targetURL, OK: true, Msg: "ok", Path: filepath.Join(destDir, fileNameFor(targetURL))}
 	}
 
 	if isNotFound(err) {
-		return downloadResult{URL: targetURL, OK: false, Msg: "wget not found; install wget and retry"}
+		return downloadResult{URL: targetURL, OK: false, Msg: "wget not found; install wget and retry", Kind: kindMissingTool}
 	}
 
-	msg := strings.TrimSpace(string(output))
-	if msg == "" {
-		msg = err.Error()
+	msg, kind := wgetFailure(err, output.Bytes())
+	return downloadResult{URL: targetURL, OK: false, Msg: msg, Kind: kind}
+}
+
+func pluginFetch(d plugin.Downloader) fetchFunc {
+	return func(ctx context.Context, targetURL, destDir string) downloadResult {
+		res, err := d.Download(ctx, plugin.DownloadRequest{URL: targetURL, DestDir: destDir})
+		if err != nil {
+			return downloadResult{URL: targetURL, OK: false, Msg: err.Error(), Kind: errorKind(err)}
+		}
+		msg := "ok"
+		if res.Path != "" {
+			msg = res.Path
+		}
+		return downloadResult{URL: targetURL, OK: true, Msg: msg, Path: res.Path}
 	}
-	return downloadResult{URL: targetURL, OK: false, Msg: msg}
 }
 
 func isNotFound(err error) bool {
@@ -241,24 +868,40 @@ func isNotFound(err error) bool {
 	return false
 }
 
-func report(results []downloadResult) {
+func report(results []downloadResult, elapsed time.Duration) {
 	var success []string
-	var failed []downloadResult
+	var failed, corrupt []downloadResult
 	for _, res := range results {
-		if res.OK {
+		switch {
+		case res.OK:
 			success = append(success, res.URL)
-			continue
+		case res.Interrupted:
+		case res.Corrupt:
+			corrupt = append(corrupt, res)
+		default:
+			failed = append(failed, res)
 		}
-		failed = append(failed, res)
 	}
 
 	if len(success) > 0 {
-		fmt.Printf("Downloaded %d file(s).\n", len(success))
+		bytes, _ := batchTotals(results)
+		fmt.Printf("Downloaded %d file(s), %s in %s (%s/s).\n", len(success), formatBytes(bytes), formatDuration(elapsed), formatBytes(int64(rate(bytes, elapsed))))
+	}
+	if len(corrupt) > 0 {
+		fmt.Printf("Corrupt %d file(s):\n", len(corrupt))
+		for _, res := range corrupt {
+			fmt.Printf("- %s :: %s :: %s\n", res.URL, res.Path, res.Msg)
+		}
 	}
 	if len(failed) > 0 {
 		fmt.Printf("Failed %d file(s):\n", len(failed))
 		for _, res := range failed {
-			fmt.Printf("- %s :: %s\n", res.URL, res.Msg)
+			if res.Kind != "" {
+				fmt.Printf("- %s :: [%s] %s\n", res.URL, res.Kind, res.Msg)
+			} else {
+				fmt.Printf("- %s :: %s\n", res.URL, res.Msg)
+			}
 		}
+		printHints(failed)
 	}
 }
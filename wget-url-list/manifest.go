@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// manifestName is the download history kept in the download directory.
+const manifestName = ".url-downloader.json"
+
+// manifestEntry records one successful download.
+type manifestEntry struct {
+	URL string `json:"url"`
+	// File is relative to the download directory when it is inside it.
+	File   string    `json:"file,omitempty"`
+	Size   int64     `json:"size,omitempty"`
+	SHA256 string    `json:"sha256,omitempty"`
+	Time   time.Time `json:"downloaded_at"`
+}
+
+// manifest is the history of what was downloaded into a directory, so a
+// URL pasted again in a later session can be skipped.
+type manifest struct {
+	path string
+	dir  string
+
+	mu      sync.Mutex
+	entries []manifestEntry
+	byURL   map[string]int
+}
+
+// loadManifest reads the history of dir; a missing file is an empty
+// history.
+func loadManifest(dir string) (*manifest, error) {
+	m := &manifest{path: filepath.Join(dir, manifestName), dir: dir, byURL: map[string]int{}}
+	data, err := os.ReadFile(m.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Downloads []manifestEntry `json:"downloads"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", m.path, err)
+	}
+	for _, e := range file.Downloads {
+		m.add(e)
+	}
+	return m, nil
+}
+
+func (m *manifest) add(e manifestEntry) {
+	if i, ok := m.byURL[e.URL]; ok {
+		m.entries[i] = e
+		return
+	}
+	m.byURL[e.URL] = len(m.entries)
+	m.entries = append(m.entries, e)
+}
+
+// has reports whether url was downloaded before.
+func (m *manifest) has(url string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.byURL[url]
+	return ok
+}
+
+// ownerOf returns the URL recorded for the file at path, or "".
+func (m *manifest) ownerOf(path string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range m.entries {
+		if e.File != "" && m.filePath(e) == path {
+			return e.URL
+		}
+	}
+	return ""
+}
+
+// wrap records every download fetch finishes, saving the history as it
+// goes so an interrupted batch keeps what it got.
+func (m *manifest) wrap(fetch fetchFunc) fetchFunc {
+	return func(ctx context.Context, targetURL, destDir string) downloadResult {
+		res := fetch(ctx, targetURL, destDir)
+		if res.OK {
+			if err := m.record(res); err != nil {
+				fmt.Fprintf(os.Stderr, "update download history: %v\n", err)
+			}
+		}
+		return res
+	}
+}
+
+// record adds a successful download, with the size and checksum of its
+// file when the downloader said where it is.
+func (m *manifest) record(res downloadResult) error {
+	e := manifestEntry{URL: res.URL, Time: time.Now().UTC()}
+	if res.Path != "" {
+		e.File = res.Path
+		if rel, err := filepath.Rel(m.dir, res.Path); err == nil && filepath.IsLocal(rel) {
+			e.File = rel
+		}
+		info, err := os.Stat(res.Path)
+		if err != nil {
+			return err
+		}
+		e.Size, e.SHA256 = info.Size(), res.SHA256
+		if e.SHA256 == "" {
+			if _, e.SHA256, err = hashFile(res.Path); err != nil {
+				return err
+			}
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.add(e)
+	return m.save()
+}
+
+// save writes the history through a temporary file, so a crash cannot
+// leave it half written. m.mu must be held.
+func (m *manifest) save() error {
+	data, err := json.MarshalIndent(map[string][]manifestEntry{"downloads": m.entries}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.path)
+}
+
+func hashFile(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// organizeModes are the values of -organize.
+var organizeModes = []string{"by-domain", "by-date", "by-batch"}
+
+func validOrganizeMode(mode string) bool {
+	if mode == "" {
+		return true
+	}
+	for _, m := range organizeModes {
+		if mode == m {
+			return true
+		}
+	}
+	return false
+}
+
+// organizeDir returns the subdirectory of the download directory that
+// targetURL goes to under mode, for a batch started at batchStart; ""
+// keeps it at the top.
+func organizeDir(mode, targetURL string, batchStart time.Time) string {
+	switch mode {
+	case "by-domain":
+		host := strings.TrimPrefix(hostOf(targetURL), "www.")
+		if host == "" {
+			return "unknown-host"
+		}
+		return host
+	case "by-date":
+		return time.Now().Format("2006-01-02")
+	case "by-batch":
+		return batchStart.Format("2006-01-02_150405")
+	}
+	return ""
+}
+
+// organizeFetch makes fetch download into the subdirectory organizeDir
+// picks, creating it as needed.
+func organizeFetch(mode string, batchStart time.Time, fetch fetchFunc) fetchFunc {
+	if mode == "" {
+		return fetch
+	}
+	return func(ctx context.Context, targetURL, destDir string) downloadResult {
+		dir := filepath.Join(destDir, organizeDir(mode, targetURL, batchStart))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return downloadResult{URL: targetURL, OK: false, Msg: fmt.Sprintf("create %s: %v", dir, err), Kind: errorKind(err)}
+		}
+		return fetch(ctx, targetURL, dir)
+	}
+}
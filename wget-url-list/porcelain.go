@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Exit statuses of batch and -feed runs, for scripts to branch on.
+const (
+	exitOK = 0
+	// exitError is a run that could not start: a bad flag, unreadable
+	// input or no URLs.
+	exitError   = 1
+	exitPartial = 2
+	exitFailed  = 3
+	// exitInterrupted is a run Ctrl-C stopped before every URL was done,
+	// as a shell reports a command killed by SIGINT.
+	exitInterrupted = 130
+)
+
+// exitStatus returns the exit status of a run in which failed URLs were
+// not downloaded and ok ones were, before or now, or were filtered out.
+func exitStatus(ok, failed int) int {
+	switch {
+	case failed == 0:
+		return exitOK
+	case ok == 0:
+		return exitFailed
+	}
+	return exitPartial
+}
+
+// porcelainLog prints one line per URL of a batch in a format that stays
+// the same between versions: status, URL, file, bytes, error kind and
+// error, separated by tabs, with "-" for what is empty. A nil *porcelainLog
+// prints nothing.
+type porcelainLog struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func (l *porcelainLog) line(status, url, path string, bytes int64, kind, msg string) {
+	if l == nil {
+		return
+	}
+	fields := []string{status, url, path, strconv.FormatInt(bytes, 10), kind, msg}
+	for i, f := range fields {
+		f = strings.Join(strings.Fields(f), " ")
+		if f == "" {
+			f = "-"
+		}
+		fields[i] = f
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintln(l.out, strings.Join(fields, "\t"))
+}
+
+// wrap prints the line of every URL fetch finishes.
+func (l *porcelainLog) wrap(fetch fetchFunc) fetchFunc {
+	if l == nil {
+		return fetch
+	}
+	return func(ctx context.Context, targetURL, destDir string) downloadResult {
+		res := fetch(ctx, targetURL, destDir)
+		msg := ""
+		if !res.OK {
+			msg = res.Msg
+		}
+		l.line(status(res), targetURL, res.Path, res.Bytes, res.Kind, msg)
+		return res
+	}
+}
+
+// list prints the same line for each of urls, such as those a batch leaves
+// out and why.
+func (l *porcelainLog) list(status string, urls []string, why string) {
+	for _, u := range urls {
+		l.line(status, u, "", 0, "", why)
+	}
+}
+
+// missing returns the URLs of all that are not in some.
+func missing(all, some []string) []string {
+	var out []string
+	for _, u := range all {
+		if !slices.Contains(some, u) {
+			out = append(out, u)
+		}
+	}
+	return out
+}
+
+// printFailures lists the failed downloads of results on stderr, for
+// -quiet runs whose report is not printed.
+func printFailures(results []downloadResult) {
+	for _, res := range results {
+		if res.OK || res.Interrupted {
+			continue
+		}
+		kind := ""
+		if res.Kind != "" {
+			kind = "[" + res.Kind + "] "
+		}
+		fmt.Fprintf(os.Stderr, "%s %s: %s%s\n", status(res), res.URL, kind, res.Msg)
+	}
+}
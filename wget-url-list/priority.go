@@ -0,0 +1,41 @@
+package main
+
+import (
+	"slices"
+	"strings"
+)
+
+// priorityMark starts an input line whose URL is downloaded before the
+// unmarked ones.
+const priorityMark = "!"
+
+// priorityURLs returns the cleaned URLs of the lines of raw marked with
+// priorityMark.
+func priorityURLs(raw []string, rules urlRules) map[string]bool {
+	first := map[string]bool{}
+	for _, line := range raw {
+		if !strings.HasPrefix(strings.TrimSpace(line), priorityMark) {
+			continue
+		}
+		if u, ok := rules.clean(line); ok {
+			first[u] = true
+		}
+	}
+	return first
+}
+
+// putFirst moves the URLs in first to the front of urls, keeping the order
+// of both groups. Downloads are handed to the workers in that order.
+func putFirst(urls []string, first map[string]bool) []string {
+	ordered := slices.Clone(urls)
+	slices.SortStableFunc(ordered, func(a, b string) int {
+		switch {
+		case first[a] && !first[b]:
+			return -1
+		case first[b] && !first[a]:
+			return 1
+		}
+		return 0
+	})
+	return ordered
+}
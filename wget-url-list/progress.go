@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressInterval is how often the live display is redrawn.
+const progressInterval = 500 * time.Millisecond
+
+// progress shows how a batch is going: a line per finished file and, on a
+// terminal, a live block with every active download and the batch total.
+// A nil *progress shows nothing.
+type progress struct {
+	out  io.Writer
+	live bool
+
+	mu      sync.Mutex
+	active  []*transfer
+	total   int
+	done    int
+	failed  int
+	bytes   int64
+	started time.Time
+	// drawn is how many lines the live block took when last drawn.
+	drawn int
+	stop  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// newProgress writes to out, drawing the live block only if live is set
+// and out is a terminal.
+func newProgress(out *os.File, live bool) *progress {
+	return &progress{out: out, live: live && isTerminal(out)}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// begin starts a batch of downloads.
+func (p *progress) begin(files int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.active, p.total, p.done, p.failed, p.bytes = nil, files, 0, 0, 0
+	p.started = time.Now()
+	p.drawn = 0
+	p.mu.Unlock()
+	if !p.live {
+		return
+	}
+	p.stop = make(chan struct{})
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				p.mu.Lock()
+				p.redraw()
+				p.mu.Unlock()
+			}
+		}
+	}()
+}
+
+// end stops the live display and leaves the batch total on screen.
+func (p *progress) end() {
+	if p == nil {
+		return
+	}
+	if p.live {
+		close(p.stop)
+		p.wg.Wait()
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	fmt.Fprintln(p.out, p.summary())
+}
+
+// wrap counts the files fetch finishes and reports each one.
+func (p *progress) wrap(fetch fetchFunc) fetchFunc {
+	if p == nil {
+		return fetch
+	}
+	return func(ctx context.Context, targetURL, destDir string) downloadResult {
+		res := fetch(ctx, targetURL, destDir)
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.done++
+		if !res.OK && !res.Interrupted {
+			p.failed++
+		}
+		p.clear()
+		fmt.Fprintf(p.out, "[%d/%d] %s %s\n", p.done, p.total, status(res), targetURL)
+		p.redraw()
+		return res
+	}
+}
+
+// notef prints a message above the live block.
+func (p *progress) notef(format string, args ...any) {
+	if p == nil {
+		fmt.Fprintf(os.Stderr, format+"\n", args...)
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	fmt.Fprintf(p.out, format+"\n", args...)
+	p.redraw()
+}
+
+// transfer is one download in progress; its Write counts the bytes
+// written to the file.
+type transfer struct {
+	p    *progress
+	url  string
+	name string
+	// size is the full length of the file, or 0 if the server did not say.
+	size    int64
+	have    int64
+	resumed int64
+	started time.Time
+}
+
+// track adds a download of targetURL into the file name to the live
+// block. offset is how much of the file an earlier attempt left and size
+// its full length (0 if unknown).
+func (p *progress) track(targetURL, name string, offset, size int64) *transfer {
+	t := &transfer{p: p, url: targetURL, name: name, size: size, have: offset, resumed: offset, started: time.Now()}
+	if p == nil {
+		return t
+	}
+	p.mu.Lock()
+	p.active = append(p.active, t)
+	p.mu.Unlock()
+	return t
+}
+
+func (t *transfer) Write(b []byte) (int, error) {
+	if t.p == nil {
+		return len(b), nil
+	}
+	t.p.mu.Lock()
+	t.have += int64(len(b))
+	t.p.bytes += int64(len(b))
+	t.p.mu.Unlock()
+	return len(b), nil
+}
+
+// finish removes the download from the live block.
+func (t *transfer) finish() {
+	if t.p == nil {
+		return
+	}
+	t.p.mu.Lock()
+	defer t.p.mu.Unlock()
+	for i, a := range t.p.active {
+		if a == t {
+			t.p.active = append(t.p.active[:i], t.p.active[i+1:]...)
+			break
+		}
+	}
+}
+
+func (t *transfer) line() string {
+	name := t.name
+	if len(name) > 40 {
+		name = name[:37] + "..."
+	}
+	return fmt.Sprintf("  %-40s %s", name, t.stats())
+}
+
+// stats is the bytes, percent, speed and ETA of the transfer. p.mu must be
+// held.
+func (t *transfer) stats() string {
+	speed := rate(t.have-t.resumed, time.Since(t.started))
+	if t.size <= 0 {
+		return fmt.Sprintf("%10s  %10s/s", formatBytes(t.have), formatBytes(int64(speed)))
+	}
+	eta := "--:--"
+	if speed > 0 {
+		eta = formatDuration(time.Duration(float64(t.size-t.have) / speed * float64(time.Second)))
+	}
+	return fmt.Sprintf("%10s / %-10s %3d%%  %10s/s  ETA %s",
+		formatBytes(t.have), formatBytes(t.size), t.have*100/t.size, formatBytes(int64(speed)), eta)
+}
+
+// stats returns the stats of the active download of targetURL, if any.
+func (p *progress) stats(targetURL string) string {
+	if p == nil {
+		return ""
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, t := range p.active {
+		if t.url == targetURL {
+			return t.stats()
+		}
+	}
+	return ""
+}
+
+// summary is the batch total line. p.mu must be held.
+func (p *progress) summary() string {
+	elapsed := time.Since(p.started)
+	s := fmt.Sprintf("%d/%d file(s) done", p.done, p.total)
+	if p.failed > 0 {
+		s += fmt.Sprintf(", %d failed", p.failed)
+	}
+	return s + fmt.Sprintf(", %s in %s (%s/s)", formatBytes(p.bytes), formatDuration(elapsed), formatBytes(int64(rate(p.bytes, elapsed))))
+}
+
+// redraw replaces the live block. p.mu must be held.
+func (p *progress) redraw() {
+	if !p.live {
+		return
+	}
+	p.clear()
+	var b strings.Builder
+	for _, t := range p.active {
+		b.WriteString(t.line())
+		b.WriteByte('\n')
+	}
+	b.WriteString(p.summary())
+	b.WriteByte('\n')
+	p.drawn = len(p.active) + 1
+	io.WriteString(p.out, b.String())
+}
+
+// clear erases the live block. p.mu must be held.
+func (p *progress) clear() {
+	if !p.live || p.drawn == 0 {
+		return
+	}
+	// Move to the start of the block's first line and erase to the end of
+	// the screen.
+	fmt.Fprintf(p.out, "\x1b[%dF\x1b[J", p.drawn)
+	p.drawn = 0
+}
+
+func rate(bytes int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(bytes) / elapsed.Seconds()
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, exp := float64(n)/unit, 0
+	for value >= unit && exp < 4 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGTP"[exp])
+}
+
+func formatDuration(d time.Duration) string {
+	s := int64(d.Round(time.Second) / time.Second)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
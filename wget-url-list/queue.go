@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// queueName is the list of unfinished downloads kept in the download
+// directory.
+const queueName = ".url-downloader-queue.json"
+
+type queuedURL struct {
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// savedQueue is the on-disk list of URLs that were queued but have not
+// finished, so a batch cut short by a kill or a reboot can be picked up by
+// the next run. Their .part files let the built-in downloader resume them.
+type savedQueue struct {
+	path string
+
+	mu    sync.Mutex
+	items []queuedURL
+}
+
+// loadQueue reads the unfinished downloads of dir; a missing file is an
+// empty queue.
+func loadQueue(dir string) (*savedQueue, error) {
+	q := &savedQueue{path: filepath.Join(dir, queueName)}
+	data, err := os.ReadFile(q.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Pending []queuedURL `json:"pending"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", q.path, err)
+	}
+	q.items = file.Pending
+	return q, nil
+}
+
+// pending returns the queued URLs, in order, and their expected checksums.
+func (q *savedQueue) pending() ([]string, map[string]string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	urls := make([]string, 0, len(q.items))
+	sums := map[string]string{}
+	for _, item := range q.items {
+		urls = append(urls, item.URL)
+		if item.SHA256 != "" {
+			sums[item.URL] = item.SHA256
+		}
+	}
+	return urls, sums
+}
+
+// add queues the URLs that are not queued yet.
+func (q *savedQueue) add(urls []string, checksums map[string]string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	queued := map[string]bool{}
+	for _, item := range q.items {
+		queued[item.URL] = true
+	}
+	for _, u := range urls {
+		if !queued[u] {
+			queued[u] = true
+			q.items = append(q.items, queuedURL{URL: u, SHA256: checksums[u]})
+		}
+	}
+	return q.save()
+}
+
+// remove drops a finished URL, whether it succeeded or not.
+func (q *savedQueue) remove(u string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, item := range q.items {
+		if item.URL == u {
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			return q.save()
+		}
+	}
+	return nil
+}
+
+// clear forgets every queued URL.
+func (q *savedQueue) clear() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = nil
+	return q.save()
+}
+
+// wrap takes every URL fetch finishes off the queue. One whose ctx was
+// cancelled did not finish, is marked interrupted and stays queued.
+func (q *savedQueue) wrap(fetch fetchFunc) fetchFunc {
+	return func(ctx context.Context, targetURL, destDir string) downloadResult {
+		res := fetch(ctx, targetURL, destDir)
+		if ctx.Err() != nil {
+			res.Interrupted = !res.OK
+			return res
+		}
+		if err := q.remove(targetURL); err != nil {
+			fmt.Fprintf(os.Stderr, "update download queue: %v\n", err)
+		}
+		return res
+	}
+}
+
+// save writes the queue, or removes its file once it is empty. q.mu must
+// be held.
+func (q *savedQueue) save() error {
+	if len(q.items) == 0 {
+		err := os.Remove(q.path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	data, err := json.MarshalIndent(map[string][]queuedURL{"pending": q.items}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := q.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, q.path)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// minRangeSize is the smallest piece a file is split into; smaller files
+// are fetched over one connection.
+const minRangeSize = 4 << 20
+
+// rangesSuffix marks the state of a download split into ranges, next to
+// its .part file, so an interrupted one resumes every range.
+const rangesSuffix = ".ranges"
+
+// rangeSaveInterval is how often the state of the ranges is saved while
+// they download.
+const rangeSaveInterval = 5 * time.Second
+
+// byteRange is one piece of a ranged download: bytes Start to End
+// inclusive, of which Done have been written.
+type byteRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	Done  int64 `json:"done"`
+}
+
+type rangeState struct {
+	Size   int64       `json:"size"`
+	Ranges []byteRange `json:"ranges"`
+}
+
+// splitRanges cuts size bytes into at most n ranges of at least
+// minRangeSize.
+func splitRanges(size int64, n int) []byteRange {
+	if max := int(size / minRangeSize); n > max {
+		n = max
+	}
+	if n < 1 {
+		n = 1
+	}
+	ranges := make([]byteRange, n)
+	step := size / int64(n)
+	for i := range ranges {
+		ranges[i].Start = int64(i) * step
+		ranges[i].End = ranges[i].Start + step - 1
+	}
+	ranges[n-1].End = size - 1
+	return ranges
+}
+
+// downloadRanged fetches targetURL into part over d.connections parallel
+// Range requests. It returns false, and leaves the download to the single
+// connection path, when the server does not support ranges, the file is
+// too small to split or part was started by a single connection.
+func (d *httpDownloader) downloadRanged(ctx context.Context, targetURL, part string) (bool, error) {
+	statePath := part + rangesSuffix
+	var state rangeState
+	if data, err := os.ReadFile(statePath); err == nil {
+		if err := json.Unmarshal(data, &state); err != nil {
+			return true, fmt.Errorf("parse %s: %w", statePath, err)
+		}
+	} else if _, err := os.Stat(part); err == nil {
+		return false, nil
+	} else {
+		size, err := d.rangeSize(ctx, targetURL)
+		if err != nil || size < 2*minRangeSize {
+			return false, nil
+		}
+		state = rangeState{Size: size, Ranges: splitRanges(size, d.connections)}
+	}
+
+	f, err := os.OpenFile(part, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return true, err
+	}
+	defer f.Close()
+	if err := f.Truncate(state.Size); err != nil {
+		return true, err
+	}
+
+	var done int64
+	for _, r := range state.Ranges {
+		done += r.Done
+	}
+	t := d.progress.track(targetURL, filepath.Base(part[:len(part)-len(partSuffix)]), done, state.Size)
+	defer t.finish()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var mu sync.Mutex
+	save := func() error {
+		mu.Lock()
+		data, err := json.Marshal(state)
+		mu.Unlock()
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(statePath, data, 0o644)
+	}
+	if err := save(); err != nil {
+		return true, err
+	}
+	stopSaving := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(rangeSaveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopSaving:
+				return
+			case <-ticker.C:
+				save()
+			}
+		}
+	}()
+
+	fileRate := newRateLimiter(d.fileRate)
+	var wg sync.WaitGroup
+	var firstErr error
+	for i := range state.Ranges {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := d.fetchRange(ctx, targetURL, f, &state.Ranges[i], &mu, t, fileRate)
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	close(stopSaving)
+	if err := save(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	if firstErr != nil {
+		return true, fmt.Errorf("%w (partial file kept for resume)", firstErr)
+	}
+
+	if err := f.Close(); err != nil {
+		return true, err
+	}
+	info, err := os.Stat(part)
+	if err != nil {
+		return true, err
+	}
+	for _, r := range state.Ranges {
+		if r.Start+r.Done != r.End+1 {
+			return true, fmt.Errorf("range %d-%d incomplete", r.Start, r.End)
+		}
+	}
+	if info.Size() != state.Size {
+		return true, fmt.Errorf("got %d bytes, want %d", info.Size(), state.Size)
+	}
+	return true, os.Remove(statePath)
+}
+
+// rangeSize asks for the first byte of targetURL and returns the full
+// length if the server answers with a range.
+func (d *httpDownloader) rangeSize(ctx context.Context, targetURL string) (int64, error) {
+	resp, err := d.get(ctx, targetURL, "bytes=0-0")
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, errors.New("no range support")
+	}
+	return contentRangeSize(resp.Header.Get("Content-Range")), nil
+}
+
+// fetchRange writes the rest of r into f, counting what it writes in
+// r.Done under mu.
+func (d *httpDownloader) fetchRange(ctx context.Context, targetURL string, f *os.File, r *byteRange, mu *sync.Mutex, t *transfer, fileRate *rateLimiter) error {
+	mu.Lock()
+	from := r.Start + r.Done
+	mu.Unlock()
+	if from > r.End {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	resp, err := d.get(ctx, targetURL, fmt.Sprintf("bytes=%d-%d", from, r.End))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("range %d-%d: %w", from, r.End, replied(resp))
+	}
+	body := io.Reader(&stallReader{r: resp.Body, timeout: d.timeout, cancel: cancel})
+	body = &limitedReader{r: body, limiters: []*rateLimiter{d.totalRate, fileRate}}
+	buf := make([]byte, 32*1024)
+	for from <= r.End {
+		n, err := body.Read(buf)
+		if int64(n) > r.End+1-from {
+			n = int(r.End + 1 - from)
+		}
+		if n > 0 {
+			if _, werr := f.WriteAt(buf[:n], from); werr != nil {
+				return werr
+			}
+			from += int64(n)
+			t.Write(buf[:n])
+			mu.Lock()
+			r.Done += int64(n)
+			mu.Unlock()
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if from <= r.End {
+		return fmt.Errorf("range %d-%d: connection closed early", r.Start, r.End)
+	}
+	return nil
+}
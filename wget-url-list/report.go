@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// timeFetch records how long fetch takes and how big the file it leaves is.
+func timeFetch(fetch fetchFunc) fetchFunc {
+	return func(ctx context.Context, targetURL, destDir string) downloadResult {
+		started := time.Now()
+		res := fetch(ctx, targetURL, destDir)
+		res.Elapsed = time.Since(started)
+		if res.Path != "" {
+			if info, err := os.Stat(res.Path); err == nil {
+				res.Bytes = info.Size()
+			}
+		}
+		return res
+	}
+}
+
+// status names how a download ended: done, interrupted, corrupt or
+// failed.
+func status(res downloadResult) string {
+	switch {
+	case res.OK:
+		return "done"
+	case res.Interrupted:
+		return "interrupted"
+	case res.Corrupt:
+		return "corrupt"
+	}
+	return "failed"
+}
+
+// batchTotals counts the files of a batch that were downloaded and their
+// bytes.
+func batchTotals(results []downloadResult) (bytes int64, ok int) {
+	for _, res := range results {
+		if res.OK {
+			ok++
+			bytes += res.Bytes
+		}
+	}
+	return bytes, ok
+}
+
+// finished counts the downloads of a batch that ran to an end, good or
+// bad.
+func finished(results []downloadResult) int {
+	n := 0
+	for _, res := range results {
+		if !res.Interrupted {
+			n++
+		}
+	}
+	return n
+}
+
+type reportEntry struct {
+	URL            string  `json:"url"`
+	Status         string  `json:"status"`
+	Bytes          int64   `json:"bytes"`
+	Seconds        float64 `json:"duration_seconds"`
+	BytesPerSecond float64 `json:"bytes_per_second"`
+	Path           string  `json:"path,omitempty"`
+	Error          string  `json:"error,omitempty"`
+	ErrorKind      string  `json:"error_kind,omitempty"`
+	Hint           string  `json:"hint,omitempty"`
+}
+
+type batchReport struct {
+	Started        time.Time     `json:"started"`
+	Seconds        float64       `json:"duration_seconds"`
+	Files          int           `json:"files"`
+	Done           int           `json:"done"`
+	Failed         int           `json:"failed"`
+	Bytes          int64         `json:"bytes"`
+	BytesPerSecond float64       `json:"bytes_per_second"`
+	Downloads      []reportEntry `json:"downloads"`
+}
+
+// writeReport writes the results of a batch, started at started and
+// taking elapsed, to path as JSON.
+func writeReport(path string, results []downloadResult, started time.Time, elapsed time.Duration) error {
+	bytes, ok := batchTotals(results)
+	r := batchReport{
+		Started:        started,
+		Seconds:        elapsed.Seconds(),
+		Files:          len(results),
+		Done:           ok,
+		Failed:         len(results) - ok,
+		Bytes:          bytes,
+		BytesPerSecond: rate(bytes, elapsed),
+		Downloads:      []reportEntry{},
+	}
+	for _, res := range results {
+		e := reportEntry{
+			URL:            res.URL,
+			Status:         status(res),
+			Bytes:          res.Bytes,
+			Seconds:        res.Elapsed.Seconds(),
+			BytesPerSecond: rate(res.Bytes, res.Elapsed),
+			Path:           res.Path,
+		}
+		if !res.OK {
+			e.Error = res.Msg
+			e.ErrorKind = res.Kind
+			e.Hint = hints[res.Kind]
+		}
+		r.Downloads = append(r.Downloads, e)
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// reviewURLs lists the cleaned URLs of a prompted batch by number and lets
+// them be pruned with ":drop 3,5-7" or ":only 1-10", or moved ahead of the
+// others with ":first 4", before the batch starts. It returns the URLs to
+// download, none if the batch is cancelled.
+func reviewURLs(r *bufio.Reader, urls []string) []string {
+	for {
+		fmt.Printf("Ready to download %d URL(s):\n", len(urls))
+		for i, u := range urls {
+			fmt.Printf("  %d. %s\n", i+1, u)
+		}
+		fmt.Print("Press Enter or type ':go' to start, ':drop 3,5-7' or ':only 1-10' to prune the list, ':first 4' to download those first, ':cancel' to discard it: ")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				fmt.Println()
+				return urls
+			}
+			command := strings.TrimSpace(line)
+			if command == "" || command == ":go" || command == ":start" || command == ":run" {
+				return urls
+			}
+			if command == ":cancel" {
+				fmt.Println("Batch discarded.")
+				return nil
+			}
+			verb, list, _ := strings.Cut(command, " ")
+			if verb != ":drop" && verb != ":only" && verb != ":first" {
+				fmt.Print("Type ':go', ':drop 3,5-7', ':only 1-10', ':first 4' or ':cancel': ")
+				continue
+			}
+			picked, err := parseIndexes(list, len(urls))
+			if err != nil {
+				fmt.Printf("%v; try again: ", err)
+				continue
+			}
+			if verb == ":first" {
+				first := map[string]bool{}
+				for i := range picked {
+					first[urls[i]] = true
+				}
+				urls = putFirst(urls, first)
+				break
+			}
+			var pruned []string
+			for i, u := range urls {
+				if picked[i] == (verb == ":only") {
+					pruned = append(pruned, u)
+				}
+			}
+			if len(pruned) == 0 {
+				fmt.Println("No URLs left.")
+				return nil
+			}
+			urls = pruned
+			break
+		}
+	}
+}
+
+// parseIndexes parses a list of 1-based numbers and ranges such as
+// "3,5-7" into the 0-based indexes it picks out of n.
+func parseIndexes(list string, n int) (map[int]bool, error) {
+	picked := map[int]bool{}
+	for _, part := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ' ' }) {
+		from, to, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, fmt.Errorf("bad number %q", from)
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.Atoi(to); err != nil {
+				return nil, fmt.Errorf("bad number %q", to)
+			}
+		}
+		if first < 1 || last > n || first > last {
+			return nil, fmt.Errorf("%s is not in 1-%d", part, n)
+		}
+		for i := first; i <= last; i++ {
+			picked[i-1] = true
+		}
+	}
+	if len(picked) == 0 {
+		return nil, fmt.Errorf("no numbers given")
+	}
+	return picked, nil
+}
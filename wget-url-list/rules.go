@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// defaultRulesPath is where the URL cleaning rules are read from when
+// -rules is not given.
+const defaultRulesPath = "~/.config/url-downloader/rules.json"
+
+// urlRule rewrites the URLs of some hosts before they are queued.
+type urlRule struct {
+	// Hosts are the host names the rule applies to, with * wildcards as
+	// in *.example.com; none means every host.
+	Hosts []string `json:"hosts,omitempty"`
+	// StripParams are the query parameters removed, by name or pattern
+	// as in utm_*.
+	StripParams []string `json:"strip_params,omitempty"`
+	// HTTPS switches http URLs to https.
+	HTTPS bool `json:"https,omitempty"`
+	// Host replaces the host name, as in twitter.com to x.com.
+	Host string `json:"host,omitempty"`
+}
+
+// urlRules are applied in order, each to the URL the ones before it left.
+type urlRules []urlRule
+
+// defaultRules drop the tag parameter that shared video links carry.
+var defaultRules = urlRules{{StripParams: []string{"tag"}}}
+
+// loadRules reads the rules of rulesPath, or of defaultRulesPath when it
+// is "". A missing default file gives defaultRules.
+func loadRules(rulesPath string) (urlRules, error) {
+	explicit := rulesPath != ""
+	if !explicit {
+		rulesPath = defaultRulesPath
+	}
+	p, err := expandPath(rulesPath)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return defaultRules, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Rules urlRules `json:"rules"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", p, err)
+	}
+	for _, r := range file.Rules {
+		for _, pattern := range append(append([]string{}, r.Hosts...), r.StripParams...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("%s: bad pattern %q", filepath.Base(p), pattern)
+			}
+		}
+	}
+	return file.Rules, nil
+}
+
+func (r urlRule) matches(host string) bool {
+	if len(r.Hosts) == 0 {
+		return true
+	}
+	for _, pattern := range r.Hosts {
+		if ok, _ := path.Match(strings.ToLower(pattern), host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r urlRule) strips(param string) bool {
+	for _, pattern := range r.StripParams {
+		if ok, _ := path.Match(pattern, param); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// clean reads the URL in raw like cleanURL and applies the rules to it.
+func (rs urlRules) clean(raw string) (string, bool) {
+	u, ok := cleanURL(raw)
+	if !ok {
+		return "", false
+	}
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "", false
+	}
+	for _, r := range rs {
+		if !r.matches(strings.ToLower(parsed.Hostname())) {
+			continue
+		}
+		if r.HTTPS && parsed.Scheme == "http" {
+			parsed.Scheme = "https"
+		}
+		if r.Host != "" {
+			parsed.Host = r.Host
+		}
+		query := parsed.Query()
+		if len(query) > 0 && len(r.StripParams) > 0 {
+			for name := range query {
+				if r.strips(name) {
+					delete(query, name)
+				}
+			}
+			parsed.RawQuery = query.Encode()
+		}
+	}
+	return strings.TrimSuffix(parsed.String(), "?"), true
+}
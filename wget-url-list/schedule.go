@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timeWindow is a daily stretch of local time when downloads may run, such
+// as 02:00-07:00. One that ends before it starts runs past midnight.
+type timeWindow struct {
+	spec       string
+	start, end time.Duration
+
+	mu sync.Mutex
+	// waiting counts the downloads waiting for the window to open, so it
+	// is announced once.
+	waiting int
+}
+
+// parseWindow reads a -schedule value; "" is no window.
+func parseWindow(s string) (*timeWindow, error) {
+	if s == "" {
+		return nil, nil
+	}
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid window %q (want e.g. 02:00-07:00)", s)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return nil, err
+	}
+	if start == end {
+		return nil, fmt.Errorf("window %q is empty", s)
+	}
+	return &timeWindow{spec: s, start: start, end: end}, nil
+}
+
+// parseClock reads a time of day like 02:00 as the time since midnight.
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q (want HH:MM)", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// at says whether now is inside the window and when that next changes:
+// the end of the window if it is open, its next start if not.
+func (w *timeWindow) at(now time.Time) (bool, time.Time) {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	clock := func(day int, d time.Duration) time.Time {
+		return midnight.AddDate(0, 0, day).Add(d)
+	}
+	tod := now.Sub(midnight)
+	if w.start < w.end {
+		switch {
+		case tod < w.start:
+			return false, clock(0, w.start)
+		case tod < w.end:
+			return true, clock(0, w.end)
+		}
+		return false, clock(1, w.start)
+	}
+	switch {
+	case tod >= w.start:
+		return true, clock(1, w.end)
+	case tod < w.end:
+		return true, clock(0, w.end)
+	}
+	return false, clock(0, w.start)
+}
+
+// scheduleFetch runs fetch only inside w, waiting for it to open. A
+// download the window closes on is stopped, leaving its partial file, and
+// resumed when the window opens again.
+func scheduleFetch(w *timeWindow, p *progress, fetch fetchFunc) fetchFunc {
+	if w == nil {
+		return fetch
+	}
+	return func(ctx context.Context, targetURL, destDir string) downloadResult {
+		for {
+			open, change := w.at(time.Now())
+			if !open {
+				w.mu.Lock()
+				if w.waiting == 0 {
+					p.notef("Outside the download window %s; waiting until %s.", w.spec, change.Format("Mon 15:04"))
+				}
+				w.waiting++
+				w.mu.Unlock()
+				err := sleepUntil(ctx, change)
+				w.mu.Lock()
+				w.waiting--
+				w.mu.Unlock()
+				if err != nil {
+					return downloadResult{URL: targetURL, OK: false, Msg: err.Error()}
+				}
+				continue
+			}
+			wctx, cancel := context.WithDeadline(ctx, change)
+			res := fetch(wctx, targetURL, destDir)
+			closed := !res.OK && ctx.Err() == nil && wctx.Err() != nil
+			cancel()
+			if !closed {
+				return res
+			}
+			p.notef("Download window %s closed; %s will resume when it opens.", w.spec, targetURL)
+		}
+	}
+}
+
+// parseStartAt reads a -start-at time: a time of day (the next one to
+// come), a local date and time or an RFC 3339 timestamp. "" is now.
+func parseStartAt(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04", s, now.Location()); err == nil {
+		return t, nil
+	}
+	d, err := parseClock(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid start time %q (want HH:MM, 2006-01-02 15:04 or RFC 3339)", s)
+	}
+	t := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).Add(d)
+	if !t.After(now) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// sleepUntil waits for t or for ctx to be cancelled.
+func sleepUntil(ctx context.Context, t time.Time) error {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// maxPageSize bounds how much of a scraped page is read.
+const maxPageSize = 8 << 20
+
+var (
+	// htmlTag finds the tags of pasted or fetched HTML.
+	htmlTag = regexp.MustCompile(`(?is)<([a-z][a-z0-9]*)\b([^>]*)>`)
+	// htmlAttr finds the attributes of a tag that can hold a media URL.
+	htmlAttr = regexp.MustCompile(`(?is)\b(src|href|content|poster|data-src|data-video-url)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+	// ogVideo finds the og:video properties of a <meta> tag.
+	ogVideo = regexp.MustCompile(`(?i)\b(?:property|name)\s*=\s*["'](?:og|twitter):(?:video|player:stream)(?::url|:secure_url)?["']`)
+	// bareMediaURL finds media links in scripts and JSON, where "/" may be
+	// escaped as "\/".
+	bareMediaURL = regexp.MustCompile(`(?i)https?:(?:\\?/){2}[^\s"'<>]+?\.(?:mp4|m4v|mov|webm|m3u8)(?:\?[^\s"'<>]*)?`)
+)
+
+// htmlLine reports whether a pasted line is part of HTML rather than a URL.
+func htmlLine(line string) bool {
+	return strings.ContainsAny(line, "<>") || strings.Contains(line, `="`)
+}
+
+// splitPastedHTML separates pasted HTML lines from plain URL lines.
+func splitPastedHTML(lines []string) (plain []string, markup string) {
+	var b strings.Builder
+	for _, line := range lines {
+		if htmlLine(line) {
+			b.WriteString(line)
+			b.WriteByte('\n')
+			continue
+		}
+		plain = append(plain, line)
+	}
+	return plain, b.String()
+}
+
+// extractMediaURLs returns the candidate media URLs of an HTML page in the
+// order they appear: the sources of <video> and <source> tags, og:video
+// meta tags, and links or bare URLs that end in a media extension.
+// Relative URLs are resolved against base, or dropped when it is nil.
+func extractMediaURLs(page string, base *url.URL) []string {
+	seen := map[string]bool{}
+	var found []string
+	add := func(raw string) {
+		raw = strings.ReplaceAll(html.UnescapeString(strings.TrimSpace(raw)), `\/`, "/")
+		ref, err := url.Parse(raw)
+		if err != nil || raw == "" {
+			return
+		}
+		if !ref.IsAbs() {
+			if base == nil {
+				return
+			}
+			ref = base.ResolveReference(ref)
+		}
+		if ref.Scheme != "http" && ref.Scheme != "https" {
+			return
+		}
+		ref.Fragment = ""
+		if u := ref.String(); !seen[u] {
+			seen[u] = true
+			found = append(found, u)
+		}
+	}
+
+	for _, tag := range htmlTag.FindAllStringSubmatch(page, -1) {
+		name, attrs := strings.ToLower(tag[1]), tag[2]
+		media := name == "video" || name == "source"
+		if name == "meta" && ogVideo.MatchString(attrs) {
+			media = true
+		}
+		for _, attr := range htmlAttr.FindAllStringSubmatch(attrs, -1) {
+			key, value := strings.ToLower(attr[1]), attr[2]+attr[3]
+			switch {
+			case key == "poster":
+			case media && (key == "src" || key == "content" || key == "data-src"):
+				add(value)
+			case mediaLink(value):
+				add(value)
+			}
+		}
+	}
+	for _, raw := range bareMediaURL.FindAllString(page, -1) {
+		add(raw)
+	}
+	return found
+}
+
+// mediaLink reports whether raw points at a video file or stream by its
+// extension.
+func mediaLink(raw string) bool {
+	parsed, err := url.Parse(html.UnescapeString(raw))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(path.Ext(parsed.Path)) {
+	case ".mp4", ".m4v", ".mov", ".webm", ".m3u8":
+		return true
+	}
+	return false
+}
+
+// scrapePage fetches pageURL and returns the media URLs it links to.
+func (d *httpDownloader) scrapePage(ctx context.Context, pageURL string) ([]string, error) {
+	resp, err := d.get(ctx, pageURL, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, replied(resp)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return nil, err
+	}
+	return extractMediaURLs(string(body), resp.Request.URL), nil
+}
+
+// confirmURLs lists URLs found in a page and asks whether to queue them.
+func confirmURLs(r *bufio.Reader, urls []string) []string {
+	if len(urls) == 0 {
+		fmt.Println("No media URLs found.")
+		return nil
+	}
+	fmt.Printf("Found %d media URL(s):\n", len(urls))
+	for i, u := range urls {
+		fmt.Printf("  %d. %s\n", i+1, u)
+	}
+	fmt.Print("Queue them? [Y/n] ")
+	line, err := r.ReadString('\n')
+	answer := strings.ToLower(strings.TrimSpace(line))
+	if strings.HasPrefix(answer, "n") || (answer == "" && err != nil) {
+		return nil
+	}
+	return urls
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// sidecarSuffix names the metadata file written next to a download.
+const sidecarSuffix = ".json"
+
+// sidecarHeaders are the response headers kept in a sidecar.
+var sidecarHeaders = []string{"Content-Type", "Content-Length", "Last-Modified", "ETag", "Content-Disposition"}
+
+// sidecar records where a downloaded file came from.
+type sidecar struct {
+	URL string `json:"url"`
+	// FinalURL is where the URL redirected to, when it did.
+	FinalURL string `json:"final_url,omitempty"`
+	// Page is the page or feed the URL was found on.
+	Page         string            `json:"page_url,omitempty"`
+	File         string            `json:"file"`
+	Size         int64             `json:"size"`
+	SHA256       string            `json:"sha256,omitempty"`
+	DownloadedAt time.Time         `json:"downloaded_at"`
+	Headers      map[string]string `json:"headers,omitempty"`
+}
+
+// pageSources remembers the page or feed each URL was found on. A nil
+// *pageSources remembers nothing and turns sidecars off.
+type pageSources struct {
+	mu    sync.Mutex
+	pages map[string]string
+}
+
+func (s *pageSources) add(urls []string, page string, rules urlRules) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pages == nil {
+		s.pages = map[string]string{}
+	}
+	for _, u := range urls {
+		if cleaned, ok := rules.clean(u); ok {
+			s.pages[cleaned] = page
+		}
+	}
+}
+
+func (s *pageSources) page(u string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pages[u]
+}
+
+// sidecarFetch writes NAME.json next to every file fetch downloads, with
+// its source URL and page, time, checksum and the headers the server sends
+// for it. Page links and HLS playlists have no headers of their own.
+func sidecarFetch(d *httpDownloader, sources *pageSources, fetch fetchFunc) fetchFunc {
+	if sources == nil {
+		return fetch
+	}
+	return func(ctx context.Context, targetURL, destDir string) downloadResult {
+		res := fetch(ctx, targetURL, destDir)
+		if !res.OK || res.Path == "" {
+			return res
+		}
+		info, err := os.Stat(res.Path)
+		if err != nil {
+			return res
+		}
+		sc := sidecar{
+			URL:          targetURL,
+			Page:         sources.page(targetURL),
+			File:         filepath.Base(res.Path),
+			Size:         info.Size(),
+			SHA256:       res.SHA256,
+			DownloadedAt: time.Now().UTC(),
+		}
+		if !needsExtractor(targetURL) && !isHLS(targetURL) {
+			if resp, err := d.head(ctx, targetURL); err == nil {
+				if final := resp.Request.URL.String(); final != targetURL {
+					sc.FinalURL = final
+				}
+				for _, name := range sidecarHeaders {
+					if v := resp.Header.Get(name); v != "" {
+						if sc.Headers == nil {
+							sc.Headers = map[string]string{}
+						}
+						sc.Headers[name] = v
+					}
+				}
+			}
+		}
+		if err := writeSidecar(res.Path+sidecarSuffix, sc); err != nil {
+			fmt.Fprintf(os.Stderr, "write sidecar of %s: %v\n", res.Path, err)
+		}
+		return res
+	}
+}
+
+func writeSidecar(path string, sc sidecar) error {
+	data, err := json.MarshalIndent(sc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// head sends a HEAD for targetURL and returns the response of its last
+// redirect.
+func (d *httpDownloader) head(ctx context.Context, targetURL string) (*http.Response, error) {
+	req, err := d.newRequest(ctx, http.MethodHead, targetURL)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, replied(resp)
+	}
+	return resp, nil
+}
@@ -0,0 +1,510 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type itemState int
+
+const (
+	stateQueued itemState = iota
+	stateActive
+	statePaused
+	stateDone
+	stateFailed
+	stateCancelled
+)
+
+var stateNames = map[itemState]string{
+	stateQueued:    "queued",
+	stateActive:    "active",
+	statePaused:    "paused",
+	stateDone:      "done",
+	stateFailed:    "failed",
+	stateCancelled: "cancelled",
+}
+
+// tuiItem is one URL of the queue screen.
+type tuiItem struct {
+	url   string
+	state itemState
+	msg   string
+	// cancel stops the item's download while it is active; stopAs is the
+	// state it ends in then (paused or cancelled).
+	cancel context.CancelFunc
+	stopAs itemState
+}
+
+// tuiConfig is what the queue screen downloads with.
+type tuiConfig struct {
+	destDir string
+	workers int
+	// fetch downloads one item, with the history, verification and
+	// organizing of a batch.
+	fetch    fetchFunc
+	progress *progress
+	history  *manifest
+	saved    *savedQueue
+	force    bool
+	// pending are URLs to start with, such as the unfinished ones of an
+	// earlier session.
+	pending []string
+	perHost int
+	rules   urlRules
+}
+
+// tui is the full-screen queue: it downloads while new URLs can be pasted,
+// and lets you pause, cancel, reorder and retry single items.
+type tui struct {
+	cfg   tuiConfig
+	queue *jobQueue
+
+	mu       sync.Mutex
+	items    []*tuiItem
+	selected int
+	input    []rune
+	notice   string
+	rows     int
+	redraw   chan struct{}
+}
+
+const tuiHelp = "Paste URLs + Enter to queue | ↑/↓ select  p pause/resume  x cancel  r retry  K/J move up/down  q quit"
+
+// runTUI shows the queue screen until q or Ctrl-C. Active downloads are
+// stopped then, keeping their .part files and their place in the saved
+// queue for the next run.
+func runTUI(cfg tuiConfig) error {
+	restore, err := makeRaw()
+	if err != nil {
+		return err
+	}
+	defer restore()
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+
+	t := &tui{
+		cfg:    cfg,
+		queue:  newJobQueue(nil, cfg.perHost),
+		rows:   terminalRows(),
+		redraw: make(chan struct{}, 1),
+	}
+	t.queue.open = true
+	t.add(cfg.pending)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := 0; i < max(cfg.workers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t.work(ctx)
+		}()
+	}
+
+	keys := make(chan byte)
+	go func() {
+		r := bufio.NewReader(os.Stdin)
+		for {
+			b, err := r.ReadByte()
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- b
+		}
+	}()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	t.draw()
+loop:
+	for {
+		select {
+		case b, ok := <-keys:
+			if !ok || t.key(b, keys) {
+				break loop
+			}
+		case <-interrupt:
+			break loop
+		case <-ticker.C:
+		case <-t.redraw:
+		}
+		t.draw()
+	}
+
+	t.queue.close()
+	t.mu.Lock()
+	for _, item := range t.items {
+		if item.state == stateActive {
+			item.stopAs = statePaused
+			item.cancel()
+		}
+	}
+	t.mu.Unlock()
+	cancel()
+	wg.Wait()
+	return nil
+}
+
+// work downloads the items the queue hands out.
+func (t *tui) work(ctx context.Context) {
+	for {
+		u, ok := t.queue.next()
+		if !ok {
+			return
+		}
+		t.mu.Lock()
+		item := t.find(u)
+		itemCtx, cancel := context.WithCancel(ctx)
+		item.state, item.msg, item.cancel, item.stopAs = stateActive, "", cancel, stateFailed
+		t.mu.Unlock()
+
+		res := t.cfg.fetch(itemCtx, u, t.cfg.destDir)
+		cancelled := itemCtx.Err() != nil
+		cancel()
+		t.queue.done(u)
+
+		t.mu.Lock()
+		item.cancel = nil
+		switch {
+		case cancelled && item.stopAs != stateFailed:
+			item.state = item.stopAs
+		case res.OK:
+			item.state, item.msg = stateDone, res.Path
+		default:
+			item.state, item.msg = stateFailed, res.Msg
+		}
+		t.mu.Unlock()
+		t.touch()
+	}
+}
+
+// touch asks for a redraw.
+func (t *tui) touch() {
+	select {
+	case t.redraw <- struct{}{}:
+	default:
+	}
+}
+
+// find returns the item of u. t.mu must be held.
+func (t *tui) find(u string) *tuiItem {
+	for _, item := range t.items {
+		if item.url == u {
+			return item
+		}
+	}
+	return nil
+}
+
+// add queues the URLs that are neither on screen nor, without -force, in
+// the download history.
+func (t *tui) add(urls []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var added []string
+	skipped := 0
+	for _, u := range urls {
+		if t.find(u) != nil {
+			continue
+		}
+		if !t.cfg.force && t.cfg.history.has(u) {
+			skipped++
+			continue
+		}
+		t.items = append(t.items, &tuiItem{url: u})
+		t.queue.push(u)
+		added = append(added, u)
+	}
+	if err := t.cfg.saved.add(added, nil); err != nil {
+		t.notice = "update download queue: " + err.Error()
+	}
+	if skipped > 0 {
+		t.notice = fmt.Sprintf("Skipped %d URL(s) downloaded before (-force to download them again).", skipped)
+	}
+}
+
+// key handles one byte of input and reports whether to quit. While the
+// input line is empty, letters are commands; otherwise they are typed.
+func (t *tui) key(b byte, keys <-chan byte) bool {
+	switch b {
+	case 0x1b:
+		// Arrow keys are ESC [ A and ESC [ B.
+		if next, ok := <-keys; !ok || next != '[' {
+			return false
+		}
+		switch <-keys {
+		case 'A':
+			t.moveSelection(-1)
+		case 'B':
+			t.moveSelection(1)
+		}
+		return false
+	case '\r', '\n':
+		t.mu.Lock()
+		line := string(t.input)
+		t.input = nil
+		t.mu.Unlock()
+		if urls := gatherURLs(strings.Fields(line), t.cfg.rules); len(urls) > 0 {
+			t.add(urls)
+		}
+		return false
+	case 0x7f, 0x08:
+		t.mu.Lock()
+		if len(t.input) > 0 {
+			t.input = t.input[:len(t.input)-1]
+		}
+		t.mu.Unlock()
+		return false
+	case 0x15: // Ctrl-U
+		t.mu.Lock()
+		t.input = nil
+		t.mu.Unlock()
+		return false
+	}
+
+	t.mu.Lock()
+	typing := len(t.input) > 0
+	t.mu.Unlock()
+	if !typing {
+		switch b {
+		case 'q':
+			return true
+		case 'k':
+			t.moveSelection(-1)
+			return false
+		case 'j':
+			t.moveSelection(1)
+			return false
+		case 'p':
+			t.togglePause()
+			return false
+		case 'x':
+			t.cancelSelected()
+			return false
+		case 'r':
+			t.retry()
+			return false
+		case 'K':
+			t.reorder(-1)
+			return false
+		case 'J':
+			t.reorder(1)
+			return false
+		}
+	}
+	if b >= 0x20 {
+		t.mu.Lock()
+		t.input = append(t.input, rune(b))
+		t.mu.Unlock()
+	}
+	return false
+}
+
+func (t *tui) moveSelection(delta int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.selected = min(max(t.selected+delta, 0), max(len(t.items)-1, 0))
+}
+
+// current returns the selected item, or nil. t.mu must be held.
+func (t *tui) current() *tuiItem {
+	if t.selected < 0 || t.selected >= len(t.items) {
+		return nil
+	}
+	return t.items[t.selected]
+}
+
+// togglePause stops an active or queued item, keeping its .part file, or
+// queues a paused one again.
+func (t *tui) togglePause() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	item := t.current()
+	if item == nil {
+		return
+	}
+	switch item.state {
+	case stateActive:
+		item.stopAs = statePaused
+		item.cancel()
+	case stateQueued:
+		if t.queue.drop(item.url) {
+			item.state = statePaused
+		}
+	case statePaused:
+		item.state = stateQueued
+		t.queue.push(item.url)
+		t.syncOrder()
+	}
+}
+
+// cancelSelected stops an item for good and takes it off the saved queue.
+func (t *tui) cancelSelected() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	item := t.current()
+	if item == nil {
+		return
+	}
+	switch item.state {
+	case stateActive:
+		item.stopAs = stateCancelled
+		item.cancel()
+	case stateQueued, statePaused:
+		t.queue.drop(item.url)
+		item.state = stateCancelled
+	default:
+		return
+	}
+	if err := t.cfg.saved.remove(item.url); err != nil {
+		t.notice = "update download queue: " + err.Error()
+	}
+}
+
+// retry queues a failed or cancelled item again.
+func (t *tui) retry() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	item := t.current()
+	if item == nil || (item.state != stateFailed && item.state != stateCancelled) {
+		return
+	}
+	item.state, item.msg = stateQueued, ""
+	t.queue.push(item.url)
+	t.syncOrder()
+	if err := t.cfg.saved.add([]string{item.url}, nil); err != nil {
+		t.notice = "update download queue: " + err.Error()
+	}
+}
+
+// reorder moves the selected queued item up or down among the queued
+// ones, on screen and in the order they are downloaded.
+func (t *tui) reorder(delta int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	item := t.current()
+	if item == nil || item.state != stateQueued {
+		return
+	}
+	j := t.selected
+	for {
+		j += delta
+		if j < 0 || j >= len(t.items) {
+			return
+		}
+		if t.items[j].state == stateQueued {
+			break
+		}
+	}
+	t.items[t.selected], t.items[j] = t.items[j], t.items[t.selected]
+	t.selected = j
+	t.syncOrder()
+}
+
+// syncOrder makes the queue hand out the queued items in their order on
+// screen. t.mu must be held.
+func (t *tui) syncOrder() {
+	var order []string
+	for _, item := range t.items {
+		if item.state == stateQueued {
+			order = append(order, item.url)
+		}
+	}
+	t.queue.reorder(order)
+}
+
+// draw repaints the whole screen.
+func (t *tui) draw() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	counts := map[itemState]int{}
+	for _, item := range t.items {
+		counts[item.state]++
+	}
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	fmt.Fprintf(&b, "url-downloader: %s | %d active, %d queued, %d paused, %d done, %d failed\r\n\r\n",
+		t.cfg.destDir, counts[stateActive], counts[stateQueued], counts[statePaused], counts[stateDone], counts[stateFailed])
+
+	// Keep the selection in view in the rows left by the header, the help
+	// and the input line.
+	height := max(t.rows-6, 3)
+	first := 0
+	if t.selected >= height {
+		first = t.selected - height + 1
+	}
+	for i := first; i < len(t.items) && i < first+height; i++ {
+		item := t.items[i]
+		cursor := "  "
+		if i == t.selected {
+			cursor = "> "
+		}
+		detail := item.msg
+		if item.state == stateActive {
+			detail = t.cfg.progress.stats(item.url)
+		}
+		fmt.Fprintf(&b, "%s[%-9s] %s  %s\r\n", cursor, stateNames[item.state], item.url, detail)
+	}
+	if len(t.items) == 0 {
+		b.WriteString("  (nothing queued)\r\n")
+	}
+	b.WriteString("\r\n")
+	if t.notice != "" {
+		b.WriteString(t.notice + "\r\n")
+	}
+	b.WriteString(tuiHelp + "\r\n")
+	b.WriteString("> " + string(t.input))
+	fmt.Print(b.String())
+}
+
+// makeRaw switches the terminal to unbuffered input without echo. It uses
+// stty to avoid extra dependencies; Ctrl-C still sends SIGINT.
+func makeRaw() (restore func(), err error) {
+	get := exec.Command("stty", "-g")
+	get.Stdin = os.Stdin
+	out, err := get.Output()
+	if err != nil {
+		return nil, fmt.Errorf("stty -g: %w", err)
+	}
+	prev := strings.TrimSpace(string(out))
+	raw := exec.Command("stty", "-echo", "-icanon", "min", "1", "time", "0")
+	raw.Stdin = os.Stdin
+	if err := raw.Run(); err != nil {
+		return nil, fmt.Errorf("stty -echo -icanon: %w", err)
+	}
+	return func() {
+		cmd := exec.Command("stty", prev)
+		cmd.Stdin = os.Stdin
+		cmd.Run()
+	}, nil
+}
+
+// terminalRows asks stty for the height of the terminal, 24 if it cannot
+// tell.
+func terminalRows() int {
+	cmd := exec.Command("stty", "size")
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	if err != nil {
+		return 24
+	}
+	rows, _, _ := strings.Cut(strings.TrimSpace(string(out)), " ")
+	if n, err := strconv.Atoi(rows); err == nil && n > 0 {
+		return n
+	}
+	return 24
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// sha256Token finds an expected checksum after a URL, as in
+// "https://example.com/a.mp4<TAB>9f86d0...".
+var sha256Token = regexp.MustCompile(`(?i)(?:^|\s)([0-9a-f]{64})(?:\s|$)`)
+
+// expectedChecksums returns the SHA-256 given on each line of raw, by the
+// URL of the line as rules clean it.
+func expectedChecksums(raw []string, rules urlRules) map[string]string {
+	sums := map[string]string{}
+	for _, line := range raw {
+		u, ok := rules.clean(line)
+		if !ok {
+			continue
+		}
+		rest := strings.Replace(line, urlToken.FindString(line), "", 1)
+		if m := sha256Token.FindStringSubmatch(rest); m != nil {
+			sums[u] = strings.ToLower(m[1])
+		}
+	}
+	return sums
+}
+
+// mp4Extensions are the files checked for a complete ISO media box
+// structure after download.
+var mp4Extensions = map[string]bool{".mp4": true, ".m4v": true, ".mov": true, ".m4a": true}
+
+// checkMP4 walks the top-level boxes of an MP4 file and reports a file
+// that is cut short, is not MP4 at all (an HTML error page, say) or has no
+// moov box, without which nothing can play it.
+func checkMP4(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	var offset int64
+	moov := false
+	header := make([]byte, 16)
+	for offset < size {
+		if size-offset < 8 {
+			return fmt.Errorf("truncated: %d stray bytes at the end", size-offset)
+		}
+		if _, err := f.ReadAt(header[:8], offset); err != nil {
+			return err
+		}
+		boxSize := int64(binary.BigEndian.Uint32(header[:4]))
+		boxType := string(header[4:8])
+		if offset == 0 && !validBoxType(boxType) {
+			return errors.New("not an MP4 file")
+		}
+		switch boxSize {
+		case 0:
+			// The last box runs to the end of the file.
+			boxSize = size - offset
+		case 1:
+			if _, err := f.ReadAt(header[8:16], offset+8); err != nil {
+				if err == io.EOF {
+					return errors.New("truncated box header")
+				}
+				return err
+			}
+			boxSize = int64(binary.BigEndian.Uint64(header[8:16]))
+		}
+		if boxSize < 8 {
+			return fmt.Errorf("broken %q box at byte %d", boxType, offset)
+		}
+		if offset+boxSize > size {
+			return fmt.Errorf("truncated: %q box needs %d more bytes", boxType, offset+boxSize-size)
+		}
+		if boxType == "moov" {
+			moov = true
+		}
+		offset += boxSize
+	}
+	if !moov {
+		return errors.New("no moov box")
+	}
+	return nil
+}
+
+func validBoxType(t string) bool {
+	for _, c := range []byte(t) {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	switch t {
+	case "ftyp", "moov", "mdat", "free", "skip", "wide", "styp", "pnot":
+		return true
+	}
+	return false
+}
+
+// verify checks a finished download: its SHA-256 against expected (""
+// to skip) and, for MP4 files, its box structure. It returns the file's
+// checksum.
+func verify(path, expected string) (string, error) {
+	_, sum, err := hashFile(path)
+	if err != nil {
+		return "", err
+	}
+	if expected != "" && sum != expected {
+		return sum, fmt.Errorf("checksum mismatch: got sha256 %s, want %s", sum, expected)
+	}
+	if mp4Extensions[strings.ToLower(filepath.Ext(path))] {
+		if err := checkMP4(path); err != nil {
+			return sum, err
+		}
+	}
+	return sum, nil
+}
+
+// verifyFetch checks every file fetch downloads, marking the ones that fail
+// as corrupt. With redownload a corrupt file is deleted and fetched once
+// more.
+func verifyFetch(checksums map[string]string, redownload bool, fetch fetchFunc) fetchFunc {
+	return func(ctx context.Context, targetURL, destDir string) downloadResult {
+		for attempt := 0; ; attempt++ {
+			res := fetch(ctx, targetURL, destDir)
+			if !res.OK || res.Path == "" {
+				return res
+			}
+			sum, err := verify(res.Path, checksums[targetURL])
+			if err == nil {
+				res.SHA256 = sum
+				return res
+			}
+			if redownload && attempt == 0 {
+				os.Remove(res.Path)
+				continue
+			}
+			return downloadResult{URL: targetURL, OK: false, Corrupt: true, Msg: err.Error(), Path: res.Path}
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// mediaExtensions are the file extensions of links that are downloaded
+// directly, whatever site they are on.
+var mediaExtensions = map[string]bool{
+	".mp4": true, ".m4v": true, ".mov": true, ".webm": true, ".mkv": true,
+	".mp3": true, ".m4a": true, ".gif": true, ".jpg": true, ".png": true,
+}
+
+// pageHosts are the sites whose links are pages that only yt-dlp can turn
+// into a video, keyed by domain (subdomains match too).
+var pageHosts = map[string]bool{
+	"youtube.com": true, "youtu.be": true,
+	"twitter.com": true, "x.com": true,
+	"reddit.com": true, "redd.it": true,
+	"instagram.com": true, "tiktok.com": true, "vimeo.com": true,
+}
+
+// needsExtractor reports whether targetURL is a page rather than a media
+// file, so it has to go through yt-dlp. Direct links such as
+// video.twimg.com ones keep the fast path.
+func needsExtractor(targetURL string) bool {
+	parsed, err := url.Parse(targetURL)
+	if err != nil {
+		return false
+	}
+	if mediaExtensions[strings.ToLower(path.Ext(parsed.Path))] {
+		return false
+	}
+	host := strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+	for {
+		if pageHosts[host] {
+			return true
+		}
+		_, parent, ok := strings.Cut(host, ".")
+		if !ok {
+			return false
+		}
+		host = parent
+	}
+}
+
+// ytdlpFetch downloads with yt-dlp, picking formats with format (a yt-dlp
+// -f expression, "" for its default) at no more than rate ("" for no
+// limit), with the credentials auth has for the page, streaming its
+// debug output to verbose.
+func ytdlpFetch(command, format, rate string, auth authProfiles, verbose *verboseLog) fetchFunc {
+	return func(ctx context.Context, targetURL, destDir string) downloadResult {
+		args := []string{
+			"--no-playlist",
+			"-P", destDir,
+			"-o", "%(title).150B [%(id)s].%(ext)s",
+			"--merge-output-format", "mp4",
+			"--print", "after_move:filepath",
+		}
+		if format != "" {
+			args = append(args, "-f", format)
+		}
+		if rate != "" {
+			args = append(args, "--limit-rate", rate)
+		}
+		if prof := auth.forURL(targetURL); prof != nil && prof.Cookies != "" {
+			args = append(args, "--cookies", prof.Cookies)
+		}
+		if a := auth.header(targetURL).Get("Authorization"); a != "" {
+			args = append(args, "--add-header", "Authorization:"+a)
+		}
+		if verbose != nil {
+			args = append(args, "--verbose")
+		}
+		args = append(args, "--", targetURL)
+		cmd := exec.CommandContext(ctx, command, args...)
+		var stderr strings.Builder
+		cmd.Stderr = verbose.tee(&stderr, "["+targetURL+"] ")
+		output, err := cmd.Output()
+		if err == nil {
+			// --print writes the path of every file it kept; the last
+			// one is the merged video.
+			lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+			return downloadResult{URL: targetURL, OK: true, Msg: "ok", Path: strings.TrimSpace(lines[len(lines)-1])}
+		}
+
+		if isNotFound(err) {
+			return downloadResult{URL: targetURL, OK: false, Msg: command + " not found; install yt-dlp to download page links", Kind: kindMissingTool}
+		}
+
+		msg := lastError(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return downloadResult{URL: targetURL, OK: false, Msg: msg, Kind: textKind(msg)}
+	}
+}
+
+// routeFetch sends the URLs match picks to matched and the rest to other.
+func routeFetch(match func(string) bool, matched, other fetchFunc) fetchFunc {
+	return func(ctx context.Context, targetURL, destDir string) downloadResult {
+		if match(targetURL) {
+			return matched(ctx, targetURL, destDir)
+		}
+		return other(ctx, targetURL, destDir)
+	}
+}